@@ -0,0 +1,327 @@
+package mediadevices
+
+import (
+	"errors"
+	"image"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/rtcp"
+)
+
+const (
+	defaultBitRateAdaptationMinBitRate        = 100_000
+	defaultBitRateAdaptationSmoothing         = 0.3
+	defaultBitRateAdaptationEstimatorInterval = time.Second
+	// bitRateAdaptationThreshold is the minimum relative change of the smoothed estimate to
+	// reconfigure the encoder. Encoders usually don't like to be reconfigured too often.
+	bitRateAdaptationThreshold = 0.05
+	// Loss based control constants from https://datatracker.ietf.org/doc/html/draft-ietf-rmcat-gcc-02#section-6
+	bitRateAdaptationLowLoss      = 0.02
+	bitRateAdaptationHighLoss     = 0.1
+	bitRateAdaptationIncreaseRate = 1.05
+	// bitRateFallbackMinRatio is the lowest quality ratio the fallback will degrade to.
+	bitRateFallbackMinRatio = 1.0 / 16
+)
+
+var errBitRateFallbackNeedsMaxBitRate = errors.New("bitrate fallback requires MaxBitRate to be set")
+
+// BitRateFallback defines how a video track degrades when its encoder can't change the bitrate.
+type BitRateFallback int
+
+// BitRateFallback definitions.
+const (
+	// BitRateFallbackNone leaves the encoder untouched.
+	BitRateFallbackNone BitRateFallback = iota
+	// BitRateFallbackFrameRate drops frames proportionally to the estimated bandwidth.
+	BitRateFallbackFrameRate
+	// BitRateFallbackResolution scales frames down proportionally to the estimated bandwidth. It's only
+	// applied to the encoders that support input resolution changes, which are codec.InputPropController.
+	BitRateFallbackResolution
+)
+
+// BandwidthEstimator is an external source of bandwidth estimates. cc.BandwidthEstimator from
+// github.com/pion/interceptor/pkg/cc satisfies this interface.
+type BandwidthEstimator interface {
+	// GetTargetBitrate returns the current target bitrate in bps.
+	GetTargetBitrate() int
+}
+
+// BitRateAdaptation configures how a track adapts its encoder to the bandwidth estimated by the remote
+// peer. When Estimator is nil, the estimate is derived from REMB and transport-wide-cc feedback.
+type BitRateAdaptation struct {
+	// MinBitRate is the lowest bitrate in bps that will be given to the encoder. The default value is 100 kbps.
+	MinBitRate int
+	// MaxBitRate is the highest bitrate in bps that will be given to the encoder. The default value, 0,
+	// doesn't limit the bitrate. When Fallback is used, MaxBitRate is treated as the full quality bitrate.
+	MaxBitRate int
+	// Smoothing is the weight, in (0, 1], of a new estimate in the exponential moving average of the
+	// estimates. The default value is 0.3.
+	Smoothing float64
+	// Estimator overrides the RTCP feedback based estimation when it's not nil.
+	Estimator BandwidthEstimator
+	// EstimatorInterval configures how often Estimator is polled. The default value is 1 second.
+	EstimatorInterval time.Duration
+	// Fallback configures the degradation of video tracks whose encoder isn't a BitRateController.
+	Fallback BitRateFallback
+}
+
+// SetBitRateAdaptation enables bandwidth adaptation for the encoders that are created by the following
+// Bind calls. Passing nil disables it.
+func (track *baseTrack) SetBitRateAdaptation(config *BitRateAdaptation) error {
+	if config != nil {
+		if config.Fallback != BitRateFallbackNone && config.MaxBitRate <= 0 {
+			return errBitRateFallbackNeedsMaxBitRate
+		}
+
+		c := *config
+		if c.MinBitRate <= 0 {
+			c.MinBitRate = defaultBitRateAdaptationMinBitRate
+		}
+		if c.Smoothing <= 0 || c.Smoothing > 1 {
+			c.Smoothing = defaultBitRateAdaptationSmoothing
+		}
+		if c.EstimatorInterval <= 0 {
+			c.EstimatorInterval = defaultBitRateAdaptationEstimatorInterval
+		}
+		config = &c
+	}
+
+	track.bitRateMu.Lock()
+	defer track.bitRateMu.Unlock()
+	track.bitRateAdaptation = config
+	return nil
+}
+
+func (track *baseTrack) bitRateAdaptationConfig() *BitRateAdaptation {
+	track.bitRateMu.Lock()
+	defer track.bitRateMu.Unlock()
+	return track.bitRateAdaptation
+}
+
+// bitRateAdapter smooths bandwidth estimates of a single RTP stream and applies them to its encoder.
+type bitRateAdapter struct {
+	config     BitRateAdaptation
+	ssrc       uint32
+	controller codec.BitRateController
+
+	mu       sync.Mutex
+	smoothed float64
+	applied  int
+}
+
+func newBitRateAdapter(config BitRateAdaptation, ssrc uint32, controller codec.BitRateController) *bitRateAdapter {
+	return &bitRateAdapter{
+		config:     config,
+		ssrc:       ssrc,
+		controller: controller,
+	}
+}
+
+// handleRTCP updates the estimate from REMB and transport-wide-cc feedback. Feedback is ignored
+// when an external estimator is configured.
+func (a *bitRateAdapter) handleRTCP(pkt rtcp.Packet) {
+	if a.config.Estimator != nil {
+		return
+	}
+
+	switch p := pkt.(type) {
+	case *rtcp.ReceiverEstimatedMaximumBitrate:
+		if len(p.SSRCs) != 0 && !slices.Contains(p.SSRCs, a.ssrc) {
+			return
+		}
+		a.update(float64(p.Bitrate))
+	case *rtcp.TransportLayerCC:
+		received, lost := countTransportLayerCCStatus(p)
+		if received+lost == 0 {
+			return
+		}
+		a.updateWithLoss(float64(lost) / float64(received+lost))
+	}
+}
+
+// run polls the external estimator until stop is closed.
+func (a *bitRateAdapter) run(stop <-chan struct{}) {
+	if a.config.Estimator == nil {
+		return
+	}
+
+	ticker := time.NewTicker(a.config.EstimatorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if estimate := a.config.Estimator.GetTargetBitrate(); estimate > 0 {
+				a.update(float64(estimate))
+			}
+		}
+	}
+}
+
+// updateWithLoss implements the loss based controller of Google Congestion Control.
+func (a *bitRateAdapter) updateWithLoss(loss float64) {
+	a.mu.Lock()
+	current := a.smoothed
+	a.mu.Unlock()
+
+	if current == 0 {
+		if a.config.MaxBitRate <= 0 {
+			// There's no reference to start from, wait for a REMB
+			return
+		}
+		current = float64(a.config.MaxBitRate)
+	}
+
+	switch {
+	case loss > bitRateAdaptationHighLoss:
+		a.update(current * (1 - 0.5*loss))
+	case loss < bitRateAdaptationLowLoss:
+		a.update(current * bitRateAdaptationIncreaseRate)
+	}
+}
+
+func (a *bitRateAdapter) update(estimate float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.smoothed == 0 {
+		a.smoothed = estimate
+	} else {
+		a.smoothed += a.config.Smoothing * (estimate - a.smoothed)
+	}
+
+	target := max(a.smoothed, float64(a.config.MinBitRate))
+	if a.config.MaxBitRate > 0 {
+		target = min(target, float64(a.config.MaxBitRate))
+	}
+	a.smoothed = target
+
+	if a.applied != 0 && math.Abs(target-float64(a.applied))/float64(a.applied) < bitRateAdaptationThreshold {
+		return
+	}
+
+	if err := a.controller.SetBitRate(int(target)); err != nil {
+		logger.Warnf("failed to set bitrate: %s", err)
+		return
+	}
+	a.applied = int(target)
+}
+
+// countTransportLayerCCStatus counts the received and lost packets reported in p.
+func countTransportLayerCCStatus(p *rtcp.TransportLayerCC) (received, lost int) {
+	remaining := int(p.PacketStatusCount)
+	count := func(symbol uint16, n int) {
+		n = min(n, remaining)
+		remaining -= n
+		if symbol == rtcp.TypeTCCPacketNotReceived {
+			lost += n
+		} else {
+			received += n
+		}
+	}
+
+	for _, chunk := range p.PacketChunks {
+		switch c := chunk.(type) {
+		case *rtcp.RunLengthChunk:
+			count(c.PacketStatusSymbol, int(c.RunLength))
+		case *rtcp.StatusVectorChunk:
+			for _, symbol := range c.SymbolList {
+				count(symbol, 1)
+			}
+		}
+	}
+	return received, lost
+}
+
+// bitRateFallback degrades the encoder input to follow the bitrate, for encoders that can't change it.
+type bitRateFallback struct {
+	mode       BitRateFallback
+	maxBitRate int
+	// resizable tells whether the encoder can encode frames of another size
+	resizable func() bool
+
+	mu    sync.Mutex
+	ratio float64
+}
+
+func newBitRateFallback(config *BitRateAdaptation, resizable func() bool) *bitRateFallback {
+	return &bitRateFallback{
+		mode:       config.Fallback,
+		maxBitRate: config.MaxBitRate,
+		resizable:  resizable,
+		ratio:      1,
+	}
+}
+
+// SetBitRate implements codec.BitRateController.
+func (f *bitRateFallback) SetBitRate(bitRate int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ratio = min(max(float64(bitRate)/float64(f.maxBitRate), bitRateFallbackMinRatio), 1)
+	return nil
+}
+
+func (f *bitRateFallback) qualityRatio() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ratio
+}
+
+func (f *bitRateFallback) transform(r video.Reader) video.Reader {
+	switch f.mode {
+	case BitRateFallbackFrameRate:
+		var credit float64
+		return video.ReaderFunc(func() (image.Image, func(), error) {
+			for {
+				img, release, err := r.Read()
+				if err != nil {
+					return nil, func() {}, err
+				}
+
+				credit += f.qualityRatio()
+				if credit >= 1 {
+					credit--
+					return img, release, nil
+				}
+				// The dropped frames go back to their pool
+				if release != nil {
+					release()
+				}
+			}
+		})
+	case BitRateFallbackResolution:
+		return scaleResolutionDownBy(func() float64 {
+			if !f.resizable() {
+				return 1
+			}
+			// Bitrate is roughly proportional to the number of pixels. Quantize the factor
+			// to avoid rebuilding the scaler on every small change.
+			return math.Ceil(4/math.Sqrt(f.qualityRatio())) / 4
+		})(r)
+	default:
+		return r
+	}
+}
+
+// controller attaches the fallback to the encoder controller if the encoder can't change its bitrate.
+func (f *bitRateFallback) controller(encoderController codec.EncoderController) codec.EncoderController {
+	if _, ok := encoderController.(codec.BitRateController); ok {
+		return encoderController
+	}
+
+	if keyFrameController, ok := encoderController.(codec.KeyFrameController); ok {
+		return &struct {
+			codec.KeyFrameController
+			codec.BitRateController
+		}{keyFrameController, f}
+	}
+
+	return f
+}
@@ -0,0 +1,249 @@
+package mediadevices
+
+import (
+	"errors"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/rtcp"
+)
+
+type fakeBitRateController struct {
+	called chan int
+}
+
+func (mock *fakeBitRateController) SetBitRate(bitRate int) error {
+	mock.called <- bitRate
+	return nil
+}
+
+type fakeBandwidthEstimator struct {
+	bitRate int
+}
+
+func (mock *fakeBandwidthEstimator) GetTargetBitrate() int {
+	return mock.bitRate
+}
+
+func marshalRTCP(t *testing.T, pkt rtcp.Packet) []byte {
+	b, err := pkt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func expectBitRate(t *testing.T, called chan int, expected int) {
+	t.Helper()
+	select {
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout waiting for bitrate %d", expected)
+	case bitRate := <-called:
+		if bitRate != expected {
+			t.Errorf("Expected bitrate %d, got %d", expected, bitRate)
+		}
+	}
+}
+
+func TestBitRateAdaptation(t *testing.T) {
+	const ssrc = 0x4bc4fcb4
+
+	t.Run("REMB", func(t *testing.T) {
+		tr := &baseTrack{}
+		stop := make(chan struct{}, 1)
+		defer func() {
+			stop <- struct{}{}
+		}()
+		controller := &fakeBitRateController{called: make(chan int, 4)}
+		adapter := newBitRateAdapter(BitRateAdaptation{
+			MinBitRate: 200_000,
+			MaxBitRate: 2_000_000,
+			Smoothing:  0.5,
+		}, ssrc, controller)
+		mockRTCPReader := &fakeRTCPReader{end: stop, mockReturn: make(chan []byte, 4)}
+
+		go tr.rtcpReadLoop(mockRTCPReader, nil, adapter, ssrc, stop)
+
+		// The first estimate is taken as is
+		mockRTCPReader.mockReturn <- marshalRTCP(t, &rtcp.ReceiverEstimatedMaximumBitrate{
+			Bitrate: 1_000_000, SSRCs: []uint32{ssrc},
+		})
+		expectBitRate(t, controller.called, 1_000_000)
+
+		// Estimates for other streams are ignored, and the following ones are smoothed
+		mockRTCPReader.mockReturn <- marshalRTCP(t, &rtcp.ReceiverEstimatedMaximumBitrate{
+			Bitrate: 100_000, SSRCs: []uint32{0x12345678},
+		})
+		mockRTCPReader.mockReturn <- marshalRTCP(t, &rtcp.ReceiverEstimatedMaximumBitrate{
+			Bitrate: 500_000, SSRCs: []uint32{ssrc},
+		})
+		expectBitRate(t, controller.called, 750_000)
+
+		// Estimates are clamped
+		mockRTCPReader.mockReturn <- marshalRTCP(t, &rtcp.ReceiverEstimatedMaximumBitrate{
+			Bitrate: 10_000_000, SSRCs: []uint32{ssrc},
+		})
+		expectBitRate(t, controller.called, 2_000_000)
+	})
+
+	t.Run("TWCC", func(t *testing.T) {
+		controller := &fakeBitRateController{called: make(chan int, 2)}
+		adapter := newBitRateAdapter(BitRateAdaptation{
+			MinBitRate: 100_000,
+			MaxBitRate: 1_000_000,
+			Smoothing:  0.5,
+		}, ssrc, controller)
+
+		// 10 received, 10 lost -> 50% loss
+		adapter.handleRTCP(&rtcp.TransportLayerCC{
+			MediaSSRC:         ssrc,
+			PacketStatusCount: 20,
+			PacketChunks: []rtcp.PacketStatusChunk{
+				&rtcp.RunLengthChunk{PacketStatusSymbol: rtcp.TypeTCCPacketReceivedSmallDelta, RunLength: 10},
+				&rtcp.RunLengthChunk{PacketStatusSymbol: rtcp.TypeTCCPacketNotReceived, RunLength: 10},
+			},
+		})
+		expectBitRate(t, controller.called, 750_000)
+
+		// No loss, but the increase is too small to be applied
+		adapter.handleRTCP(&rtcp.TransportLayerCC{
+			MediaSSRC:         ssrc,
+			PacketStatusCount: 7,
+			PacketChunks: []rtcp.PacketStatusChunk{
+				&rtcp.StatusVectorChunk{
+					SymbolSize: rtcp.TypeTCCSymbolSizeTwoBit,
+					SymbolList: []uint16{1, 1, 1, 1, 1, 1, 1},
+				},
+			},
+		})
+		select {
+		case bitRate := <-controller.called:
+			t.Errorf("Unexpected bitrate change to %d", bitRate)
+		default:
+		}
+	})
+
+	t.Run("Estimator", func(t *testing.T) {
+		controller := &fakeBitRateController{called: make(chan int, 1)}
+		adapter := newBitRateAdapter(BitRateAdaptation{
+			MinBitRate:        100_000,
+			Smoothing:         1,
+			Estimator:         &fakeBandwidthEstimator{bitRate: 300_000},
+			EstimatorInterval: time.Millisecond,
+		}, ssrc, controller)
+
+		// RTCP feedback must be ignored when an estimator is given
+		adapter.handleRTCP(&rtcp.ReceiverEstimatedMaximumBitrate{Bitrate: 1_000_000})
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go adapter.run(stop)
+		expectBitRate(t, controller.called, 300_000)
+	})
+
+	t.Run("InvalidFallback", func(t *testing.T) {
+		tr := &baseTrack{}
+		err := tr.SetBitRateAdaptation(&BitRateAdaptation{Fallback: BitRateFallbackFrameRate})
+		if !errors.Is(err, errBitRateFallbackNeedsMaxBitRate) {
+			t.Errorf("Expected error: %v, got: %v", errBitRateFallbackNeedsMaxBitRate, err)
+		}
+	})
+}
+
+func TestBitRateFallback(t *testing.T) {
+	source := video.ReaderFunc(func() (image.Image, func(), error) {
+		return image.NewYCbCr(image.Rect(0, 0, 640, 480), image.YCbCrSubsampleRatio420), func() {}, nil
+	})
+	resizable := func() bool { return true }
+
+	t.Run("FrameRate", func(t *testing.T) {
+		var frames, released int
+		counted := video.ReaderFunc(func() (image.Image, func(), error) {
+			frames++
+			img, _, err := source.Read()
+			return img, func() { released++ }, err
+		})
+
+		fallback := newBitRateFallback(&BitRateAdaptation{Fallback: BitRateFallbackFrameRate, MaxBitRate: 1_000_000}, resizable)
+		reader := fallback.transform(counted)
+		if err := fallback.SetBitRate(250_000); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 10; i++ {
+			_, release, err := reader.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			release()
+		}
+		if frames != 40 {
+			t.Errorf("Expected to read 40 frames to output 10 frames, read %d", frames)
+		}
+		if released != frames {
+			t.Errorf("Expected the %d frames to be released, %d were", frames, released)
+		}
+	})
+
+	t.Run("Resolution", func(t *testing.T) {
+		fallback := newBitRateFallback(&BitRateAdaptation{Fallback: BitRateFallbackResolution, MaxBitRate: 1_000_000}, resizable)
+		reader := fallback.transform(source)
+
+		img, _, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != 640 || img.Bounds().Dy() != 480 {
+			t.Errorf("Expected full resolution, got %v", img.Bounds())
+		}
+
+		if err := fallback.SetBitRate(250_000); err != nil {
+			t.Fatal(err)
+		}
+		img, _, err = reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != 320 || img.Bounds().Dy() != 240 {
+			t.Errorf("Expected half resolution, got %v", img.Bounds())
+		}
+	})
+
+	t.Run("ResolutionFixedSize", func(t *testing.T) {
+		fallback := newBitRateFallback(&BitRateAdaptation{Fallback: BitRateFallbackResolution, MaxBitRate: 1_000_000}, func() bool { return false })
+		reader := fallback.transform(source)
+
+		// The encoder would read past the frames if they were smaller than the ones that it's built with
+		if err := fallback.SetBitRate(250_000); err != nil {
+			t.Fatal(err)
+		}
+		img, _, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != 640 || img.Bounds().Dy() != 480 {
+			t.Errorf("Expected full resolution, got %v", img.Bounds())
+		}
+	})
+
+	t.Run("Controller", func(t *testing.T) {
+		fallback := newBitRateFallback(&BitRateAdaptation{Fallback: BitRateFallbackFrameRate, MaxBitRate: 1_000_000}, resizable)
+
+		keyFrameController := &fakeKeyFrameController{called: make(chan struct{}, 1)}
+		controller := fallback.controller(keyFrameController)
+		if _, ok := controller.(codec.BitRateController); !ok {
+			t.Error("Expected fallback to provide a BitRateController")
+		}
+		if _, ok := controller.(codec.KeyFrameController); !ok {
+			t.Error("Expected fallback to keep the KeyFrameController")
+		}
+
+		bitRateController := &fakeBitRateController{}
+		if controller := fallback.controller(bitRateController); controller != bitRateController {
+			t.Error("Expected fallback to be unused when the encoder has a BitRateController")
+		}
+	})
+}
@@ -3,6 +3,7 @@ package mediadevices
 import (
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/pion/mediadevices/pkg/codec"
@@ -12,11 +13,15 @@ import (
 	"github.com/pion/webrtc/v4"
 )
 
+var errDecoderNotFound = errors.New("failed to find a decoder for the given codec")
+
 // CodecSelector is a container of video and audio encoder builders, which later will be used
-// for codec matching.
+// for codec matching. It also holds decoder builders, which can be looked up by MIME type.
 type CodecSelector struct {
 	videoEncoders []codec.VideoEncoderBuilder
 	audioEncoders []codec.AudioEncoderBuilder
+	videoDecoders []codec.VideoDecoderBuilder
+	audioDecoders []codec.AudioDecoderBuilder
 }
 
 // CodecSelectorOption is a type for specifying CodecSelector options
@@ -36,6 +41,20 @@ func WithAudioEncoders(encoders ...codec.AudioEncoderBuilder) CodecSelectorOptio
 	}
 }
 
+// WithVideoDecoders replace current video decoders with listed decoders
+func WithVideoDecoders(decoders ...codec.VideoDecoderBuilder) CodecSelectorOption {
+	return func(t *CodecSelector) {
+		t.videoDecoders = decoders
+	}
+}
+
+// WithAudioDecoders replace current audio decoders with listed decoders
+func WithAudioDecoders(decoders ...codec.AudioDecoderBuilder) CodecSelectorOption {
+	return func(t *CodecSelector) {
+		t.audioDecoders = decoders
+	}
+}
+
 // NewCodecSelector constructs CodecSelector with given variadic options
 func NewCodecSelector(opts ...CodecSelectorOption) *CodecSelector {
 	var track CodecSelector
@@ -59,9 +78,9 @@ func (selector *CodecSelector) Populate(setting *webrtc.MediaEngine) {
 }
 
 // selectVideoCodecByNames selects a single codec that can be built and matched. codecNames can be formatted as "video/<codecName>" or "<codecName>"
-func (selector *CodecSelector) selectVideoCodecByNames(reader video.Reader, inputProp prop.Media, codecNames ...string) (codec.ReadCloser, *codec.RTPCodec, error) {
+func (selector *CodecSelector) selectVideoCodecByNames(reader video.Reader, inputProp prop.Media, codecNames ...string) (codec.TimestampedReadCloser, *codec.RTPCodec, error) {
 	var selectedEncoder codec.VideoEncoderBuilder
-	var encodedReader codec.ReadCloser
+	var encodedReader codec.TimestampedReadCloser
 	var errReasons []string
 	var err error
 
@@ -71,7 +90,7 @@ outer:
 		for _, encoder := range selector.videoEncoders {
 			// MimeType is formated as "video/<codecName>"
 			if strings.HasSuffix(strings.ToLower(encoder.RTPCodec().MimeType), wantCodecLower) {
-				encodedReader, err = encoder.BuildVideoEncoder(reader, inputProp)
+				encodedReader, err = codec.BuildTimestampedVideoEncoder(encoder, reader, inputProp)
 				if err == nil {
 					selectedEncoder = encoder
 					break outer
@@ -89,7 +108,7 @@ outer:
 	return encodedReader, selectedEncoder.RTPCodec(), nil
 }
 
-func (selector *CodecSelector) selectVideoCodec(reader video.Reader, inputProp prop.Media, codecs ...webrtc.RTPCodecParameters) (codec.ReadCloser, *codec.RTPCodec, error) {
+func (selector *CodecSelector) selectVideoCodec(reader video.Reader, inputProp prop.Media, codecs ...webrtc.RTPCodecParameters) (codec.TimestampedReadCloser, *codec.RTPCodec, error) {
 	var codecNames []string
 
 	for _, codec := range codecs {
@@ -100,9 +119,9 @@ func (selector *CodecSelector) selectVideoCodec(reader video.Reader, inputProp p
 }
 
 // selectAudioCodecByNames selects a single codec that can be built and matched. codecNames can be formatted as "audio/<codecName>" or "<codecName>"
-func (selector *CodecSelector) selectAudioCodecByNames(reader audio.Reader, inputProp prop.Media, codecNames ...string) (codec.ReadCloser, *codec.RTPCodec, error) {
+func (selector *CodecSelector) selectAudioCodecByNames(reader audio.Reader, inputProp prop.Media, codecNames ...string) (codec.TimestampedReadCloser, *codec.RTPCodec, error) {
 	var selectedEncoder codec.AudioEncoderBuilder
-	var encodedReader codec.ReadCloser
+	var encodedReader codec.TimestampedReadCloser
 	var errReasons []string
 	var err error
 
@@ -112,7 +131,13 @@ outer:
 		for _, encoder := range selector.audioEncoders {
 			// MimeType is formated as "audio/<codecName>"
 			if strings.HasSuffix(strings.ToLower(encoder.RTPCodec().MimeType), wantCodecLower) {
-				encodedReader, err = encoder.BuildAudioEncoder(reader, inputProp)
+				encoderReader, encoderProp := reader, inputProp
+				// Convert the audio to the sampling rate of the codec, e.g. from a 44.1 kHz microphone to 48 kHz for Opus
+				if rate := int(encoder.RTPCodec().ClockRate); inputProp.SampleRate != 0 && inputProp.SampleRate != rate {
+					encoderReader = audio.Merge(audio.NewResampler(rate, audio.ResampleQualityHigh))(reader)
+					encoderProp.SampleRate = rate
+				}
+				encodedReader, err = codec.BuildTimestampedAudioEncoder(encoder, encoderReader, encoderProp)
 				if err == nil {
 					selectedEncoder = encoder
 					break outer
@@ -130,7 +155,7 @@ outer:
 	return encodedReader, selectedEncoder.RTPCodec(), nil
 }
 
-func (selector *CodecSelector) selectAudioCodec(reader audio.Reader, inputProp prop.Media, codecs ...webrtc.RTPCodecParameters) (codec.ReadCloser, *codec.RTPCodec, error) {
+func (selector *CodecSelector) selectAudioCodec(reader audio.Reader, inputProp prop.Media, codecs ...webrtc.RTPCodecParameters) (codec.TimestampedReadCloser, *codec.RTPCodec, error) {
 	var codecNames []string
 
 	for _, codec := range codecs {
@@ -139,3 +164,53 @@ func (selector *CodecSelector) selectAudioCodec(reader audio.Reader, inputProp p
 
 	return selector.selectAudioCodecByNames(reader, inputProp, codecNames...)
 }
+
+// BuildVideoDecoder builds the first video decoder that matches mimeType. mimeType can be formatted as
+// "video/<codecName>" or "<codecName>". Every read from r must return a single encoded frame.
+func (selector *CodecSelector) BuildVideoDecoder(mimeType string, r io.Reader, p prop.Media) (codec.VideoDecoder, error) {
+	var errReasons []string
+
+	wantCodecLower := strings.ToLower(mimeType)
+	for _, decoder := range selector.videoDecoders {
+		// MimeType is formated as "video/<codecName>"
+		if !strings.HasSuffix(strings.ToLower(decoder.RTPCodec().MimeType), wantCodecLower) {
+			continue
+		}
+
+		videoDecoder, err := decoder.BuildVideoDecoder(r, p)
+		if err == nil {
+			return videoDecoder, nil
+		}
+		errReasons = append(errReasons, fmt.Sprintf("%s: %s", decoder.RTPCodec().MimeType, err))
+	}
+
+	if len(errReasons) == 0 {
+		return nil, fmt.Errorf("%w: %s", errDecoderNotFound, mimeType)
+	}
+	return nil, errors.New(strings.Join(errReasons, "\n\n"))
+}
+
+// BuildAudioDecoder builds the first audio decoder that matches mimeType. mimeType can be formatted as
+// "audio/<codecName>" or "<codecName>". Every read from r must return a single encoded frame.
+func (selector *CodecSelector) BuildAudioDecoder(mimeType string, r io.Reader, p prop.Media) (codec.AudioDecoder, error) {
+	var errReasons []string
+
+	wantCodecLower := strings.ToLower(mimeType)
+	for _, decoder := range selector.audioDecoders {
+		// MimeType is formated as "audio/<codecName>"
+		if !strings.HasSuffix(strings.ToLower(decoder.RTPCodec().MimeType), wantCodecLower) {
+			continue
+		}
+
+		audioDecoder, err := decoder.BuildAudioDecoder(r, p)
+		if err == nil {
+			return audioDecoder, nil
+		}
+		errReasons = append(errReasons, fmt.Sprintf("%s: %s", decoder.RTPCodec().MimeType, err))
+	}
+
+	if len(errReasons) == 0 {
+		return nil, fmt.Errorf("%w: %s", errDecoderNotFound, mimeType)
+	}
+	return nil, errors.New(strings.Join(errReasons, "\n\n"))
+}
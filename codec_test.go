@@ -0,0 +1,113 @@
+package mediadevices
+
+import (
+	"errors"
+	"image"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/io/audio"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/wave"
+)
+
+type fakeVideoDecoder struct {
+	r io.Reader
+}
+
+func (d *fakeVideoDecoder) Read() (image.Image, func(), error) { return nil, func() {}, io.EOF }
+func (d *fakeVideoDecoder) Close() error                       { return nil }
+
+type fakeVideoDecoderBuilder struct {
+	codec *codec.RTPCodec
+	err   error
+}
+
+func (b *fakeVideoDecoderBuilder) RTPCodec() *codec.RTPCodec { return b.codec }
+
+func (b *fakeVideoDecoderBuilder) BuildVideoDecoder(r io.Reader, p prop.Media) (codec.VideoDecoder, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return &fakeVideoDecoder{r: r}, nil
+}
+
+func TestCodecSelectorBuildVideoDecoder(t *testing.T) {
+	errBroken := errors.New("broken decoder")
+	vp8 := &fakeVideoDecoderBuilder{codec: codec.NewRTPVP8Codec(90000)}
+	brokenH264 := &fakeVideoDecoderBuilder{codec: codec.NewRTPH264Codec(90000), err: errBroken}
+	selector := NewCodecSelector(WithVideoDecoders(brokenH264, vp8))
+
+	for _, mimeType := range []string{"video/VP8", "vp8"} {
+		decoder, err := selector.BuildVideoDecoder(mimeType, nil, prop.Media{})
+		if err != nil {
+			t.Fatalf("%s: %v", mimeType, err)
+		}
+		if _, ok := decoder.(*fakeVideoDecoder); !ok {
+			t.Errorf("%s: unexpected decoder %T", mimeType, decoder)
+		}
+	}
+
+	if _, err := selector.BuildVideoDecoder("video/AV1", nil, prop.Media{}); !errors.Is(err, errDecoderNotFound) {
+		t.Errorf("Expected error: %v, got: %v", errDecoderNotFound, err)
+	}
+	if _, err := selector.BuildVideoDecoder("video/H264", nil, prop.Media{}); err == nil {
+		t.Error("Expected the error of the H264 decoder")
+	}
+}
+
+// fakeAudioEncoderBuilder builds encoders that return the sampling rate of the chunks they read.
+type fakeAudioEncoderBuilder struct {
+	codec *codec.RTPCodec
+	prop  prop.Media
+}
+
+func (b *fakeAudioEncoderBuilder) RTPCodec() *codec.RTPCodec { return b.codec }
+
+func (b *fakeAudioEncoderBuilder) BuildAudioEncoder(r audio.Reader, p prop.Media) (codec.ReadCloser, error) {
+	b.prop = p
+	return &fakeAudioEncoder{r: r}, nil
+}
+
+type fakeAudioEncoder struct {
+	r audio.Reader
+}
+
+func (e *fakeAudioEncoder) Read() ([]byte, func(), error) {
+	chunk, _, err := e.r.Read()
+	if err != nil {
+		return nil, func() {}, err
+	}
+	return []byte(strconv.Itoa(chunk.ChunkInfo().SamplingRate)), func() {}, nil
+}
+
+func (e *fakeAudioEncoder) Close() error                        { return nil }
+func (e *fakeAudioEncoder) Controller() codec.EncoderController { return nil }
+
+func TestSelectAudioCodecResamples(t *testing.T) {
+	encoder := &fakeAudioEncoderBuilder{codec: codec.NewRTPOpusCodec(48000)}
+	selector := NewCodecSelector(WithAudioEncoders(encoder))
+
+	reader := audio.ReaderFunc(func() (wave.Audio, func(), error) {
+		return wave.NewInt16Interleaved(wave.ChunkInfo{Len: 441, Channels: 1, SamplingRate: 44100}), func() {}, nil
+	})
+	inputProp := prop.Media{Audio: prop.Audio{SampleRate: 44100, ChannelCount: 1}}
+	encodedReader, _, err := selector.selectAudioCodecByNames(reader, inputProp, "opus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoder.prop.SampleRate != 48000 {
+		t.Errorf("Expected the encoder to be built for 48000 Hz, got %d Hz", encoder.prop.SampleRate)
+	}
+	for i := 0; i < 3; i++ {
+		buf, _, err := encodedReader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate := string(buf); rate != "48000" {
+			t.Errorf("Expected the encoder to read 48000 Hz audio, got %s Hz", rate)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package mediadevices
+
+import (
+	"math"
+
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+// controlConstraint is a constraint of a control of a device.
+type controlConstraint struct {
+	id driver.ControlID
+	// name is the name of the field of the constraint, e.g. "Zoom"
+	name       string
+	constraint any
+}
+
+// controlConstraints returns the constraints of the controls that are set in constraints.
+func controlConstraints(constraints prop.VideoConstraints) []controlConstraint {
+	var cs []controlConstraint
+	add := func(id driver.ControlID, name string, constraint any) {
+		if constraint != nil {
+			cs = append(cs, controlConstraint{id: id, name: name, constraint: constraint})
+		}
+	}
+	add(driver.ControlExposureMode, "ExposureMode", constraints.ExposureMode)
+	add(driver.ControlWhiteBalanceMode, "WhiteBalanceMode", constraints.WhiteBalanceMode)
+	add(driver.ControlFocusDistance, "FocusDistance", constraints.FocusDistance)
+	add(driver.ControlZoom, "Zoom", constraints.Zoom)
+	add(driver.ControlPan, "Pan", constraints.Pan)
+	add(driver.ControlTilt, "Tilt", constraints.Tilt)
+	add(driver.ControlBrightness, "Brightness", constraints.Brightness)
+	return cs
+}
+
+// controlValue is a value to set a control to.
+type controlValue struct {
+	id    driver.ControlID
+	value int32
+}
+
+// driverControls returns the controls of d, which has to be open.
+func driverControls(d driver.Driver) []driver.Control {
+	if ca, ok := d.(driver.ControlAdapter); ok {
+		return ca.Controls()
+	}
+	return nil
+}
+
+// selectControls finds the values of controls that fit constraints best. It fails with an
+// *OverconstrainedError if a constraint that isn't only ideal can't be satisfied, e.g. because the
+// device doesn't have the control.
+func selectControls(controls []driver.Control, constraints prop.MediaConstraints) ([]controlValue, error) {
+	cs := controlConstraints(constraints.VideoConstraints)
+	if len(cs) == 0 {
+		return nil, nil
+	}
+
+	var values []controlValue
+	for _, c := range cs {
+		var control *driver.Control
+		for i := range controls {
+			if controls[i].ID == c.id {
+				control = &controls[i]
+				break
+			}
+		}
+		if control == nil {
+			if isIdeal(c.constraint) {
+				continue
+			}
+			return nil, &OverconstrainedError{Constraint: c.name}
+		}
+
+		value, ok := fitControl(*control, c.constraint)
+		if !ok {
+			return nil, &OverconstrainedError{Constraint: c.name}
+		}
+		values = append(values, controlValue{id: c.id, value: value})
+	}
+	return values, nil
+}
+
+// setControls sets the controls of d to values.
+func setControls(d driver.Driver, values []controlValue) error {
+	if len(values) == 0 {
+		return nil
+	}
+	ca, ok := d.(driver.ControlAdapter)
+	if !ok {
+		return errNotConstrainable
+	}
+	for _, v := range values {
+		if err := ca.SetControl(v.id, v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyControls sets the controls of d to the values that fit constraints best.
+func applyControls(d driver.Driver, constraints prop.MediaConstraints) error {
+	values, err := selectControls(driverControls(d), constraints)
+	if err != nil {
+		return err
+	}
+	return setControls(d, values)
+}
+
+// isIdeal checks if constraint only tells the ideal value, so any value satisfies it.
+func isIdeal(constraint any) bool {
+	switch c := constraint.(type) {
+	case prop.Float, prop.String:
+		return true
+	case prop.FloatRanged:
+		return c.Min == 0 && c.Max == 0
+	default:
+		return false
+	}
+}
+
+// fitControl returns the value of control that fits constraint best. The modes are matched by the
+// names of the menu items, and the other values are snapped to the steps of the control.
+func fitControl(control driver.Control, constraint any) (int32, bool) {
+	var candidates []int32
+	var compare func(int32) (float64, bool)
+
+	switch c := constraint.(type) {
+	case prop.StringConstraint:
+		names := make(map[int32]string)
+		for _, item := range control.Menu {
+			candidates = append(candidates, item.Value)
+			names[item.Value] = item.Name
+		}
+		compare = func(v int32) (float64, bool) { return c.Compare(names[v]) }
+	case prop.FloatConstraint:
+		if control.Type == driver.ControlTypeMenu {
+			for _, item := range control.Menu {
+				candidates = append(candidates, item.Value)
+			}
+		} else {
+			candidates = append(candidates, control.Min, control.Max, control.Default)
+			for _, v := range floatCandidates(c) {
+				candidates = append(candidates, snapControl(control, v))
+			}
+		}
+		compare = func(v int32) (float64, bool) { return c.Compare(float32(v)) }
+	default:
+		return 0, false
+	}
+
+	best, bestDist := int32(0), math.Inf(1)
+	for _, v := range candidates {
+		if dist, ok := compare(v); ok && dist < bestDist {
+			best, bestDist = v, dist
+		}
+	}
+	return best, !math.IsInf(bestDist, 1)
+}
+
+// floatCandidates returns the values that constraint tells, which the best value is closest to.
+func floatCandidates(constraint prop.FloatConstraint) []float32 {
+	switch c := constraint.(type) {
+	case prop.FloatOneOf:
+		return c
+	case prop.FloatRanged:
+		return []float32{c.Min, c.Max, c.Ideal}
+	}
+	if v, ok := constraint.Value(); ok {
+		return []float32{v}
+	}
+	return nil
+}
+
+// snapControl returns the value of control that's closest to v.
+func snapControl(control driver.Control, v float32) int32 {
+	v = min(max(v, float32(control.Min)), float32(control.Max))
+	if control.Step <= 1 {
+		return int32(math.Round(float64(v)))
+	}
+	steps := math.Round(float64(v-float32(control.Min)) / float64(control.Step))
+	return min(control.Min+int32(steps)*control.Step, control.Max)
+}
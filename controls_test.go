@@ -0,0 +1,212 @@
+package mediadevices
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+var (
+	zoomControl     = driver.Control{ID: driver.ControlZoom, Type: driver.ControlTypeInteger, Min: 100, Max: 500, Step: 1, Default: 100}
+	panControl      = driver.Control{ID: driver.ControlPan, Type: driver.ControlTypeInteger, Min: -36000, Max: 36000, Step: 3600}
+	exposureControl = driver.Control{
+		ID: driver.ControlExposureMode, Type: driver.ControlTypeMenu, Max: 3, Step: 1, Default: 3,
+		Menu: []driver.ControlMenuItem{{Value: 1, Name: "manual"}, {Value: 3, Name: "continuous"}},
+	}
+)
+
+// fakePTZCamera is a fakeCamera that can zoom, pan and set its exposure mode.
+type fakePTZCamera struct {
+	fakeCamera
+	controlsMu sync.Mutex
+	values     map[driver.ControlID]int32
+}
+
+func (c *fakePTZCamera) Controls() []driver.Control {
+	return []driver.Control{zoomControl, panControl, exposureControl}
+}
+
+func (c *fakePTZCamera) GetControl(id driver.ControlID) (int32, error) {
+	c.controlsMu.Lock()
+	defer c.controlsMu.Unlock()
+	return c.values[id], nil
+}
+
+func (c *fakePTZCamera) SetControl(id driver.ControlID, value int32) error {
+	c.controlsMu.Lock()
+	defer c.controlsMu.Unlock()
+	if c.values == nil {
+		c.values = make(map[driver.ControlID]int32)
+	}
+	c.values[id] = value
+	return nil
+}
+
+func (c *fakePTZCamera) control(id driver.ControlID) (int32, bool) {
+	c.controlsMu.Lock()
+	defer c.controlsMu.Unlock()
+	value, ok := c.values[id]
+	return value, ok
+}
+
+func TestFitControl(t *testing.T) {
+	testCases := map[string]struct {
+		control    driver.Control
+		constraint any
+		expected   int32
+		ok         bool
+	}{
+		"Ideal": {
+			control:    zoomControl,
+			constraint: prop.Float(250.4),
+			expected:   250,
+			ok:         true,
+		},
+		"IdealOutOfRange": {
+			control:    zoomControl,
+			constraint: prop.Float(1000),
+			expected:   500,
+			ok:         true,
+		},
+		"ExactOutOfRange": {
+			control:    zoomControl,
+			constraint: prop.FloatExact(1000),
+			ok:         false,
+		},
+		"SnappedToStep": {
+			control:    panControl,
+			constraint: prop.Float(5000),
+			expected:   3600,
+			ok:         true,
+		},
+		"ExactNotOnStep": {
+			control:    panControl,
+			constraint: prop.FloatExact(5000),
+			ok:         false,
+		},
+		"Ranged": {
+			control:    zoomControl,
+			constraint: prop.FloatRanged{Min: 200, Max: 300},
+			expected:   200,
+			ok:         true,
+		},
+		"Mode": {
+			control:    exposureControl,
+			constraint: prop.StringExact("manual"),
+			expected:   1,
+			ok:         true,
+		},
+		"UnknownMode": {
+			control:    exposureControl,
+			constraint: prop.StringExact("single-shot"),
+			ok:         false,
+		},
+	}
+
+	for name, c := range testCases {
+		t.Run(name, func(t *testing.T) {
+			value, ok := fitControl(c.control, c.constraint)
+			if ok != c.ok {
+				t.Fatalf("Expected ok to be %v, got %v", c.ok, ok)
+			}
+			if ok && value != c.expected {
+				t.Errorf("Expected %d, got %d", c.expected, value)
+			}
+		})
+	}
+}
+
+func TestApplyControlConstraints(t *testing.T) {
+	camera := &fakePTZCamera{}
+	if err := driver.GetManager().Register(camera, driver.Info{Label: t.Name(), DeviceType: driver.Camera}); err != nil {
+		t.Fatal(err)
+	}
+	d := driver.GetManager().Query(func(d driver.Driver) bool { return d.Info().Label == t.Name() })[0]
+	defer driver.GetManager().Delete(d.ID())
+
+	track := newFakeCameraTrack(t, d, nil, func(c *MediaTrackConstraints) {
+		c.Zoom = prop.Float(200)
+		c.ExposureMode = prop.String("manual")
+	})
+	if value, _ := camera.control(driver.ControlZoom); value != 200 {
+		t.Errorf("Expected the zoom to be 200, got %d", value)
+	}
+	if value, _ := camera.control(driver.ControlExposureMode); value != 1 {
+		t.Errorf("Expected the exposure to be manual, got %d", value)
+	}
+
+	if err := track.ApplyConstraints(func(c *MediaTrackConstraints) {
+		c.Pan = prop.FloatExact(7200)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := camera.control(driver.ControlPan); value != 7200 {
+		t.Errorf("Expected the pan to be 7200, got %d", value)
+	}
+
+	// The camera can't focus, so the controls are left unchanged
+	err := track.ApplyConstraints(func(c *MediaTrackConstraints) {
+		c.Pan = prop.FloatExact(0)
+		c.FocusDistance = prop.FloatExact(1)
+	})
+	var errOverconstrained *OverconstrainedError
+	if !errors.As(err, &errOverconstrained) || errOverconstrained.Constraint != "FocusDistance" {
+		t.Errorf("Expected the FocusDistance constraint to be overconstrained, got %v", err)
+	}
+	if value, _ := camera.control(driver.ControlPan); value != 7200 {
+		t.Errorf("Expected the pan to stay 7200, got %d", value)
+	}
+
+	// Ideal values of missing controls are ignored
+	if err := track.ApplyConstraints(func(c *MediaTrackConstraints) {
+		c.Brightness = prop.Float(10)
+	}); err != nil {
+		t.Error(err)
+	}
+	if _, ok := camera.control(driver.ControlBrightness); ok {
+		t.Error("Expected the brightness not to be set")
+	}
+}
+
+func TestSelectControlConstraints(t *testing.T) {
+	camera := &fakePTZCamera{}
+	if err := driver.GetManager().Register(camera, driver.Info{Label: t.Name() + "PTZ", DeviceType: driver.Camera}); err != nil {
+		t.Fatal(err)
+	}
+	ptz := driver.GetManager().Query(func(d driver.Driver) bool { return d.Info().Label == t.Name()+"PTZ" })[0]
+	defer driver.GetManager().Delete(ptz.ID())
+	registerFakeCamera(t)
+
+	filter := func(d driver.Driver) bool { return strings.HasPrefix(d.Info().Label, t.Name()) }
+
+	// Only the camera that can zoom is selected
+	explanation := explainSelection(filter, constraintsOf(func(c *MediaTrackConstraints) {
+		c.Zoom = prop.FloatExact(200)
+	}))
+	if explanation.Err != nil {
+		t.Fatal(explanation.Err)
+	}
+	for _, c := range explanation.Candidates {
+		switch {
+		case c.DeviceID == ptz.ID() && c.Rejected:
+			t.Errorf("Expected the camera that can zoom to be a candidate, got %+v", c)
+		case c.DeviceID != ptz.ID() && (!c.Rejected || c.Reason != "Zoom isn't satisfied"):
+			t.Errorf("Expected the camera that can't zoom to be rejected by Zoom, got %+v", c)
+		case c.Selected && c.DeviceID != ptz.ID():
+			t.Errorf("Expected the camera that can zoom to be selected, got %+v", c)
+		}
+	}
+
+	// None of the cameras can focus
+	explanation = explainSelection(filter, constraintsOf(func(c *MediaTrackConstraints) {
+		c.FocusDistance = prop.FloatExact(1)
+	}))
+	var errOverconstrained *OverconstrainedError
+	if !errors.As(explanation.Err, &errOverconstrained) || errOverconstrained.Constraint != "FocusDistance" {
+		t.Errorf("Expected the FocusDistance constraint to be overconstrained, got %v", explanation.Err)
+	}
+}
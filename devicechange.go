@@ -0,0 +1,65 @@
+package mediadevices
+
+import (
+	"errors"
+
+	"github.com/pion/mediadevices/pkg/driver"
+)
+
+// ErrDeviceRemoved is given to the OnEnded handlers of the tracks whose device has been removed, e.g.
+// because it was unplugged.
+var ErrDeviceRemoved = errors.New("device has been removed")
+
+// DeviceChangeType is the type of a DeviceChangeEvent.
+type DeviceChangeType int
+
+const (
+	// DeviceAdded is sent after a device is added to the ones that EnumerateDevices lists.
+	DeviceAdded DeviceChangeType = iota
+	// DeviceRemoved is sent after a device is removed from the ones that EnumerateDevices lists. The
+	// tracks of the device have ended with ErrDeviceRemoved by then.
+	DeviceRemoved
+	// DeviceAvailabilityChanged is sent when a device may have become available or unavailable, e.g.
+	// because the permissions of the device node of a Linux camera have changed.
+	DeviceAvailabilityChanged
+)
+
+// DeviceChangeEvent is a change of the devices that EnumerateDevices lists.
+// Reference: https://w3c.github.io/mediacapture-main/#event-mediadevices-devicechange
+type DeviceChangeEvent struct {
+	Type   DeviceChangeType
+	Device MediaDeviceInfo
+}
+
+func init() {
+	driver.GetManager().Subscribe(func(e driver.Event) {
+		if e.Type == driver.EventRemoved {
+			endCaptures(e.Driver)
+		}
+	})
+}
+
+// OnDeviceChange calls handler with the changes of the devices that EnumerateDevices lists, until the
+// returned function is called. handler is called from the goroutine that registered or removed the
+// device, e.g. the one of the camera observer.
+func OnDeviceChange(handler func(DeviceChangeEvent)) (unsubscribe func()) {
+	return driver.GetManager().Subscribe(func(e driver.Event) {
+		info, ok := mediaDeviceInfo(e.Driver)
+		if !ok {
+			return
+		}
+
+		var typ DeviceChangeType
+		switch e.Type {
+		case driver.EventAdded:
+			typ = DeviceAdded
+		case driver.EventRemoved:
+			typ = DeviceRemoved
+		case driver.EventAvailabilityChanged:
+			typ = DeviceAvailabilityChanged
+		default:
+			return
+		}
+		handler(DeviceChangeEvent{Type: typ, Device: info})
+	})
+}
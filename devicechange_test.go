@@ -0,0 +1,61 @@
+package mediadevices
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+func TestOnDeviceChange(t *testing.T) {
+	var mu sync.Mutex
+	var events []DeviceChangeEvent
+	unsubscribe := OnDeviceChange(func(e DeviceChangeEvent) {
+		// The devices of the other tests are ignored
+		if e.Device.Label == t.Name() {
+			mu.Lock()
+			events = append(events, e)
+			mu.Unlock()
+		}
+	})
+	defer unsubscribe()
+
+	d, _ := registerFakeCamera(t)
+	driver.GetManager().NotifyAvailabilityChanged(d.ID())
+	driver.GetManager().Delete(d.ID())
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []DeviceChangeType{DeviceAdded, DeviceAvailabilityChanged, DeviceRemoved}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %v", len(expected), events)
+	}
+	for i, e := range events {
+		if e.Type != expected[i] || e.Device.DeviceID != d.ID() || e.Device.Kind != VideoInput {
+			t.Errorf("Expected event %d to be %v of the camera, got %+v", i, expected[i], e)
+		}
+	}
+}
+
+func TestTrackEndsWhenDeviceRemoved(t *testing.T) {
+	d, _ := registerFakeCamera(t)
+	track := newFakeCameraTrack(t, d, nil, func(c *MediaTrackConstraints) {
+		c.Width = prop.Int(640)
+	})
+
+	ended := make(chan error, 1)
+	track.OnEnded(func(err error) { ended <- err })
+
+	driver.GetManager().Delete(d.ID())
+	select {
+	case err := <-ended:
+		if !errors.Is(err, ErrDeviceRemoved) {
+			t.Errorf("Expected the track to end with %v, got %v", ErrDeviceRemoved, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the track to end")
+	}
+}
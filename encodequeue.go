@@ -0,0 +1,292 @@
+package mediadevices
+
+import (
+	"errors"
+	"image"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/io/video"
+)
+
+const (
+	defaultEncodeQueueSize = 2
+	// encodeQueueRateWindow is how long the encoded frames are counted for before the expected frame rate of the
+	// encoder is checked
+	encodeQueueRateWindow = time.Second
+	// encodeQueueRateTolerance is how far, relative to the expected frame rate, the encoded frame rate can be
+	// before the encoder is told about it
+	encodeQueueRateTolerance = 0.1
+)
+
+var errInvalidEncodeQueueSize = errors.New("encode queue size must not be negative")
+
+// EncodeQueue configures a video track to decouple the capture from the encoders. Frames are queued for each
+// encoder as they're captured, so a slow encoder doesn't hold them back in the driver or the broadcaster, and
+// the frames that the encoder can't keep up with are dropped instead of adding latency. When frames are
+// dropped, the encoder is told the frame rate that it actually gets, if it implements
+// codec.InputPropController. The others, e.g. x264 and SVT-AV1, can't be told, so their rate control keeps
+// assuming the frame rate that they were built with, and spends the bits of the dropped frames on the encoded
+// ones. The RTP timestamps follow the capture time of the encoded frames, so they stay correct whichever
+// frames are dropped.
+type EncodeQueue struct {
+	// Size is the number of frames that can wait for the encoder. When the queue is full, the oldest frame is
+	// dropped. The default value is 2.
+	Size int
+	// MaxAge drops the frames that were captured longer than MaxAge ago when the encoder reads them. The
+	// default value, 0, uses DiscardFramesOlderThan of the track settings, and doesn't drop frames by age if
+	// that's 0 too.
+	MaxAge time.Duration
+}
+
+// EncodeQueueStats counts the frames that went through the encode queues of a track.
+type EncodeQueueStats struct {
+	// FramesEncoded is the number of frames that the encoders read from their queues.
+	FramesEncoded uint64
+	// FramesDropped is the number of frames that were dropped because a queue was full.
+	FramesDropped uint64
+	// FramesDiscarded is the number of frames that were dropped because they were older than the maximum age.
+	FramesDiscarded uint64
+}
+
+type encodeQueueCounters struct {
+	encoded, dropped, discarded atomic.Uint64
+}
+
+// SetEncodeQueue enables encode queues for the encoders that are created by the following Bind calls and
+// NewEncodedReader calls. Passing nil disables them. Tracks that pass the frames of the camera through without
+// encoding them don't use the queue.
+func (track *VideoTrack) SetEncodeQueue(config *EncodeQueue) error {
+	if config != nil {
+		if config.Size < 0 {
+			return errInvalidEncodeQueueSize
+		}
+
+		c := *config
+		if c.Size == 0 {
+			c.Size = defaultEncodeQueueSize
+		}
+		config = &c
+	}
+
+	track.encodeQueueMu.Lock()
+	defer track.encodeQueueMu.Unlock()
+	track.encodeQueue = config
+	return nil
+}
+
+// EncodeQueueStats returns the number of frames that were encoded and dropped by the encode queues of the
+// track since it was created.
+func (track *VideoTrack) EncodeQueueStats() EncodeQueueStats {
+	return EncodeQueueStats{
+		FramesEncoded:   track.encodeQueueCounters.encoded.Load(),
+		FramesDropped:   track.encodeQueueCounters.dropped.Load(),
+		FramesDiscarded: track.encodeQueueCounters.discarded.Load(),
+	}
+}
+
+func (track *VideoTrack) encodeQueueConfig() *EncodeQueue {
+	track.encodeQueueMu.Lock()
+	defer track.encodeQueueMu.Unlock()
+	return track.encodeQueue
+}
+
+type queuedFrame struct {
+	img       image.Image
+	timestamp time.Time
+	release   func()
+}
+
+// encodeQueue reads the frames of a track in its own goroutine, and keeps the latest ones until the encoder
+// reads them.
+type encodeQueue struct {
+	counters *encodeQueueCounters
+	size     int
+	// configuredMaxAge is MaxAge of the config, which takes precedence over the track settings
+	configuredMaxAge time.Duration
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	frames []queuedFrame
+	err    error
+	closed bool
+	maxAge time.Duration
+
+	// The fields below measure the encoded frame rate, and are guarded by mu
+	frameRate        float32
+	adjusted         bool
+	frameRateChanged bool
+	windowStart      time.Time
+	windowFrames     int
+	windowDropped    bool
+}
+
+// newEncodeQueue starts reading r. frameRate is the frame rate that the encoder expects, and maxAge is
+// DiscardFramesOlderThan of the track settings.
+func newEncodeQueue(r video.Reader, config *EncodeQueue, counters *encodeQueueCounters, frameRate float32, maxAge time.Duration) *encodeQueue {
+	q := &encodeQueue{
+		counters:         counters,
+		size:             config.Size,
+		configuredMaxAge: config.MaxAge,
+		frames:           make([]queuedFrame, 0, config.Size),
+		frameRate:        frameRate,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	q.setMaxAge(maxAge)
+
+	go q.run(video.WithTimestamp(r))
+	return q
+}
+
+func (q *encodeQueue) run(r video.TimestampedReader) {
+	for {
+		img, timestamp, release, err := r.ReadTimestamped()
+		if err != nil {
+			q.mu.Lock()
+			q.err = err
+			q.mu.Unlock()
+			q.cond.Broadcast()
+			return
+		}
+
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			release()
+			return
+		}
+		var dropped func()
+		if len(q.frames) == q.size {
+			dropped = q.frames[0].release
+			q.frames = q.frames[:copy(q.frames, q.frames[1:])]
+			q.windowDropped = true
+			q.counters.dropped.Add(1)
+		}
+		q.frames = append(q.frames, queuedFrame{img: img, timestamp: timestamp, release: release})
+		q.mu.Unlock()
+		q.cond.Signal()
+
+		if dropped != nil {
+			dropped()
+		}
+	}
+}
+
+// ReadTimestamped implements video.TimestampedReader. It waits for the next frame that isn't too old.
+func (q *encodeQueue) ReadTimestamped() (image.Image, time.Time, func(), error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		for len(q.frames) == 0 && q.err == nil && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			return nil, time.Time{}, func() {}, io.EOF
+		}
+		if len(q.frames) == 0 {
+			return nil, time.Time{}, func() {}, q.err
+		}
+
+		frame := q.frames[0]
+		q.frames = q.frames[:copy(q.frames, q.frames[1:])]
+		if q.maxAge > 0 && time.Since(frame.timestamp) > q.maxAge {
+			q.windowDropped = true
+			q.counters.discarded.Add(1)
+			frame.release()
+			continue
+		}
+
+		q.counters.encoded.Add(1)
+		q.measure(frame.timestamp)
+		return frame.img, frame.timestamp, frame.release, nil
+	}
+}
+
+// Read implements video.Reader.
+func (q *encodeQueue) Read() (image.Image, func(), error) {
+	img, _, release, err := q.ReadTimestamped()
+	return img, release, err
+}
+
+// measure counts a frame that is given to the encoder. The expected frame rate is updated once a window
+// passes, if frames were dropped in it, or if it was lowered before and has to be restored. q.mu must be held.
+func (q *encodeQueue) measure(timestamp time.Time) {
+	if q.windowStart.IsZero() {
+		q.windowStart = timestamp
+		return
+	}
+	q.windowFrames++
+
+	elapsed := timestamp.Sub(q.windowStart)
+	if elapsed < encodeQueueRateWindow {
+		return
+	}
+
+	rate := float32(float64(q.windowFrames) / elapsed.Seconds())
+	if q.windowDropped || q.adjusted {
+		diff := math.Abs(float64(rate - q.frameRate))
+		if q.frameRate <= 0 || diff > encodeQueueRateTolerance*float64(q.frameRate) {
+			q.frameRate = rate
+			q.adjusted = true
+			q.frameRateChanged = true
+		}
+	}
+	q.windowStart = timestamp
+	q.windowFrames = 0
+	q.windowDropped = false
+}
+
+// takeFrameRate returns the frame rate that the encoder should expect, and whether it changed since the last
+// call. It mustn't be called while the encoder reads a frame, since encoders are locked while reading.
+func (q *encodeQueue) takeFrameRate() (float32, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	changed := q.frameRateChanged
+	q.frameRateChanged = false
+	return q.frameRate, changed
+}
+
+// expectedFrameRate returns the frame rate that the encoder should expect if it was adjusted, or frameRate.
+func (q *encodeQueue) expectedFrameRate(frameRate float32) float32 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.adjusted {
+		return q.frameRate
+	}
+	q.frameRate = frameRate
+	return frameRate
+}
+
+// setMaxAge sets DiscardFramesOlderThan of the track settings, which is used when the config doesn't set
+// MaxAge.
+func (q *encodeQueue) setMaxAge(maxAge time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.configuredMaxAge > 0 {
+		maxAge = q.configuredMaxAge
+	}
+	q.maxAge = maxAge
+}
+
+// Close releases the queued frames and wakes the encoder up if it's waiting for a frame. The goroutine that
+// reads the track stops with the next frame or error.
+func (q *encodeQueue) Close() error {
+	q.mu.Lock()
+	q.closed = true
+	frames := q.frames
+	q.frames = nil
+	q.mu.Unlock()
+	q.cond.Broadcast()
+
+	for _, frame := range frames {
+		frame.release()
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package mediadevices
+
+import (
+	"image"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/webrtc/v4"
+)
+
+// fakeTimedSource produces a frame of size every interval like a camera, whether it's read or not, or of 16x16 if
+// size is empty. stamp gives the capture time of the nth frame.
+type fakeTimedSource struct {
+	interval time.Duration
+	size     image.Rectangle
+	stamp    func(n int) time.Time
+	n        int
+	ticker   *time.Ticker
+}
+
+func (s *fakeTimedSource) ID() string   { return "fakeTimedSource" }
+func (s *fakeTimedSource) Close() error { return nil }
+
+func (s *fakeTimedSource) Read() (image.Image, func(), error) {
+	img, _, release, err := s.ReadTimestamped()
+	return img, release, err
+}
+
+func (s *fakeTimedSource) ReadTimestamped() (image.Image, time.Time, func(), error) {
+	if s.ticker == nil {
+		s.ticker = time.NewTicker(s.interval)
+	}
+	<-s.ticker.C
+	s.n++
+	size := s.size
+	if size.Empty() {
+		size = image.Rect(0, 0, 16, 16)
+	}
+	return image.NewYCbCr(size, image.YCbCrSubsampleRatio420), s.stamp(s.n), func() {}, nil
+}
+
+// slowVideoEncoder takes delay to encode each frame, and records the input properties it's given.
+type slowVideoEncoder struct {
+	r     video.Reader
+	delay time.Duration
+	mu    sync.Mutex
+	p     []prop.Media
+}
+
+func (e *slowVideoEncoder) Read() ([]byte, func(), error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, _, err := e.r.Read(); err != nil {
+		return nil, func() {}, err
+	}
+	time.Sleep(e.delay)
+	return []byte{0}, func() {}, nil
+}
+
+func (e *slowVideoEncoder) Close() error                        { return nil }
+func (e *slowVideoEncoder) Controller() codec.EncoderController { return e }
+
+func (e *slowVideoEncoder) SetInputProp(p prop.Media) error {
+	// Like the real encoders, the input can't be changed while a frame is encoded
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.p = append(e.p, p)
+	return nil
+}
+
+func (e *slowVideoEncoder) inputProps() []prop.Media {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]prop.Media(nil), e.p...)
+}
+
+type slowVideoEncoderBuilder struct {
+	delay   time.Duration
+	encoder *slowVideoEncoder
+}
+
+func (b *slowVideoEncoderBuilder) RTPCodec() *codec.RTPCodec { return codec.NewRTPVP8Codec(90000) }
+
+func (b *slowVideoEncoderBuilder) BuildVideoEncoder(r video.Reader, p prop.Media) (codec.ReadCloser, error) {
+	b.encoder = &slowVideoEncoder{r: r, delay: b.delay}
+	return b.encoder, nil
+}
+
+func TestEncodeQueue(t *testing.T) {
+	builder := &slowVideoEncoderBuilder{delay: 20 * time.Millisecond}
+	source := &fakeTimedSource{interval: 5 * time.Millisecond, stamp: func(int) time.Time { return time.Now() }}
+	track := NewVideoTrack(source, NewCodecSelector(WithVideoEncoders(builder))).(*VideoTrack)
+	defer track.Close()
+
+	if err := track.SetEncodeQueue(&EncodeQueue{Size: -1}); err != errInvalidEncodeQueueSize {
+		t.Fatalf("Expected %v, got %v", errInvalidEncodeQueueSize, err)
+	}
+	if err := track.SetEncodeQueue(&EncodeQueue{}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := track.NewEncodedReader(webrtc.MimeTypeVP8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var first time.Time
+	var samples uint32
+	deadline := time.Now().Add(5 * time.Second)
+	for len(builder.encoder.inputProps()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the encoder to be told about the frame rate")
+		}
+
+		buffer, release, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+
+		// The RTP timestamps follow the capture time of the frames that weren't dropped
+		if first.IsZero() {
+			first = buffer.Timestamp
+		}
+		samples += buffer.Samples
+		if expected := uint32(math.Round(90000 * buffer.Timestamp.Sub(first).Seconds())); samples != expected {
+			t.Errorf("Expected %d samples since the first frame, got %d", expected, samples)
+		}
+
+		// The frames waiting for the encoder are bounded by the queue
+		if latency := time.Since(buffer.Timestamp); latency > 200*time.Millisecond {
+			t.Errorf("Expected the encoded frames to be fresh, got %v of latency", latency)
+		}
+	}
+
+	// The encoder gets about 50 fps of the 200 fps that are captured
+	if frameRate := builder.encoder.inputProps()[0].FrameRate; frameRate < 20 || frameRate > 60 {
+		t.Errorf("Expected the encoder to expect about 50 fps, got %f", frameRate)
+	}
+	stats := track.EncodeQueueStats()
+	if stats.FramesEncoded == 0 || stats.FramesDropped == 0 || stats.FramesDiscarded != 0 {
+		t.Errorf("Expected frames to be encoded and dropped, got %+v", stats)
+	}
+}
+
+func TestEncodeQueueMaxAge(t *testing.T) {
+	builder := &slowVideoEncoderBuilder{}
+	source := &fakeTimedSource{interval: time.Millisecond, stamp: func(n int) time.Time {
+		// Every other frame comes too late
+		if n%2 == 0 {
+			return time.Now().Add(-time.Second)
+		}
+		return time.Now()
+	}}
+	track := NewVideoTrack(source, NewCodecSelector(WithVideoEncoders(builder))).(*VideoTrack)
+	defer track.Close()
+
+	if err := track.SetEncodeQueue(&EncodeQueue{Size: 16, MaxAge: 500 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := track.NewEncodedReader(webrtc.MimeTypeVP8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	for i := 0; i < 20; i++ {
+		buffer, release, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+		if latency := time.Since(buffer.Timestamp); latency > 500*time.Millisecond {
+			t.Fatalf("Expected the frames older than the maximum age to be discarded, got %v of latency", latency)
+		}
+	}
+	if stats := track.EncodeQueueStats(); stats.FramesDiscarded == 0 {
+		t.Errorf("Expected frames to be discarded, got %+v", stats)
+	}
+}
@@ -2,8 +2,6 @@ package main
 
 import (
 	"fmt"
-	"image"
-	"io"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,8 +10,8 @@ import (
 	"github.com/pion/mediadevices/pkg/codec/x264"      // This is required to use H264 video encoder
 	_ "github.com/pion/mediadevices/pkg/driver/camera" // This is required to register camera adapter
 	"github.com/pion/mediadevices/pkg/frame"
-	"github.com/pion/mediadevices/pkg/io/video"
 	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/recorder"
 )
 
 func must(err error) {
@@ -24,7 +22,7 @@ func must(err error) {
 
 func main() {
 	if len(os.Args) != 2 {
-		fmt.Printf("usage: %s <path/to/file.h264>\n", os.Args[0])
+		fmt.Printf("usage: %s <path/to/file.mkv>\n", os.Args[0])
 		return
 	}
 	dest := os.Args[1]
@@ -51,32 +49,22 @@ func main() {
 	})
 	must(err)
 
-	videoTrack := mediaStream.GetVideoTracks()[0].(*mediadevices.VideoTrack)
-	defer videoTrack.Close()
-
-	videoTrack.Transform(video.TransformFunc(func(r video.Reader) video.Reader {
-		return video.ReaderFunc(func() (img image.Image, release func(), err error) {
-			// we send io.EOF signal to the encoder reader to stop reading. Therefore, io.Copy
-			// will finish its execution and the program will finish
-			select {
-			case <-sigs:
-				return nil, func() {}, io.EOF
-			default:
-			}
-
-			return r.Read()
-		})
-	}))
+	for _, track := range mediaStream.GetTracks() {
+		defer track.Close()
+	}
 
-	reader, err := videoTrack.NewEncodedIOReader(x264Params.RTPCodec().MimeType)
+	out, err := os.Create(dest)
 	must(err)
-	defer reader.Close()
+	defer out.Close()
 
-	out, err := os.Create(dest)
+	// H264 isn't allowed in WebM, the recorder writes a Matroska file instead
+	rec, err := recorder.New(out, mediaStream, recorder.WithVideoCodec(x264Params.RTPCodec().MimeType))
 	must(err)
 
 	fmt.Println("Recording... Press Ctrl+c to stop")
-	_, err = io.Copy(out, reader)
-	must(err)
+	<-sigs
+
+	// Close finalizes the file, so that it's seekable
+	must(rec.Close())
 	fmt.Println("Your video has been recorded to", dest)
 }
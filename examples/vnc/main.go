@@ -33,7 +33,7 @@ func main() {
 	}
 	driver.GetManager().Register(
 		vncdriver.NewVnc("127.0.0.1:5900"),
-		driver.Info{Label: "VNC", DeviceType: driver.Camera, Priority: driver.PriorityLow},
+		driver.Info{Label: "VNC", DeviceType: driver.Camera, Priority: driver.PriorityLow, StableID: "vnc:127.0.0.1:5900"},
 	)
 	// Wait for the offer to be pasted
 	offer := webrtc.SessionDescription{}
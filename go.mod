@@ -14,6 +14,7 @@ require (
 	github.com/pion/webrtc/v4 v4.2.13
 	github.com/stretchr/testify v1.11.1
 	golang.org/x/image v0.23.0
+	golang.org/x/sys v0.41.0
 )
 
 require (
@@ -37,7 +38,6 @@ require (
 	github.com/wlynxg/anet v0.0.5 // indirect
 	golang.org/x/crypto v0.48.0 // indirect
 	golang.org/x/net v0.50.0 // indirect
-	golang.org/x/sys v0.41.0 // indirect
 	golang.org/x/time v0.14.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,28 @@
+package bitstream
+
+// SplitAnnexB splits an Annex-B byte stream into NAL units, without their start codes.
+func SplitAnnexB(b []byte) [][]byte {
+	var nalus [][]byte
+	start := -1
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] != 0 || b[i+1] != 0 || b[i+2] != 1 {
+			continue
+		}
+
+		if start >= 0 {
+			end := i
+			// The zero byte of a 4 bytes start code belongs to the next start code
+			if end > start && b[end-1] == 0 {
+				end--
+			}
+			nalus = append(nalus, b[start:end])
+		}
+		i += 2
+		start = i + 1
+	}
+
+	if start >= 0 && start < len(b) {
+		nalus = append(nalus, b[start:])
+	}
+	return nalus
+}
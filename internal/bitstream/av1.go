@@ -0,0 +1,67 @@
+package bitstream
+
+import "errors"
+
+// AV1 OBU types.
+const (
+	AV1OBUTypeSequenceHeader       = 1
+	AV1OBUTypeTemporalDelimiter    = 2
+	AV1OBUTypeFrameHeader          = 3
+	AV1OBUTypeFrame                = 6
+	AV1OBUTypeRedundantFrameHeader = 7
+	AV1OBUTypePadding              = 15
+)
+
+// ErrInvalidAV1OBU is returned when a temporal unit can't be split into OBUs.
+var ErrInvalidAV1OBU = errors.New("av1: invalid OBU")
+
+// AV1OBU is an Open Bitstream Unit. Header includes the extension header if there's one.
+type AV1OBU struct {
+	Type    byte
+	Header  []byte
+	Payload []byte
+}
+
+// SplitAV1OBUs splits a temporal unit in the low overhead bitstream format into OBUs.
+func SplitAV1OBUs(tu []byte) ([]AV1OBU, error) {
+	var obus []AV1OBU
+	for len(tu) > 0 {
+		headerSize := 1
+		if tu[0]&0x04 != 0 {
+			headerSize++
+		}
+		if len(tu) < headerSize {
+			return nil, ErrInvalidAV1OBU
+		}
+		obu := AV1OBU{Type: tu[0] >> 3 & 0x0F, Header: tu[:headerSize]}
+		tu = tu[headerSize:]
+
+		size := uint64(len(tu))
+		if obu.Header[0]&0x02 != 0 {
+			var n int
+			size, n = readLEB128(tu)
+			if n == 0 {
+				return nil, ErrInvalidAV1OBU
+			}
+			tu = tu[n:]
+		}
+		if size > uint64(len(tu)) {
+			return nil, ErrInvalidAV1OBU
+		}
+		obu.Payload = tu[:size]
+		tu = tu[size:]
+		obus = append(obus, obu)
+	}
+	return obus, nil
+}
+
+func readLEB128(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8 && i < len(b); i++ {
+		v |= uint64(b[i]&0x7F) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
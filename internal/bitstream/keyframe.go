@@ -0,0 +1,106 @@
+package bitstream
+
+import (
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	h264NALUTypeIDR     = 5
+	h265NALUTypeBLAWLP  = 16
+	h265NALUTypeRSVIRAP = 23
+)
+
+// KeyFrameDetector returns the function that reports whether an encoded frame of mimeType is a key frame,
+// or nil if the codec isn't known.
+func KeyFrameDetector(mimeType string) func(frame []byte) bool {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		return IsVP8KeyFrame
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		return IsVP9KeyFrame
+	case strings.ToLower(webrtc.MimeTypeAV1):
+		return IsAV1KeyFrame
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return IsH264KeyFrame
+	case strings.ToLower(webrtc.MimeTypeH265):
+		return IsH265KeyFrame
+	default:
+		return nil
+	}
+}
+
+// IsVP8KeyFrame reports whether frame is a VP8 key frame (RFC 6386, 9.1).
+func IsVP8KeyFrame(frame []byte) bool {
+	return len(frame) > 0 && frame[0]&0x01 == 0
+}
+
+// IsVP9KeyFrame reports whether frame is a VP9 key frame by parsing the beginning of its
+// uncompressed header (VP9 Bitstream Specification, 6.2).
+func IsVP9KeyFrame(frame []byte) bool {
+	r := NewReader(frame)
+	if r.ReadBits(2) != 2 { // frame_marker
+		return false
+	}
+	profile := r.ReadBits(1) | r.ReadBits(1)<<1
+	if profile == 3 {
+		r.ReadBits(1) // reserved_zero
+	}
+	if r.ReadFlag() { // show_existing_frame
+		return false
+	}
+	return r.ReadBits(1) == 0 && r.err == nil // frame_type == KEY_FRAME
+}
+
+// IsH264KeyFrame reports whether the Annex-B access unit au contains an IDR picture.
+func IsH264KeyFrame(au []byte) bool {
+	for _, nalu := range SplitAnnexB(au) {
+		if len(nalu) > 0 && nalu[0]&0x1F == h264NALUTypeIDR {
+			return true
+		}
+	}
+	return false
+}
+
+// IsH265KeyFrame reports whether the Annex-B access unit au contains an IRAP picture.
+func IsH265KeyFrame(au []byte) bool {
+	for _, nalu := range SplitAnnexB(au) {
+		if len(nalu) < 2 {
+			continue
+		}
+		if typ := nalu[0] >> 1 & 0x3F; typ >= h265NALUTypeBLAWLP && typ <= h265NALUTypeRSVIRAP {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAV1KeyFrame reports whether the temporal unit tu starts with a key frame.
+func IsAV1KeyFrame(tu []byte) bool {
+	obus, err := SplitAV1OBUs(tu)
+	if err != nil {
+		return false
+	}
+
+	reducedStillPictureHeader := false
+	for _, obu := range obus {
+		switch obu.Type {
+		case AV1OBUTypeSequenceHeader:
+			r := NewReader(obu.Payload)
+			r.ReadBits(3) // seq_profile
+			r.ReadFlag()  // still_picture
+			reducedStillPictureHeader = r.ReadFlag() && r.err == nil
+		case AV1OBUTypeFrameHeader, AV1OBUTypeFrame, AV1OBUTypeRedundantFrameHeader:
+			if reducedStillPictureHeader {
+				return true
+			}
+			r := NewReader(obu.Payload)
+			if r.ReadFlag() { // show_existing_frame
+				return false
+			}
+			return r.ReadBits(2) == 0 && r.err == nil // frame_type == KEY_FRAME
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+// Package bitstream parses the parts of the video bitstreams that are needed to handle the encoded frames
+// without decoding them, e.g. to find the key frames.
+package bitstream
+
+import "errors"
+
+var errReaderEOF = errors.New("unexpected end of bitstream")
+
+// Reader reads MSB first bit fields. Reading past the end sets the error and returns zeros, so that
+// parsers only need to check Err once at the end.
+type Reader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+// NewReader creates a Reader that reads b.
+func NewReader(b []byte) *Reader {
+	return &Reader{b: b}
+}
+
+// Err returns the error of the first read past the end, if there was one.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// ReadBits reads n bits as an unsigned integer.
+func (r *Reader) ReadBits(n int) uint {
+	var v uint
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.b)*8 {
+			r.err = errReaderEOF
+			return 0
+		}
+		bit := r.b[r.pos/8] >> (7 - r.pos%8) & 1
+		v = v<<1 | uint(bit)
+		r.pos++
+	}
+	return v
+}
+
+// ReadFlag reads a bit as a boolean.
+func (r *Reader) ReadFlag() bool {
+	return r.ReadBits(1) == 1
+}
+
+// ReadUE reads an Exp-Golomb coded unsigned integer, ue(v) in the H.264 specification.
+func (r *Reader) ReadUE() uint {
+	zeros := 0
+	for !r.ReadFlag() {
+		if r.err != nil || zeros > 31 {
+			r.err = errReaderEOF
+			return 0
+		}
+		zeros++
+	}
+	return (1<<zeros - 1) + r.ReadBits(zeros)
+}
+
+// ReadUVLC reads a variable length unsigned integer, uvlc() in the AV1 specification.
+func (r *Reader) ReadUVLC() uint {
+	zeros := 0
+	for !r.ReadFlag() {
+		if r.err != nil {
+			return 0
+		}
+		zeros++
+		if zeros >= 32 {
+			return 1<<32 - 1
+		}
+	}
+	return r.ReadBits(zeros) + (1<<zeros - 1)
+}
@@ -0,0 +1,28 @@
+// Package sysfs looks up the devices of the Linux sysfs.
+package sysfs
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Dir is where sysfs is mounted.
+var Dir = "/sys"
+
+// USBDevice returns the sysfs directory of the USB device that a device belongs to, e.g. the webcam that
+// a video4linux node or a sound card is an interface of. device is the sysfs link of the device, e.g.
+// /sys/class/video4linux/video0/device. It's empty if the device isn't on USB.
+func USBDevice(device string) string {
+	dir, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return ""
+	}
+
+	// The USB devices are the ancestors of their interfaces that have a vendor ID
+	for ; dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package sysfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUSBDevice(t *testing.T) {
+	dir := t.TempDir()
+	usb := filepath.Join(dir, "devices/pci0000:00/usb1/1-2")
+	for _, path := range []string{
+		filepath.Join(usb, "1-2:1.0/video4linux/video0"),
+		filepath.Join(usb, "1-2:1.2/sound/card1"),
+		filepath.Join(dir, "devices/platform/v4l2loopback.0/video4linux/video1"),
+		filepath.Join(dir, "class/video4linux/video0"),
+		filepath.Join(dir, "class/video4linux/video1"),
+		filepath.Join(dir, "class/sound/card1"),
+	} {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(usb, "idVendor"), []byte("046d\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"class/video4linux/video0/device": "devices/pci0000:00/usb1/1-2/1-2:1.0",
+		"class/video4linux/video1/device": "devices/platform/v4l2loopback.0",
+		"class/sound/card1/device":        "devices/pci0000:00/usb1/1-2/1-2:1.2",
+	}
+	for link, target := range links {
+		if err := os.Symlink(filepath.Join(dir, target), filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	camera := USBDevice(filepath.Join(dir, "class/video4linux/video0/device"))
+	if camera == "" || camera != USBDevice(filepath.Join(dir, "class/sound/card1/device")) {
+		t.Errorf("Expected the camera and the sound card to be on the same USB device, got %q", camera)
+	}
+	if device := USBDevice(filepath.Join(dir, "class/video4linux/video1/device")); device != "" {
+		t.Errorf("Expected no USB device, got %q", device)
+	}
+	if device := USBDevice(filepath.Join(dir, "class/video4linux/video2/device")); device != "" {
+		t.Errorf("Expected no USB device for a missing device, got %q", device)
+	}
+}
@@ -1,10 +1,17 @@
 package mediadevices
 
-import "github.com/pion/mediadevices/pkg/codec"
+import (
+	"time"
+
+	"github.com/pion/mediadevices/pkg/codec"
+)
 
 type EncodedBuffer struct {
 	Data    []byte
 	Samples uint32
+	// Timestamp is the capture time of the media that Data was encoded from. It can be used
+	// as the presentation time of Data.
+	Timestamp time.Time
 }
 
 type EncodedReadCloser interface {
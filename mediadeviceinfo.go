@@ -14,8 +14,12 @@ const (
 
 // MediaDeviceInfo represents https://w3c.github.io/mediacapture-main/#dom-mediadeviceinfo
 type MediaDeviceInfo struct {
+	// DeviceID is the same across process restarts for the drivers that have a stable ID.
 	DeviceID   string
 	Kind       MediaDeviceType
 	Label      string
 	DeviceType driver.DeviceType
+	// GroupID is shared by the devices of the same physical device, e.g. the camera and the microphone
+	// of a USB webcam. It's empty if the driver doesn't know the group.
+	GroupID string
 }
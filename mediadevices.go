@@ -1,16 +1,13 @@
 package mediadevices
 
 import (
-	"fmt"
-	"math"
+	"slices"
 	"strings"
 
 	"github.com/pion/mediadevices/pkg/driver"
 	"github.com/pion/mediadevices/pkg/prop"
 )
 
-var errNotFound = fmt.Errorf("failed to find the best driver that fits the constraints")
-
 // GetDisplayMedia prompts the user to select and grant permission to capture the contents
 // of a display or portion thereof (such as a window) as a MediaStream.
 // Reference: https://developer.mozilla.org/en-US/docs/Web/API/MediaDevices/getDisplayMedia
@@ -89,22 +86,32 @@ func GetUserMedia(constraints MediaStreamConstraints) (MediaStream, error) {
 	return s, nil
 }
 
-func queryDriverProperties(filter driver.FilterFn) map[driver.Driver][]prop.Media {
+// driverProperties are the properties of a driver, or the error that it failed to open with.
+type driverProperties struct {
+	driver     driver.Driver
+	properties []prop.Media
+	// controls are the controls of the driver, which can only be found while it's open
+	controls []driver.Control
+	err      error
+}
+
+func queryDriverProperties(filter driver.FilterFn) []driverProperties {
 	var needToClose []driver.Driver
 	drivers := driver.GetManager().Query(filter)
-	m := make(map[driver.Driver][]prop.Media)
+	result := make([]driverProperties, 0, len(drivers))
 
 	for _, d := range drivers {
 		if d.Status() == driver.StateClosed {
 			err := d.Open()
 			if err != nil {
-				// Skip this driver if we failed to open because we can't get the properties
+				// The properties of this driver can't be found, so it's kept only to explain the selection
+				result = append(result, driverProperties{driver: d, err: err})
 				continue
 			}
 			needToClose = append(needToClose, d)
 		}
 
-		m[d] = d.Properties()
+		result = append(result, driverProperties{driver: d, properties: d.Properties(), controls: driverControls(d)})
 	}
 
 	for _, d := range needToClose {
@@ -112,58 +119,53 @@ func queryDriverProperties(filter driver.FilterFn) map[driver.Driver][]prop.Medi
 		d.Close()
 	}
 
-	return m
+	return result
 }
 
 // select implements SelectSettings algorithm.
 // Reference: https://w3c.github.io/mediacapture-main/#dfn-selectsettings
 func selectBestDriver(filter driver.FilterFn, constraints MediaTrackConstraints) (driver.Driver, MediaTrackConstraints, error) {
-	var bestDriver driver.Driver
-	var bestProp prop.Media
-	var foundPropertiesLog []string
-	minFitnessDist := math.Inf(1)
+	explanation := explainSelection(filter, constraints)
 
+	var foundPropertiesLog []string
 	foundPropertiesLog = append(foundPropertiesLog, "\n============ Found Properties ============")
-	driverProperties := queryDriverProperties(filter)
-	for d, props := range driverProperties {
-		priority := float64(d.Info().Priority)
-		for _, p := range props {
-			foundPropertiesLog = append(foundPropertiesLog, p.String())
-			fitnessDist, ok := constraints.MediaConstraints.FitnessDistance(p)
-			if !ok {
-				continue
-			}
-			fitnessDist -= priority
-			if fitnessDist < minFitnessDist {
-				minFitnessDist = fitnessDist
-				bestDriver = d
-				bestProp = p
-			}
-		}
+	for _, c := range explanation.Candidates {
+		foundPropertiesLog = append(foundPropertiesLog, c.Properties.String())
 	}
-
 	foundPropertiesLog = append(foundPropertiesLog, "=============== Constraints ==============")
 	foundPropertiesLog = append(foundPropertiesLog, constraints.String())
 	foundPropertiesLog = append(foundPropertiesLog, "================ Best Fit ================")
 
-	if bestDriver == nil {
-		foundPropertiesLog = append(foundPropertiesLog, "Not found")
+	if explanation.Err != nil {
+		foundPropertiesLog = append(foundPropertiesLog, explanation.Err.Error())
 		logger.Debug(strings.Join(foundPropertiesLog, "\n\n"))
-		return nil, MediaTrackConstraints{}, errNotFound
+		return nil, MediaTrackConstraints{}, explanation.Err
 	}
 
-	foundPropertiesLog = append(foundPropertiesLog, bestProp.String())
+	i := slices.IndexFunc(explanation.Candidates, func(c SelectionCandidate) bool { return c.Selected })
+	best := explanation.Candidates[i]
+	foundPropertiesLog = append(foundPropertiesLog, best.Properties.String())
 	logger.Debug(strings.Join(foundPropertiesLog, "\n\n"))
 	constraints.selectedMedia = prop.Media{}
 	constraints.selectedMedia.MergeConstraints(constraints.MediaConstraints)
-	constraints.selectedMedia.Merge(bestProp)
-	return bestDriver, constraints, nil
+	constraints.selectedMedia.Merge(best.Properties)
+	return best.driver, constraints, nil
 }
 
-func selectAudio(constraints MediaTrackConstraints, selector *CodecSelector) (Track, error) {
-	typeFilter := driver.FilterAudioRecorder()
+// audioInputFilter matches the drivers that GetUserMedia records audio from.
+func audioInputFilter() driver.FilterFn {
+	return driver.FilterAudioRecorder()
+}
 
-	d, c, err := selectBestDriver(typeFilter, constraints)
+// videoInputFilter matches the drivers that GetUserMedia records video from.
+func videoInputFilter() driver.FilterFn {
+	typeFilter := driver.FilterVideoRecorder()
+	notScreenFilter := driver.FilterNot(driver.FilterDeviceType(driver.Screen))
+	return driver.FilterAnd(typeFilter, notScreenFilter)
+}
+
+func selectAudio(constraints MediaTrackConstraints, selector *CodecSelector) (Track, error) {
+	d, c, err := selectBestDriver(audioInputFilter(), constraints)
 	if err != nil {
 		return nil, err
 	}
@@ -171,11 +173,7 @@ func selectAudio(constraints MediaTrackConstraints, selector *CodecSelector) (Tr
 	return newTrackFromDriver(d, c, selector)
 }
 func selectVideo(constraints MediaTrackConstraints, selector *CodecSelector) (Track, error) {
-	typeFilter := driver.FilterVideoRecorder()
-	notScreenFilter := driver.FilterNot(driver.FilterDeviceType(driver.Screen))
-	filter := driver.FilterAnd(typeFilter, notScreenFilter)
-
-	d, c, err := selectBestDriver(filter, constraints)
+	d, c, err := selectBestDriver(videoInputFilter(), constraints)
 	if err != nil {
 		return nil, err
 	}
@@ -201,22 +199,30 @@ func EnumerateDevices() []MediaDeviceInfo {
 		driver.FilterFn(func(driver.Driver) bool { return true }))
 	info := make([]MediaDeviceInfo, 0, len(drivers))
 	for _, d := range drivers {
-		var kind MediaDeviceType
-		switch {
-		case driver.FilterVideoRecorder()(d):
-			kind = VideoInput
-		case driver.FilterAudioRecorder()(d):
-			kind = AudioInput
-		default:
-			continue
+		if deviceInfo, ok := mediaDeviceInfo(d); ok {
+			info = append(info, deviceInfo)
 		}
-		driverInfo := d.Info()
-		info = append(info, MediaDeviceInfo{
-			DeviceID:   d.ID(),
-			Kind:       kind,
-			Label:      driverInfo.Label,
-			DeviceType: driverInfo.DeviceType,
-		})
 	}
 	return info
 }
+
+// mediaDeviceInfo returns the MediaDeviceInfo of d, or false if d isn't a media input.
+func mediaDeviceInfo(d driver.Driver) (MediaDeviceInfo, bool) {
+	var kind MediaDeviceType
+	switch {
+	case driver.FilterVideoRecorder()(d):
+		kind = VideoInput
+	case driver.FilterAudioRecorder()(d):
+		kind = AudioInput
+	default:
+		return MediaDeviceInfo{}, false
+	}
+	driverInfo := d.Info()
+	return MediaDeviceInfo{
+		DeviceID:   d.ID(),
+		Kind:       kind,
+		Label:      driverInfo.Label,
+		DeviceType: driverInfo.DeviceType,
+		GroupID:    driverInfo.GroupID,
+	}, true
+}
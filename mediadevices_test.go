@@ -240,3 +240,34 @@ func TestSelectBestDriverConstraintsNoFit(t *testing.T) {
 		})
 	}
 }
+
+func TestEnumerateDevicesGroupID(t *testing.T) {
+	const label = "EnumerateDevicesGroupID"
+	for _, stableID := range []string{"color", "infrared"} {
+		info := driver.Info{Label: label, DeviceType: driver.Camera, StableID: label + stableID, GroupID: label}
+		if err := driver.GetManager().Register(&fakeCamera{}, info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, d := range driver.GetManager().Query(func(d driver.Driver) bool { return d.Info().Label == label }) {
+			driver.GetManager().Delete(d.ID())
+		}
+	}()
+
+	var devices []MediaDeviceInfo
+	for _, device := range EnumerateDevices() {
+		if device.Label == label {
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) != 2 {
+		t.Fatalf("Expected 2 devices, got %v", devices)
+	}
+	if devices[0].GroupID == "" || devices[0].GroupID != devices[1].GroupID {
+		t.Errorf("Expected the devices to be in the same group, got %v", devices)
+	}
+	if devices[0].DeviceID == devices[1].DeviceID {
+		t.Errorf("Expected the devices to have different IDs, got %v", devices)
+	}
+}
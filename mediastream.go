@@ -3,11 +3,14 @@ package mediadevices
 import (
 	"sync"
 
+	"github.com/google/uuid"
 	"github.com/pion/webrtc/v4"
 )
 
 // MediaStream is an interface that represents a collection of existing tracks.
 type MediaStream interface {
+	// ID implements https://w3c.github.io/mediacapture-main/#dom-mediastream-id
+	ID() string
 	// GetAudioTracks implements https://w3c.github.io/mediacapture-main/#dom-mediastream-getaudiotracks
 	GetAudioTracks() []Track
 	// GetVideoTracks implements https://w3c.github.io/mediacapture-main/#dom-mediastream-getvideotracks
@@ -21,26 +24,45 @@ type MediaStream interface {
 }
 
 type mediaStream struct {
+	id     string
 	tracks map[Track]struct{}
 	l      sync.RWMutex
 }
 
+// streamIDAssigner is implemented by tracks that can be grouped into a MediaStream.
+type streamIDAssigner interface {
+	assignStreamID(id string)
+}
+
 const trackTypeDefault webrtc.RTPCodecType = 0
 
 // NewMediaStream creates a MediaStream interface that's defined in
 // https://w3c.github.io/mediacapture-main/#dom-mediastream
+// The stream gets a random ID, which is used as the StreamID of the given tracks.
 func NewMediaStream(tracks ...Track) (MediaStream, error) {
-	m := mediaStream{tracks: make(map[Track]struct{})}
+	generator, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMediaStreamWithID(generator.String(), tracks...)
+}
+
+// NewMediaStreamWithID is the same as NewMediaStream, but uses id as the stream ID instead of a random one.
+func NewMediaStreamWithID(id string, tracks ...Track) (MediaStream, error) {
+	m := mediaStream{id: id, tracks: make(map[Track]struct{})}
 
 	for _, track := range tracks {
-		if _, ok := m.tracks[track]; !ok {
-			m.tracks[track] = struct{}{}
-		}
+		m.addTrack(track)
 	}
 
 	return &m, nil
 }
 
+func (m *mediaStream) ID() string {
+	return m.id
+}
+
 func (m *mediaStream) GetAudioTracks() []Track {
 	return m.queryTracks(webrtc.RTPCodecTypeAudio)
 }
@@ -73,11 +95,18 @@ func (m *mediaStream) AddTrack(t Track) {
 	m.l.Lock()
 	defer m.l.Unlock()
 
+	m.addTrack(t)
+}
+
+func (m *mediaStream) addTrack(t Track) {
 	if _, ok := m.tracks[t]; ok {
 		return
 	}
 
 	m.tracks[t] = struct{}{}
+	if assigner, ok := t.(streamIDAssigner); ok {
+		assigner.assignStreamID(m.id)
+	}
 }
 
 func (m *mediaStream) RemoveTrack(t Track) {
@@ -114,3 +114,55 @@ func TestMediaStreamFilters(t *testing.T) {
 		expect(t, stream.GetTracks(), tracks)
 	})
 }
+
+func TestMediaStreamID(t *testing.T) {
+	newTrack := func(kind MediaDeviceType) Track {
+		return &AudioTrack{baseTrack: newBaseTrack(&mockMediaStreamTrack{kind}, kind, nil)}
+	}
+
+	t.Run("StableWithoutStream", func(t *testing.T) {
+		track := newTrack(AudioInput)
+		if track.StreamID() == "" {
+			t.Fatal("Expected a non-empty StreamID")
+		}
+		if track.StreamID() != track.StreamID() {
+			t.Error("Expected StreamID to be stable")
+		}
+	})
+
+	t.Run("NewMediaStream", func(t *testing.T) {
+		audioTrack, videoTrack := newTrack(AudioInput), newTrack(VideoInput)
+		stream, err := NewMediaStream(audioTrack, videoTrack)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stream.ID() == "" {
+			t.Fatal("Expected a non-empty stream ID")
+		}
+		if audioTrack.StreamID() != stream.ID() || videoTrack.StreamID() != stream.ID() {
+			t.Errorf("Expected tracks to be grouped by stream ID %s, got %s and %s",
+				stream.ID(), audioTrack.StreamID(), videoTrack.StreamID())
+		}
+	})
+
+	t.Run("NewMediaStreamWithID", func(t *testing.T) {
+		track := newTrack(VideoInput)
+		stream, err := NewMediaStreamWithID("my-stream")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.AddTrack(track)
+		if stream.ID() != "my-stream" || track.StreamID() != "my-stream" {
+			t.Errorf("Expected stream ID my-stream, got %s and %s", stream.ID(), track.StreamID())
+		}
+
+		// The first stream wins so that the negotiated StreamID never changes
+		other, err := NewMediaStreamWithID("other-stream", track)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if track.StreamID() != "my-stream" {
+			t.Errorf("Expected StreamID to stay my-stream after adding to %s, got %s", other.ID(), track.StreamID())
+		}
+	})
+}
@@ -15,7 +15,10 @@ func detectCurrentVideoProp(broadcaster *video.Broadcaster) (prop.Media, error)
 	// in any case.
 	metaReader := broadcaster.NewReader(false)
 	metaReader = video.DetectChanges(0, 0, func(p prop.Media) { currentProp = p })(metaReader)
-	_, _, err := metaReader.Read()
+	_, release, err := metaReader.Read()
+	if err == nil {
+		release()
+	}
 
 	return currentProp, err
 }
@@ -29,7 +32,10 @@ func detectCurrentAudioProp(broadcaster *audio.Broadcaster) (prop.Media, error)
 	// in any case.
 	metaReader := broadcaster.NewReader(false)
 	metaReader = audio.DetectChanges(0, func(p prop.Media) { currentProp = p })(metaReader)
-	_, _, err := metaReader.Read()
+	_, release, err := metaReader.Read()
+	if err == nil {
+		release()
+	}
 
 	return currentProp, err
 }
@@ -0,0 +1,333 @@
+package mediadevices
+
+import (
+	"errors"
+	"image"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/io/video"
+)
+
+const (
+	defaultCPUOveruseHighUsageThreshold = 0.85
+	defaultCPUOveruseLowUsageThreshold  = 0.42
+	defaultCPUOveruseCheckInterval      = 5 * time.Second
+	defaultCPUOveruseRampUpDelay        = 10 * time.Second
+	// cpuOveruseMaxRampUpDelayFactor bounds how much the ramp up delay grows when ramping up overuses again
+	cpuOveruseMaxRampUpDelayFactor = 8
+	// Each resolution step scales the number of pixels by 3/5 and each frame rate step scales the frame rate by
+	// 2/3, like WebRTC does.
+	cpuOveruseResolutionStep   = 5.0 / 3
+	cpuOveruseFrameRateStep    = 2.0 / 3
+	cpuOveruseResolutionSteps  = 5
+	cpuOveruseFrameRateSteps   = 6
+	cpuOveruseMinFrameRate     = 2
+	cpuOveruseSourceRateWeight = 0.1
+)
+
+var errInvalidCPUOveruseThresholds = errors.New("cpu overuse low usage threshold must be lower than the high usage threshold")
+
+// DegradationPreference defines what a video track gives up first when its encoder overuses the CPU.
+type DegradationPreference int
+
+// DegradationPreference definitions.
+const (
+	// DegradationBalanced lowers the frame rate and the resolution in turns.
+	DegradationBalanced DegradationPreference = iota
+	// DegradationMaintainFramerate lowers the resolution and keeps the frame rate.
+	DegradationMaintainFramerate
+	// DegradationMaintainResolution lowers the frame rate and keeps the resolution.
+	DegradationMaintainResolution
+)
+
+func (p DegradationPreference) String() string {
+	switch p {
+	case DegradationBalanced:
+		return "balanced"
+	case DegradationMaintainFramerate:
+		return "maintain-framerate"
+	case DegradationMaintainResolution:
+		return "maintain-resolution"
+	default:
+		return "unknown"
+	}
+}
+
+// CPUOveruseDetection configures a video track to adapt its encoders to the CPU, like WebRTC does. The encode
+// usage, which is the time spent encoding relative to the capture interval of the encoded frames, is checked
+// every CheckInterval. When it's above HighUsageThreshold, the encoder input is degraded by a step according to
+// DegradationPreference, by scaling the frames down or throttling them. When it's below LowUsageThreshold,
+// the quality is restored by a step, at most once per ramp up delay.
+type CPUOveruseDetection struct {
+	// DegradationPreference defines whether the resolution or the frame rate is lowered first. The default
+	// value is DegradationBalanced. Only the frame rate of the encoders that can't change their input size,
+	// which aren't codec.InputPropController, e.g. x264 and SVT-AV1, is lowered.
+	DegradationPreference DegradationPreference
+	// HighUsageThreshold is the encode usage above which the encoder overuses the CPU. The default value is 0.85.
+	HighUsageThreshold float64
+	// LowUsageThreshold is the encode usage below which the quality is restored. The default value is 0.42.
+	LowUsageThreshold float64
+	// CheckInterval is how long the encode usage is measured for. The default value is 5 seconds.
+	CheckInterval time.Duration
+	// RampUpDelay is how long the encoder has to stay below LowUsageThreshold after it was adapted before the
+	// quality is restored by a step. It's doubled, up to 8 times, whenever restoring the quality overuses the CPU
+	// again. The default value is 10 seconds.
+	RampUpDelay time.Duration
+}
+
+// SetCPUOveruseDetection enables CPU overuse detection for the encoders that are created by the following Bind
+// calls and NewEncodedReader calls. Passing nil disables it.
+func (track *VideoTrack) SetCPUOveruseDetection(config *CPUOveruseDetection) error {
+	if config != nil {
+		c := *config
+		if c.HighUsageThreshold <= 0 {
+			c.HighUsageThreshold = defaultCPUOveruseHighUsageThreshold
+		}
+		if c.LowUsageThreshold <= 0 {
+			c.LowUsageThreshold = defaultCPUOveruseLowUsageThreshold
+		}
+		if c.LowUsageThreshold >= c.HighUsageThreshold {
+			return errInvalidCPUOveruseThresholds
+		}
+		if c.CheckInterval <= 0 {
+			c.CheckInterval = defaultCPUOveruseCheckInterval
+		}
+		if c.RampUpDelay <= 0 {
+			c.RampUpDelay = defaultCPUOveruseRampUpDelay
+		}
+		config = &c
+	}
+
+	track.cpuOveruseMu.Lock()
+	defer track.cpuOveruseMu.Unlock()
+	track.cpuOveruse = config
+	return nil
+}
+
+func (track *VideoTrack) cpuOveruseConfig() *CPUOveruseDetection {
+	track.cpuOveruseMu.Lock()
+	defer track.cpuOveruseMu.Unlock()
+	return track.cpuOveruse
+}
+
+// overuseDetector measures the encode usage of an encoder, and degrades its input when the usage is too high.
+type overuseDetector struct {
+	config CPUOveruseDetection
+	// resizable tells whether the encoder can encode frames of another size. If it can't, only the frame rate
+	// is lowered.
+	resizable func() bool
+
+	mu sync.Mutex
+	// level is the number of degradation steps that are applied
+	level       int
+	adapted     time.Time
+	rampedUp    bool
+	rampUpDelay time.Duration
+	// sourceRate is the frame rate of the track settings, or the smoothed frame rate of the frames before
+	// they're throttled if the settings don't have one
+	sourceRate    float64
+	fixedRate     bool
+	lastSource    time.Time
+	inputRead     time.Time
+	windowStart   time.Time
+	encodeTime    time.Duration
+	frames        int
+	firstCapture  time.Time
+	lastCapture   time.Time
+	windowSkipped bool
+}
+
+// newOveruseDetector creates a detector for an encoder of a track whose settings have frameRate, which is 0 if the
+// track isn't recorded from a driver.
+func newOveruseDetector(config *CPUOveruseDetection, frameRate float32, resizable func() bool) *overuseDetector {
+	return &overuseDetector{
+		config:      *config,
+		resizable:   resizable,
+		rampUpDelay: config.RampUpDelay,
+		sourceRate:  float64(frameRate),
+		fixedRate:   frameRate > 0,
+	}
+}
+
+// preference returns the degradation preference, which maintains the resolution if the encoder can't encode
+// frames of another size.
+func (d *overuseDetector) preference() DegradationPreference {
+	if !d.resizable() {
+		return DegradationMaintainResolution
+	}
+	return d.config.DegradationPreference
+}
+
+// maxLevel returns the number of degradation steps of the preference.
+func (d *overuseDetector) maxLevel() int {
+	switch d.preference() {
+	case DegradationMaintainFramerate:
+		return cpuOveruseResolutionSteps
+	case DegradationMaintainResolution:
+		return cpuOveruseFrameRateSteps
+	default:
+		return cpuOveruseResolutionSteps + cpuOveruseFrameRateSteps
+	}
+}
+
+// steps returns the number of resolution and frame rate steps of the current level. d.mu must be held.
+func (d *overuseDetector) steps() (resolution, frameRate int) {
+	switch d.preference() {
+	case DegradationMaintainFramerate:
+		return d.level, 0
+	case DegradationMaintainResolution:
+		return 0, d.level
+	default:
+		// The frame rate goes first, since it's cheaper to restore
+		frameRate = min((d.level+1)/2, cpuOveruseFrameRateSteps)
+		return d.level - frameRate, frameRate
+	}
+}
+
+// resolutionFactor returns how much the frames are scaled down by.
+func (d *overuseDetector) resolutionFactor() float64 {
+	d.mu.Lock()
+	steps, _ := d.steps()
+	d.mu.Unlock()
+
+	// Quantize the factor to quarters to keep the frame sizes simple
+	return math.Ceil(4*math.Sqrt(math.Pow(cpuOveruseResolutionStep, float64(steps)))) / 4
+}
+
+// frameRate returns the frame rate that the frames are throttled to, or 0 if they aren't.
+func (d *overuseDetector) frameRate() float32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, steps := d.steps()
+	if steps == 0 || d.sourceRate <= 0 {
+		return 0
+	}
+	return float32(max(math.Round(d.sourceRate*math.Pow(cpuOveruseFrameRateStep, float64(steps))), cpuOveruseMinFrameRate))
+}
+
+func (d *overuseDetector) observeSource(timestamp time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.fixedRate {
+		return
+	}
+	// The frames are only read as fast as the encoder reads them, so this underestimates the frame rate of
+	// the source when the encoder is slower than it
+	if !d.lastSource.IsZero() && timestamp.After(d.lastSource) {
+		rate := 1 / timestamp.Sub(d.lastSource).Seconds()
+		if d.sourceRate <= 0 {
+			d.sourceRate = rate
+		} else {
+			d.sourceRate += cpuOveruseSourceRateWeight * (rate - d.sourceRate)
+		}
+	}
+	d.lastSource = timestamp
+}
+
+// transform degrades the frames of r with video.Throttle and video.Scale as the level changes.
+func (d *overuseDetector) transform(r video.Reader) video.Reader {
+	src := video.WithTimestamp(r)
+	observed := video.ReaderFunc(func() (image.Image, func(), error) {
+		img, timestamp, release, err := src.ReadTimestamped()
+		if err == nil {
+			d.observeSource(timestamp)
+		}
+		return img, release, err
+	})
+
+	var throttled video.Reader = observed
+	var rate float32
+	return scaleResolutionDownBy(d.resolutionFactor)(video.ReaderFunc(func() (image.Image, func(), error) {
+		if frameRate := d.frameRate(); frameRate != rate {
+			rate = frameRate
+			throttled = observed
+			if rate > 0 {
+				throttled = video.Throttle(rate)(observed)
+			}
+		}
+		return throttled.Read()
+	}))
+}
+
+// encoderInput records when the encoder gets each frame from r, and the capture time of the frame.
+func (d *overuseDetector) encoderInput(r video.Reader) video.Reader {
+	src := video.WithTimestamp(r)
+	return video.TimestampedReaderFunc(func() (image.Image, time.Time, func(), error) {
+		img, timestamp, release, err := src.ReadTimestamped()
+		if err != nil {
+			return img, timestamp, release, err
+		}
+
+		d.mu.Lock()
+		d.inputRead = time.Now()
+		if d.frames == 0 {
+			d.firstCapture = timestamp
+		}
+		d.lastCapture = timestamp
+		d.mu.Unlock()
+		return img, timestamp, release, err
+	})
+}
+
+// encoded is called when the encoder returns the frame that it read last. The encode usage is checked once
+// CheckInterval passes.
+func (d *overuseDetector) encoded(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.inputRead.IsZero() {
+		return
+	}
+	d.encodeTime += now.Sub(d.inputRead)
+	d.inputRead = time.Time{}
+	d.frames++
+
+	if d.windowStart.IsZero() {
+		d.windowStart = now
+	}
+	if now.Sub(d.windowStart) < d.config.CheckInterval {
+		return
+	}
+
+	interval := d.lastCapture.Sub(d.firstCapture)
+	frames := d.frames
+	encodeTime := d.encodeTime
+	d.windowStart = now
+	d.encodeTime = 0
+	d.frames = 0
+	if frames < 2 || interval <= 0 {
+		return
+	}
+	// The frames that were encoded with the previous level are mixed with the new ones in the window
+	// after the level changed, so it's not checked
+	if d.windowSkipped {
+		d.windowSkipped = false
+		return
+	}
+
+	usage := (encodeTime.Seconds() / float64(frames)) / (interval.Seconds() / float64(frames-1))
+	switch {
+	case usage > d.config.HighUsageThreshold && d.level < d.maxLevel():
+		if d.rampedUp && now.Sub(d.adapted) < d.rampUpDelay {
+			// Restoring the quality was too much, so wait longer before trying again
+			d.rampUpDelay = min(2*d.rampUpDelay, cpuOveruseMaxRampUpDelayFactor*d.config.RampUpDelay)
+		}
+		d.adapt(now, d.level+1, false)
+		logger.Debugf("encode usage is %.2f, degrading the video to level %d (%s)", usage, d.level, d.preference())
+	case usage < d.config.LowUsageThreshold && d.level > 0 && now.Sub(d.adapted) >= d.rampUpDelay:
+		d.adapt(now, d.level-1, true)
+		logger.Debugf("encode usage is %.2f, restoring the video to level %d (%s)", usage, d.level, d.preference())
+	}
+}
+
+// adapt changes the level. d.mu must be held.
+func (d *overuseDetector) adapt(now time.Time, level int, rampedUp bool) {
+	d.level = level
+	d.adapted = now
+	d.rampedUp = rampedUp
+	d.windowSkipped = true
+}
@@ -0,0 +1,194 @@
+package mediadevices
+
+import (
+	"encoding/binary"
+	"image"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/webrtc/v4"
+)
+
+// loadedVideoEncoder takes costPerPixel to encode each pixel, and returns the width of the frames. It encodes
+// frames of any size.
+type loadedVideoEncoder struct {
+	r            video.Reader
+	costPerPixel *atomic.Int64
+}
+
+func (e *loadedVideoEncoder) Read() ([]byte, func(), error) {
+	img, release, err := e.r.Read()
+	if err != nil {
+		return nil, func() {}, err
+	}
+	defer release()
+
+	bounds := img.Bounds()
+	time.Sleep(time.Duration(e.costPerPixel.Load() * int64(bounds.Dx()*bounds.Dy())))
+	return binary.BigEndian.AppendUint16(nil, uint16(bounds.Dx())), func() {}, nil
+}
+
+func (e *loadedVideoEncoder) Close() error                        { return nil }
+func (e *loadedVideoEncoder) Controller() codec.EncoderController { return e }
+func (e *loadedVideoEncoder) SetInputProp(prop.Media) error       { return nil }
+
+type loadedVideoEncoderBuilder struct {
+	costPerPixel atomic.Int64
+}
+
+func (b *loadedVideoEncoderBuilder) RTPCodec() *codec.RTPCodec { return codec.NewRTPVP8Codec(90000) }
+
+func (b *loadedVideoEncoderBuilder) BuildVideoEncoder(r video.Reader, p prop.Media) (codec.ReadCloser, error) {
+	return &loadedVideoEncoder{r: r, costPerPixel: &b.costPerPixel}, nil
+}
+
+func TestCPUOveruseDetection(t *testing.T) {
+	const width, height = 320, 240
+	// The camera captures a frame every 10 ms
+	const interval = 10 * time.Millisecond
+
+	testCases := map[string]struct {
+		preference DegradationPreference
+		// encodeTime is how long it takes to encode a full frame
+		encodeTime time.Duration
+		// degraded tells whether the encoder gets degraded frames of width at the mean interval
+		degraded func(width int, interval time.Duration) bool
+	}{
+		"MaintainFramerate": {
+			preference: DegradationMaintainFramerate,
+			encodeTime: 20 * time.Millisecond,
+			degraded: func(w int, _ time.Duration) bool {
+				return w < width
+			},
+		},
+		"MaintainResolution": {
+			preference: DegradationMaintainResolution,
+			encodeTime: 20 * time.Millisecond,
+			degraded: func(w int, i time.Duration) bool {
+				if w != width {
+					t.Fatalf("Expected the resolution to be maintained, got width %d", w)
+				}
+				return i > 25*time.Millisecond
+			},
+		},
+		"Balanced": {
+			preference: DegradationBalanced,
+			// Lowering the frame rate isn't enough for an encoder this slow
+			encodeTime: 40 * time.Millisecond,
+			degraded: func(w int, i time.Duration) bool {
+				return w < width && i > 12*time.Millisecond
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			builder := &loadedVideoEncoderBuilder{}
+			builder.costPerPixel.Store(int64(testCase.encodeTime / (width * height)))
+			source := &fakeTimedSource{
+				interval: interval,
+				size:     image.Rect(0, 0, width, height),
+				stamp:    func(int) time.Time { return time.Now() },
+			}
+			track := NewVideoTrack(source, NewCodecSelector(WithVideoEncoders(builder))).(*VideoTrack)
+			defer track.Close()
+
+			err := track.SetCPUOveruseDetection(&CPUOveruseDetection{
+				DegradationPreference: testCase.preference,
+				CheckInterval:         100 * time.Millisecond,
+				RampUpDelay:           200 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader, err := track.NewEncodedReader(webrtc.MimeTypeVP8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			// waitFor reads the encoded frames until cond is true for the last width and the mean capture
+			// interval of the last frames
+			waitFor := func(what string, cond func(width int, interval time.Duration) bool) {
+				t.Helper()
+
+				var timestamps []time.Time
+				deadline := time.Now().Add(10 * time.Second)
+				for time.Now().Before(deadline) {
+					buffer, release, err := reader.Read()
+					if err != nil {
+						t.Fatal(err)
+					}
+					w := int(binary.BigEndian.Uint16(buffer.Data))
+					release()
+
+					timestamps = append(timestamps, buffer.Timestamp)
+					if len(timestamps) > 8 {
+						timestamps = timestamps[1:]
+					}
+					if len(timestamps) < 8 {
+						continue
+					}
+					mean := timestamps[len(timestamps)-1].Sub(timestamps[0]) / time.Duration(len(timestamps)-1)
+					if cond(w, mean) {
+						return
+					}
+				}
+				t.Fatalf("Expected the video to be %s", what)
+			}
+
+			waitFor("degraded", testCase.degraded)
+
+			// Once the encoder is fast again, the quality is restored step by step
+			builder.costPerPixel.Store(0)
+			waitFor("restored", func(w int, i time.Duration) bool {
+				return w == width && i < 12*time.Millisecond
+			})
+		})
+	}
+}
+
+func TestOveruseDetectorFixedSize(t *testing.T) {
+	for _, preference := range []DegradationPreference{DegradationBalanced, DegradationMaintainFramerate} {
+		t.Run(preference.String(), func(t *testing.T) {
+			d := newOveruseDetector(&CPUOveruseDetection{DegradationPreference: preference}, 30, func() bool { return false })
+			if maxLevel := d.maxLevel(); maxLevel != cpuOveruseFrameRateSteps {
+				t.Errorf("Expected only the frame rate steps, got %d steps", maxLevel)
+			}
+
+			// The encoder would read past the frames if they were smaller than the ones that it's built with
+			d.level = 2
+			if factor := d.resolutionFactor(); factor != 1 {
+				t.Errorf("Expected the resolution to be maintained, got a factor of %v", factor)
+			}
+			if frameRate := d.frameRate(); frameRate != 13 {
+				t.Errorf("Expected the frame rate to be lowered by 2 steps, got %v", frameRate)
+			}
+		})
+	}
+}
+
+func TestSetCPUOveruseDetection(t *testing.T) {
+	track := NewVideoTrack(&fakeTimedSource{}, NewCodecSelector()).(*VideoTrack)
+
+	err := track.SetCPUOveruseDetection(&CPUOveruseDetection{HighUsageThreshold: 0.5, LowUsageThreshold: 0.6})
+	if err != errInvalidCPUOveruseThresholds {
+		t.Errorf("Expected %v, got %v", errInvalidCPUOveruseThresholds, err)
+	}
+	if err := track.SetCPUOveruseDetection(&CPUOveruseDetection{}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := track.cpuOveruseConfig()
+	if config.HighUsageThreshold != defaultCPUOveruseHighUsageThreshold || config.LowUsageThreshold != defaultCPUOveruseLowUsageThreshold ||
+		config.CheckInterval != defaultCPUOveruseCheckInterval || config.RampUpDelay != defaultCPUOveruseRampUpDelay {
+		t.Errorf("Expected the default values to be set, got %+v", config)
+	}
+	if config.DegradationPreference.String() != "balanced" {
+		t.Errorf("Expected balanced degradation by default, got %s", config.DegradationPreference)
+	}
+}
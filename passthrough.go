@@ -0,0 +1,266 @@
+package mediadevices
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/mediadevices/internal/bitstream"
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+const (
+	// passthroughKeyFrameTimeout is how long a negotiated H.264 reader waits for the first IDR access unit,
+	// which tells the profile of the stream, before the frames are encoded instead
+	passthroughKeyFrameTimeout = 2 * time.Second
+	h264NALUTypeSPS            = 7
+)
+
+var errPassthroughKeyFrameTimeout = errors.New("no key frame came in time")
+
+// h264Profile is a profile of H.264 as WebRTC tells them apart.
+type h264Profile int
+
+const (
+	h264ProfileConstrainedBaseline h264Profile = iota
+	h264ProfileBaseline
+	h264ProfileMain
+	h264ProfileConstrainedHigh
+	h264ProfileHigh
+	h264ProfilePredictiveHigh444
+)
+
+// h264ProfilePatterns maps profile_idc and the constraint flags of profile-level-id to the profiles, where the
+// flags match if flags&mask == value. The first pattern that matches is the profile.
+var h264ProfilePatterns = []struct {
+	profileIDC  byte
+	mask, value byte
+	profile     h264Profile
+}{
+	{0x42, 0x4F, 0x40, h264ProfileConstrainedBaseline},
+	{0x4D, 0x8F, 0x80, h264ProfileConstrainedBaseline},
+	{0x58, 0xCF, 0xC0, h264ProfileConstrainedBaseline},
+	{0x42, 0x4F, 0x00, h264ProfileBaseline},
+	{0x58, 0xCF, 0x80, h264ProfileBaseline},
+	{0x4D, 0xAF, 0x00, h264ProfileMain},
+	{0x64, 0xFF, 0x00, h264ProfileHigh},
+	{0x64, 0xFF, 0x0C, h264ProfileConstrainedHigh},
+	{0xF4, 0xFF, 0x00, h264ProfilePredictiveHigh444},
+}
+
+// passthroughCodecs are the codecs that send the compressed frames of the drivers as they are.
+var passthroughCodecs = map[frame.Format]func() *codec.RTPCodec{
+	frame.FormatMJPEG: func() *codec.RTPCodec { return codec.NewRTPJPEGCodec(90000) },
+	frame.FormatH264:  func() *codec.RTPCodec { return codec.NewRTPH264Codec(90000) },
+}
+
+// newPassthroughReader reads the compressed frames that the driver of the track records, if one of
+// codecNames is their codec, so that they're sent without being decoded and encoded again. The frames
+// are only passed through if the track doesn't crop, scale or throttle them, and if the peer connection
+// negotiated fmtp that they fit, which is checked with the first key frame for H.264. The transforms of the track
+// are only applied to its decoded frames. The third return value is false if the frames can't be passed
+// through.
+//
+// The camera can't be asked for key frames, so the key frame requests of the peer connections are ignored.
+// A new reader skips the frames until the next key frame, e.g. the next IDR access unit of H.264, since the
+// frames before it can't be decoded. The camera has to send key frames periodically.
+func (track *VideoTrack) newPassthroughReader(fmtp string, codecNames ...string) (EncodedReadCloser, *codec.RTPCodec, bool) {
+	if track.capture == nil {
+		return nil, nil, false
+	}
+	native, ok := track.capture.untransformed()
+	if !ok {
+		return nil, nil, false
+	}
+	newCodec, ok := passthroughCodecs[native.FrameFormat]
+	if !ok {
+		return nil, nil, false
+	}
+	selectedCodec := newCodec()
+	matches := func(name string) bool {
+		// MimeType is formated as "video/<codecName>"
+		return strings.HasSuffix(strings.ToLower(selectedCodec.MimeType), strings.ToLower(name))
+	}
+	if !slices.ContainsFunc(codecNames, matches) {
+		return nil, nil, false
+	}
+
+	recorder, ok := track.capture.driver.(driver.EncodedVideoRecorder)
+	if !ok {
+		return nil, nil, false
+	}
+	reader, err := recorder.EncodedVideoRecord(native)
+	if err != nil {
+		logger.Debugf("failed to pass %s frames through: %v", native.FrameFormat, err)
+		return nil, nil, false
+	}
+
+	// The frames that the peer connection can't decode are encoded instead. The key frame that tells it is
+	// sent first.
+	var first []byte
+	var firstTimestamp time.Time
+	if fmtp != "" && native.FrameFormat == frame.FormatH264 {
+		au, timestamp, sps, err := readH264KeyFrame(reader)
+		if err != nil {
+			logger.Debugf("failed to pass H.264 frames through: %v", err)
+			return nil, nil, false
+		}
+		if !h264FmtpMatches(fmtp, sps) {
+			logger.Debugf("H.264 frames of the camera don't fit %q, encoding them instead", fmtp)
+			return nil, nil, false
+		}
+		first, firstTimestamp = au, timestamp
+	}
+
+	sample := newVideoSampler(selectedCodec.ClockRate)
+	var closed atomic.Bool
+	// The frames of the codecs that can't be parsed, e.g. JPEG, are all taken as key frames
+	isKeyFrame := bitstream.KeyFrameDetector(selectedCodec.MimeType)
+	waitKeyFrame := isKeyFrame != nil && first == nil
+
+	return &encodedReadCloserImpl{
+		readFn: func() (EncodedBuffer, func(), error) {
+			if closed.Load() {
+				return EncodedBuffer{}, func() {}, io.EOF
+			}
+			var data []byte
+			var timestamp time.Time
+			var err error
+			if first != nil {
+				data, timestamp, first = first, firstTimestamp, nil
+			} else {
+				data, timestamp, err = reader.Read()
+			}
+			for err == nil && waitKeyFrame && !isKeyFrame(data) {
+				data, timestamp, err = reader.Read()
+			}
+			if err != nil {
+				return EncodedBuffer{}, func() {}, track.capture.readError(err)
+			}
+			waitKeyFrame = false
+			buffer := EncodedBuffer{
+				Data:      data,
+				Samples:   sample(timestamp),
+				Timestamp: timestamp,
+			}
+			return buffer, func() {}, nil
+		},
+		closeFn: func() error {
+			closed.Store(true)
+			return nil
+		},
+		// The frames aren't encoded by the track, so there's nothing to control. Drivers can't force key
+		// frames through driver.EncodedVideoRecorder.
+		controllerFn: func() codec.EncoderController { return nil },
+	}, selectedCodec, true
+}
+
+// untransformed returns the properties that the driver records with, if c reads the recording as it is.
+func (c *capture) untransformed() (prop.Media, bool) {
+	sharedDevicesMu.Lock()
+	defer sharedDevicesMu.Unlock()
+
+	device, ok := sharedDevices[c.driver]
+	if !ok || c.closed || c.settings != device.native {
+		return prop.Media{}, false
+	}
+	return device.native, true
+}
+
+// readH264KeyFrame reads r until an IDR access unit, and returns it with the last SPS that came with it or
+// before it, which is nil if there wasn't one. It gives up after passthroughKeyFrameTimeout.
+func readH264KeyFrame(r driver.EncodedVideoReader) (au []byte, timestamp time.Time, sps []byte, err error) {
+	type result struct {
+		au, sps   []byte
+		timestamp time.Time
+		err       error
+	}
+	done := make(chan struct{})
+	defer close(done)
+	resultCh := make(chan result, 1)
+
+	go func() {
+		var sps []byte
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			au, timestamp, err := r.Read()
+			if err != nil {
+				resultCh <- result{err: err}
+				return
+			}
+			for _, nalu := range bitstream.SplitAnnexB(au) {
+				if len(nalu) > 3 && nalu[0]&0x1F == h264NALUTypeSPS {
+					sps = nalu
+				}
+			}
+			if bitstream.IsH264KeyFrame(au) {
+				resultCh <- result{au: au, sps: sps, timestamp: timestamp}
+				return
+			}
+		}
+	}()
+
+	select {
+	case res := <-resultCh:
+		return res.au, res.timestamp, res.sps, res.err
+	case <-time.After(passthroughKeyFrameTimeout):
+		return nil, time.Time{}, nil, errPassthroughKeyFrameTimeout
+	}
+}
+
+// h264FmtpMatches checks if a stream whose SPS is sps can be sent to a peer connection that negotiated fmtp.
+// Like WebRTC, the profiles have to be the same, and the level isn't compared. The access units are
+// packetized with fragmentation units, which need packetization-mode 1.
+func h264FmtpMatches(fmtp string, sps []byte) bool {
+	params := parseFmtp(fmtp)
+	if params["packetization-mode"] != "1" || len(sps) < 3 {
+		return false
+	}
+	profileLevelID, ok := params["profile-level-id"]
+	if !ok {
+		// The default of RFC 6184, the baseline profile at level 1
+		profileLevelID = "42000a"
+	}
+	b, err := hex.DecodeString(profileLevelID)
+	if err != nil || len(b) != 3 {
+		return false
+	}
+
+	negotiated, ok := parseH264Profile(b[0], b[1])
+	if !ok {
+		return false
+	}
+	stream, ok := parseH264Profile(sps[1], sps[2])
+	return ok && stream == negotiated
+}
+
+func parseH264Profile(profileIDC, constraintFlags byte) (h264Profile, bool) {
+	for _, p := range h264ProfilePatterns {
+		if p.profileIDC == profileIDC && constraintFlags&p.mask == p.value {
+			return p.profile, true
+		}
+	}
+	return 0, false
+}
+
+// parseFmtp parses the format parameters of an SDP fmtp line, whose keys are lower cased.
+func parseFmtp(line string) map[string]string {
+	params := make(map[string]string)
+	for _, param := range strings.Split(line, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		params[strings.ToLower(key)] = value
+	}
+	return params
+}
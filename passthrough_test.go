@@ -0,0 +1,253 @@
+package mediadevices
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+// h264Stream is a canned H.264 stream, an IDR access unit with its parameter sets followed by a P
+// access unit.
+var h264Stream = [][]byte{
+	{
+		0, 0, 0, 1, 0x67, 0x42, 0xc0, 0x1f, 0xda, 0x01, 0x40, 0x16, 0xe8,
+		0, 0, 0, 1, 0x68, 0xce, 0x3c, 0x80,
+		0, 0, 0, 1, 0x65, 0x88, 0x84, 0x00, 0x33, 0xff, 0xfe, 0xf6, 0xf0, 0xfe, 0x05, 0x36,
+	},
+	{0, 0, 0, 1, 0x41, 0x9a, 0x21, 0x6c, 0x42, 0xbf, 0xfe, 0x38, 0x40},
+}
+
+// fakeEncodedCamera is a fakeCamera that also records MJPEG and H.264 frames.
+type fakeEncodedCamera struct {
+	fakeCamera
+}
+
+func (c *fakeEncodedCamera) Properties() []prop.Media {
+	return append(c.fakeCamera.Properties(),
+		prop.Media{Video: prop.Video{Width: 640, Height: 480, FrameRate: 30, FrameFormat: frame.FormatMJPEG}},
+		prop.Media{Video: prop.Video{Width: 640, Height: 480, FrameRate: 30, FrameFormat: frame.FormatH264}},
+	)
+}
+
+func (c *fakeEncodedCamera) EncodedVideoRecord(p prop.Media) (driver.EncodedVideoReader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = append(c.records, p)
+	closed := c.closed
+
+	frames := h264Stream
+	if p.FrameFormat == frame.FormatMJPEG {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, p.Width, p.Height)), nil); err != nil {
+			return nil, err
+		}
+		frames = [][]byte{buf.Bytes()}
+	}
+
+	var n int
+	return driver.EncodedVideoReaderFunc(func() ([]byte, time.Time, error) {
+		select {
+		case <-closed:
+			return nil, time.Time{}, io.EOF
+		case <-time.After(time.Millisecond):
+		}
+		data := frames[n%len(frames)]
+		n++
+		return data, time.Now(), nil
+	}), nil
+}
+
+func registerFakeEncodedCamera(t *testing.T) (driver.Driver, *fakeEncodedCamera) {
+	t.Helper()
+
+	camera := &fakeEncodedCamera{}
+	if err := driver.GetManager().Register(camera, driver.Info{Label: t.Name(), DeviceType: driver.Camera}); err != nil {
+		t.Fatal(err)
+	}
+	d := driver.GetManager().Query(func(d driver.Driver) bool { return d.Info().Label == t.Name() })[0]
+	t.Cleanup(func() { driver.GetManager().Delete(d.ID()) })
+	return d, camera
+}
+
+func TestPassthroughH264(t *testing.T) {
+	d, camera := registerFakeEncodedCamera(t)
+
+	// H.264 can't be decoded, so it's only recorded when it's asked for
+	track := newFakeCameraTrack(t, d, nil, func(c *MediaTrackConstraints) {})
+	if format := camera.records[0].FrameFormat; format != frame.FormatI420 {
+		t.Errorf("Expected %s frames to be recorded by default, got %s", frame.FormatI420, format)
+	}
+	track.Close()
+
+	track = newFakeCameraTrack(t, d, nil, func(c *MediaTrackConstraints) {
+		c.FrameFormat = prop.FrameFormatExact(frame.FormatH264)
+	})
+
+	r, err := track.NewEncodedReader("H264")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := 0; i < 2*len(h264Stream); i++ {
+		buffer, _, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := h264Stream[i%len(h264Stream)]; !bytes.Equal(expected, buffer.Data) {
+			t.Errorf("Expected access unit %d to be passed through, got %x", i, buffer.Data)
+		}
+	}
+
+	if _, err := track.NewEncodedReader("VP8"); err == nil {
+		t.Error("Expected the frames not to be encoded with other codecs")
+	}
+
+	rtpReader, err := track.NewRTPReader("video/H264", 1, 1200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rtpReader.Close()
+	// The reader starts with the next IDR access unit
+	var depacketized [][]byte
+	for len(depacketized) < 2 {
+		pkts, _, err := rtpReader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var h264 codecs.H264Packet
+		var au []byte
+		for _, pkt := range pkts {
+			data, err := h264.Unmarshal(pkt.Payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			au = append(au, data...)
+		}
+		if !pkts[len(pkts)-1].Marker {
+			t.Error("Expected the last packet of the access unit to be marked")
+		}
+		depacketized = append(depacketized, au)
+	}
+	for i, au := range depacketized {
+		if !bytes.Equal(au, h264Stream[i]) {
+			t.Errorf("Expected the packets to carry access unit %d of the stream, got %x", i, au)
+		}
+	}
+}
+
+func TestPassthroughH264Fmtp(t *testing.T) {
+	testCases := map[string]struct {
+		fmtp        string
+		passthrough bool
+	}{
+		"Matching": {
+			fmtp:        "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+			passthrough: true,
+		},
+		// The level isn't compared
+		"OtherLevel": {
+			fmtp:        "packetization-mode=1;profile-level-id=42e034",
+			passthrough: true,
+		},
+		"SingleNALUnitMode": {
+			fmtp: "level-asymmetry-allowed=1;profile-level-id=42e01f",
+		},
+		"OtherProfile": {
+			fmtp: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640c1f",
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			d, _ := registerFakeEncodedCamera(t)
+			track := newFakeCameraTrack(t, d, nil, func(c *MediaTrackConstraints) {
+				c.FrameFormat = prop.FrameFormatExact(frame.FormatH264)
+			})
+
+			r, err := track.newRTPReader(track, webrtc.RTPCodecParameters{
+				RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000, SDPFmtpLine: testCase.fmtp},
+				PayloadType:        102,
+			}, 1)
+			if !testCase.passthrough {
+				// There's no H.264 encoder to fall back to
+				if err == nil {
+					r.Close()
+					t.Fatal("Expected the frames not to be passed through")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			pkts, _, err := r.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var h264 codecs.H264Packet
+			var au []byte
+			for _, pkt := range pkts {
+				data, err := h264.Unmarshal(pkt.Payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				au = append(au, data...)
+			}
+			if !bytes.Equal(au, h264Stream[0]) {
+				t.Errorf("Expected the IDR access unit that was checked to be sent first, got %x", au)
+			}
+		})
+	}
+}
+
+func TestPassthroughMJPEG(t *testing.T) {
+	d, camera := registerFakeEncodedCamera(t)
+	track := newFakeCameraTrack(t, d, nil, func(c *MediaTrackConstraints) {
+		c.FrameFormat = prop.FrameFormatExact(frame.FormatMJPEG)
+	})
+
+	r, err := track.NewEncodedReader("JPEG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	buffer, _, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(buffer.Data)); err != nil {
+		t.Errorf("Expected JPEG frames, got %v", err)
+	}
+
+	// The decoded frames come from the same recording
+	img, _, err := track.NewReader(false).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(640, 480) {
+		t.Errorf("Expected decoded frames of 640x480, got %v", size)
+	}
+	if n := camera.recordCount(); n != 1 {
+		t.Errorf("Expected the camera to be recorded once, got %d", n)
+	}
+
+	// Scaled frames have to be encoded again
+	if err := track.ApplyConstraints(func(c *MediaTrackConstraints) {
+		c.FrameFormat = prop.FrameFormatExact(frame.FormatMJPEG)
+		c.Width = prop.IntExact(320)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := track.NewEncodedReader("JPEG"); err == nil {
+		t.Error("Expected scaled frames not to be passed through")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/pion/mediadevices/pkg/io/audio"
 	"github.com/pion/mediadevices/pkg/io/video"
 	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/wave"
 	"github.com/pion/rtp"
 	"github.com/pion/rtp/codecs"
 	"github.com/pion/webrtc/v4"
@@ -155,15 +156,45 @@ type ReadCloser interface {
 	Controllable
 }
 
+// VideoDecoderBuilder is the interface that wraps basic operations that are
+// necessary to build the video decoder.
+//
+// This interface is for codec implementors to provide codec specific params,
+// but still giving generality for the users.
 type VideoDecoderBuilder interface {
+	// RTPCodec represents the codec metadata
+	RTPCodec() *RTPCodec
+	// BuildVideoDecoder builds video decoder by given media params and encoded input.
+	// Every read from r must return a single encoded frame.
 	BuildVideoDecoder(r io.Reader, p prop.Media) (VideoDecoder, error)
 }
 
+// VideoDecoder reads the decoded frames of an encoded input.
 type VideoDecoder interface {
 	Read() (image.Image, func(), error)
 	Close() error
 }
 
+// AudioDecoderBuilder is the interface that wraps basic operations that are
+// necessary to build the audio decoder.
+//
+// This interface is for codec implementors to provide codec specific params,
+// but still giving generality for the users.
+type AudioDecoderBuilder interface {
+	// RTPCodec represents the codec metadata
+	RTPCodec() *RTPCodec
+	// BuildAudioDecoder builds audio decoder by given media params and encoded input.
+	// Every read from r must return a single encoded frame. A read of zero bytes
+	// without an error signals a lost frame, which the decoder conceals if it can.
+	BuildAudioDecoder(r io.Reader, p prop.Media) (AudioDecoder, error)
+}
+
+// AudioDecoder reads the decoded chunks of an encoded input.
+type AudioDecoder interface {
+	Read() (wave.Audio, func(), error)
+	Close() error
+}
+
 // EncoderController is the interface allowing to control the encoder behaviour after it's initialisation.
 // It will possibly have common control method in the future.
 // A controller can have optional methods represented by *Controller interfaces
@@ -190,6 +221,16 @@ type BitRateController interface {
 	SetBitRate(int) error
 }
 
+// InputPropController is a interface representing an encoder that can be told that the properties of
+// its input have changed, e.g. when the constraints of the track are changed while it's being encoded.
+// The encoders that implement it encode frames of any size. The frames of the others are kept at the
+// size that they're built with.
+type InputPropController interface {
+	EncoderController
+	// SetInputProp updates the input properties. The next frames that are read may already have them.
+	SetInputProp(prop.Media) error
+}
+
 type QPController interface {
 	EncoderController
 	// DynamicQPControl adjusts the QP of the encoder based on the current and target bitrate
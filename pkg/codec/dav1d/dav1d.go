@@ -0,0 +1,166 @@
+// Package dav1d implements AV1 decoder.
+// This package requires libdav1d headers and libraries to be built.
+package dav1d
+
+// #cgo pkg-config: dav1d
+// #include <errno.h>
+// #include <string.h>
+// #include <dav1d/dav1d.h>
+//
+// // DAV1D_ERR is a macro, so it can't be used from cgo
+// static int errAgain() {
+//   return DAV1D_ERR(EAGAIN);
+// }
+//
+// // Copies an encoded frame to a buffer allocated by dav1d
+// static int dataCreate(Dav1dData *data, const uint8_t *buf, size_t size) {
+//   uint8_t *dst = dav1d_data_create(data, size);
+//   if (dst == NULL)
+//     return DAV1D_ERR(ENOMEM);
+//   memcpy(dst, buf, size);
+//   return 0;
+// }
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"sync"
+	"unsafe"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+const (
+	// decoderBufferSize is the initial size of the buffer a temporal unit is read to. It's doubled whenever
+	// a temporal unit doesn't fit, up to decoderMaxBufferSize.
+	decoderBufferSize    = 1024 * 1024
+	decoderMaxBufferSize = 64 * 1024 * 1024
+)
+
+// ErrUnsupportedPixelFormat is returned when a decoded picture isn't 8 bits 4:2:0.
+var ErrUnsupportedPixelFormat = errors.New("dav1d: only 8 bits 4:2:0 pictures are supported")
+
+type decoder struct {
+	ctx *C.Dav1dContext
+	// data is the part of the last temporal unit that the decoder hasn't consumed yet.
+	data C.Dav1dData
+	r    io.Reader
+	buf  []byte
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newDecoder(r io.Reader, p prop.Media, params Params) (codec.VideoDecoder, error) {
+	var settings C.Dav1dSettings
+	C.dav1d_default_settings(&settings)
+	settings.n_threads = C.int(params.Threads)
+	// Pictures are output as soon as they're decoded
+	settings.max_frame_delay = 1
+
+	d := &decoder{
+		r:   r,
+		buf: make([]byte, decoderBufferSize),
+	}
+	if ret := C.dav1d_open(&d.ctx, &settings); ret < 0 {
+		return nil, fmt.Errorf("dav1d_open failed: %d", ret)
+	}
+	return d, nil
+}
+
+func (d *decoder) Read() (image.Image, func(), error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, func() {}, io.EOF
+	}
+
+	for {
+		if d.data.sz > 0 {
+			// The decoder may not consume everything if a picture has to be output first
+			if ret := C.dav1d_send_data(d.ctx, &d.data); ret < 0 && ret != C.errAgain() {
+				C.dav1d_data_unref(&d.data)
+				return nil, func() {}, fmt.Errorf("dav1d_send_data failed: %d", ret)
+			}
+		}
+
+		var pic C.Dav1dPicture
+		ret := C.dav1d_get_picture(d.ctx, &pic)
+		if ret == 0 {
+			img, err := toImage(&pic)
+			C.dav1d_picture_unref(&pic)
+			if err != nil {
+				return nil, func() {}, err
+			}
+			return img, func() {}, nil
+		}
+		if ret != C.errAgain() {
+			return nil, func() {}, fmt.Errorf("dav1d_get_picture failed: %d", ret)
+		}
+		if d.data.sz > 0 {
+			continue
+		}
+
+		n, err := d.r.Read(d.buf)
+		if errors.Is(err, io.ErrShortBuffer) && len(d.buf) < decoderMaxBufferSize {
+			// The reader keeps the frame, it's read again with a larger buffer
+			d.buf = make([]byte, 2*len(d.buf))
+			continue
+		}
+		if err != nil {
+			return nil, func() {}, err
+		}
+		if n == 0 {
+			continue
+		}
+		if ret := C.dataCreate(&d.data, (*C.uint8_t)(unsafe.Pointer(&d.buf[0])), C.size_t(n)); ret < 0 {
+			return nil, func() {}, fmt.Errorf("dav1d_data_create failed: %d", ret)
+		}
+	}
+}
+
+// toImage copies pic, which is owned by the decoder.
+func toImage(pic *C.Dav1dPicture) (image.Image, error) {
+	if pic.p.layout != C.DAV1D_PIXEL_LAYOUT_I420 || pic.p.bpc != 8 {
+		return nil, ErrUnsupportedPixelFormat
+	}
+
+	w, h := int(pic.p.w), int(pic.p.h)
+	cw, ch := (w+1)/2, (h+1)/2
+	yStride, cStride := int(pic.stride[0]), int(pic.stride[1])
+	ySrc := unsafe.Slice((*byte)(pic.data[0]), yStride*h)
+	uSrc := unsafe.Slice((*byte)(pic.data[1]), cStride*ch)
+	vSrc := unsafe.Slice((*byte)(pic.data[2]), cStride*ch)
+
+	img := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio420)
+	for r := 0; r < h; r++ {
+		copy(img.Y[r*img.YStride:r*img.YStride+w], ySrc[r*yStride:])
+	}
+	for r := 0; r < ch; r++ {
+		copy(img.Cb[r*img.CStride:r*img.CStride+cw], uSrc[r*cStride:])
+		copy(img.Cr[r*img.CStride:r*img.CStride+cw], vSrc[r*cStride:])
+	}
+	return img, nil
+}
+
+func (d *decoder) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil
+	}
+
+	d.closed = true
+
+	if d.data.sz > 0 {
+		C.dav1d_data_unref(&d.data)
+	}
+	C.dav1d_close(&d.ctx)
+	return nil
+}
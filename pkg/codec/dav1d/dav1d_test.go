@@ -0,0 +1,95 @@
+package dav1d
+
+import (
+	"image"
+	"io"
+	"testing"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/codec/svtav1"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+func TestShouldImplementVideoDecoderBuilder(t *testing.T) {
+	var _ codec.VideoDecoderBuilder = &Params{}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	const width, height, totalFrames = 256, 144, 10
+
+	property := prop.Media{
+		Video: prop.Video{
+			Width:       width,
+			Height:      height,
+			FrameRate:   30,
+			FrameFormat: frame.FormatI420,
+		},
+	}
+
+	encoderParams, err := svtav1.NewParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoderParams.BitRate = 200000
+	var cnt int
+	encoder, err := encoderParams.BuildVideoEncoder(video.ReaderFunc(func() (image.Image, func(), error) {
+		cnt++
+		if cnt > totalFrames {
+			return nil, func() {}, io.EOF
+		}
+		return image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420), func() {}, nil
+	}), property)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+
+	p, err := NewParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, writer := io.Pipe()
+	decoder, err := p.BuildVideoDecoder(reader, property)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.Close()
+
+	go func() {
+		for {
+			b, release, err := encoder.Read()
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			if len(b) > 0 {
+				_, err = writer.Write(b)
+			}
+			release()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	decoded := 0
+	for {
+		img, release, err := decoder.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != width || img.Bounds().Dy() != height {
+			t.Errorf("Expected %dx%d, got %v", width, height, img.Bounds())
+		}
+		release()
+		decoded++
+	}
+	if decoded == 0 {
+		t.Error("No frame was decoded")
+	}
+}
@@ -0,0 +1,31 @@
+package dav1d
+
+import (
+	"io"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+// Params stores dav1d specific decoding parameters.
+type Params struct {
+	// Threads is the number of threads used by the decoder. 0 lets dav1d pick it from the number
+	// of CPUs.
+	Threads int
+}
+
+// NewParams returns default dav1d codec specific parameters.
+func NewParams() (Params, error) {
+	return Params{}, nil
+}
+
+// RTPCodec represents the codec metadata
+func (p *Params) RTPCodec() *codec.RTPCodec {
+	return codec.NewRTPAV1Codec(90000)
+}
+
+// BuildVideoDecoder builds dav1d decoder with given params.
+// Every read from r must return a single temporal unit.
+func (p *Params) BuildVideoDecoder(r io.Reader, property prop.Media) (codec.VideoDecoder, error) {
+	return newDecoder(r, property, *p)
+}
@@ -157,3 +157,73 @@ func VideoEncoderReadAfterCloseTest(t *testing.T, c codec.VideoEncoderBuilder, p
 		t.Fatalf("Expected: %v, got: %v", io.EOF, err)
 	}
 }
+
+// frameReader returns a single frame per read. nil frames are returned as lost frames.
+type frameReader struct {
+	frames [][]byte
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	if len(r.frames) == 0 {
+		return 0, io.EOF
+	}
+	frame := r.frames[0]
+	if len(frame) > len(p) {
+		return 0, io.ErrShortBuffer
+	}
+	r.frames = r.frames[1:]
+	return copy(p, frame), nil
+}
+
+// AudioEncodeDecodeTest encodes 16 chunks w, and decodes them back. lost is the index of a frame that
+// is dropped before decoding, to be concealed by the decoder, or -1.
+func AudioEncodeDecodeTest(t *testing.T, e codec.AudioEncoderBuilder, d codec.AudioDecoderBuilder, p prop.Media, w wave.Audio, lost int) {
+	enc, err := e.BuildAudioEncoder(audio.ReaderFunc(func() (wave.Audio, func(), error) {
+		return w, func() {}, nil
+	}), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := make([][]byte, 16)
+	for i := range frames {
+		b, release, err := enc.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames[i] = append([]byte{}, b...)
+		release()
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if lost >= 0 {
+		frames[lost] = nil
+	}
+
+	dec, err := d.BuildAudioDecoder(&frameReader{frames: frames}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range frames {
+		chunk, release, err := dec.Read()
+		if err != nil {
+			t.Fatalf("Failed to decode frame %d: %v", i, err)
+		}
+		info := chunk.ChunkInfo()
+		if info != w.ChunkInfo() {
+			t.Errorf("Expected decoded chunk %d to be %+v, got %+v", i, w.ChunkInfo(), info)
+		}
+		release()
+	}
+	if _, _, err := dec.Read(); err != io.EOF {
+		t.Fatalf("Expected EOF, got %v", err)
+	}
+
+	if err := assertNoPanic(t, dec.Close, "on first Close()"); err != nil {
+		t.Fatal(err)
+	}
+	if err := assertNoPanic(t, dec.Close, "on second Close()"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,204 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// MimeTypeJPEG is the MIME type of JPEG over RTP, which webrtc doesn't define.
+const MimeTypeJPEG = "video/JPEG"
+
+// The markers of the JPEG segments that jpegPayloader reads.
+const (
+	jpegMarkerSOI  = 0xd8
+	jpegMarkerEOI  = 0xd9
+	jpegMarkerSOF0 = 0xc0
+	jpegMarkerDHT  = 0xc4
+	jpegMarkerDQT  = 0xdb
+	jpegMarkerDRI  = 0xdd
+	jpegMarkerSOS  = 0xda
+	jpegMarkerRST0 = 0xd0
+	jpegMarkerRST7 = 0xd7
+	// jpegQDynamic tells that the quantization tables are sent in the first packet of each frame
+	jpegQDynamic = 255
+	// jpegTypeRestart is added to the type when the frame has restart markers
+	jpegTypeRestart = 64
+)
+
+var (
+	errInvalidJPEG     = errors.New("invalid JPEG")
+	errUnsupportedJPEG = errors.New("only baseline YUV 4:2:2 and 4:2:0 JPEG with 8-bit tables can be sent over RTP")
+)
+
+// NewRTPJPEGCodec is a helper to create a JPEG codec, which sends JPEG images, e.g. the frames of MJPEG
+// cameras, as they are. RFC 2435 uses a clock rate of 90000.
+func NewRTPJPEGCodec(clockrate uint32) *RTPCodec {
+	return &RTPCodec{
+		RTPCodecParameters: webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:     MimeTypeJPEG,
+				ClockRate:    clockrate,
+				Channels:     0,
+				SDPFmtpLine:  "",
+				RTCPFeedback: nil,
+			},
+			PayloadType: 26,
+		},
+		Payloader: &jpegPayloader{},
+	}
+}
+
+// jpegPayloader payloads JPEG images. The headers of the images are replaced by the RTP JPEG headers,
+// which tell the receivers how to rebuild them, so only the images that they can rebuild are sent. The
+// others are dropped.
+// Reference: https://www.rfc-editor.org/rfc/rfc2435
+type jpegPayloader struct{}
+
+// jpegFrame is a JPEG image that's parsed to be sent over RTP.
+type jpegFrame struct {
+	typ uint8
+	// width and height are in 8 pixel blocks
+	width, height   uint8
+	restartInterval uint16
+	// quantTables are the tables of the luma and the chroma
+	quantTables []byte
+	// scan is the entropy-coded data
+	scan []byte
+}
+
+func (p *jpegPayloader) Payload(mtu uint16, payload []byte) [][]byte {
+	f, err := parseJPEG(payload)
+	if err != nil {
+		return nil
+	}
+
+	var packets [][]byte
+	for offset := 0; offset < len(f.scan); {
+		header := []byte{0, byte(offset >> 16), byte(offset >> 8), byte(offset), f.typ, jpegQDynamic, f.width, f.height}
+		if f.restartInterval > 0 {
+			// The restart markers aren't tracked, so the packets are marked as both the first and the last
+			// ones of a chunk, with a restart count of 0x3fff
+			header = binary.BigEndian.AppendUint16(header, f.restartInterval)
+			header = append(header, 0xff, 0xff)
+		}
+		if offset == 0 {
+			header = append(header, 0, 0)
+			header = binary.BigEndian.AppendUint16(header, uint16(len(f.quantTables)))
+			header = append(header, f.quantTables...)
+		}
+
+		n := min(int(mtu)-len(header), len(f.scan)-offset)
+		if n <= 0 {
+			return nil
+		}
+		packet := make([]byte, len(header)+n)
+		copy(packet, header)
+		copy(packet[len(header):], f.scan[offset:offset+n])
+		packets = append(packets, packet)
+		offset += n
+	}
+	return packets
+}
+
+// parseJPEG finds the type, the size, the quantization tables, and the entropy-coded data of a JPEG image.
+func parseJPEG(data []byte) (*jpegFrame, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != jpegMarkerSOI {
+		return nil, errInvalidJPEG
+	}
+
+	var f jpegFrame
+	var tableIDs []byte
+	tables := make(map[byte][]byte)
+	for i := 2; i+1 < len(data); {
+		if data[i] != 0xff {
+			return nil, errInvalidJPEG
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xff:
+			// Fill bytes
+			i++
+			continue
+		case marker == jpegMarkerSOI, marker >= jpegMarkerRST0 && marker <= jpegMarkerRST7:
+			// The markers without segments
+			i += 2
+			continue
+		case marker == jpegMarkerEOI:
+			return nil, errInvalidJPEG
+		}
+
+		if i+4 > len(data) {
+			return nil, errInvalidJPEG
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errInvalidJPEG
+		}
+		segment := data[i+4 : end]
+
+		switch {
+		case marker == jpegMarkerDQT:
+			for len(segment) > 0 {
+				// Only the tables of 8-bit precision have a type
+				if segment[0]>>4 != 0 || len(segment) < 65 {
+					return nil, errUnsupportedJPEG
+				}
+				tables[segment[0]&0x0f] = segment[1:65]
+				segment = segment[65:]
+			}
+		case marker == jpegMarkerSOF0:
+			if len(segment) < 15 || segment[5] != 3 {
+				return nil, errUnsupportedJPEG
+			}
+			height, width := binary.BigEndian.Uint16(segment[1:]), binary.BigEndian.Uint16(segment[3:])
+			if width == 0 || height == 0 || width > 2040 || height > 2040 {
+				return nil, errUnsupportedJPEG
+			}
+			f.width, f.height = uint8((width+7)/8), uint8((height+7)/8)
+			switch segment[7] {
+			case 0x21:
+				f.typ = 0
+			case 0x22:
+				f.typ = 1
+			default:
+				return nil, errUnsupportedJPEG
+			}
+			if segment[10] != 0x11 || segment[13] != 0x11 {
+				return nil, errUnsupportedJPEG
+			}
+			tableIDs = []byte{segment[8], segment[11]}
+		case marker > jpegMarkerSOF0 && marker <= 0xcf && marker != jpegMarkerDHT && marker != 0xc8 && marker != 0xcc:
+			// Progressive, lossless and arithmetic-coded images
+			return nil, errUnsupportedJPEG
+		case marker == jpegMarkerDRI:
+			if len(segment) < 2 {
+				return nil, errInvalidJPEG
+			}
+			f.restartInterval = binary.BigEndian.Uint16(segment)
+		case marker == jpegMarkerSOS:
+			if tableIDs == nil {
+				return nil, errInvalidJPEG
+			}
+			for _, id := range tableIDs {
+				table, ok := tables[id]
+				if !ok {
+					return nil, errInvalidJPEG
+				}
+				f.quantTables = append(f.quantTables, table...)
+			}
+			if f.restartInterval > 0 {
+				f.typ += jpegTypeRestart
+			}
+			f.scan = data[end:]
+			if n := len(f.scan); n >= 2 && f.scan[n-2] == 0xff && f.scan[n-1] == jpegMarkerEOI {
+				f.scan = f.scan[:n-2]
+			}
+			return &f, nil
+		}
+		i = end
+	}
+	return nil, errInvalidJPEG
+}
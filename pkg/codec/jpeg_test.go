@@ -0,0 +1,100 @@
+package codec
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func TestJPEGPayloader(t *testing.T) {
+	var buf bytes.Buffer
+	img := image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = uint8(i)
+	}
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	// The restart interval is inserted after SOI
+	restarted := append([]byte{0xff, 0xd8, 0xff, jpegMarkerDRI, 0, 4, 0, 16}, encoded[2:]...)
+
+	testCases := map[string]struct {
+		data       []byte
+		typ        uint8
+		headerSize int
+	}{
+		"Baseline": {
+			data:       encoded,
+			typ:        1,
+			headerSize: 8,
+		},
+		"RestartMarkers": {
+			data:       restarted,
+			typ:        1 + jpegTypeRestart,
+			headerSize: 12,
+		},
+	}
+
+	for name, c := range testCases {
+		t.Run(name, func(t *testing.T) {
+			packets := (&jpegPayloader{}).Payload(200, c.data)
+			if len(packets) < 2 {
+				t.Fatalf("Expected the frame to be fragmented, got %d packets", len(packets))
+			}
+
+			var scan []byte
+			for i, packet := range packets {
+				if len(packet) > 200 {
+					t.Errorf("Expected packets of at most 200 bytes, got %d", len(packet))
+				}
+				offset := int(packet[1])<<16 | int(packet[2])<<8 | int(packet[3])
+				if offset != len(scan) {
+					t.Errorf("Expected the fragment offset to be %d, got %d", len(scan), offset)
+				}
+				if typ, q, width, height := packet[4], packet[5], packet[6], packet[7]; typ != c.typ || q != jpegQDynamic || width != 8 || height != 6 {
+					t.Errorf("Unexpected header: type %d, Q %d, %dx%d blocks", typ, q, width, height)
+				}
+				if c.typ >= jpegTypeRestart && (packet[8] != 0 || packet[9] != 16) {
+					t.Errorf("Expected the restart interval to be 16, got %v", packet[8:10])
+				}
+
+				payload := packet[c.headerSize:]
+				if i == 0 {
+					// The luma and the chroma tables
+					if length := int(payload[2])<<8 | int(payload[3]); length != 128 {
+						t.Errorf("Expected 128 bytes of quantization tables, got %d", length)
+					}
+					payload = payload[4+128:]
+				}
+				scan = append(scan, payload...)
+			}
+
+			// The entropy-coded data is sent as it is, without EOI
+			if !bytes.HasSuffix(c.data, append(scan, 0xff, jpegMarkerEOI)) {
+				t.Error("Expected the payloads to be the entropy-coded data of the frame")
+			}
+		})
+	}
+}
+
+func TestJPEGPayloaderUnsupported(t *testing.T) {
+	var buf bytes.Buffer
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"Grayscale": buf.Bytes(),
+		"Truncated": buf.Bytes()[:20],
+		"NotJPEG":   {0, 0, 0, 1, 0x67},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if packets := (&jpegPayloader{}).Payload(1200, data); packets != nil {
+				t.Errorf("Expected the frame to be dropped, got %d packets", len(packets))
+			}
+		})
+	}
+}
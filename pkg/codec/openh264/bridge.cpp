@@ -131,3 +131,62 @@ Slice enc_encode(Encoder *e, Frame f, int *eresult) {
   payload.data_len = size;
   return payload;
 }
+
+Decoder *dec_new(int *eresult) {
+  int rv;
+  ISVCDecoder *engine;
+  SDecodingParam params = {0};
+
+  rv = WelsCreateDecoder(&engine);
+  if (rv != 0) {
+    *eresult = rv;
+    return NULL;
+  }
+
+  params.sVideoProperty.eVideoBsType = VIDEO_BITSTREAM_AVC;
+  rv = engine->Initialize(&params);
+  if (rv != 0) {
+    WelsDestroyDecoder(engine);
+    *eresult = rv;
+    return NULL;
+  }
+
+  Decoder *decoder = (Decoder *)malloc(sizeof(Decoder));
+  decoder->engine = engine;
+  return decoder;
+}
+
+void dec_free(Decoder *d, int *eresult) {
+  int rv = d->engine->Uninitialize();
+  if (rv != 0) {
+    *eresult = rv;
+    return;
+  }
+
+  WelsDestroyDecoder(d->engine);
+  free(d);
+}
+
+Frame dec_decode(Decoder *d, const unsigned char *data, int data_len, int *eresult) {
+  unsigned char *planes[3] = {0};
+  SBufferInfo info = {0};
+  Frame f = {0};
+
+  DECODING_STATE rv = d->engine->DecodeFrameNoDelay(data, data_len, planes, &info);
+  if (rv != dsErrorFree) {
+    *eresult = rv;
+    return f;
+  }
+  // The planes are owned by the decoder, and stay valid until the next call
+  if (info.iBufferStatus != 1)
+    return f;
+
+  f.y = planes[0];
+  f.u = planes[1];
+  f.v = planes[2];
+  f.ystride = info.UsrData.sSystemBuffer.iStride[0];
+  f.cstride = info.UsrData.sSystemBuffer.iStride[1];
+  f.width = info.UsrData.sSystemBuffer.iWidth;
+  f.height = info.UsrData.sSystemBuffer.iHeight;
+  return f;
+}
@@ -45,6 +45,15 @@ Encoder *enc_new(const EncoderOptions params, int *eresult);
 void enc_free(Encoder *e, int *eresult);
 Slice enc_encode(Encoder *e, Frame f, int *eresult);
 void enc_set_bitrate(Encoder *e, int bitrate);
+
+typedef struct Decoder {
+  ISVCDecoder *engine;
+} Decoder;
+
+Decoder *dec_new(int *eresult);
+void dec_free(Decoder *d, int *eresult);
+// The returned frame has no data when the access unit didn't complete a picture.
+Frame dec_decode(Decoder *d, const unsigned char *data, int data_len, int *eresult);
 #ifdef __cplusplus
 }
 #endif
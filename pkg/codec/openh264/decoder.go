@@ -0,0 +1,114 @@
+package openh264
+
+// #include <openh264/codec_api.h>
+// #include "bridge.hpp"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"sync"
+	"unsafe"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+const (
+	// decoderBufferSize is the initial size of the buffer an access unit is read to. It's doubled whenever
+	// an access unit doesn't fit, up to decoderMaxBufferSize.
+	decoderBufferSize    = 1024 * 1024
+	decoderMaxBufferSize = 64 * 1024 * 1024
+)
+
+type decoder struct {
+	engine *C.Decoder
+	r      io.Reader
+	buf    []byte
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newDecoder(r io.Reader, p prop.Media) (codec.VideoDecoder, error) {
+	var rv C.int
+	cDecoder := C.dec_new(&rv)
+	if err := errResult(rv); err != nil {
+		return nil, fmt.Errorf("failed in creating decoder: %v", err)
+	}
+
+	return &decoder{
+		engine: cDecoder,
+		r:      r,
+		buf:    make([]byte, decoderBufferSize),
+	}, nil
+}
+
+func (d *decoder) Read() (image.Image, func(), error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, func() {}, io.EOF
+	}
+
+	for {
+		n, err := d.r.Read(d.buf)
+		if errors.Is(err, io.ErrShortBuffer) && len(d.buf) < decoderMaxBufferSize {
+			// The reader keeps the frame, it's read again with a larger buffer
+			d.buf = make([]byte, 2*len(d.buf))
+			continue
+		}
+		if err != nil {
+			return nil, func() {}, err
+		}
+		if n == 0 {
+			continue
+		}
+
+		var rv C.int
+		f := C.dec_decode(d.engine, (*C.uchar)(unsafe.Pointer(&d.buf[0])), C.int(n), &rv)
+		if rv != 0 {
+			return nil, func() {}, fmt.Errorf("failed in decoding: %v", decodingState(rv))
+		}
+		if f.y == nil {
+			// The access unit didn't complete a picture
+			continue
+		}
+
+		w, h := int(f.width), int(f.height)
+		yStride, cStride := int(f.ystride), int(f.cstride)
+		ySrc := unsafe.Slice((*byte)(f.y), yStride*h)
+		uSrc := unsafe.Slice((*byte)(f.u), cStride*(h+1)/2)
+		vSrc := unsafe.Slice((*byte)(f.v), cStride*(h+1)/2)
+
+		// The planes are reused by the decoder, they're copied
+		img := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio420)
+		for r := 0; r < h; r++ {
+			copy(img.Y[r*img.YStride:r*img.YStride+w], ySrc[r*yStride:])
+		}
+		cw := (w + 1) / 2
+		for r := 0; r < (h+1)/2; r++ {
+			copy(img.Cb[r*img.CStride:r*img.CStride+cw], uSrc[r*cStride:])
+			copy(img.Cr[r*img.CStride:r*img.CStride+cw], vSrc[r*cStride:])
+		}
+		return img, func() {}, nil
+	}
+}
+
+func (d *decoder) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil
+	}
+
+	d.closed = true
+
+	var rv C.int
+	C.dec_free(d.engine, &rv)
+	return errResult(rv)
+}
@@ -43,3 +43,31 @@ func errResult(e C.int) error {
 	}
 	return eResult(e)
 }
+
+// decodingState is a combination of the DECODING_STATE flags returned by the decoder.
+type decodingState int
+
+const (
+	dsRefLost         decodingState = 0x02
+	dsBitstreamError  decodingState = 0x04
+	dsNoParamSets     decodingState = 0x10
+	dsInvalidArgument decodingState = 0x1000
+	dsOutOfMemory     decodingState = 0x4000
+)
+
+func (s decodingState) Error() string {
+	switch {
+	case s&dsNoParamSets != 0:
+		return "no parameter sets"
+	case s&dsRefLost != 0:
+		return "reference lost"
+	case s&dsBitstreamError != 0:
+		return "bitstream error"
+	case s&dsInvalidArgument != 0:
+		return "invalid argument"
+	case s&dsOutOfMemory != 0:
+		return "out of memory"
+	default:
+		return fmt.Sprintf("decoding error (%#x)", int(s))
+	}
+}
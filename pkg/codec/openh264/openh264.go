@@ -20,10 +20,13 @@ import (
 
 type encoder struct {
 	engine *C.Encoder
+	opts   C.EncoderOptions
 	r      video.Reader
 
 	mu     sync.Mutex
 	closed bool
+	// reinit is set when the engine has to be recreated with opts before the next frame
+	reinit bool
 }
 
 func newEncoder(r video.Reader, p prop.Media, params Params) (codec.ReadCloser, error) {
@@ -31,8 +34,7 @@ func newEncoder(r video.Reader, p prop.Media, params Params) (codec.ReadCloser,
 		params.BitRate = 100000
 	}
 
-	var rv C.int
-	cEncoder := C.enc_new(C.EncoderOptions{
+	opts := C.EncoderOptions{
 		width:                 C.int(p.Width),
 		height:                C.int(p.Height),
 		target_bitrate:        C.int(params.BitRate),
@@ -46,33 +48,49 @@ func newEncoder(r video.Reader, p prop.Media, params Params) (codec.ReadCloser,
 		slice_num:             C.uint(params.SliceNum),
 		slice_mode:            C.SliceModeEnum(params.SliceMode),
 		slice_size_constraint: C.uint(params.SliceSizeConstraint),
-	}, &rv)
+	}
+	var rv C.int
+	cEncoder := C.enc_new(opts, &rv)
 	if err := errResult(rv); err != nil {
 		return nil, fmt.Errorf("failed in creating encoder: %v", err)
 	}
 
 	return &encoder{
 		engine: cEncoder,
+		opts:   opts,
 		r:      video.ToI420(r),
 	}, nil
 }
 
 func (e *encoder) Read() ([]byte, func(), error) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
-	if e.closed {
+	if e.isClosed() {
 		return nil, func() {}, io.EOF
 	}
 
+	// The frame is read without holding e.mu, so that the controller isn't blocked while waiting for it
 	img, release, err := e.r.Read()
 	if err != nil {
 		return nil, func() {}, err
 	}
 	defer release()
 
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return nil, func() {}, io.EOF
+	}
+
 	yuvImg := img.(*image.YCbCr)
 	bounds := yuvImg.Bounds()
+	width, height := C.int(bounds.Dx()), C.int(bounds.Dy())
+	if e.reinit || e.opts.width != width || e.opts.height != height {
+		e.opts.width, e.opts.height = width, height
+		if err := e.recreate(); err != nil {
+			return nil, func() {}, err
+		}
+	}
+
 	var rv C.int
 	s := C.enc_encode(e.engine, C.Frame{
 		y:       unsafe.Pointer(&yuvImg.Y[0]),
@@ -80,8 +98,8 @@ func (e *encoder) Read() ([]byte, func(), error) {
 		v:       unsafe.Pointer(&yuvImg.Cr[0]),
 		ystride: C.int(yuvImg.YStride),
 		cstride: C.int(yuvImg.CStride),
-		height:  C.int(bounds.Max.Y - bounds.Min.Y),
-		width:   C.int(bounds.Max.X - bounds.Min.X),
+		height:  height,
+		width:   width,
 	}, &rv)
 	if err := errResult(rv); err != nil {
 		return nil, func() {}, fmt.Errorf("failed in encoding: %v", err)
@@ -91,13 +109,66 @@ func (e *encoder) Read() ([]byte, func(), error) {
 	return encoded, func() {}, nil
 }
 
+// recreate replaces the engine with a new one that is configured with opts. The first frame of the
+// new engine is a key frame. e.mu must be held.
+func (e *encoder) recreate() error {
+	var rv C.int
+	cEncoder := C.enc_new(e.opts, &rv)
+	if err := errResult(rv); err != nil {
+		return fmt.Errorf("failed in recreating encoder: %v", err)
+	}
+	// The old engine isn't used anymore, even if it fails to be freed
+	C.enc_free(e.engine, &rv)
+	e.engine = cEncoder
+	e.reinit = false
+	return nil
+}
+
+// SetInputProp implements codec.InputPropController. The engine is recreated for the next frame.
+func (e *encoder) SetInputProp(p prop.Media) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if p.Width > 0 && p.Height > 0 {
+		e.opts.width, e.opts.height = C.int(p.Width), C.int(p.Height)
+	}
+	if p.FrameRate > 0 {
+		e.opts.max_fps = C.float(p.FrameRate)
+	}
+	e.reinit = true
+	return nil
+}
+
+func (e *encoder) isClosed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closed
+}
+
 func (e *encoder) ForceKeyFrame() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return nil
+	}
+	// A recreated engine starts with a key frame anyway
 	e.engine.force_key_frame = C.int(1)
 	return nil
 }
 
 func (e *encoder) SetBitRate(bitrate int) error {
-	C.enc_set_bitrate(e.engine, C.int(bitrate))
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return nil
+	}
+	e.opts.target_bitrate = C.int(bitrate)
+	if !e.reinit {
+		// Otherwise, the engine is recreated with the bit rate for the next frame
+		C.enc_set_bitrate(e.engine, C.int(bitrate))
+	}
 	return nil
 }
 
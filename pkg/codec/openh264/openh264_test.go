@@ -2,11 +2,13 @@ package openh264
 
 import (
 	"image"
+	"io"
 	"testing"
 
 	"github.com/pion/mediadevices/pkg/codec"
 	"github.com/pion/mediadevices/pkg/codec/internal/codectest"
 	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/io/video"
 	"github.com/pion/mediadevices/pkg/prop"
 )
 
@@ -80,3 +82,310 @@ func TestEncoder(t *testing.T) {
 		)
 	})
 }
+
+func TestEncodeDecode(t *testing.T) {
+	const width, height, totalFrames = 320, 240, 10
+
+	p, err := NewParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	property := prop.Media{
+		Video: prop.Video{
+			Width:       width,
+			Height:      height,
+			FrameRate:   30,
+			FrameFormat: frame.FormatI420,
+		},
+	}
+
+	var cnt int
+	encoder, err := p.BuildVideoEncoder(video.ReaderFunc(func() (image.Image, func(), error) {
+		cnt++
+		if cnt > totalFrames {
+			return nil, func() {}, io.EOF
+		}
+		img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+		for i := range img.Y {
+			img.Y[i] = 0x80
+		}
+		return img, func() {}, nil
+	}), property)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+
+	reader, writer := io.Pipe()
+	decoder, err := p.BuildVideoDecoder(reader, property)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.Close()
+
+	go func() {
+		for {
+			b, release, err := encoder.Read()
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			if len(b) > 0 {
+				// Empty frames are dropped by the encoder
+				_, err = writer.Write(b)
+			}
+			release()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	decoded := 0
+	for {
+		img, release, err := decoder.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != width || img.Bounds().Dy() != height {
+			t.Errorf("Expected %dx%d, got %v", width, height, img.Bounds())
+		}
+		if y := img.(*image.YCbCr).Y[width*height/2+width/2]; y < 0x78 || y > 0x88 {
+			t.Errorf("Expected a gray picture, got luma %d", y)
+		}
+		release()
+		decoded++
+	}
+	if decoded != totalFrames {
+		t.Errorf("Expected %d decoded frames, got %d", totalFrames, decoded)
+	}
+}
+
+func TestSetInputProp(t *testing.T) {
+	const totalFrames = 10
+
+	p, err := NewParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	property := prop.Media{
+		Video: prop.Video{
+			Width:       320,
+			Height:      240,
+			FrameRate:   30,
+			FrameFormat: frame.FormatI420,
+		},
+	}
+
+	// The frames are scaled down half way through
+	var cnt int
+	size := image.Rect(0, 0, 320, 240)
+	encoder, err := p.BuildVideoEncoder(video.ReaderFunc(func() (image.Image, func(), error) {
+		cnt++
+		if cnt > totalFrames {
+			return nil, func() {}, io.EOF
+		}
+		return image.NewYCbCr(size, image.YCbCrSubsampleRatio420), func() {}, nil
+	}), property)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+
+	reader, writer := io.Pipe()
+	decoder, err := p.BuildVideoDecoder(reader, property)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.Close()
+
+	go func() {
+		for i := 0; ; i++ {
+			if i == totalFrames/2 {
+				size = image.Rect(0, 0, 160, 120)
+				if err := encoder.Controller().(codec.InputPropController).SetInputProp(prop.Media{
+					Video: prop.Video{Width: 160, Height: 120, FrameRate: 15, FrameFormat: frame.FormatI420},
+				}); err != nil {
+					writer.CloseWithError(err)
+					return
+				}
+			}
+			b, release, err := encoder.Read()
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			if len(b) > 0 {
+				_, err = writer.Write(b)
+			}
+			release()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var sizes []image.Rectangle
+	for {
+		img, release, err := decoder.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, img.Bounds())
+		release()
+	}
+	if len(sizes) != totalFrames {
+		t.Fatalf("Expected %d decoded frames, got %d", totalFrames, len(sizes))
+	}
+	for i, s := range sizes {
+		expected := image.Rect(0, 0, 320, 240)
+		if i >= totalFrames/2 {
+			expected = image.Rect(0, 0, 160, 120)
+		}
+		if s != expected {
+			t.Errorf("Expected frame %d to be %v, got %v", i, expected, s)
+		}
+	}
+}
+
+// accessUnitReader returns an access unit per read, and keeps it if it doesn't fit.
+type accessUnitReader struct {
+	units [][]byte
+}
+
+func (r *accessUnitReader) Read(p []byte) (int, error) {
+	if len(r.units) == 0 {
+		return 0, io.EOF
+	}
+	if len(r.units[0]) > len(p) {
+		return 0, io.ErrShortBuffer
+	}
+	n := copy(p, r.units[0])
+	r.units = r.units[1:]
+	return n, nil
+}
+
+func TestDecodeShortBuffer(t *testing.T) {
+	const width, height = 320, 240
+
+	p, err := NewParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	property := prop.Media{
+		Video: prop.Video{
+			Width:       width,
+			Height:      height,
+			FrameRate:   30,
+			FrameFormat: frame.FormatI420,
+		},
+	}
+	encoder, err := p.BuildVideoEncoder(video.ReaderFunc(func() (image.Image, func(), error) {
+		return image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420), func() {}, nil
+	}), property)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+	b, release, err := encoder.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unit := append([]byte{}, b...)
+	release()
+
+	dec, err := p.BuildVideoDecoder(&accessUnitReader{units: [][]byte{unit}}, property)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	// The access unit doesn't fit at first
+	dec.(*decoder).buf = make([]byte, len(unit)/4)
+
+	img, release, err := dec.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if img.Bounds().Dx() != width || img.Bounds().Dy() != height {
+		t.Errorf("Expected %dx%d, got %v", width, height, img.Bounds())
+	}
+}
+
+func TestControllerWhileRecreating(t *testing.T) {
+	const totalFrames = 20
+
+	p, err := NewParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	property := prop.Media{
+		Video: prop.Video{
+			Width:       320,
+			Height:      240,
+			FrameRate:   30,
+			FrameFormat: frame.FormatI420,
+		},
+	}
+
+	var cnt int
+	encoder, err := p.BuildVideoEncoder(video.ReaderFunc(func() (image.Image, func(), error) {
+		cnt++
+		if cnt > totalFrames {
+			return nil, func() {}, io.EOF
+		}
+		// The size changes with every frame, which recreates the engine
+		size := image.Rect(0, 0, 320-cnt%2*160, 240-cnt%2*120)
+		return image.NewYCbCr(size, image.YCbCrSubsampleRatio420), func() {}, nil
+	}), property)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bit rate and the key frames are controlled from other goroutines, e.g. by RTCP feedback
+	controller := encoder.Controller()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if err := controller.(codec.BitRateController).SetBitRate(100000 + i*1000); err != nil {
+				t.Error(err)
+			}
+			if err := controller.(codec.KeyFrameController).ForceKeyFrame(); err != nil {
+				t.Error(err)
+			}
+			if err := controller.(codec.InputPropController).SetInputProp(property); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	for {
+		_, release, err := encoder.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	<-done
+
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The controller mustn't use the freed engine
+	if err := controller.(codec.BitRateController).SetBitRate(100000); err != nil {
+		t.Error(err)
+	}
+	if err := controller.(codec.KeyFrameController).ForceKeyFrame(); err != nil {
+		t.Error(err)
+	}
+}
@@ -4,6 +4,8 @@ package openh264
 import "C"
 
 import (
+	"io"
+
 	"github.com/pion/mediadevices/pkg/codec"
 	"github.com/pion/mediadevices/pkg/io/video"
 	"github.com/pion/mediadevices/pkg/prop"
@@ -80,3 +82,9 @@ func (p *Params) RTPCodec() *codec.RTPCodec {
 func (p *Params) BuildVideoEncoder(r video.Reader, property prop.Media) (codec.ReadCloser, error) {
 	return newEncoder(r, property, *p)
 }
+
+// BuildVideoDecoder builds openh264 decoder. The encoding params are ignored.
+// Every read from r must return a single Annex-B access unit.
+func (p *Params) BuildVideoDecoder(r io.Reader, property prop.Media) (codec.VideoDecoder, error) {
+	return newDecoder(r, property)
+}
@@ -0,0 +1,156 @@
+package opus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/wave"
+)
+
+/*
+#include <opus.h>
+
+int pion_get_decoder_last_packet_duration(OpusDecoder *d, opus_int32 *samples)
+{
+	return opus_decoder_ctl(d, OPUS_GET_LAST_PACKET_DURATION(samples));
+}
+*/
+import "C"
+
+const (
+	// maxPacketSize is large enough for any Opus packet sent over RTP.
+	maxPacketSize = 4000
+	// maxFrameDuration is the longest duration of an Opus packet, in milliseconds.
+	maxFrameDuration = 120
+)
+
+type decoder struct {
+	reader   io.Reader
+	engine   *C.OpusDecoder
+	channels int
+	rate     int
+	fec      bool
+
+	packet []byte
+	pcm    []int16
+	// The frame, or error, read ahead to recover a lost frame with FEC
+	pending    []byte
+	pendingErr error
+
+	mu sync.Mutex
+}
+
+func newDecoder(r io.Reader, p prop.Media, params Params) (codec.AudioDecoder, error) {
+	var cerror C.int
+
+	if p.SampleRate == 0 {
+		p.SampleRate = 48000
+	}
+	if p.ChannelCount == 0 {
+		p.ChannelCount = 2
+	}
+
+	engine := C.opus_decoder_create(
+		C.opus_int32(p.SampleRate),
+		C.int(p.ChannelCount),
+		&cerror,
+	)
+	if cerror != C.OPUS_OK {
+		return nil, errors.New("failed to create decoder engine")
+	}
+
+	return &decoder{
+		reader:   r,
+		engine:   engine,
+		channels: p.ChannelCount,
+		rate:     p.SampleRate,
+		fec:      params.FEC,
+		packet:   make([]byte, maxPacketSize),
+		pcm:      make([]int16, p.SampleRate*maxFrameDuration/1000*p.ChannelCount),
+	}, nil
+}
+
+// Read decodes the next frame. Lost frames, signaled by reads of zero bytes, are recovered from the
+// redundancy of the next frame if FEC is enabled, and concealed otherwise.
+func (d *decoder) Read() (wave.Audio, func(), error) {
+	frame, err := d.readFrame()
+	if err != nil {
+		return nil, func() {}, err
+	}
+	var next []byte
+	if len(frame) == 0 && d.fec {
+		// The next frame, or read error, is returned by the next call
+		next, err = d.readFrame()
+		d.pending, d.pendingErr = next, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.engine == nil {
+		return nil, func() {}, io.EOF
+	}
+
+	var samples C.int
+	switch {
+	case len(frame) > 0:
+		samples = C.opus_decode(d.engine, (*C.uchar)(&frame[0]), C.opus_int32(len(frame)),
+			(*C.opus_int16)(&d.pcm[0]), C.int(len(d.pcm)/d.channels), 0)
+	case len(next) > 0:
+		samples = C.opus_decode(d.engine, (*C.uchar)(&next[0]), C.opus_int32(len(next)),
+			(*C.opus_int16)(&d.pcm[0]), d.lostFrameSize(), 1)
+	default:
+		samples = C.opus_decode(d.engine, nil, 0, (*C.opus_int16)(&d.pcm[0]), d.lostFrameSize(), 0)
+	}
+	if samples < 0 {
+		return nil, func() {}, fmt.Errorf("failed to decode: %s", C.GoString(C.opus_strerror(samples)))
+	}
+
+	chunk := wave.NewInt16Interleaved(wave.ChunkInfo{
+		Len:          int(samples),
+		Channels:     d.channels,
+		SamplingRate: d.rate,
+	})
+	copy(chunk.Data, d.pcm[:int(samples)*d.channels])
+	return chunk, func() {}, nil
+}
+
+// readFrame returns the frame read ahead, if any, or reads the next one. The frame is empty if it's lost.
+func (d *decoder) readFrame() ([]byte, error) {
+	if d.pending != nil || d.pendingErr != nil {
+		frame, err := d.pending, d.pendingErr
+		d.pending, d.pendingErr = nil, nil
+		return frame, err
+	}
+
+	n, err := d.reader.Read(d.packet)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, d.packet[:n]...), nil
+}
+
+// lostFrameSize returns the number of samples per channel to generate for a lost frame, which is the
+// duration of the last decoded frame.
+func (d *decoder) lostFrameSize() C.int {
+	var samples C.opus_int32
+	if C.pion_get_decoder_last_packet_duration(d.engine, &samples) != C.OPUS_OK || samples <= 0 {
+		// 20 ms
+		samples = C.opus_int32(d.rate / 50)
+	}
+	return C.int(samples)
+}
+
+func (d *decoder) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.engine == nil {
+		return nil
+	}
+	C.opus_decoder_destroy(d.engine)
+	d.engine = nil
+	return nil
+}
@@ -20,6 +20,14 @@ int pion_set_encoder_bitrate(OpusEncoder *e, opus_int32 bitrate)
 {
 	return opus_encoder_ctl(e, OPUS_SET_BITRATE(bitrate));
 }
+
+int pion_set_encoder_fec(OpusEncoder *e, opus_int32 packet_loss_perc)
+{
+	int err = opus_encoder_ctl(e, OPUS_SET_INBAND_FEC(1));
+	if (err != OPUS_OK)
+		return err;
+	return opus_encoder_ctl(e, OPUS_SET_PACKET_LOSS_PERC(packet_loss_perc));
+}
 */
 import "C"
 
@@ -74,14 +82,27 @@ func newEncoder(r audio.Reader, p prop.Media, params Params) (codec.ReadCloser,
 		e.Close()
 		return nil, err
 	}
+
+	if params.FEC {
+		if params.PacketLossPercentage == 0 {
+			params.PacketLossPercentage = 10
+		}
+		if C.pion_set_encoder_fec(engine, C.opus_int32(params.PacketLossPercentage)) != C.OPUS_OK {
+			e.Close()
+			return nil, fmt.Errorf("opus: failed to enable FEC for a packet loss of %d%%", params.PacketLossPercentage)
+		}
+	}
 	return &e, nil
 }
 
 func (e *encoder) Read() ([]byte, func(), error) {
-	buff, _, err := e.reader.Read()
+	buff, release, err := e.reader.Read()
 	if err != nil {
 		return nil, func() {}, err
 	}
+	if release != nil {
+		defer release()
+	}
 
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -77,3 +77,40 @@ func TestEncoder(t *testing.T) {
 		)
 	})
 }
+
+func TestEncodeDecode(t *testing.T) {
+	p := prop.Media{
+		Audio: prop.Audio{
+			SampleRate:   48000,
+			ChannelCount: 2,
+		},
+	}
+	chunk := wave.NewInt16Interleaved(wave.ChunkInfo{
+		Len:          960,
+		SamplingRate: 48000,
+		Channels:     2,
+	})
+	for i := range chunk.Data {
+		chunk.Data[i] = int16(i * 100)
+	}
+
+	for name, fec := range map[string]bool{"PLC": false, "FEC": true} {
+		t.Run(name, func(t *testing.T) {
+			params, err := NewParams()
+			if err != nil {
+				t.Fatal(err)
+			}
+			params.FEC = fec
+
+			t.Run("NoLoss", func(t *testing.T) {
+				codectest.AudioEncodeDecodeTest(t, &params, &params, p, chunk, -1)
+			})
+			t.Run("Loss", func(t *testing.T) {
+				codectest.AudioEncodeDecodeTest(t, &params, &params, p, chunk, 5)
+			})
+			t.Run("LastFrameLost", func(t *testing.T) {
+				codectest.AudioEncodeDecodeTest(t, &params, &params, p, chunk, 15)
+			})
+		})
+	}
+}
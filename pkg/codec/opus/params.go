@@ -1,6 +1,7 @@
 package opus
 
 import (
+	"io"
 	"time"
 
 	"github.com/pion/mediadevices/pkg/codec"
@@ -50,6 +51,13 @@ type Params struct {
 
 	// Expected latency of the codec.
 	Latency Latency
+
+	// FEC enables the in-band forward error correction. The encoder adds redundant data for an
+	// expected packet loss of PacketLossPercentage, and the decoder uses it to recover lost frames.
+	FEC bool
+	// PacketLossPercentage is the expected packet loss, from 0 to 100. The default is 10 when FEC is
+	// enabled.
+	PacketLossPercentage int
 }
 
 // NewParams returns default opus codec specific parameters.
@@ -70,3 +78,9 @@ func (p *Params) RTPCodec() *codec.RTPCodec {
 func (p *Params) BuildAudioEncoder(r audio.Reader, property prop.Media) (codec.ReadCloser, error) {
 	return newEncoder(r, property, *p)
 }
+
+// BuildAudioDecoder builds opus decoder with given params. The decoded audio has the sample rate and
+// channel count of property, which default to 48000 Hz and 2 channels.
+func (p *Params) BuildAudioDecoder(r io.Reader, property prop.Media) (codec.AudioDecoder, error) {
+	return newDecoder(r, property, *p)
+}
@@ -0,0 +1,92 @@
+package codec
+
+import (
+	"image"
+	"sync"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/io/audio"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/wave"
+)
+
+// TimestampedReadCloser is a ReadCloser that also reports the capture time of the encoded data.
+type TimestampedReadCloser interface {
+	ReadCloser
+	// ReadTimestamped is the same as Read, but it also returns the capture time of the input that
+	// the encoded data was made from.
+	ReadTimestamped() (b []byte, timestamp time.Time, release func(), err error)
+}
+
+// BuildTimestampedVideoEncoder builds a video encoder with builder, and carries the capture timestamps of r
+// to the encoded data. Encoders read frames synchronously, so the timestamp of the last frame that the encoder
+// read is used for the encoded data. Frames from a Reader that isn't a video.TimestampedReader are stamped
+// when they're read.
+func BuildTimestampedVideoEncoder(builder VideoEncoderBuilder, r video.Reader, p prop.Media) (TimestampedReadCloser, error) {
+	src := video.WithTimestamp(r)
+	var tracker timestampTracker
+
+	encoder, err := builder.BuildVideoEncoder(video.TimestampedReaderFunc(func() (image.Image, time.Time, func(), error) {
+		img, timestamp, release, err := src.ReadTimestamped()
+		tracker.store(timestamp)
+		return img, timestamp, release, err
+	}), p)
+	if err != nil {
+		return nil, err
+	}
+
+	return withTimestamp(encoder, &tracker), nil
+}
+
+// BuildTimestampedAudioEncoder is the same as BuildTimestampedVideoEncoder, but for audio encoders.
+func BuildTimestampedAudioEncoder(builder AudioEncoderBuilder, r audio.Reader, p prop.Media) (TimestampedReadCloser, error) {
+	src := audio.WithTimestamp(r)
+	var tracker timestampTracker
+
+	encoder, err := builder.BuildAudioEncoder(audio.TimestampedReaderFunc(func() (wave.Audio, time.Time, func(), error) {
+		chunk, timestamp, release, err := src.ReadTimestamped()
+		tracker.store(timestamp)
+		return chunk, timestamp, release, err
+	}), p)
+	if err != nil {
+		return nil, err
+	}
+
+	return withTimestamp(encoder, &tracker), nil
+}
+
+func withTimestamp(encoder ReadCloser, tracker *timestampTracker) TimestampedReadCloser {
+	if timestamped, ok := encoder.(TimestampedReadCloser); ok {
+		return timestamped
+	}
+
+	return &timestampedReadCloser{ReadCloser: encoder, tracker: tracker}
+}
+
+type timestampTracker struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (t *timestampTracker) store(timestamp time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = timestamp
+}
+
+func (t *timestampTracker) load() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last
+}
+
+type timestampedReadCloser struct {
+	ReadCloser
+	tracker *timestampTracker
+}
+
+func (rc *timestampedReadCloser) ReadTimestamped() ([]byte, time.Time, func(), error) {
+	b, release, err := rc.Read()
+	return b, rc.tracker.load(), release, err
+}
@@ -0,0 +1,54 @@
+package codec
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+type fakeVideoEncoderBuilder struct{}
+
+func (fakeVideoEncoderBuilder) RTPCodec() *RTPCodec { return nil }
+
+func (fakeVideoEncoderBuilder) BuildVideoEncoder(r video.Reader, p prop.Media) (ReadCloser, error) {
+	return &fakeEncoder{r: r}, nil
+}
+
+type fakeEncoder struct {
+	r video.Reader
+}
+
+func (e *fakeEncoder) Read() ([]byte, func(), error) {
+	_, _, err := e.r.Read()
+	return []byte{0}, func() {}, err
+}
+
+func (e *fakeEncoder) Controller() EncoderController { return nil }
+func (e *fakeEncoder) Close() error                  { return nil }
+
+func TestBuildTimestampedVideoEncoder(t *testing.T) {
+	base := time.Unix(1000, 0)
+	var count int
+	source := video.TimestampedReaderFunc(func() (image.Image, time.Time, func(), error) {
+		count++
+		return image.NewGray(image.Rect(0, 0, 2, 2)), base.Add(time.Duration(count) * time.Millisecond), func() {}, nil
+	})
+
+	encoder, err := BuildTimestampedVideoEncoder(fakeVideoEncoderBuilder{}, source, prop.Media{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		_, timestamp, _, err := encoder.ReadTimestamped()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := base.Add(time.Duration(i) * time.Millisecond); !timestamp.Equal(expected) {
+			t.Errorf("Expected timestamp %v, got %v", expected, timestamp)
+		}
+	}
+}
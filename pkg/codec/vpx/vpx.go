@@ -387,6 +387,12 @@ func (e *encoder) SetBitRate(bitrate int) error {
 	return nil
 }
 
+// SetInputProp implements codec.InputPropController. The encoder is reconfigured when the size of the
+// frames changes, and the frames are timed with the wall clock, so there's nothing to update.
+func (e *encoder) SetInputProp(p prop.Media) error {
+	return nil
+}
+
 func (e *encoder) DynamicQPControl(currentBitrate int, targetBitrate int) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -81,18 +81,34 @@ type decoder struct {
 	closed bool
 }
 
+// BuildVideoDecoder builds VP8 decoder.
 func BuildVideoDecoder(r io.Reader, property prop.Media) (codec.VideoDecoder, error) {
 	return NewDecoder(r, property)
 }
 
+// NewDecoder creates VP8 decoder.
 func NewDecoder(r io.Reader, p prop.Media) (codec.VideoDecoder, error) {
+	return newDecoder(r, p, C.ifaceVP8Decoder())
+}
+
+// BuildVideoDecoder builds VP8 decoder. The encoding params are ignored.
+func (p *VP8Params) BuildVideoDecoder(r io.Reader, property prop.Media) (codec.VideoDecoder, error) {
+	return newDecoder(r, property, C.ifaceVP8Decoder())
+}
+
+// BuildVideoDecoder builds VP9 decoder. The encoding params are ignored.
+func (p *VP9Params) BuildVideoDecoder(r io.Reader, property prop.Media) (codec.VideoDecoder, error) {
+	return newDecoder(r, property, C.ifaceVP9Decoder())
+}
+
+func newDecoder(r io.Reader, p prop.Media, iface *C.vpx_codec_iface_t) (codec.VideoDecoder, error) {
 	cfg := &C.vpx_codec_dec_cfg_t{}
 	cfg.threads = 1
 	cfg.w = C.uint(p.Width)
 	cfg.h = C.uint(p.Height)
 
 	codec := C.newDecoderCtx()
-	if C.decoderInit(codec, C.ifaceVP8Decoder()) != C.VPX_CODEC_OK {
+	if C.decoderInit(codec, iface) != C.VPX_CODEC_OK {
 		return nil, fmt.Errorf("vpx_codec_dec_init failed")
 	}
 
@@ -679,3 +679,90 @@ func TestVP8EncodeDecode(t *testing.T) {
 		assert.Equal(t, totalFrames, counter)
 	})
 }
+
+func TestEncodeDecode(t *testing.T) {
+	const width, height, totalFrames = 320, 240, 10
+
+	for name, factory := range map[string]func() (codec.VideoEncoderBuilder, codec.VideoDecoderBuilder, error){
+		"VP8": func() (codec.VideoEncoderBuilder, codec.VideoDecoderBuilder, error) {
+			p, err := NewVP8Params()
+			p.LagInFrames = 0
+			return &p, &p, err
+		},
+		"VP9": func() (codec.VideoEncoderBuilder, codec.VideoDecoderBuilder, error) {
+			p, err := NewVP9Params()
+			p.LagInFrames = 0
+			return &p, &p, err
+		},
+	} {
+		factory := factory
+		t.Run(name, func(t *testing.T) {
+			encoderBuilder, decoderBuilder, err := factory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			property := prop.Media{
+				Video: prop.Video{
+					Width:       width,
+					Height:      height,
+					FrameRate:   30,
+					FrameFormat: frame.FormatI420,
+				},
+			}
+
+			var cnt int
+			encoder, err := encoderBuilder.BuildVideoEncoder(video.ReaderFunc(func() (image.Image, func(), error) {
+				cnt++
+				if cnt > totalFrames {
+					return nil, func() {}, io.EOF
+				}
+				return image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420), func() {}, nil
+			}), property)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer encoder.Close()
+
+			reader, writer := io.Pipe()
+			decoder, err := decoderBuilder.BuildVideoDecoder(reader, property)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer decoder.Close()
+
+			go func() {
+				for {
+					b, release, err := encoder.Read()
+					if err != nil {
+						writer.CloseWithError(err)
+						return
+					}
+					if len(b) > 0 {
+						// Empty frames are dropped by the encoder
+						_, err = writer.Write(b)
+					}
+					release()
+					if err != nil {
+						return
+					}
+				}
+			}()
+
+			decoded := 0
+			for {
+				img, release, err := decoder.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, width, img.Bounds().Dx())
+				assert.Equal(t, height, img.Bounds().Dy())
+				release()
+				decoded++
+			}
+			assert.Equal(t, totalFrames, decoded)
+		})
+	}
+}
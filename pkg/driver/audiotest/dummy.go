@@ -15,7 +15,7 @@ import (
 
 func init() {
 	driver.GetManager().Register(
-		&dummy{}, driver.Info{Label: "AudioTest", DeviceType: driver.Microphone},
+		&dummy{}, driver.Info{Label: "AudioTest", DeviceType: driver.Microphone, StableID: "AudioTest"},
 	)
 }
 
@@ -62,7 +62,7 @@ func (d *dummy) AudioRecord(p prop.Media) (audio.Reader, error) {
 		time.Sleep(nextReadTime.Sub(time.Now()))
 		nextReadTime = nextReadTime.Add(p.Latency)
 
-		a := wave.NewFloat32Interleaved(
+		a, release := wave.DefaultPool.Float32Interleaved(
 			wave.ChunkInfo{
 				Channels:     p.ChannelCount,
 				Len:          nSample,
@@ -79,7 +79,7 @@ func (d *dummy) AudioRecord(p prop.Media) (audio.Reader, error) {
 				a.SetFloat32(i, ch, wave.Float32Sample(sin[phase]))
 			}
 		}
-		return a, func() {}, nil
+		return a, release, nil
 	})
 	return reader, nil
 }
@@ -11,6 +11,51 @@ bindings in /dev/v4l/by-path/), it will be:
 */
 package camera
 
+import (
+	"sync"
+
+	"github.com/pion/mediadevices/pkg/driver"
+)
+
 // LabelSeparator is used to separate labels for a driver that
 // is found from multiple locations on a host.
 const LabelSeparator = ";"
+
+// DeviceEventType is the type of a change of the connected cameras.
+type DeviceEventType int
+
+const (
+	// DeviceEventConnected is sent after a camera is connected, and registered.
+	DeviceEventConnected DeviceEventType = iota
+	// DeviceEventDisconnected is sent after a camera is disconnected, and unregistered.
+	DeviceEventDisconnected
+)
+
+var (
+	onDeviceChangeMu sync.Mutex
+	onDeviceChange   func(driver.Driver, DeviceEventType)
+)
+
+// SetOnDeviceChange sets f to be called when the device observer registers or unregisters a camera.
+// f is called from the goroutine of the observer. This is part of an experimental API.
+func SetOnDeviceChange(f func(d driver.Driver, event DeviceEventType)) {
+	onDeviceChangeMu.Lock()
+	defer onDeviceChangeMu.Unlock()
+	onDeviceChange = f
+}
+
+func notifyDeviceChange(d driver.Driver, event DeviceEventType) {
+	onDeviceChangeMu.Lock()
+	f := onDeviceChange
+	onDeviceChangeMu.Unlock()
+
+	if f != nil {
+		f(d, event)
+	}
+}
+
+// removeCamera removes a camera that has been disconnected from manager. It's removed before it's
+// closed, so that the tracks of the camera end because it's removed, rather than because reading fails.
+func removeCamera(manager *driver.Manager, d driver.Driver) error {
+	return manager.Remove(d.ID())
+}
@@ -41,6 +41,7 @@ func Initialize() {
 			Label:      device.UID,
 			DeviceType: driver.Camera,
 			Name:       device.Name,
+			StableID:   device.UID,
 		})
 	}
 }
@@ -67,19 +68,21 @@ func SetupObserver() error {
 				Label:      device.UID,
 				DeviceType: driver.Camera,
 				Name:       device.Name,
+				StableID:   device.UID,
 			})
+			for _, d := range manager.Query(func(d driver.Driver) bool {
+				return d.Info().Label == device.UID
+			}) {
+				notifyDeviceChange(d, DeviceEventConnected)
+			}
 
 		case avfoundation.DeviceEventDisconnected:
 			drivers := manager.Query(func(d driver.Driver) bool {
 				return d.Info().Label == device.UID
 			})
 			for _, d := range drivers {
-				status := d.Status()
-				if status != driver.StateClosed {
-					if err := d.Close(); err != nil {
-					}
-				}
-				manager.Delete(d.ID())
+				_ = removeCamera(manager, d)
+				notifyDeviceChange(d, DeviceEventDisconnected)
 			}
 		}
 	})
@@ -221,7 +224,7 @@ func syncVideoRecorders(manager *driver.Manager) error {
 		label := d.Info().Label
 		registeredByLabel[label] = struct{}{}
 		if _, ok := current[label]; !ok {
-			manager.Delete(d.ID())
+			_ = removeCamera(manager, d)
 			delete(registeredByLabel, label)
 		}
 	}
@@ -237,6 +240,7 @@ func syncVideoRecorders(manager *driver.Manager) error {
 			Label:      device.UID,
 			DeviceType: driver.Camera,
 			Name:       device.Name,
+			StableID:   device.UID,
 		})
 		registeredByLabel[device.UID] = struct{}{}
 	}
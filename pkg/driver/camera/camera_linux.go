@@ -12,10 +12,12 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/pion/mediadevices/internal/sysfs"
 	"github.com/pion/mediadevices/pkg/driver/availability"
 
 	"github.com/blackjack/webcam"
@@ -33,36 +35,8 @@ const (
 var (
 	errReadTimeout = errors.New("read timeout")
 	errEmptyFrame  = errors.New("empty frame")
-	// Reference: https://commons.wikimedia.org/wiki/File:Vector_Video_Standards2.svg
-	supportedResolutions = [][2]int{
-		{320, 240},
-		{640, 480},
-		{768, 576},
-		{800, 600},
-		{1024, 768},
-		{1280, 854},
-		{1280, 960},
-		{1280, 1024},
-		{1400, 1050},
-		{1600, 1200},
-		{2048, 1536},
-		{320, 200},
-		{800, 480},
-		{854, 480},
-		{1024, 600},
-		{1152, 768},
-		{1280, 720},
-		{1280, 768},
-		{1366, 768},
-		{1280, 800},
-		{1440, 900},
-		{1440, 960},
-		{1680, 1050},
-		{1920, 1080},
-		{2048, 1080},
-		{1920, 1200},
-		{2560, 1600},
-	}
+	// errNotCompressed is returned when the compressed frames of an uncompressed format are recorded
+	errNotCompressed = errors.New("frame format isn't compressed")
 )
 
 const bufCount = 2
@@ -78,6 +52,8 @@ type camera struct {
 	mutex           sync.Mutex
 	cancel          func()
 	prevFrameTime   time.Time
+	// dev is where the controls and the formats are queried from. It's nil if the camera is closed.
+	dev ioctlDevice
 }
 
 func init() {
@@ -85,40 +61,30 @@ func init() {
 }
 
 // Initialize finds and registers camera devices. This is part of an experimental API.
+//
+// Cameras that were registered by a previous call, and are still connected, are kept as is. The
+// cameras that were disconnected since then are unregistered.
 func Initialize() {
-	// Clear all registered camera devices to prevent duplicates.
-	// If first initalize call, this will be a noop.
-	manager := driver.GetManager()
-	for _, d := range manager.Query(driver.FilterVideoRecorder()) {
-		manager.Delete(d.ID())
-	}
-	discovered := make(map[string]struct{})
-	discover(discovered, "/dev/v4l/by-id/*")
-	discover(discovered, "/dev/v4l/by-path/*")
-	discover(discovered, "/dev/video*")
-}
-
-// SetupObserver is a stub implementation for Linux.
-func SetupObserver() error {
-	return availability.ErrUnimplemented
-}
-
-// StartObserver is a stub implementation for Linux.
-func StartObserver() error {
-	return availability.ErrUnimplemented
+	syncCameras(driver.GetManager(), devDir)
 }
 
-// DestroyObserver is a stub implementation for Linux.
-func DestroyObserver() error {
-	return availability.ErrUnimplemented
+// v4l2Device is a V4L2 device node, found at path.
+type v4l2Device struct {
+	path  string
+	label string
+	// node is the name of the device node, e.g. video0
+	node string
 }
 
-func discover(discovered map[string]struct{}, pattern string) {
+// findDevices returns the device nodes matching pattern, which haven't been discovered yet.
+func findDevices(discovered map[string]struct{}, pattern string) []v4l2Device {
 	devices, err := filepath.Glob(pattern)
 	if err != nil {
 		// No v4l device.
-		return
+		return nil
 	}
+
+	var found []v4l2Device
 	for _, device := range devices {
 		label := filepath.Base(device)
 		reallink, err := os.Readlink(device)
@@ -132,32 +98,69 @@ func discover(discovered map[string]struct{}, pattern string) {
 		}
 
 		discovered[reallink] = struct{}{}
-		cam := newCamera(device)
-		priority := driver.PriorityNormal
-		if reallink == prioritizedDevice {
-			priority = driver.PriorityHigh
-		}
+		found = append(found, v4l2Device{path: device, label: label, node: reallink})
+	}
+	return found
+}
 
-		var name, busInfo string
-		if webcamCam, err := webcam.Open(cam.path); err == nil {
-			defer webcamCam.Close()
-			name, _ = webcamCam.GetName()
-			busInfo, _ = webcamCam.GetBusInfo()
-		}
+// scanDevices finds the device nodes in dir, e.g. /dev. The most descriptive path of each node is
+// used to label it.
+func scanDevices(dir string) []v4l2Device {
+	discovered := make(map[string]struct{})
+	var devices []v4l2Device
+	for _, pattern := range []string{"v4l/by-id/*", "v4l/by-path/*", "video*"} {
+		devices = append(devices, findDevices(discovered, filepath.Join(dir, pattern))...)
+	}
+	return devices
+}
 
-		driver.GetManager().Register(cam, driver.Info{
-			// 	Source: https://www.kernel.org/doc/html/v4.9/media/uapi/v4l/vidioc-querycap.html
-			//	Name of the device, a NUL-terminated UTF-8 string. For example: “Yoyodyne TV/FM”. One driver may support
-			//	different brands or models of video hardware. This information is intended for users, for example in a
-			//	menu of available devices. Since multiple TV cards of the same brand may be installed which are
-			//	supported by the same driver, this name should be combined with the character device file name
-			//	(e.g. /dev/video2) or the bus_info string to avoid ambiguities.
-			Name:       name + LabelSeparator + busInfo,
-			Label:      label + LabelSeparator + reallink,
-			DeviceType: driver.Camera,
-			Priority:   priority,
-		})
+// stableID identifies the device across restarts by its by-id or by-path link, which udev names after the
+// device and the port that it's plugged in. Without them, the bus and the index of the device node are used.
+func (d v4l2Device) stableID(busInfo string) string {
+	if links := filepath.Base(filepath.Dir(d.path)); links == "by-id" || links == "by-path" {
+		return "v4l2:" + links + "/" + d.label
+	}
+	if busInfo != "" {
+		index, _ := os.ReadFile(filepath.Join(sysfs.Dir, "class", "video4linux", d.node, "index"))
+		return "v4l2:" + busInfo + "/" + strings.TrimSpace(string(index))
+	}
+	return "v4l2:" + d.path
+}
+
+// groupID is the USB device that the device node is an interface of, which the microphone of a webcam is
+// also an interface of.
+func (d v4l2Device) groupID() string {
+	return sysfs.USBDevice(filepath.Join(sysfs.Dir, "class", "video4linux", d.node, "device"))
+}
+
+func registerCamera(manager *driver.Manager, device v4l2Device) {
+	cam := newCamera(device.path)
+	priority := driver.PriorityNormal
+	if device.node == prioritizedDevice {
+		priority = driver.PriorityHigh
 	}
+
+	var name, busInfo string
+	if webcamCam, err := webcam.Open(cam.path); err == nil {
+		defer webcamCam.Close()
+		name, _ = webcamCam.GetName()
+		busInfo, _ = webcamCam.GetBusInfo()
+	}
+
+	manager.Register(cam, driver.Info{
+		// 	Source: https://www.kernel.org/doc/html/v4.9/media/uapi/v4l/vidioc-querycap.html
+		//	Name of the device, a NUL-terminated UTF-8 string. For example: “Yoyodyne TV/FM”. One driver may support
+		//	different brands or models of video hardware. This information is intended for users, for example in a
+		//	menu of available devices. Since multiple TV cards of the same brand may be installed which are
+		//	supported by the same driver, this name should be combined with the character device file name
+		//	(e.g. /dev/video2) or the bus_info string to avoid ambiguities.
+		Name:       name + LabelSeparator + busInfo,
+		Label:      device.label + LabelSeparator + device.node,
+		DeviceType: driver.Camera,
+		Priority:   priority,
+		StableID:   device.stableID(busInfo),
+		GroupID:    device.groupID(),
+	})
 }
 
 func newCamera(path string) *camera {
@@ -168,6 +171,7 @@ func newCamera(path string) *camera {
 		webcam.PixelFormat(C.V4L2_PIX_FMT_YUYV):   frame.FormatYUYV,
 		webcam.PixelFormat(C.V4L2_PIX_FMT_UYVY):   frame.FormatUYVY,
 		webcam.PixelFormat(C.V4L2_PIX_FMT_MJPEG):  frame.FormatMJPEG,
+		webcam.PixelFormat(C.V4L2_PIX_FMT_H264):   frame.FormatH264,
 		webcam.PixelFormat(C.V4L2_PIX_FMT_Z16):    frame.FormatZ16,
 	}
 
@@ -209,8 +213,17 @@ func (c *camera) Open() error {
 		return err
 	}
 
+	// The controls and the formats are queried through a descriptor of their own, since webcam doesn't
+	// expose its one
+	dev, err := openFDDevice(c.path)
+	if err != nil {
+		cam.Close()
+		return err
+	}
+
 	c.prevFrameTime = time.Now()
 	c.cam = cam
+	c.dev = dev
 	return nil
 }
 
@@ -232,18 +245,88 @@ func (c *camera) Close() error {
 		c.cam.StopStreaming()
 		c.cancel = nil
 	}
+	if dev, ok := c.dev.(fdDevice); ok {
+		dev.close()
+		c.dev = nil
+	}
 	c.cam.Close()
 	return nil
 }
 
+func (c *camera) Controls() []driver.Control {
+	if c.dev == nil {
+		return nil
+	}
+	return enumerateControls(c.dev)
+}
+
+func (c *camera) GetControl(id driver.ControlID) (int32, error) {
+	if c.dev == nil {
+		return 0, errUnknownControl
+	}
+	return getControl(c.dev, id)
+}
+
+func (c *camera) SetControl(id driver.ControlID, value int32) error {
+	if c.dev == nil {
+		return errUnknownControl
+	}
+	return setControl(c.dev, id, value)
+}
+
 func (c *camera) VideoRecord(p prop.Media) (video.Reader, error) {
 	decoder, err := frame.NewDecoder(p.FrameFormat)
 	if err != nil {
 		return nil, err
 	}
 
+	read, err := c.startStreaming(p)
+	if err != nil {
+		return nil, err
+	}
+
+	r := video.TimestampedReaderFunc(func() (img image.Image, timestamp time.Time, release func(), err error) {
+		timestamp, err = read(func(b []byte) {
+			// The decoders move the memory from mmap to Go. This will guarantee that any data that's going out
+			// from this reader will be Go safe. Otherwise, it's possible that outside of this reader
+			// that this memory is still being used even after we close it.
+			img, release, err = decoder.Decode(b, p.Width, p.Height)
+		})
+		if release == nil {
+			release = func() {}
+		}
+		return img, timestamp, release, err
+	})
+
+	return r, nil
+}
+
+// EncodedVideoRecord records MJPEG or H.264 frames with p, which are read as they are. Each frame is
+// copied from the mmap'd buffer, so it can be shared by the readers.
+func (c *camera) EncodedVideoRecord(p prop.Media) (driver.EncodedVideoReader, error) {
+	if !frame.IsCompressed(p.FrameFormat) {
+		return nil, errNotCompressed
+	}
+
+	read, err := c.startStreaming(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.EncodedVideoReaderFunc(func() ([]byte, time.Time, error) {
+		var data []byte
+		timestamp, err := read(func(b []byte) {
+			data = append([]byte(nil), b...)
+		})
+		return data, timestamp, err
+	}), nil
+}
+
+// startStreaming starts streaming with p. The returned function waits for a frame, and gives it to
+// process while the buffer is still mmap'd.
+func (c *camera) startStreaming(p prop.Media) (func(process func(b []byte)) (time.Time, error), error) {
 	pf := c.reversedFormats[p.FrameFormat]
-	_, _, _, err = c.cam.SetImageFormat(pf, uint32(p.Width), uint32(p.Height))
+	_, _, _, err := c.cam.SetImageFormat(pf, uint32(p.Width), uint32(p.Height))
 	if err != nil {
 		return nil, err
 	}
@@ -265,8 +348,9 @@ func (c *camera) VideoRecord(p prop.Media) (video.Reader, error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	c.cancel = cancel
-	var buf []byte
-	r := video.ReaderFunc(func() (img image.Image, release func(), err error) {
+	// The webcam package doesn't expose the V4L2 buffer timestamps, so frames are stamped as soon as
+	// they're dequeued. This is closer to the capture time than stamping them after decoding.
+	return func(process func(b []byte)) (timestamp time.Time, err error) {
 		// Lock to avoid accessing the buffer after StopStreaming()
 		c.mutex.Lock()
 		defer c.mutex.Unlock()
@@ -275,7 +359,7 @@ func (c *camera) VideoRecord(p prop.Media) (video.Reader, error) {
 		for i := 0; i < maxEmptyFrameCount; i++ {
 			if ctx.Err() != nil {
 				// Return EOF if the camera is already closed.
-				return nil, func() {}, io.EOF
+				return time.Time{}, io.EOF
 			}
 
 			if p.DiscardFramesOlderThan != 0 && time.Now().Sub(c.prevFrameTime) >= p.DiscardFramesOlderThan {
@@ -288,17 +372,18 @@ func (c *camera) VideoRecord(p prop.Media) (video.Reader, error) {
 			err := cam.WaitForFrame(readTimeoutSec)
 			switch err.(type) {
 			case nil:
+				timestamp = time.Now()
 			case *webcam.Timeout:
-				return nil, func() {}, errReadTimeout
+				return time.Time{}, errReadTimeout
 			default:
 				// Camera has been stopped.
-				return nil, func() {}, err
+				return time.Time{}, err
 			}
 
 			b, err := cam.ReadFrame()
 			if err != nil {
 				// Camera has been stopped.
-				return nil, func() {}, err
+				return time.Time{}, err
 			}
 
 			if p.DiscardFramesOlderThan != 0 {
@@ -311,102 +396,33 @@ func (c *camera) VideoRecord(p prop.Media) (video.Reader, error) {
 				continue
 			}
 
-			if len(b) > len(buf) {
-				// Grow the intermediate buffer
-				buf = make([]byte, len(b))
-			}
-
-			// move the memory from mmap to Go. This will guarantee that any data that's going out
-			// from this reader will be Go safe. Otherwise, it's possible that outside of this reader
-			// that this memory is still being used even after we close it.
-			n := copy(buf, b)
-			return decoder.Decode(buf[:n], p.Width, p.Height)
+			process(b)
+			return timestamp, nil
 		}
-		return nil, func() {}, errEmptyFrame
-	})
-
-	return r, nil
+		return time.Time{}, errEmptyFrame
+	}, nil
 }
 
 func (c *camera) Properties() []prop.Media {
+	if c.dev == nil {
+		return nil
+	}
+
 	properties := make([]prop.Media, 0)
 	for format := range c.cam.GetSupportedFormats() {
-		for _, frameSize := range c.cam.GetSupportedFrameSizes(format) {
-			supportedFormat, ok := c.formats[format]
-			if !ok {
-				continue
-			}
-
-			if frameSize.StepWidth == 0 || frameSize.StepHeight == 0 {
-				framerates := c.cam.GetSupportedFramerates(format, uint32(frameSize.MaxWidth), uint32(frameSize.MaxHeight))
-				// If the camera doesn't support framerate, we just add the resolution and format
-				if len(framerates) == 0 {
-					properties = append(properties, prop.Media{
-						Video: prop.Video{
-							Width:       int(frameSize.MaxWidth),
-							Height:      int(frameSize.MaxHeight),
-							FrameFormat: supportedFormat,
-						},
-					})
-					continue
-				}
-
-				for _, framerate := range framerates {
-					for _, fps := range enumFramerate(framerate) {
-						properties = append(properties, prop.Media{
-							Video: prop.Video{
-								Width:       int(frameSize.MaxWidth),
-								Height:      int(frameSize.MaxHeight),
-								FrameFormat: supportedFormat,
-								FrameRate:   fps,
-							},
-						})
-					}
-				}
-			} else {
-				// FIXME: we should probably use a custom data structure to capture all of the supported resolutions
-				for _, supportedResolution := range supportedResolutions {
-					minWidth, minHeight := int(frameSize.MinWidth), int(frameSize.MinHeight)
-					maxWidth, maxHeight := int(frameSize.MaxWidth), int(frameSize.MaxHeight)
-					stepWidth, stepHeight := int(frameSize.StepWidth), int(frameSize.StepHeight)
-					width, height := supportedResolution[0], supportedResolution[1]
-
-					if width < minWidth || width > maxWidth ||
-						height < minHeight || height > maxHeight {
-						continue
-					}
-
-					if (width-minWidth)%stepWidth != 0 ||
-						(height-minHeight)%stepHeight != 0 {
-						continue
-					}
-
-					framerates := c.cam.GetSupportedFramerates(format, uint32(width), uint32(height))
-					if len(framerates) == 0 {
-						properties = append(properties, prop.Media{
-							Video: prop.Video{
-								Width:       width,
-								Height:      height,
-								FrameFormat: supportedFormat,
-							},
-						})
-						continue
-					}
-
-					for _, framerate := range framerates {
-						for _, fps := range enumFramerate(framerate) {
-							properties = append(properties, prop.Media{
-								Video: prop.Video{
-									Width:       width,
-									Height:      height,
-									FrameFormat: supportedFormat,
-									FrameRate:   fps,
-								},
-							})
-						}
-					}
-				}
-			}
+		supportedFormat, ok := c.formats[format]
+		if !ok {
+			continue
+		}
+		for _, mode := range enumerateModes(c.dev, uint32(format)) {
+			properties = append(properties, prop.Media{
+				Video: prop.Video{
+					Width:       mode.width,
+					Height:      mode.height,
+					FrameFormat: supportedFormat,
+					FrameRate:   mode.frameRate,
+				},
+			})
 		}
 	}
 	return properties
@@ -445,31 +461,6 @@ func (c *camera) IsAvailable() (bool, error) {
 	}
 }
 
-// enumFramerate returns a list of fps options from a FrameRate struct.
-// discrete framerates will return a list of 1 fps element.
-// stepwise framerates will return a list of all possible fps options.
-func enumFramerate(framerate webcam.FrameRate) []float32 {
-	var framerates []float32
-	if framerate.StepNumerator == 0 && framerate.StepDenominator == 0 {
-		fr, err := calcFramerate(framerate.MaxNumerator, framerate.MaxDenominator)
-		if err != nil {
-			return framerates
-		}
-		framerates = append(framerates, fr)
-	} else {
-		for n := framerate.MinNumerator; n <= framerate.MaxNumerator; n += framerate.StepNumerator {
-			for d := framerate.MinDenominator; d <= framerate.MaxDenominator; d += framerate.StepDenominator {
-				fr, err := calcFramerate(n, d)
-				if err != nil {
-					continue
-				}
-				framerates = append(framerates, fr)
-			}
-		}
-	}
-	return framerates
-}
-
 // calcFramerate turns fraction into a float32 fps value.
 func calcFramerate(numerator uint32, denominator uint32) (float32, error) {
 	if denominator == 0 {
@@ -11,6 +11,13 @@ import (
 	"github.com/pion/mediadevices/pkg/driver"
 )
 
+// discover registers the cameras matching pattern, which haven't been discovered yet.
+func discover(discovered map[string]struct{}, pattern string) {
+	for _, device := range findDevices(discovered, pattern) {
+		registerCamera(driver.GetManager(), device)
+	}
+}
+
 func TestDiscover(t *testing.T) {
 	const (
 		shortName  = "unittest-video0"
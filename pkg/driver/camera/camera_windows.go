@@ -63,6 +63,8 @@ func Initialize() {
 		info := driver.Info{
 			Label:      label,
 			DeviceType: driver.Camera,
+			// The name of a DirectShow device is its device path, which is stable
+			StableID: label,
 		}
 		if fn := C.getFriendlyName(&list, C.int(i)); fn != nil {
 			info.Name = C.GoString(fn)
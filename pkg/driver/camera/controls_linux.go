@@ -0,0 +1,277 @@
+package camera
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/blackjack/webcam"
+	"github.com/blackjack/webcam/ioctl"
+	"github.com/pion/mediadevices/pkg/driver"
+	"golang.org/x/sys/unix"
+)
+
+var errUnknownControl = errors.New("unknown control")
+
+// The V4L2 control IDs, types and flags.
+// Reference: https://www.kernel.org/doc/html/latest/userspace-api/media/v4l/vidioc-queryctrl.html
+const (
+	v4l2CIDBase             uint32 = 0x00980900
+	v4l2CIDBrightness       uint32 = v4l2CIDBase + 0
+	v4l2CIDAutoWhiteBalance uint32 = v4l2CIDBase + 12
+	v4l2CIDCameraClassBase  uint32 = 0x009a0900
+	v4l2CIDExposureAuto     uint32 = v4l2CIDCameraClassBase + 1
+	v4l2CIDPanAbsolute      uint32 = v4l2CIDCameraClassBase + 8
+	v4l2CIDTiltAbsolute     uint32 = v4l2CIDCameraClassBase + 9
+	v4l2CIDFocusAbsolute    uint32 = v4l2CIDCameraClassBase + 10
+	v4l2CIDFocusAuto        uint32 = v4l2CIDCameraClassBase + 12
+	v4l2CIDZoomAbsolute     uint32 = v4l2CIDCameraClassBase + 13
+	v4l2CtrlTypeInteger     uint32 = 1
+	v4l2CtrlTypeBoolean     uint32 = 2
+	v4l2CtrlTypeMenu        uint32 = 3
+	v4l2CtrlTypeIntegerMenu uint32 = 9
+	v4l2CtrlFlagDisabled    uint32 = 0x0001
+	v4l2CtrlFlagNextCtrl    uint32 = 0x80000000
+	v4l2ExposureAuto        int32  = 0
+	v4l2ExposureManual      int32  = 1
+	v4l2ExposureShutter     int32  = 2
+	v4l2ExposureAperture    int32  = 3
+)
+
+const (
+	// v4l2ControlIDPrefix is the prefix of the IDs of the controls that don't have well-known IDs,
+	// which are followed by the V4L2 control ID, e.g. "v4l2:0x980901"
+	v4l2ControlIDPrefix       = "v4l2:"
+	v4l2ControlModeManual     = "manual"
+	v4l2ControlModeContinuous = "continuous"
+)
+
+// v4l2QueryCtrl is struct v4l2_queryctrl.
+type v4l2QueryCtrl struct {
+	id           uint32
+	typ          uint32
+	name         [32]byte
+	minimum      int32
+	maximum      int32
+	step         int32
+	defaultValue int32
+	flags        uint32
+	reserved     [2]uint32
+}
+
+// v4l2QueryMenu is struct v4l2_querymenu. name is a union with the int64 value of integer menus.
+type v4l2QueryMenu struct {
+	id       uint32
+	index    uint32
+	name     [32]byte
+	reserved uint32
+}
+
+// v4l2Control is struct v4l2_control.
+type v4l2Control struct {
+	id    uint32
+	value int32
+}
+
+var (
+	vidiocGCtrl     = ioctl.IoRW('V', 27, unsafe.Sizeof(v4l2Control{}))
+	vidiocSCtrl     = ioctl.IoRW('V', 28, unsafe.Sizeof(v4l2Control{}))
+	vidiocQueryCtrl = ioctl.IoRW('V', 36, unsafe.Sizeof(v4l2QueryCtrl{}))
+	vidiocQueryMenu = ioctl.IoRW('V', 37, unsafe.Sizeof(v4l2QueryMenu{}))
+)
+
+// v4l2ControlIDs are the V4L2 controls that have well-known IDs.
+var v4l2ControlIDs = map[uint32]driver.ControlID{
+	v4l2CIDBrightness:       driver.ControlBrightness,
+	v4l2CIDAutoWhiteBalance: driver.ControlWhiteBalanceMode,
+	v4l2CIDExposureAuto:     driver.ControlExposureMode,
+	v4l2CIDPanAbsolute:      driver.ControlPan,
+	v4l2CIDTiltAbsolute:     driver.ControlTilt,
+	v4l2CIDFocusAbsolute:    driver.ControlFocusDistance,
+	v4l2CIDZoomAbsolute:     driver.ControlZoom,
+}
+
+// controlDevice is a V4L2 device that controls are queried and set with. It's an interface, so that
+// the controls can be parsed from recorded ioctl responses.
+type controlDevice interface {
+	queryControl(q *v4l2QueryCtrl) error
+	queryMenu(q *v4l2QueryMenu) error
+	getControl(id uint32) (int32, error)
+	setControl(id uint32, value int32) error
+}
+
+// ioctlDevice is a V4L2 device whose controls and formats are queried with ioctls.
+type ioctlDevice interface {
+	controlDevice
+	formatDevice
+}
+
+// fdDevice is an ioctlDevice of an open device node.
+type fdDevice int
+
+func openFDDevice(path string) (fdDevice, error) {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	return fdDevice(fd), err
+}
+
+func (fd fdDevice) close() error {
+	return unix.Close(int(fd))
+}
+
+func (fd fdDevice) queryControl(q *v4l2QueryCtrl) error {
+	return ioctl.Ioctl(uintptr(fd), vidiocQueryCtrl, uintptr(unsafe.Pointer(q)))
+}
+
+func (fd fdDevice) queryMenu(q *v4l2QueryMenu) error {
+	return ioctl.Ioctl(uintptr(fd), vidiocQueryMenu, uintptr(unsafe.Pointer(q)))
+}
+
+func (fd fdDevice) getControl(id uint32) (int32, error) {
+	c := v4l2Control{id: id}
+	err := ioctl.Ioctl(uintptr(fd), vidiocGCtrl, uintptr(unsafe.Pointer(&c)))
+	return c.value, err
+}
+
+func (fd fdDevice) setControl(id uint32, value int32) error {
+	c := v4l2Control{id: id, value: value}
+	return ioctl.Ioctl(uintptr(fd), vidiocSCtrl, uintptr(unsafe.Pointer(&c)))
+}
+
+// enumerateControls lists the enabled controls of dev, whose values are integers, booleans or menus.
+func enumerateControls(dev controlDevice) []driver.Control {
+	var controls []driver.Control
+	q := v4l2QueryCtrl{id: v4l2CtrlFlagNextCtrl}
+	for dev.queryControl(&q) == nil {
+		next := q.id | v4l2CtrlFlagNextCtrl
+		if q.flags&v4l2CtrlFlagDisabled == 0 {
+			if c, ok := parseControl(dev, q); ok {
+				controls = append(controls, c)
+			}
+		}
+		q = v4l2QueryCtrl{id: next}
+	}
+	return controls
+}
+
+// parseControl converts q to a control. The menus are queried from dev.
+func parseControl(dev controlDevice, q v4l2QueryCtrl) (driver.Control, bool) {
+	c := driver.Control{
+		ID:      controlID(q.id),
+		Name:    webcam.CToGoString(q.name[:]),
+		Min:     q.minimum,
+		Max:     q.maximum,
+		Step:    q.step,
+		Default: q.defaultValue,
+	}
+	switch q.typ {
+	case v4l2CtrlTypeInteger:
+		c.Type = driver.ControlTypeInteger
+	case v4l2CtrlTypeBoolean:
+		c.Type = driver.ControlTypeBoolean
+	case v4l2CtrlTypeMenu, v4l2CtrlTypeIntegerMenu:
+		c.Type = driver.ControlTypeMenu
+		for i := q.minimum; i <= q.maximum; i++ {
+			m := v4l2QueryMenu{id: q.id, index: uint32(i)}
+			// Some of the indexes may be skipped
+			if dev.queryMenu(&m) != nil {
+				continue
+			}
+			name := webcam.CToGoString(m.name[:])
+			if q.typ == v4l2CtrlTypeIntegerMenu {
+				name = strconv.FormatInt(int64(binary.LittleEndian.Uint64(m.name[:8])), 10)
+			}
+			c.Menu = append(c.Menu, driver.ControlMenuItem{Value: i, Name: name})
+		}
+	default:
+		return driver.Control{}, false
+	}
+
+	// The modes are menus of "manual" and "continuous", like in the constraints
+	switch q.id {
+	case v4l2CIDExposureAuto:
+		c.Menu = exposureModes(c.Menu)
+	case v4l2CIDAutoWhiteBalance:
+		c.Type = driver.ControlTypeMenu
+		c.Menu = []driver.ControlMenuItem{
+			{Value: 0, Name: v4l2ControlModeManual},
+			{Value: 1, Name: v4l2ControlModeContinuous},
+		}
+	}
+	return c, true
+}
+
+// exposureModes renames the V4L2 exposure modes to "manual" and "continuous". The first of the V4L2
+// modes is kept for each of them, so that manual is preferred over shutter priority, and auto over
+// aperture priority.
+func exposureModes(menu []driver.ControlMenuItem) []driver.ControlMenuItem {
+	var modes []driver.ControlMenuItem
+	seen := make(map[string]bool)
+	for _, item := range menu {
+		switch item.Value {
+		case v4l2ExposureManual, v4l2ExposureShutter:
+			item.Name = v4l2ControlModeManual
+		case v4l2ExposureAuto, v4l2ExposureAperture:
+			item.Name = v4l2ControlModeContinuous
+		default:
+			continue
+		}
+		if !seen[item.Name] {
+			seen[item.Name] = true
+			modes = append(modes, item)
+		}
+	}
+	return modes
+}
+
+// controlID returns the ID of the V4L2 control cid.
+func controlID(cid uint32) driver.ControlID {
+	if id, ok := v4l2ControlIDs[cid]; ok {
+		return id
+	}
+	return driver.ControlID(fmt.Sprintf("%s%#x", v4l2ControlIDPrefix, cid))
+}
+
+// v4l2ControlID returns the V4L2 control of id.
+func v4l2ControlID(id driver.ControlID) (uint32, error) {
+	for cid, wellKnown := range v4l2ControlIDs {
+		if wellKnown == id {
+			return cid, nil
+		}
+	}
+	if s, ok := strings.CutPrefix(string(id), v4l2ControlIDPrefix); ok {
+		if cid, err := strconv.ParseUint(s, 0, 32); err == nil {
+			return uint32(cid), nil
+		}
+	}
+	return 0, errUnknownControl
+}
+
+// getControl returns the value of the control id of dev.
+func getControl(dev controlDevice, id driver.ControlID) (int32, error) {
+	cid, err := v4l2ControlID(id)
+	if err != nil {
+		return 0, err
+	}
+	return dev.getControl(cid)
+}
+
+// setControl sets the control id of dev to value. Auto focus is switched off to set the focus
+// distance, which can't be set otherwise.
+func setControl(dev controlDevice, id driver.ControlID, value int32) error {
+	cid, err := v4l2ControlID(id)
+	if err != nil {
+		return err
+	}
+	if cid == v4l2CIDFocusAbsolute {
+		q := v4l2QueryCtrl{id: v4l2CIDFocusAuto}
+		if dev.queryControl(&q) == nil && q.flags&v4l2CtrlFlagDisabled == 0 {
+			if err := dev.setControl(v4l2CIDFocusAuto, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return dev.setControl(cid, value)
+}
@@ -0,0 +1,154 @@
+package camera
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/pion/mediadevices/pkg/driver"
+)
+
+// recordedControlDevice replays the ioctl responses of a device.
+type recordedControlDevice struct {
+	controls []v4l2QueryCtrl
+	// menus are the names of the menu items, by control and index
+	menus  map[uint32]map[uint32]string
+	values map[uint32]int32
+	// set are the controls that have been set, in order
+	set []uint32
+}
+
+func (d *recordedControlDevice) queryControl(q *v4l2QueryCtrl) error {
+	id := q.id &^ v4l2CtrlFlagNextCtrl
+	for _, c := range d.controls {
+		if (q.id&v4l2CtrlFlagNextCtrl != 0 && c.id > id) || c.id == q.id {
+			*q = c
+			return nil
+		}
+	}
+	return syscall.EINVAL
+}
+
+func (d *recordedControlDevice) queryMenu(q *v4l2QueryMenu) error {
+	name, ok := d.menus[q.id][q.index]
+	if !ok {
+		return syscall.EINVAL
+	}
+	copy(q.name[:], name)
+	return nil
+}
+
+func (d *recordedControlDevice) getControl(id uint32) (int32, error) {
+	value, ok := d.values[id]
+	if !ok {
+		return 0, syscall.EINVAL
+	}
+	return value, nil
+}
+
+func (d *recordedControlDevice) setControl(id uint32, value int32) error {
+	if _, ok := d.values[id]; !ok {
+		return syscall.EINVAL
+	}
+	d.values[id] = value
+	d.set = append(d.set, id)
+	return nil
+}
+
+func queryCtrl(id, typ uint32, name string, minimum, maximum, step, defaultValue int32, flags uint32) v4l2QueryCtrl {
+	q := v4l2QueryCtrl{id: id, typ: typ, minimum: minimum, maximum: maximum, step: step, defaultValue: defaultValue, flags: flags}
+	copy(q.name[:], name)
+	return q
+}
+
+// newUVCCamera returns the controls of a UVC webcam, as they were queried from it.
+func newUVCCamera() *recordedControlDevice {
+	return &recordedControlDevice{
+		controls: []v4l2QueryCtrl{
+			queryCtrl(0x00980001, 6, "User Controls", 0, 0, 0, 0, 0x44),
+			queryCtrl(v4l2CIDBrightness, v4l2CtrlTypeInteger, "Brightness", 0, 255, 1, 128, 0),
+			queryCtrl(0x00980902, v4l2CtrlTypeInteger, "Contrast", 0, 255, 1, 128, 0),
+			queryCtrl(v4l2CIDAutoWhiteBalance, v4l2CtrlTypeBoolean, "White Balance, Automatic", 0, 1, 1, 1, 0),
+			queryCtrl(0x00980918, v4l2CtrlTypeMenu, "Power Line Frequency", 0, 2, 1, 2, 0),
+			queryCtrl(0x0098091a, v4l2CtrlTypeInteger, "White Balance Temperature", 2000, 6500, 1, 4000, 0x10),
+			queryCtrl(0x009a0001, 6, "Camera Controls", 0, 0, 0, 0, 0x44),
+			queryCtrl(v4l2CIDExposureAuto, v4l2CtrlTypeMenu, "Auto Exposure", 0, 3, 1, 3, 0),
+			queryCtrl(0x009a0902, v4l2CtrlTypeInteger, "Exposure Time, Absolute", 3, 2047, 1, 250, 0x10),
+			queryCtrl(v4l2CIDPanAbsolute, v4l2CtrlTypeInteger, "Pan, Absolute", -36000, 36000, 3600, 0, 0),
+			queryCtrl(v4l2CIDTiltAbsolute, v4l2CtrlTypeInteger, "Tilt, Absolute", -36000, 36000, 3600, 0, 0),
+			queryCtrl(v4l2CIDFocusAbsolute, v4l2CtrlTypeInteger, "Focus, Absolute", 0, 250, 5, 0, 0x10),
+			queryCtrl(v4l2CIDFocusAuto, v4l2CtrlTypeBoolean, "Focus, Automatic Continuous", 0, 1, 1, 1, 0),
+			queryCtrl(v4l2CIDZoomAbsolute, v4l2CtrlTypeInteger, "Zoom, Absolute", 100, 500, 1, 100, 0),
+			queryCtrl(0x009a0910, v4l2CtrlTypeBoolean, "Privacy", 0, 1, 1, 0, v4l2CtrlFlagDisabled),
+		},
+		menus: map[uint32]map[uint32]string{
+			0x00980918:          {0: "Disabled", 1: "50 Hz", 2: "60 Hz"},
+			v4l2CIDExposureAuto: {1: "Manual Mode", 3: "Aperture Priority Mode"},
+		},
+		values: map[uint32]int32{
+			v4l2CIDBrightness:    128,
+			v4l2CIDFocusAbsolute: 0,
+			v4l2CIDFocusAuto:     1,
+			v4l2CIDZoomAbsolute:  100,
+		},
+	}
+}
+
+func TestEnumerateControls(t *testing.T) {
+	controls := enumerateControls(newUVCCamera())
+
+	expected := []driver.Control{
+		{ID: driver.ControlBrightness, Name: "Brightness", Type: driver.ControlTypeInteger, Max: 255, Step: 1, Default: 128},
+		{ID: "v4l2:0x980902", Name: "Contrast", Type: driver.ControlTypeInteger, Max: 255, Step: 1, Default: 128},
+		{
+			ID: driver.ControlWhiteBalanceMode, Name: "White Balance, Automatic", Type: driver.ControlTypeMenu, Max: 1, Step: 1, Default: 1,
+			Menu: []driver.ControlMenuItem{{Value: 0, Name: "manual"}, {Value: 1, Name: "continuous"}},
+		},
+		{
+			ID: "v4l2:0x980918", Name: "Power Line Frequency", Type: driver.ControlTypeMenu, Max: 2, Step: 1, Default: 2,
+			Menu: []driver.ControlMenuItem{{Value: 0, Name: "Disabled"}, {Value: 1, Name: "50 Hz"}, {Value: 2, Name: "60 Hz"}},
+		},
+		{ID: "v4l2:0x98091a", Name: "White Balance Temperature", Type: driver.ControlTypeInteger, Min: 2000, Max: 6500, Step: 1, Default: 4000},
+		{
+			ID: driver.ControlExposureMode, Name: "Auto Exposure", Type: driver.ControlTypeMenu, Max: 3, Step: 1, Default: 3,
+			Menu: []driver.ControlMenuItem{{Value: 1, Name: "manual"}, {Value: 3, Name: "continuous"}},
+		},
+		{ID: "v4l2:0x9a0902", Name: "Exposure Time, Absolute", Type: driver.ControlTypeInteger, Min: 3, Max: 2047, Step: 1, Default: 250},
+		{ID: driver.ControlPan, Name: "Pan, Absolute", Type: driver.ControlTypeInteger, Min: -36000, Max: 36000, Step: 3600},
+		{ID: driver.ControlTilt, Name: "Tilt, Absolute", Type: driver.ControlTypeInteger, Min: -36000, Max: 36000, Step: 3600},
+		{ID: driver.ControlFocusDistance, Name: "Focus, Absolute", Type: driver.ControlTypeInteger, Max: 250, Step: 5},
+		{ID: "v4l2:0x9a090c", Name: "Focus, Automatic Continuous", Type: driver.ControlTypeBoolean, Max: 1, Step: 1, Default: 1},
+		{ID: driver.ControlZoom, Name: "Zoom, Absolute", Type: driver.ControlTypeInteger, Min: 100, Max: 500, Step: 1, Default: 100},
+	}
+	if !reflect.DeepEqual(expected, controls) {
+		t.Errorf("Expected controls\n%+v\ngot\n%+v", expected, controls)
+	}
+}
+
+func TestSetControl(t *testing.T) {
+	dev := newUVCCamera()
+
+	if err := setControl(dev, driver.ControlZoom, 200); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := getControl(dev, driver.ControlZoom); err != nil || value != 200 {
+		t.Errorf("Expected the zoom to be 200, got %d (%v)", value, err)
+	}
+
+	// Auto focus is switched off first
+	dev.set = nil
+	if err := setControl(dev, driver.ControlFocusDistance, 50); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []uint32{v4l2CIDFocusAuto, v4l2CIDFocusAbsolute}; !reflect.DeepEqual(expected, dev.set) {
+		t.Errorf("Expected controls %v to be set, got %v", expected, dev.set)
+	}
+
+	// The controls without well-known IDs are set by their V4L2 IDs
+	if value, err := getControl(dev, "v4l2:0x9a090c"); err != nil || value != 0 {
+		t.Errorf("Expected auto focus to be off, got %d (%v)", value, err)
+	}
+	if err := setControl(dev, "unknown", 0); err != errUnknownControl {
+		t.Errorf("Expected %v, got %v", errUnknownControl, err)
+	}
+}
@@ -0,0 +1,312 @@
+package camera
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/mediadevices/internal/logging"
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/driver/availability"
+	"golang.org/x/sys/unix"
+)
+
+var logger = logging.NewLogger("mediadevices/driver/camera")
+
+// devDir is where the device nodes are looked up.
+var devDir = "/dev"
+
+const (
+	// observerSettleDelay is how long the observer waits after a change in devDir before looking for
+	// cameras, so that udev has created all the links of a new device.
+	observerSettleDelay = 500 * time.Millisecond
+	observerPollTimeout = 100 * time.Millisecond
+
+	observerInotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ATTRIB
+)
+
+var (
+	// cameras are the labels of the registered cameras, by device node
+	cameras   = make(map[string]string)
+	camerasMu sync.Mutex
+)
+
+// syncCameras registers the cameras found in dir that aren't registered yet, and unregisters the
+// ones that are gone.
+func syncCameras(manager *driver.Manager, dir string) (connected, disconnected []driver.Driver) {
+	camerasMu.Lock()
+	defer camerasMu.Unlock()
+
+	devices := scanDevices(dir)
+	current := make(map[string]v4l2Device, len(devices))
+	for _, device := range devices {
+		current[device.node] = device
+	}
+
+	for node, label := range cameras {
+		// The device node may also have been reused by another camera
+		if device, ok := current[node]; ok && device.label == label {
+			continue
+		}
+		for _, d := range manager.Query(filterCameraLabel(label, node)) {
+			if err := removeCamera(manager, d); err != nil {
+				logger.Debugf("failed to close disconnected camera %s: %v", label, err)
+			}
+			disconnected = append(disconnected, d)
+		}
+		delete(cameras, node)
+	}
+
+	for _, device := range devices {
+		if _, ok := cameras[device.node]; ok {
+			continue
+		}
+		registerCamera(manager, device)
+		cameras[device.node] = device.label
+		connected = append(connected, manager.Query(filterCameraLabel(device.label, device.node))...)
+	}
+
+	return connected, disconnected
+}
+
+// notifyAvailabilityChanges tells the manager that the registered cameras whose device node or link is one
+// of names may have become available or unavailable, e.g. because the permissions of the device node have
+// changed. The cameras that were just connected are skipped.
+func notifyAvailabilityChanges(manager *driver.Manager, names map[string]struct{}, connected []driver.Driver) {
+	camerasMu.Lock()
+	var filters []driver.FilterFn
+	for node, label := range cameras {
+		_, nodeChanged := names[node]
+		_, labelChanged := names[label]
+		if nodeChanged || labelChanged {
+			filters = append(filters, filterCameraLabel(label, node))
+		}
+	}
+	camerasMu.Unlock()
+
+	for _, filter := range filters {
+		for _, d := range manager.Query(filter) {
+			if !slices.Contains(connected, d) {
+				manager.NotifyAvailabilityChanged(d.ID())
+			}
+		}
+	}
+}
+
+// parseInotifyAttribNames returns the names of the files whose attributes changed, from the inotify events
+// in b.
+func parseInotifyAttribNames(b []byte, names map[string]struct{}) {
+	for len(b) >= unix.SizeofInotifyEvent {
+		// struct inotify_event is wd, mask, cookie and len, followed by the name padded with zeros
+		mask := binary.NativeEndian.Uint32(b[4:8])
+		nameLen := int(binary.NativeEndian.Uint32(b[12:16]))
+		b = b[unix.SizeofInotifyEvent:]
+		if nameLen > len(b) {
+			return
+		}
+		name := strings.TrimRight(string(b[:nameLen]), "\x00")
+		b = b[nameLen:]
+		if mask&unix.IN_ATTRIB != 0 && name != "" {
+			names[name] = struct{}{}
+		}
+	}
+}
+
+func filterCameraLabel(label, node string) driver.FilterFn {
+	return driver.FilterAnd(
+		driver.FilterDeviceType(driver.Camera),
+		func(d driver.Driver) bool {
+			return d.Info().Label == label+LabelSeparator+node
+		},
+	)
+}
+
+type observerStateType int
+
+const (
+	observerInitial observerStateType = iota
+	observerSetup
+	observerRunning
+	observerDestroyed
+)
+
+// deviceObserver watches devDir with inotify, and keeps the registered cameras in sync with it.
+// The observer is single-use. Once DestroyObserver is called, it cannot be restarted.
+type deviceObserver struct {
+	mu    sync.Mutex
+	state observerStateType
+	fd    int
+	// Closed to stop the observer goroutine
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+var observer = &deviceObserver{}
+
+// SetupObserver initializes the device observer without starting monitoring.
+// Safe to call concurrently and idempotent; multiple calls are no-ops if already setup.
+func SetupObserver() error {
+	return observer.setup()
+}
+
+// StartObserver starts the background observer to monitor for device changes.
+// If SetupObserver has not been called, StartObserver will call it first.
+// Safe to call concurrently and idempotently.
+func StartObserver() error {
+	return observer.start()
+}
+
+// DestroyObserver destroys the device observer and releases all resources.
+// The observer is single-use and cannot be restarted after being destroyed.
+// Safe to call concurrently and idempotently.
+func DestroyObserver() error {
+	return observer.destroy()
+}
+
+func (obs *deviceObserver) setup() error {
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+
+	switch obs.state {
+	case observerSetup, observerRunning:
+		return nil
+	case observerDestroyed:
+		return availability.ErrObserverUnavailable
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	obs.fd = fd
+	if err := obs.addWatch(devDir); err != nil {
+		unix.Close(fd)
+		return err
+	}
+	obs.addLinkWatches()
+
+	obs.state = observerSetup
+	return nil
+}
+
+// addWatch starts watching dir. Directories that are already watched are ignored. obs.mu must be held.
+func (obs *deviceObserver) addWatch(dir string) error {
+	_, err := unix.InotifyAddWatch(obs.fd, dir, observerInotifyMask)
+	return err
+}
+
+// addLinkWatches watches the directories of the links to the device nodes, which udev creates with
+// the first camera. obs.mu must be held.
+func (obs *deviceObserver) addLinkWatches() {
+	for _, dir := range []string{"v4l", "v4l/by-id", "v4l/by-path"} {
+		dir = filepath.Join(devDir, dir)
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := obs.addWatch(dir); err != nil {
+			logger.Debugf("failed to watch %s: %v", dir, err)
+		}
+	}
+}
+
+func (obs *deviceObserver) start() error {
+	if err := obs.setup(); err != nil {
+		return err
+	}
+
+	obs.mu.Lock()
+	if obs.state != observerSetup {
+		// Already running, or destroyed concurrently
+		defer obs.mu.Unlock()
+		if obs.state == observerDestroyed {
+			return availability.ErrObserverUnavailable
+		}
+		return nil
+	}
+	obs.state = observerRunning
+	obs.done = make(chan struct{})
+	obs.wg.Add(1)
+	obs.mu.Unlock()
+
+	// Devices may have changed since Initialize
+	notifyCameraChanges(syncCameras(driver.GetManager(), devDir))
+
+	go obs.run()
+	return nil
+}
+
+func (obs *deviceObserver) run() {
+	defer obs.wg.Done()
+
+	buf := make([]byte, 4096)
+	var lastChange time.Time
+	// attribChanged are the names of the files whose attributes changed since the last sync
+	attribChanged := make(map[string]struct{})
+	for {
+		select {
+		case <-obs.done:
+			return
+		default:
+		}
+
+		fds := []unix.PollFd{{Fd: int32(obs.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(observerPollTimeout/time.Millisecond))
+		if err != nil && !errors.Is(err, unix.EINTR) {
+			logger.Errorf("device observer stopped: %v", err)
+			return
+		}
+		if n > 0 {
+			for {
+				n, err := unix.Read(obs.fd, buf)
+				if err != nil || n <= 0 {
+					break
+				}
+				parseInotifyAttribNames(buf[:n], attribChanged)
+			}
+			lastChange = time.Now()
+			continue
+		}
+
+		if !lastChange.IsZero() && time.Since(lastChange) >= observerSettleDelay {
+			lastChange = time.Time{}
+			obs.mu.Lock()
+			obs.addLinkWatches()
+			obs.mu.Unlock()
+			connected, disconnected := syncCameras(driver.GetManager(), devDir)
+			notifyCameraChanges(connected, disconnected)
+			notifyAvailabilityChanges(driver.GetManager(), attribChanged, connected)
+			clear(attribChanged)
+		}
+	}
+}
+
+func notifyCameraChanges(connected, disconnected []driver.Driver) {
+	for _, d := range disconnected {
+		notifyDeviceChange(d, DeviceEventDisconnected)
+	}
+	for _, d := range connected {
+		notifyDeviceChange(d, DeviceEventConnected)
+	}
+}
+
+func (obs *deviceObserver) destroy() error {
+	obs.mu.Lock()
+	state := obs.state
+	obs.state = observerDestroyed
+	obs.mu.Unlock()
+
+	switch state {
+	case observerRunning:
+		close(obs.done)
+		obs.wg.Wait()
+		fallthrough
+	case observerSetup:
+		return unix.Close(obs.fd)
+	}
+	return nil
+}
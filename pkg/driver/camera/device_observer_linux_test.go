@@ -0,0 +1,198 @@
+package camera
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/driver/availability"
+)
+
+// useDevDir makes the cameras be looked up in a temporary directory standing in for /dev.
+func useDevDir(t *testing.T) string {
+	dir := t.TempDir()
+	devDir = dir
+	t.Cleanup(func() {
+		devDir = "/dev"
+		Initialize()
+	})
+	return dir
+}
+
+func createDevice(t *testing.T, dir, node, byID string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, node), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if byID == "" {
+		return
+	}
+	byIDDir := filepath.Join(dir, "v4l", "by-id")
+	if err := os.MkdirAll(byIDDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, node), filepath.Join(byIDDir, byID)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func labels(drivers []driver.Driver) []string {
+	var labels []string
+	for _, d := range drivers {
+		labels = append(labels, d.Info().Label)
+	}
+	return labels
+}
+
+func TestSyncCameras(t *testing.T) {
+	dir := useDevDir(t)
+	manager := driver.GetManager()
+
+	createDevice(t, dir, "video90", "usb-unittest-camera-video-index0")
+	connected, disconnected := syncCameras(manager, dir)
+	if len(connected) != 1 || len(disconnected) != 0 {
+		t.Fatalf("Expected a connected camera, got %v, %v", labels(connected), labels(disconnected))
+	}
+	first := connected[0]
+	if label := first.Info().Label; label != "usb-unittest-camera-video-index0"+LabelSeparator+"video90" {
+		t.Errorf("Unexpected label: %s", label)
+	}
+
+	createDevice(t, dir, "video91", "")
+	connected, disconnected = syncCameras(manager, dir)
+	if len(connected) != 1 || len(disconnected) != 0 {
+		t.Fatalf("Expected a connected camera, got %v, %v", labels(connected), labels(disconnected))
+	}
+	if label := connected[0].Info().Label; label != "video91"+LabelSeparator+"video91" {
+		t.Errorf("Unexpected label: %s", label)
+	}
+	if drivers := manager.Query(driver.FilterID(first.ID())); len(drivers) != 1 {
+		t.Error("Expected the camera that is still connected to be kept")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "v4l", "by-id", "usb-unittest-camera-video-index0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "video90")); err != nil {
+		t.Fatal(err)
+	}
+	connected, disconnected = syncCameras(manager, dir)
+	if len(connected) != 0 || len(disconnected) != 1 || disconnected[0].ID() != first.ID() {
+		t.Fatalf("Expected the first camera to be disconnected, got %v, %v", labels(connected), labels(disconnected))
+	}
+	if drivers := manager.Query(driver.FilterID(first.ID())); len(drivers) != 0 {
+		t.Error("Expected the disconnected camera to be unregistered")
+	}
+}
+
+func TestDeviceObserver(t *testing.T) {
+	dir := useDevDir(t)
+
+	type event struct {
+		label string
+		typ   DeviceEventType
+	}
+	events := make(chan event, 10)
+	SetOnDeviceChange(func(d driver.Driver, typ DeviceEventType) {
+		events <- event{d.Info().Label, typ}
+	})
+	defer SetOnDeviceChange(nil)
+
+	expectEvent := func(t *testing.T, expected event) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e != expected {
+				t.Errorf("Expected event %v, got %v", expected, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for event %v", expected)
+		}
+	}
+
+	obs := &deviceObserver{}
+	if err := obs.setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := obs.start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := obs.start(); err != nil {
+		t.Fatalf("Expected StartObserver to be idempotent, got %v", err)
+	}
+
+	createDevice(t, dir, "video92", "usb-unittest-observer-video-index0")
+	expectEvent(t, event{"usb-unittest-observer-video-index0" + LabelSeparator + "video92", DeviceEventConnected})
+
+	// The camera may become available or unavailable when the permissions of its device node change
+	availabilityChanged := make(chan string, 10)
+	unsubscribe := driver.GetManager().Subscribe(func(e driver.Event) {
+		if e.Type == driver.EventAvailabilityChanged {
+			availabilityChanged <- e.Driver.Info().Label
+		}
+	})
+	defer unsubscribe()
+	if err := os.Chmod(filepath.Join(dir, "video92"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case label := <-availabilityChanged:
+		if expected := "usb-unittest-observer-video-index0" + LabelSeparator + "video92"; label != expected {
+			t.Errorf("Expected the availability of %s to change, got %s", expected, label)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the availability to change")
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, "v4l")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "video92")); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, event{"usb-unittest-observer-video-index0" + LabelSeparator + "video92", DeviceEventDisconnected})
+
+	for i := 0; i < 2; i++ {
+		if err := obs.destroy(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := obs.start(); !errors.Is(err, availability.ErrObserverUnavailable) {
+		t.Errorf("Expected error: %v, got: %v", availability.ErrObserverUnavailable, err)
+	}
+}
+
+func TestSyncCamerasStableID(t *testing.T) {
+	dir := useDevDir(t)
+	manager := driver.GetManager()
+
+	createDevice(t, dir, "video90", "usb-unittest-stable-video-index0")
+	connected, _ := syncCameras(manager, dir)
+	if len(connected) != 1 {
+		t.Fatalf("Expected a connected camera, got %v", labels(connected))
+	}
+	first := connected[0]
+	if stableID := first.Info().StableID; stableID != "v4l2:by-id/usb-unittest-stable-video-index0" {
+		t.Errorf("Unexpected stable ID: %s", stableID)
+	}
+
+	// The camera is plugged in again, and gets another device node
+	if err := os.Remove(filepath.Join(dir, "v4l", "by-id", "usb-unittest-stable-video-index0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "video90")); err != nil {
+		t.Fatal(err)
+	}
+	if _, disconnected := syncCameras(manager, dir); len(disconnected) != 1 {
+		t.Fatalf("Expected the camera to be disconnected, got %v", labels(disconnected))
+	}
+	createDevice(t, dir, "video91", "usb-unittest-stable-video-index0")
+	connected, _ = syncCameras(manager, dir)
+	if len(connected) != 1 || connected[0].ID() != first.ID() {
+		t.Errorf("Expected the camera to keep its ID %s, got %v", first.ID(), connected)
+	}
+}
@@ -0,0 +1,228 @@
+package camera
+
+import (
+	"math"
+	"unsafe"
+
+	"github.com/blackjack/webcam/ioctl"
+)
+
+// The types of the frame sizes and the frame intervals.
+// Reference: https://www.kernel.org/doc/html/latest/userspace-api/media/v4l/vidioc-enum-framesizes.html
+const (
+	v4l2FrmSizeTypeDiscrete   uint32 = 1
+	v4l2FrmSizeTypeContinuous uint32 = 2
+	v4l2FrmSizeTypeStepwise   uint32 = 3
+	v4l2FrmIvalTypeDiscrete   uint32 = 1
+	v4l2FrmIvalTypeContinuous uint32 = 2
+	v4l2FrmIvalTypeStepwise   uint32 = 3
+)
+
+// v4l2FrmSizeEnum is struct v4l2_frmsizeenum. union is either the width and the height of a discrete
+// size, or the minimum, maximum and step of the width, and then of the height.
+type v4l2FrmSizeEnum struct {
+	index       uint32
+	pixelFormat uint32
+	typ         uint32
+	union       [6]uint32
+	reserved    [2]uint32
+}
+
+// v4l2FrmIvalEnum is struct v4l2_frmivalenum. union is either the numerator and the denominator of a
+// discrete interval, or the ones of the minimum, maximum and step.
+type v4l2FrmIvalEnum struct {
+	index       uint32
+	pixelFormat uint32
+	width       uint32
+	height      uint32
+	typ         uint32
+	union       [6]uint32
+	reserved    [2]uint32
+}
+
+var (
+	vidiocEnumFrameSizes     = ioctl.IoRW('V', 74, unsafe.Sizeof(v4l2FrmSizeEnum{}))
+	vidiocEnumFrameIntervals = ioctl.IoRW('V', 75, unsafe.Sizeof(v4l2FrmIvalEnum{}))
+)
+
+var (
+	// commonResolutions are the sizes that are listed for the devices that support ranges of sizes,
+	// along with the smallest and the largest ones.
+	// Reference: https://commons.wikimedia.org/wiki/File:Vector_Video_Standards2.svg
+	commonResolutions = [][2]int{
+		{320, 240},
+		{640, 480},
+		{768, 576},
+		{800, 600},
+		{1024, 768},
+		{1280, 854},
+		{1280, 960},
+		{1280, 1024},
+		{1400, 1050},
+		{1600, 1200},
+		{2048, 1536},
+		{320, 200},
+		{800, 480},
+		{854, 480},
+		{1024, 600},
+		{1152, 768},
+		{1280, 720},
+		{1280, 768},
+		{1366, 768},
+		{1280, 800},
+		{1440, 900},
+		{1440, 960},
+		{1680, 1050},
+		{1920, 1080},
+		{2048, 1080},
+		{1920, 1200},
+		{2560, 1600},
+		{3840, 2160},
+	}
+	// commonFrameRates are the frame rates that are listed for the sizes that support ranges of frame
+	// intervals, along with the highest and the lowest ones.
+	commonFrameRates = []float32{60, 50, 30, 25, 24, 20, 15, 10, 5}
+)
+
+// formatDevice is a V4L2 device that frame sizes and intervals are enumerated from.
+type formatDevice interface {
+	enumFrameSizes(q *v4l2FrmSizeEnum) error
+	enumFrameIntervals(q *v4l2FrmIvalEnum) error
+}
+
+func (fd fdDevice) enumFrameSizes(q *v4l2FrmSizeEnum) error {
+	return ioctl.Ioctl(uintptr(fd), vidiocEnumFrameSizes, uintptr(unsafe.Pointer(q)))
+}
+
+func (fd fdDevice) enumFrameIntervals(q *v4l2FrmIvalEnum) error {
+	return ioctl.Ioctl(uintptr(fd), vidiocEnumFrameIntervals, uintptr(unsafe.Pointer(q)))
+}
+
+// mode is a frame size and a frame rate that a device records with. frameRate is 0 if the device
+// doesn't tell the frame intervals.
+type mode struct {
+	width, height int
+	frameRate     float32
+}
+
+// enumerateModes lists the modes of pixelFormat that dev supports. The discrete sizes and intervals
+// are listed as they are. The ranges are listed as their ends, and the common resolutions and frame
+// rates that are in them, so that there's a bounded number of modes.
+func enumerateModes(dev formatDevice, pixelFormat uint32) []mode {
+	var modes []mode
+	for _, size := range enumerateFrameSizes(dev, pixelFormat) {
+		frameRates := enumerateFrameRates(dev, pixelFormat, size[0], size[1])
+		if len(frameRates) == 0 {
+			modes = append(modes, mode{width: size[0], height: size[1]})
+			continue
+		}
+		for _, frameRate := range frameRates {
+			modes = append(modes, mode{width: size[0], height: size[1], frameRate: frameRate})
+		}
+	}
+	return modes
+}
+
+func enumerateFrameSizes(dev formatDevice, pixelFormat uint32) [][2]int {
+	var sizes [][2]int
+	add := func(width, height int) {
+		for _, s := range sizes {
+			if s[0] == width && s[1] == height {
+				return
+			}
+		}
+		sizes = append(sizes, [2]int{width, height})
+	}
+
+	for i := uint32(0); ; i++ {
+		q := v4l2FrmSizeEnum{index: i, pixelFormat: pixelFormat}
+		if dev.enumFrameSizes(&q) != nil {
+			break
+		}
+
+		switch q.typ {
+		case v4l2FrmSizeTypeDiscrete:
+			add(int(q.union[0]), int(q.union[1]))
+		case v4l2FrmSizeTypeContinuous, v4l2FrmSizeTypeStepwise:
+			minWidth, maxWidth, stepWidth := int(q.union[0]), int(q.union[1]), max(int(q.union[2]), 1)
+			minHeight, maxHeight, stepHeight := int(q.union[3]), int(q.union[4]), max(int(q.union[5]), 1)
+			add(maxWidth, maxHeight)
+			for _, r := range commonResolutions {
+				width, height := r[0], r[1]
+				if width < minWidth || width > maxWidth || height < minHeight || height > maxHeight {
+					continue
+				}
+				if (width-minWidth)%stepWidth != 0 || (height-minHeight)%stepHeight != 0 {
+					continue
+				}
+				add(width, height)
+			}
+			add(minWidth, minHeight)
+			// A range is the only size
+			return sizes
+		default:
+			return sizes
+		}
+	}
+	return sizes
+}
+
+func enumerateFrameRates(dev formatDevice, pixelFormat uint32, width, height int) []float32 {
+	var frameRates []float32
+	add := func(numerator, denominator uint32) {
+		frameRate, err := calcFramerate(numerator, denominator)
+		if err != nil {
+			return
+		}
+		for _, f := range frameRates {
+			if f == frameRate {
+				return
+			}
+		}
+		frameRates = append(frameRates, frameRate)
+	}
+
+	for i := uint32(0); ; i++ {
+		q := v4l2FrmIvalEnum{index: i, pixelFormat: pixelFormat, width: uint32(width), height: uint32(height)}
+		if dev.enumFrameIntervals(&q) != nil {
+			break
+		}
+
+		switch q.typ {
+		case v4l2FrmIvalTypeDiscrete:
+			add(q.union[0], q.union[1])
+		case v4l2FrmIvalTypeContinuous, v4l2FrmIvalTypeStepwise:
+			// The shortest interval is the highest frame rate
+			minInterval := fraction(q.union[0], q.union[1])
+			maxInterval := fraction(q.union[2], q.union[3])
+			step := fraction(q.union[4], q.union[5])
+			add(q.union[0], q.union[1])
+			for _, frameRate := range commonFrameRates {
+				interval := 1 / float64(frameRate)
+				if interval < minInterval || interval > maxInterval {
+					continue
+				}
+				if q.typ == v4l2FrmIvalTypeStepwise && step > 0 {
+					steps := (interval - minInterval) / step
+					if math.Abs(steps-math.Round(steps)) > 1e-6 {
+						continue
+					}
+				}
+				add(1, uint32(frameRate))
+			}
+			add(q.union[2], q.union[3])
+			// A range is the only interval
+			return frameRates
+		default:
+			return frameRates
+		}
+	}
+	return frameRates
+}
+
+func fraction(numerator, denominator uint32) float64 {
+	if denominator == 0 {
+		return 0
+	}
+	return float64(numerator) / float64(denominator)
+}
@@ -0,0 +1,133 @@
+package camera
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+// recordedFormatDevice replays the frame sizes and the frame intervals that were enumerated from a
+// device.
+type recordedFormatDevice struct {
+	sizes []v4l2FrmSizeEnum
+	// intervals are the frame intervals of each size
+	intervals map[[2]uint32][]v4l2FrmIvalEnum
+}
+
+func (d *recordedFormatDevice) enumFrameSizes(q *v4l2FrmSizeEnum) error {
+	if int(q.index) >= len(d.sizes) {
+		return syscall.EINVAL
+	}
+	*q = d.sizes[q.index]
+	return nil
+}
+
+func (d *recordedFormatDevice) enumFrameIntervals(q *v4l2FrmIvalEnum) error {
+	intervals := d.intervals[[2]uint32{q.width, q.height}]
+	if int(q.index) >= len(intervals) {
+		return syscall.EINVAL
+	}
+	*q = intervals[q.index]
+	return nil
+}
+
+func discreteSize(width, height uint32) v4l2FrmSizeEnum {
+	return v4l2FrmSizeEnum{typ: v4l2FrmSizeTypeDiscrete, union: [6]uint32{width, height}}
+}
+
+func discreteInterval(numerator, denominator uint32) v4l2FrmIvalEnum {
+	return v4l2FrmIvalEnum{typ: v4l2FrmIvalTypeDiscrete, union: [6]uint32{numerator, denominator}}
+}
+
+func TestEnumerateModes(t *testing.T) {
+	testCases := map[string]struct {
+		dev      *recordedFormatDevice
+		expected []mode
+	}{
+		"Discrete": {
+			// A UVC webcam
+			dev: &recordedFormatDevice{
+				sizes: []v4l2FrmSizeEnum{discreteSize(640, 480), discreteSize(1920, 1080)},
+				intervals: map[[2]uint32][]v4l2FrmIvalEnum{
+					{640, 480}:   {discreteInterval(1, 30), discreteInterval(2, 15)},
+					{1920, 1080}: {discreteInterval(1, 5)},
+				},
+			},
+			expected: []mode{
+				{640, 480, 30},
+				{640, 480, 7.5},
+				{1920, 1080, 5},
+			},
+		},
+		"NoIntervals": {
+			dev: &recordedFormatDevice{
+				sizes: []v4l2FrmSizeEnum{discreteSize(640, 480)},
+			},
+			expected: []mode{{640, 480, 0}},
+		},
+		"Stepwise": {
+			dev: &recordedFormatDevice{
+				sizes: []v4l2FrmSizeEnum{
+					{typ: v4l2FrmSizeTypeStepwise, union: [6]uint32{320, 1280, 16, 240, 720, 8}},
+				},
+				intervals: map[[2]uint32][]v4l2FrmIvalEnum{
+					// 1/30 to 1 second, in steps of 1/60
+					{1280, 720}: {{typ: v4l2FrmIvalTypeStepwise, union: [6]uint32{1, 30, 1, 1, 1, 60}}},
+					{640, 480}:  {discreteInterval(1, 30)},
+					{320, 240}:  {discreteInterval(1, 30)},
+				},
+			},
+			expected: []mode{
+				// 25 and 24 fps aren't whole steps
+				{1280, 720, 30},
+				{1280, 720, 20},
+				{1280, 720, 15},
+				{1280, 720, 10},
+				{1280, 720, 5},
+				{1280, 720, 1},
+				// The common resolutions that are whole steps, e.g. not 854x480. 320x240 is also the smallest size.
+				{320, 240, 30},
+				{640, 480, 30},
+				{768, 576, 0},
+				{800, 600, 0},
+				{800, 480, 0},
+				{1024, 600, 0},
+			},
+		},
+		"Continuous": {
+			dev: &recordedFormatDevice{
+				sizes: []v4l2FrmSizeEnum{
+					{typ: v4l2FrmSizeTypeContinuous, union: [6]uint32{16, 800, 1, 16, 600, 1}},
+				},
+				intervals: map[[2]uint32][]v4l2FrmIvalEnum{
+					{800, 600}: {{typ: v4l2FrmIvalTypeContinuous, union: [6]uint32{1, 60, 1, 10, 1, 1}}},
+				},
+			},
+			expected: []mode{
+				{800, 600, 60},
+				{800, 600, 50},
+				{800, 600, 30},
+				{800, 600, 25},
+				{800, 600, 24},
+				{800, 600, 20},
+				{800, 600, 15},
+				{800, 600, 10},
+				{320, 240, 0},
+				{640, 480, 0},
+				{768, 576, 0},
+				{320, 200, 0},
+				{800, 480, 0},
+				{16, 16, 0},
+			},
+		},
+	}
+
+	for name, c := range testCases {
+		t.Run(name, func(t *testing.T) {
+			modes := enumerateModes(c.dev, 0)
+			if !reflect.DeepEqual(c.expected, modes) {
+				t.Errorf("Expected modes\n%v\ngot\n%v", c.expected, modes)
+			}
+		})
+	}
+}
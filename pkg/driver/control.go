@@ -0,0 +1,59 @@
+package driver
+
+import "errors"
+
+var errControlsUnsupported = errors.New("driver doesn't support controls")
+
+// ControlID identifies a control of a device. The controls that prop.VideoConstraints constrain have
+// the IDs below. The other controls have IDs that their drivers make up.
+type ControlID string
+
+const (
+	// ControlExposureMode is a menu of the "manual" and "continuous" exposure modes.
+	ControlExposureMode ControlID = "exposureMode"
+	// ControlWhiteBalanceMode is a menu of the "manual" and "continuous" white balance modes.
+	ControlWhiteBalanceMode ControlID = "whiteBalanceMode"
+	// ControlFocusDistance is the focus distance, which the driver switches auto focus off to set.
+	ControlFocusDistance ControlID = "focusDistance"
+	ControlZoom          ControlID = "zoom"
+	ControlPan           ControlID = "pan"
+	ControlTilt          ControlID = "tilt"
+	ControlBrightness    ControlID = "brightness"
+)
+
+// ControlType is the type of the value of a control.
+type ControlType int
+
+const (
+	// ControlTypeInteger is a value between Min and Max, in steps of Step.
+	ControlTypeInteger ControlType = iota
+	// ControlTypeBoolean is either 0 or 1.
+	ControlTypeBoolean
+	// ControlTypeMenu is one of the values of Menu.
+	ControlTypeMenu
+)
+
+// ControlMenuItem is a value of a menu control.
+type ControlMenuItem struct {
+	Value int32
+	Name  string
+}
+
+// Control describes a control of a device, e.g. the zoom of a camera. The values are in the units of
+// the device.
+type Control struct {
+	ID ControlID
+	// Name is the name that the device gives to the control, e.g. "Zoom, Absolute"
+	Name                    string
+	Type                    ControlType
+	Min, Max, Step, Default int32
+	Menu                    []ControlMenuItem
+}
+
+// ControlAdapter is an optional interface of the adapters whose devices have controls. The controls
+// can only be used while the adapter is open.
+type ControlAdapter interface {
+	Controls() []Control
+	GetControl(id ControlID) (int32, error)
+	SetControl(id ControlID, value int32) error
+}
@@ -1,6 +1,8 @@
 package driver
 
 import (
+	"time"
+
 	"github.com/pion/mediadevices/pkg/driver/availability"
 	"github.com/pion/mediadevices/pkg/io/audio"
 	"github.com/pion/mediadevices/pkg/io/video"
@@ -11,6 +13,26 @@ type VideoRecorder interface {
 	VideoRecord(p prop.Media) (r video.Reader, err error)
 }
 
+// EncodedVideoRecorder is an optional interface of the VideoRecorders whose devices record compressed
+// frames, e.g. cameras that record MJPEG or H.264. It records the frames of p.FrameFormat as they are,
+// without decoding them.
+type EncodedVideoRecorder interface {
+	EncodedVideoRecord(p prop.Media) (r EncodedVideoReader, err error)
+}
+
+// EncodedVideoReader reads compressed frames, e.g. JPEG images or H.264 access units. The frames may be
+// shared by many readers, so they must not be modified.
+type EncodedVideoReader interface {
+	Read() (frame []byte, timestamp time.Time, err error)
+}
+
+// EncodedVideoReaderFunc is a proxy type for EncodedVideoReader
+type EncodedVideoReaderFunc func() (frame []byte, timestamp time.Time, err error)
+
+func (f EncodedVideoReaderFunc) Read() (frame []byte, timestamp time.Time, err error) {
+	return f()
+}
+
 type AudioRecorder interface {
 	AudioRecord(p prop.Media) (r audio.Reader, err error)
 }
@@ -32,6 +54,12 @@ type Info struct {
 	DeviceType DeviceType
 	Priority   Priority
 	Name       string
+	// StableID identifies the device across process restarts, e.g. the V4L2 by-id path of a camera. The ID
+	// of the driver is hashed from it if it's set, otherwise it's random.
+	StableID string
+	// GroupID is shared by the drivers of the same physical device, e.g. the camera and the microphone of
+	// a USB webcam. It's hashed when the driver is registered, like the ID.
+	GroupID string
 }
 
 type Adapter interface {
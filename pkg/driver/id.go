@@ -0,0 +1,55 @@
+package driver
+
+import (
+	"os"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// idSaltEnv is the environment variable of the salt that the stable IDs of the drivers are hashed with,
+// unless SetDeviceIDSalt sets one.
+const idSaltEnv = "PION_MEDIADEVICES_DEVICE_ID_SALT"
+
+// idNamespace is the namespace of the UUIDs that are hashed from stable IDs.
+var idNamespace = uuid.MustParse("6c1f4a5e-3d2b-4e8a-9f07-5b9d2c8e1a43")
+
+var (
+	idSaltMu sync.Mutex
+	// idSalt is the salt that SetDeviceIDSalt set. It's nil until then, and the environment variable is
+	// used instead.
+	idSalt *string
+	// envIDSalt reads the environment variable once, the first time that it's needed.
+	envIDSalt = sync.OnceValue(func() string { return os.Getenv(idSaltEnv) })
+)
+
+// SetDeviceIDSalt sets the salt that the stable IDs of the devices are hashed with. Like browsers do for
+// each origin, applications can set their own salt so that their IDs can't be used to tell the devices
+// apart by other applications. The IDs of the drivers that are already registered, e.g. the ones that
+// are registered when a driver package is imported, are hashed again, so the IDs that have been queried
+// before are stale. Call it before querying the devices, e.g. at the start of main.
+//
+// Without it, the salt is taken from the PION_MEDIADEVICES_DEVICE_ID_SALT environment variable.
+func SetDeviceIDSalt(salt string) {
+	idSaltMu.Lock()
+	idSalt = &salt
+	idSaltMu.Unlock()
+
+	manager.rehashIDs()
+}
+
+// deviceIDSalt returns the salt that the stable IDs are hashed with.
+func deviceIDSalt() string {
+	idSaltMu.Lock()
+	defer idSaltMu.Unlock()
+	if idSalt != nil {
+		return *idSalt
+	}
+	return envIDSalt()
+}
+
+// hashID hashes the stable ID of kind into a UUID, which is the same in every process with the same salt.
+func hashID(kind, stableID string) string {
+	salt := deviceIDSalt()
+	return uuid.NewSHA1(idNamespace, []byte(salt+"\x00"+kind+"\x00"+stableID)).String()
+}
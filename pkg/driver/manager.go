@@ -1,6 +1,12 @@
 package driver
 
-import "sync"
+import (
+	"errors"
+	"slices"
+	"sync"
+)
+
+var errDuplicateID = errors.New("a driver with the same ID is already registered")
 
 // FilterFn is being used to decide if a driver should be included in the
 // query result.
@@ -55,10 +61,37 @@ func FilterNot(filter FilterFn) FilterFn {
 	}
 }
 
+// EventType is the type of a change of the registered drivers.
+type EventType int
+
+const (
+	// EventAdded is sent after a driver is registered.
+	EventAdded EventType = iota
+	// EventRemoved is sent after a driver is deleted.
+	EventRemoved
+	// EventAvailabilityChanged is sent when a driver may have become available or unavailable, which
+	// IsAvailable tells.
+	EventAvailabilityChanged
+)
+
+// Event is a change of a registered driver.
+type Event struct {
+	Type   EventType
+	Driver Driver
+}
+
+// subscriber is a handler that's given to Subscribe. It's a pointer so that it can be unsubscribed.
+type subscriber struct {
+	handler func(Event)
+}
+
 // Manager is a singleton to manage multiple drivers and their states
 type Manager struct {
 	mu      sync.Mutex
 	drivers map[string]Driver
+	// ids are the IDs of the drivers in the order that they were registered
+	ids         []string
+	subscribers []*subscriber
 }
 
 var manager = &Manager{
@@ -70,21 +103,48 @@ func GetManager() *Manager {
 	return manager
 }
 
-// Register registers adapter to be discoverable by Query
+// Register registers adapter to be discoverable by Query. It fails if a driver with the same stable ID
+// is already registered.
 func (m *Manager) Register(a Adapter, info Info) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
 	d := wrapAdapter(a, info)
+	m.mu.Lock()
+	if _, ok := m.drivers[d.ID()]; ok {
+		m.mu.Unlock()
+		return errDuplicateID
+	}
 	m.drivers[d.ID()] = d
+	m.ids = append(m.ids, d.ID())
+	m.mu.Unlock()
+
+	m.notify(Event{Type: EventAdded, Driver: d})
 	return nil
 }
 
-// Query queries by using f to filter drivers, and simply return the filtered results.
+// rehashIDs hashes the IDs of the registered drivers again after the salt has changed, and keeps them
+// in the order that they were registered.
+func (m *Manager) rehashIDs() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	drivers := make(map[string]Driver, len(m.drivers))
+	for i, id := range m.ids {
+		d := m.drivers[id]
+		if h, ok := d.(idHasher); ok {
+			h.hashIDs()
+		}
+		m.ids[i] = d.ID()
+		drivers[d.ID()] = d
+	}
+	m.drivers = drivers
+}
+
+// Query queries by using f to filter drivers, and simply return the filtered results in the order that
+// they were registered.
 func (m *Manager) Query(f FilterFn) []Driver {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	results := make([]Driver, 0)
-	for _, d := range m.drivers {
+	for _, id := range m.ids {
+		d := m.drivers[id]
 		if ok := f(d); ok {
 			results = append(results, d)
 		}
@@ -95,7 +155,72 @@ func (m *Manager) Query(f FilterFn) []Driver {
 
 // Delete deletes a driver from manager given its ID
 func (m *Manager) Delete(id string) {
+	m.delete(id)
+}
+
+// Remove deletes the driver with the given ID like Delete, and then closes it even if it's still used.
+// Drivers call it when their device is gone, e.g. when a camera is unplugged, since the users of the
+// driver can't keep it open anymore.
+func (m *Manager) Remove(id string) error {
+	d, ok := m.delete(id)
+	if !ok {
+		return nil
+	}
+	if c, ok := d.(forceCloser); ok {
+		return c.forceClose()
+	}
+	return nil
+}
+
+func (m *Manager) delete(id string) (Driver, bool) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	d, ok := m.drivers[id]
 	delete(m.drivers, id)
+	m.ids = slices.DeleteFunc(m.ids, func(i string) bool { return i == id })
+	m.mu.Unlock()
+
+	if ok {
+		m.notify(Event{Type: EventRemoved, Driver: d})
+	}
+	return d, ok
+}
+
+// NotifyAvailabilityChanged sends an EventAvailabilityChanged for the driver with the given ID. Drivers
+// that learn that a device may have become available or unavailable call it, e.g. the Linux camera observer
+// when the permissions of a device node change. Nothing is sent if the driver isn't registered.
+func (m *Manager) NotifyAvailabilityChanged(id string) {
+	m.mu.Lock()
+	d, ok := m.drivers[id]
+	m.mu.Unlock()
+
+	if ok {
+		m.notify(Event{Type: EventAvailabilityChanged, Driver: d})
+	}
+}
+
+// Subscribe calls handler with the changes of the registered drivers, until the returned function is
+// called. handler is called from the goroutine that made the change, after it has been made, so it may
+// query the manager.
+func (m *Manager) Subscribe(handler func(Event)) (unsubscribe func()) {
+	s := &subscriber{handler: handler}
+	m.mu.Lock()
+	m.subscribers = append(m.subscribers, s)
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.subscribers = slices.DeleteFunc(m.subscribers, func(ss *subscriber) bool { return ss == s })
+	}
+}
+
+// notify calls the subscribers with e. m.mu must not be held.
+func (m *Manager) notify(e Event) {
+	m.mu.Lock()
+	subscribers := slices.Clone(m.subscribers)
+	m.mu.Unlock()
+
+	for _, s := range subscribers {
+		s.handler(e)
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/pion/mediadevices/pkg/io/video"
 	"github.com/pion/mediadevices/pkg/prop"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -112,3 +113,128 @@ func TestQuerySync(t *testing.T) {
 	// write while reading
 	assert.NoError(t, m.Register(&fakeVideoAdapter{}, Info{}))
 }
+
+func TestQueryOrder(t *testing.T) {
+	m := GetManager()
+	labels := []string{"QueryOrder0", "QueryOrder1", "QueryOrder2", "QueryOrder3"}
+	for _, label := range labels {
+		assert.NoError(t, m.Register(&fakeVideoAdapter{}, Info{Label: label}))
+	}
+	filter := func(d Driver) bool { return strings.HasPrefix(d.Info().Label, "QueryOrder") }
+
+	queryLabels := func() []string {
+		var result []string
+		for _, d := range m.Query(filter) {
+			result = append(result, d.Info().Label)
+		}
+		return result
+	}
+	assert.Equal(t, labels, queryLabels())
+
+	m.Delete(m.Query(filter)[1].ID())
+	assert.Equal(t, []string{"QueryOrder0", "QueryOrder2", "QueryOrder3"}, queryLabels())
+
+	for _, d := range m.Query(filter) {
+		m.Delete(d.ID())
+	}
+}
+
+func TestRegisterDuplicateStableID(t *testing.T) {
+	m := GetManager()
+	info := Info{Label: "DuplicateStableID", StableID: "DuplicateStableID"}
+
+	assert.NoError(t, m.Register(&fakeVideoAdapter{}, info))
+	assert.Equal(t, errDuplicateID, m.Register(&fakeVideoAdapter{}, info))
+
+	drivers := m.Query(func(d Driver) bool { return d.Info().Label == info.Label })
+	assert.Equal(t, 1, len(drivers))
+	m.Delete(drivers[0].ID())
+
+	// The device can be registered again after it's removed, with the same ID
+	assert.NoError(t, m.Register(&fakeVideoAdapter{}, info))
+	assert.Equal(t, drivers[0].ID(), m.Query(func(d Driver) bool { return d.Info().Label == info.Label })[0].ID())
+	m.Delete(drivers[0].ID())
+}
+
+func TestSetDeviceIDSalt(t *testing.T) {
+	m := GetManager()
+	infos := []Info{
+		{Label: "DeviceIDSalt0", StableID: "DeviceIDSalt0", GroupID: "DeviceIDSalt"},
+		{Label: "DeviceIDSalt1"},
+		{Label: "DeviceIDSalt2", StableID: "DeviceIDSalt2"},
+	}
+	for _, info := range infos {
+		assert.NoError(t, m.Register(&fakeVideoAdapter{}, info))
+	}
+	filter := func(d Driver) bool { return strings.HasPrefix(d.Info().Label, "DeviceIDSalt") }
+	before := m.Query(filter)
+
+	SetDeviceIDSalt("application")
+	t.Cleanup(func() { SetDeviceIDSalt("") })
+
+	after := m.Query(filter)
+	assert.Equal(t, before, after)
+	assert.NotEqual(t, infos[0].GroupID, after[0].Info().GroupID)
+	for i, d := range after {
+		assert.Equal(t, infos[i].Label, d.Info().Label)
+		assert.Equal(t, []Driver{d}, m.Query(FilterID(d.ID())))
+	}
+	assert.Equal(t, hashID(string(infos[0].DeviceType), infos[0].StableID), after[0].ID())
+
+	// Drivers without a stable ID keep their random ID
+	ids := []string{after[0].ID(), after[1].ID(), after[2].ID()}
+	SetDeviceIDSalt("other")
+	assert.NotEqual(t, ids[0], after[0].ID())
+	assert.Equal(t, ids[1], after[1].ID())
+	assert.NotEqual(t, ids[2], after[2].ID())
+
+	for _, d := range m.Query(filter) {
+		m.Delete(d.ID())
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	m := GetManager()
+	var events []Event
+	unsubscribe := m.Subscribe(func(e Event) {
+		// Only the drivers of this test are recorded, since the other tests may run at the same time
+		if e.Driver.Info().Label == "Subscribe" {
+			events = append(events, e)
+		}
+	})
+
+	assert.NoError(t, m.Register(&fakeVideoAdapter{}, Info{Label: "Subscribe"}))
+	d := m.Query(func(d Driver) bool { return d.Info().Label == "Subscribe" })[0]
+	m.NotifyAvailabilityChanged(d.ID())
+	m.Delete(d.ID())
+	// Unknown drivers don't send events
+	m.Delete(d.ID())
+	m.NotifyAvailabilityChanged(d.ID())
+
+	assert.Equal(t, []Event{
+		{Type: EventAdded, Driver: d},
+		{Type: EventAvailabilityChanged, Driver: d},
+		{Type: EventRemoved, Driver: d},
+	}, events)
+
+	unsubscribe()
+	assert.NoError(t, m.Register(&fakeVideoAdapter{}, Info{Label: "Subscribe"}))
+	m.Delete(m.Query(func(d Driver) bool { return d.Info().Label == "Subscribe" })[0].ID())
+	assert.Equal(t, 3, len(events), "unsubscribed handler should not be called")
+}
+
+func TestRemove(t *testing.T) {
+	m := GetManager()
+	var a sharedAdapterMock
+	assert.NoError(t, m.Register(&a, Info{Label: "Remove"}))
+	d := m.Query(func(d Driver) bool { return d.Info().Label == "Remove" })[0]
+
+	assert.NoError(t, d.Open())
+	assert.NoError(t, d.Open())
+	assert.NoError(t, m.Remove(d.ID()))
+	assert.Equal(t, StateClosed, d.Status(), "removed driver should be closed even if it's still used")
+	assert.Empty(t, m.Query(func(d Driver) bool { return d.Info().Label == "Remove" }))
+
+	// Unknown drivers are ignored
+	assert.NoError(t, m.Remove(d.ID()))
+}
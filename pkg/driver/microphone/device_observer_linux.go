@@ -0,0 +1,214 @@
+//go:build !nomicrophone
+// +build !nomicrophone
+
+package microphone
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gen2brain/malgo"
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/driver/availability"
+	"golang.org/x/sys/unix"
+)
+
+// sndDir is where the ALSA device nodes are, which change when a sound card is plugged in or removed.
+var sndDir = "/dev/snd"
+
+const (
+	// observerSettleDelay is how long the observer waits after a change in sndDir before listing the
+	// microphones, so that the audio backend, e.g. PulseAudio, has found the new sound card.
+	observerSettleDelay = time.Second
+	observerPollTimeout = 100 * time.Millisecond
+
+	observerInotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+)
+
+// syncMicrophones registers the devices that aren't registered yet, and removes the registered
+// microphones that aren't in devices anymore.
+func syncMicrophones(manager *driver.Manager, devices []malgo.DeviceInfo) {
+	current := make(map[string]struct{}, len(devices))
+	for _, info := range devices {
+		current[info.ID.String()] = struct{}{}
+	}
+
+	registered := make(map[string]struct{})
+	for _, d := range manager.Query(driver.FilterDeviceType(driver.Microphone)) {
+		label := d.Info().Label
+		if _, ok := current[label]; ok {
+			registered[label] = struct{}{}
+			continue
+		}
+		if err := manager.Remove(d.ID()); err != nil {
+			logger.Debugf("failed to close disconnected microphone %s: %v", label, err)
+		}
+	}
+
+	for _, info := range devices {
+		if _, ok := registered[info.ID.String()]; !ok {
+			registerMicrophone(manager, info)
+		}
+	}
+}
+
+type observerStateType int
+
+const (
+	observerInitial observerStateType = iota
+	observerSetup
+	observerRunning
+	observerDestroyed
+)
+
+// deviceObserver watches sndDir with inotify, and keeps the registered microphones in sync with the
+// capture devices of the audio backend. The observer is single-use. Once DestroyObserver is called, it
+// cannot be restarted.
+type deviceObserver struct {
+	mu    sync.Mutex
+	state observerStateType
+	fd    int
+	// Closed to stop the observer goroutine
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+var observer = &deviceObserver{}
+
+// SetupObserver initializes the device observer without starting monitoring.
+// Safe to call concurrently and idempotent; multiple calls are no-ops if already setup.
+func SetupObserver() error {
+	return observer.setup()
+}
+
+// StartObserver starts the background observer to monitor for device changes. The microphones that
+// are connected or removed are registered or removed from driver.GetManager(), whose subscribers are
+// told about them. If SetupObserver has not been called, StartObserver will call it first.
+// Safe to call concurrently and idempotently.
+func StartObserver() error {
+	return observer.start()
+}
+
+// DestroyObserver destroys the device observer and releases all resources.
+// The observer is single-use and cannot be restarted after being destroyed.
+// Safe to call concurrently and idempotently.
+func DestroyObserver() error {
+	return observer.destroy()
+}
+
+func (obs *deviceObserver) setup() error {
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+
+	switch obs.state {
+	case observerSetup, observerRunning:
+		return nil
+	case observerDestroyed:
+		return availability.ErrObserverUnavailable
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	if _, err := unix.InotifyAddWatch(fd, sndDir, observerInotifyMask); err != nil {
+		unix.Close(fd)
+		return err
+	}
+	obs.fd = fd
+
+	obs.state = observerSetup
+	return nil
+}
+
+func (obs *deviceObserver) start() error {
+	if err := obs.setup(); err != nil {
+		return err
+	}
+
+	obs.mu.Lock()
+	if obs.state != observerSetup {
+		// Already running, or destroyed concurrently
+		defer obs.mu.Unlock()
+		if obs.state == observerDestroyed {
+			return availability.ErrObserverUnavailable
+		}
+		return nil
+	}
+	obs.state = observerRunning
+	obs.done = make(chan struct{})
+	obs.wg.Add(1)
+	obs.mu.Unlock()
+
+	// Devices may have changed since Initialize
+	syncCaptureDevices()
+
+	go obs.run()
+	return nil
+}
+
+// syncCaptureDevices keeps the registered microphones in sync with the capture devices of the audio
+// backend.
+func syncCaptureDevices() {
+	devices, err := captureDevices()
+	if err != nil {
+		logger.Errorf("failed to list the microphones: %v", err)
+		return
+	}
+	syncMicrophones(driver.GetManager(), devices)
+}
+
+func (obs *deviceObserver) run() {
+	defer obs.wg.Done()
+
+	buf := make([]byte, 4096)
+	var lastChange time.Time
+	for {
+		select {
+		case <-obs.done:
+			return
+		default:
+		}
+
+		fds := []unix.PollFd{{Fd: int32(obs.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(observerPollTimeout/time.Millisecond))
+		if err != nil && !errors.Is(err, unix.EINTR) {
+			logger.Errorf("device observer stopped: %v", err)
+			return
+		}
+		if n > 0 {
+			// Only the time of the changes matters, the devices are listed by the audio backend
+			for {
+				n, err := unix.Read(obs.fd, buf)
+				if err != nil || n <= 0 {
+					break
+				}
+			}
+			lastChange = time.Now()
+			continue
+		}
+
+		if !lastChange.IsZero() && time.Since(lastChange) >= observerSettleDelay {
+			lastChange = time.Time{}
+			syncCaptureDevices()
+		}
+	}
+}
+
+func (obs *deviceObserver) destroy() error {
+	obs.mu.Lock()
+	state := obs.state
+	obs.state = observerDestroyed
+	obs.mu.Unlock()
+
+	switch state {
+	case observerRunning:
+		close(obs.done)
+		obs.wg.Wait()
+		fallthrough
+	case observerSetup:
+		return unix.Close(obs.fd)
+	}
+	return nil
+}
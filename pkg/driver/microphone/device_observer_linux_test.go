@@ -0,0 +1,62 @@
+//go:build !nomicrophone
+// +build !nomicrophone
+
+package microphone
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/gen2brain/malgo"
+	"github.com/pion/mediadevices/pkg/driver"
+)
+
+func fakeDevice(id byte) malgo.DeviceInfo {
+	var info malgo.DeviceInfo
+	info.ID[0] = id
+	return info
+}
+
+func microphoneLabels(manager *driver.Manager) []string {
+	var labels []string
+	for _, d := range manager.Query(driver.FilterDeviceType(driver.Microphone)) {
+		labels = append(labels, d.Info().Label)
+	}
+	return labels
+}
+
+func TestSyncMicrophones(t *testing.T) {
+	manager := driver.GetManager()
+	// The microphones of the machine stay registered
+	devices, err := captureDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { syncMicrophones(manager, devices) })
+
+	first, second := fakeDevice(0xf1), fakeDevice(0xf2)
+	syncMicrophones(manager, append(slices.Clip(devices), first, second))
+	labels := microphoneLabels(manager)
+	if !slices.Contains(labels, "f1") || !slices.Contains(labels, "f2") {
+		t.Fatalf("Expected the microphones to be registered, got %v", labels)
+	}
+	d := manager.Query(func(d driver.Driver) bool { return d.Info().Label == "f1" })[0]
+	if err := d.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	syncMicrophones(manager, append(slices.Clip(devices), second))
+	labels = microphoneLabels(manager)
+	if slices.Contains(labels, "f1") || !slices.Contains(labels, "f2") {
+		t.Errorf("Expected the first microphone to be removed, got %v", labels)
+	}
+	if d.Status() != driver.StateClosed {
+		t.Errorf("Expected the removed microphone to be closed, got %v", d.Status())
+	}
+
+	// The registered microphones are kept
+	syncMicrophones(manager, append(slices.Clip(devices), second))
+	if n := len(microphoneLabels(manager)); n != len(labels) {
+		t.Errorf("Expected %d microphones, got %d", len(labels), n)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !nomicrophone
+// +build !linux,!nomicrophone
+
+package microphone
+
+import "github.com/pion/mediadevices/pkg/driver/availability"
+
+// SetupObserver isn't supported on this platform.
+func SetupObserver() error {
+	return availability.ErrUnimplemented
+}
+
+// StartObserver isn't supported on this platform.
+func StartObserver() error {
+	return availability.ErrUnimplemented
+}
+
+// DestroyObserver isn't supported on this platform.
+func DestroyObserver() error {
+	return availability.ErrUnimplemented
+}
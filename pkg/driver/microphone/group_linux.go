@@ -0,0 +1,27 @@
+//go:build !nomicrophone
+// +build !nomicrophone
+
+package microphone
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+
+	"github.com/gen2brain/malgo"
+	"github.com/pion/mediadevices/internal/sysfs"
+)
+
+// alsaCard matches the ALSA IDs of the devices, e.g. hw:1,0, to find their sound card.
+var alsaCard = regexp.MustCompile(`^(?:plug)?hw:(\d+),`)
+
+// groupID returns the USB device that the sound card of an ALSA device is an interface of, which the
+// camera of a webcam is also an interface of. It's empty for the other backends.
+func groupID(id malgo.DeviceID) string {
+	name, _, _ := bytes.Cut(id[:], []byte{0})
+	match := alsaCard.FindSubmatch(name)
+	if match == nil {
+		return ""
+	}
+	return sysfs.USBDevice(filepath.Join(sysfs.Dir, "class", "sound", "card"+string(match[1]), "device"))
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !nomicrophone
+// +build !linux,!nomicrophone
+
+package microphone
+
+import "github.com/gen2brain/malgo"
+
+// groupID isn't supported on this platform.
+func groupID(malgo.DeviceID) string {
+	return ""
+}
@@ -23,9 +23,9 @@ import (
 
 const (
 	maxDeviceIDLength = 20
-	// TODO: should replace this with a more flexible approach
-	sampleRateStep    = 1000
 	initialBufferSize = 1024
+	// defaultSampleRate is used for the formats that don't have a native sampling rate
+	defaultSampleRate = 48000
 )
 
 var logger = logging.NewLogger("mediadevices/driver/microphone")
@@ -55,25 +55,13 @@ func Initialize() {
 		panic(err)
 	}
 
-	devices, err := ctx.Devices(malgo.Capture)
+	devices, err := captureDevices()
 	if err != nil {
 		panic(err)
 	}
 
-	for _, device := range devices {
-		info, err := ctx.DeviceInfo(malgo.Capture, device.ID, malgo.Shared)
-		if err == nil {
-			priority := driver.PriorityNormal
-			if info.IsDefault > 0 {
-				priority = driver.PriorityHigh
-			}
-			driver.GetManager().Register(newMicrophone(info), driver.Info{
-				Label:      device.ID.String(),
-				DeviceType: driver.Microphone,
-				Priority:   priority,
-				Name:       info.Name(),
-			})
-		}
+	for _, info := range devices {
+		registerMicrophone(driver.GetManager(), info)
 	}
 
 	// Decide which endian
@@ -87,6 +75,42 @@ func Initialize() {
 	}
 }
 
+// captureDevices returns the details of the capture devices of the audio backend. The devices whose
+// details can't be read are skipped.
+func captureDevices() ([]malgo.DeviceInfo, error) {
+	devices, err := ctx.Devices(malgo.Capture)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []malgo.DeviceInfo
+	for _, device := range devices {
+		info, err := ctx.DeviceInfo(malgo.Capture, device.ID, malgo.Shared)
+		if err == nil {
+			// The drivers are labeled with the ID that the device is listed with
+			info.ID = device.ID
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+func registerMicrophone(manager *driver.Manager, info malgo.DeviceInfo) {
+	priority := driver.PriorityNormal
+	if info.IsDefault > 0 {
+		priority = driver.PriorityHigh
+	}
+	manager.Register(newMicrophone(info), driver.Info{
+		Label:      info.ID.String(),
+		DeviceType: driver.Microphone,
+		Priority:   priority,
+		Name:       info.Name(),
+		// The IDs of the backends are stable, e.g. the ALSA hw:1,0 or the PulseAudio source name
+		StableID: info.ID.String(),
+		GroupID:  groupID(info.ID),
+	})
+}
+
 func newMicrophone(info malgo.DeviceInfo) *microphone {
 	return &microphone{
 		DeviceInfo: info,
@@ -201,13 +225,15 @@ func (m *microphone) Properties() []prop.Media {
 	}
 
 	for _, format := range m.Formats {
-		// FIXME: Currently support 48kHz only. We need to implement a resampler first.
-		// for sampleRate := m.MinSampleRate; sampleRate <= m.MaxSampleRate; sampleRate += sampleRateStep {
-		sampleRate := 48000
+		// The audio is resampled to the sampling rate of the encoder when it's different
+		sampleRate := int(format.SampleRate)
+		if sampleRate == 0 {
+			sampleRate = defaultSampleRate
+		}
 		supportedProp := prop.Media{
 			Audio: prop.Audio{
 				ChannelCount: int(format.Channels),
-				SampleRate:   int(sampleRate),
+				SampleRate:   sampleRate,
 				IsBigEndian:  isBigEndian,
 				// miniaudio only supports interleaved at the moment
 				IsInterleaved: true,
@@ -233,7 +259,6 @@ func (m *microphone) Properties() []prop.Media {
 			continue
 		}
 		supportedProps = append(supportedProps, supportedProp)
-		// }
 	}
 	return supportedProps
 }
@@ -37,6 +37,7 @@ func Initialize() {
 			Label:      fmt.Sprint(i),
 			DeviceType: driver.Screen,
 			Priority:   priority,
+			StableID:   fmt.Sprint("display:", i),
 		})
 	}
 }
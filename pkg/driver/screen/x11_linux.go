@@ -42,6 +42,7 @@ func Initialize() {
 			driver.Info{
 				Label:      deviceID(i),
 				DeviceType: driver.Screen,
+				StableID:   deviceID(i),
 			},
 		)
 	}
@@ -17,7 +17,7 @@ import (
 func init() {
 	driver.GetManager().Register(
 		newVideoTest(),
-		driver.Info{Label: "VideoTest", DeviceType: driver.Camera},
+		driver.Info{Label: "VideoTest", DeviceType: driver.Camera, StableID: "VideoTest"},
 	)
 }
 
@@ -59,9 +59,6 @@ func (d *dummy) VideoRecord(p prop.Media) (video.Reader, error) {
 
 	yi := p.Width * p.Height
 	ci := yi / 2
-	yy := make([]byte, yi)
-	cb := make([]byte, ci)
-	cr := make([]byte, ci)
 	yyBase := make([]byte, yi)
 	cbBase := make([]byte, ci)
 	crBase := make([]byte, ci)
@@ -100,17 +97,18 @@ func (d *dummy) VideoRecord(p prop.Media) (video.Reader, error) {
 	closed := d.closed
 
 	r := video.ReaderFunc(func() (image.Image, func(), error) {
+		// The ticker is stopped when the driver is closed, so it has to be waited for together with closed
 		select {
 		case <-closed:
 			return nil, func() {}, io.EOF
-		default:
+		case <-tick.C:
 		}
 
-		<-tick.C
-
+		img, release := frame.DefaultPool.YCbCr(image.Rect(0, 0, p.Width, p.Height), image.YCbCrSubsampleRatio422)
+		yy := img.Y
 		copy(yy, yyBase)
-		copy(cb, cbBase)
-		copy(cr, crBase)
+		copy(img.Cb, cbBase)
+		copy(img.Cr, crBase)
 		for y := hColorBarEnd; y < p.Height; y++ {
 			yi := p.Width * y
 			for x := wGradationEnd; x < p.Width; x++ {
@@ -118,15 +116,7 @@ func (d *dummy) VideoRecord(p prop.Media) (video.Reader, error) {
 				yy[yi+x] = uint8(random.Int31n(2) * 255)
 			}
 		}
-		return &image.YCbCr{
-			Y:              yy,
-			YStride:        p.Width,
-			Cb:             cb,
-			Cr:             cr,
-			CStride:        p.Width / 2,
-			SubsampleRatio: image.YCbCrSubsampleRatio422,
-			Rect:           image.Rect(0, 0, p.Width, p.Height),
-		}, func() {}, nil
+		return img, release, nil
 	})
 
 	return r, nil
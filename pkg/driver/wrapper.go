@@ -1,30 +1,51 @@
 package driver
 
 import (
+	"errors"
+	"image"
+	"sync"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/pion/mediadevices/pkg/driver/availability"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/io"
 	"github.com/pion/mediadevices/pkg/io/audio"
 	"github.com/pion/mediadevices/pkg/io/video"
 	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/wave"
 )
 
-func wrapAdapter(a Adapter, info Info) Driver {
-	generator, err := uuid.NewRandom()
-	if err != nil {
-		panic(err)
-	}
+var (
+	errEncodedVideoUnsupported = errors.New("driver doesn't record compressed frames of the format")
+	errRecordingNotCompressed  = errors.New("recording has been restarted with uncompressed frames")
+)
 
-	id := generator.String()
+func wrapAdapter(a Adapter, info Info) Driver {
 	d := &adapterWrapper{
 		Adapter: a,
-		id:      id,
 		info:    info,
+		groupID: info.GroupID,
 		state:   StateClosed,
 	}
+	if info.StableID == "" {
+		generator, err := uuid.NewRandom()
+		if err != nil {
+			panic(err)
+		}
+		d.id = generator.String()
+	}
+	d.hashIDs()
 
 	if aa, ok := a.(AvailabilityAdapter); ok {
 		d.isAvailable = aa.IsAvailable
 	}
+	if ca, ok := a.(ControlAdapter); ok {
+		d.controls = ca
+	}
+	if er, ok := a.(EncodedVideoRecorder); ok {
+		d.encodedVideo = er
+	}
 
 	switch v := a.(type) {
 	case VideoRecorder:
@@ -33,8 +54,12 @@ func wrapAdapter(a Adapter, info Info) Driver {
 		r := &struct {
 			Driver
 			VideoRecorder
+			EncodedVideoRecorder
 			AvailabilityAdapter
-		}{d, d, d}
+			ControlAdapter
+			idHasher
+			forceCloser
+		}{d, d, d, d, d, d, d}
 		return r
 	case AudioRecorder:
 		// Only expose Driver and AudioRecorder interfaces
@@ -43,7 +68,10 @@ func wrapAdapter(a Adapter, info Info) Driver {
 			Driver
 			AudioRecorder
 			AvailabilityAdapter
-		}{d, d, d}
+			ControlAdapter
+			idHasher
+			forceCloser
+		}{d, d, d, d, d, d}
 	default:
 		panic("adapter has to be either VideoRecorder/AudioRecorder")
 	}
@@ -53,64 +81,359 @@ type adapterWrapper struct {
 	Adapter
 	VideoRecorder
 	AudioRecorder
-	id          string
-	info        Info
-	state       State
+	// idMu guards id and info, which hashIDs changes when the salt is changed
+	idMu sync.RWMutex
+	id   string
+	info Info
+	// groupID is the group ID of the adapter before it's hashed into info
+	groupID     string
 	isAvailable func() (bool, error)
+	// controls is nil if the adapter has no controls
+	controls ControlAdapter
+	// encodedVideo is nil if the adapter can't record compressed frames
+	encodedVideo EncodedVideoRecorder
+
+	mu    sync.Mutex
+	state State
+	// users is the number of Open calls that haven't been closed yet. The adapter is opened with the first
+	// one, and closed with the last one.
+	users int
+	// recording is the properties that the adapter is recording with. generation is incremented whenever
+	// the recording is restarted with other properties.
+	recording        prop.Media
+	generation       uint64
+	videoReader      video.TimestampedReader
+	audioReader      audio.TimestampedReader
+	videoBroadcaster *video.Broadcaster
+	audioBroadcaster *audio.Broadcaster
+	// encodedVideoReader is nil unless the adapter is recording compressed frames, which the video
+	// readers decode then
+	encodedVideoReader      EncodedVideoReader
+	encodedVideoBroadcaster *io.Broadcaster
+}
+
+// encodedVideoFrame is a compressed frame that's shared with the readers.
+type encodedVideoFrame struct {
+	data      []byte
+	timestamp time.Time
 }
 
 func (w *adapterWrapper) ID() string {
+	w.idMu.RLock()
+	defer w.idMu.RUnlock()
 	return w.id
 }
 
 func (w *adapterWrapper) Info() Info {
+	w.idMu.RLock()
+	defer w.idMu.RUnlock()
 	return w.info
 }
 
+// idHasher is implemented by the drivers that wrapAdapter returns, so that the manager can hash their IDs
+// again when the salt is changed.
+type idHasher interface {
+	hashIDs()
+}
+
+// hashIDs hashes the stable ID and the group ID of the adapter with the current salt. Adapters without
+// a stable ID keep their random ID.
+func (w *adapterWrapper) hashIDs() {
+	w.idMu.Lock()
+	defer w.idMu.Unlock()
+	if w.info.StableID != "" {
+		w.id = hashID(string(w.info.DeviceType), w.info.StableID)
+	}
+	if w.groupID != "" {
+		w.info.GroupID = hashID("group", w.groupID)
+	}
+}
+
 func (w *adapterWrapper) Status() State {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	return w.state
 }
 
+// Open opens the adapter, or adds a user to it if it's already open. Every Open has to be paired with a
+// Close.
 func (w *adapterWrapper) Open() error {
-	return w.state.Update(StateOpened, w.Adapter.Open)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.users == 0 {
+		if err := w.state.Update(StateOpened, w.Adapter.Open); err != nil {
+			return err
+		}
+	}
+	w.users++
+	return nil
 }
 
+// Close removes a user of the adapter, and closes it if it was the last one. It does nothing if the
+// adapter is already closed.
 func (w *adapterWrapper) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.state == StateClosed {
+		return nil
+	}
+	if w.users > 1 {
+		w.users--
+		return nil
+	}
+	return w.close()
+}
+
+// forceCloser is implemented by the drivers that wrapAdapter returns, so that the manager can close them
+// when their device is removed.
+type forceCloser interface {
+	forceClose() error
+}
+
+// forceClose closes the adapter whatever the number of its users, since its device is gone. The users
+// closing it afterwards do nothing.
+func (w *adapterWrapper) forceClose() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.state == StateClosed {
+		return nil
+	}
+	return w.close()
+}
+
+// close closes the adapter. w.mu must be held.
+func (w *adapterWrapper) close() error {
+	w.users = 0
+	w.videoBroadcaster, w.audioBroadcaster = nil, nil
+	w.encodedVideoReader, w.encodedVideoBroadcaster = nil, nil
 	return w.state.Update(StateClosed, w.Adapter.Close)
 }
 
 func (w *adapterWrapper) Properties() []prop.Media {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	if w.state == StateClosed {
 		return nil
 	}
 
 	p := w.Adapter.Properties()
 	for i := range p {
-		p[i].DeviceID = w.id
+		p[i].DeviceID = w.ID()
 	}
 	return p
 }
 
-func (w *adapterWrapper) VideoRecord(p prop.Media) (r video.Reader, err error) {
-	err = w.state.Update(StateRunning, func() error {
-		r, err = w.VideoRecorder.VideoRecord(p)
+// VideoRecord starts recording with p. If the adapter is already recording, the recording is shared with
+// the returned reader. It's restarted first if it's recording with other properties, which the readers
+// of the recording don't notice, except for the properties of the frames.
+func (w *adapterWrapper) VideoRecord(p prop.Media) (video.Reader, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.recordVideo(p); err != nil {
+		return nil, err
+	}
+	return w.videoBroadcaster.NewReader(false), nil
+}
+
+// EncodedVideoRecord is the same as VideoRecord, but reads the compressed frames that the adapter
+// records, if it's an EncodedVideoRecorder and p.FrameFormat is compressed. The video readers of the
+// recording decode its frames, and only the frames that they read are decoded.
+func (w *adapterWrapper) EncodedVideoRecord(p prop.Media) (EncodedVideoReader, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.encodedVideo == nil || !frame.IsCompressed(p.FrameFormat) {
+		return nil, errEncodedVideoUnsupported
+	}
+	if err := w.recordVideo(p); err != nil {
+		return nil, err
+	}
+	r := w.encodedVideoBroadcaster.NewReader(func(data any) any { return data })
+	return EncodedVideoReaderFunc(func() ([]byte, time.Time, error) {
+		data, _, err := r.Read()
+		f, _ := data.(encodedVideoFrame)
+		return f.data, f.timestamp, err
+	}), nil
+}
+
+// recordVideo starts recording with p, or restarts the recording if it's recording with other
+// properties. The compressed frames are recorded if the adapter can record them. w.mu must be held.
+func (w *adapterWrapper) recordVideo(p prop.Media) error {
+	record := func(p prop.Media) error {
+		if w.encodedVideo == nil || !frame.IsCompressed(p.FrameFormat) {
+			r, err := w.VideoRecorder.VideoRecord(p)
+			if err != nil {
+				return err
+			}
+			w.videoReader = video.WithTimestamp(r)
+			w.encodedVideoReader = nil
+			w.recording = p
+			return nil
+		}
+
+		r, err := w.encodedVideo.EncodedVideoRecord(p)
+		if err != nil {
+			return err
+		}
+		w.encodedVideoReader = r
+		w.videoReader = w.decodeVideo(p)
+		w.recording = p
+		return nil
+	}
+
+	if w.state == StateRunning {
+		if p != w.recording {
+			return w.restart(p, record)
+		}
+		return nil
+	}
+
+	if err := w.state.Update(StateRunning, func() error { return record(p) }); err != nil {
+		_ = w.close()
 		return err
+	}
+	w.videoBroadcaster = video.NewBroadcaster(video.TimestampedReaderFunc(func() (image.Image, time.Time, func(), error) {
+		for {
+			w.mu.Lock()
+			r, generation := w.videoReader, w.generation
+			w.mu.Unlock()
+
+			img, timestamp, release, err := r.ReadTimestamped()
+			if err != nil && w.restarted(generation) {
+				continue
+			}
+			return img, timestamp, release, err
+		}
+	}), nil)
+	return nil
+}
+
+// decodeVideo returns a reader of the compressed frames of the recording with p, which decodes them. The
+// reader fails if the frames can't be decoded, e.g. if they're H.264. w.mu must be held.
+func (w *adapterWrapper) decodeVideo(p prop.Media) video.TimestampedReader {
+	if w.encodedVideoBroadcaster == nil {
+		w.encodedVideoBroadcaster = io.NewBroadcaster(io.ReaderFunc(func() (any, func(), error) {
+			for {
+				w.mu.Lock()
+				r, generation := w.encodedVideoReader, w.generation
+				w.mu.Unlock()
+
+				if r == nil {
+					return nil, func() {}, errRecordingNotCompressed
+				}
+				data, timestamp, err := r.Read()
+				if err != nil {
+					if w.restarted(generation) {
+						continue
+					}
+					return nil, func() {}, err
+				}
+				return encodedVideoFrame{data: data, timestamp: timestamp}, func() {}, nil
+			}
+		}), nil)
+	}
+
+	decoder, errDecoder := frame.NewDecoder(p.FrameFormat)
+	r := w.encodedVideoBroadcaster.NewReader(func(data any) any { return data })
+	return video.TimestampedReaderFunc(func() (image.Image, time.Time, func(), error) {
+		if errDecoder != nil {
+			return nil, time.Time{}, func() {}, errDecoder
+		}
+		data, releaseData, err := r.Read()
+		if err != nil {
+			return nil, time.Time{}, func() {}, err
+		}
+		// The decoded frames don't share memory with the compressed ones
+		defer releaseData()
+		f := data.(encodedVideoFrame)
+		img, release, err := decoder.Decode(f.data, p.Width, p.Height)
+		return img, f.timestamp, release, err
 	})
-	if err != nil {
-		_ = w.Close()
+}
+
+// AudioRecord is the same as VideoRecord, but for audio adapters.
+func (w *adapterWrapper) AudioRecord(p prop.Media) (audio.Reader, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	record := func(p prop.Media) error {
+		r, err := w.AudioRecorder.AudioRecord(p)
+		if err != nil {
+			return err
+		}
+		w.audioReader = audio.WithTimestamp(r)
+		w.recording = p
+		return nil
 	}
-	return
+
+	if w.state == StateRunning {
+		if p != w.recording {
+			if err := w.restart(p, record); err != nil {
+				return nil, err
+			}
+		}
+		return w.audioBroadcaster.NewReader(false), nil
+	}
+
+	if err := w.state.Update(StateRunning, func() error { return record(p) }); err != nil {
+		_ = w.close()
+		return nil, err
+	}
+	w.audioBroadcaster = audio.NewBroadcaster(audio.TimestampedReaderFunc(func() (wave.Audio, time.Time, func(), error) {
+		for {
+			w.mu.Lock()
+			r, generation := w.audioReader, w.generation
+			w.mu.Unlock()
+
+			chunk, timestamp, release, err := r.ReadTimestamped()
+			if err != nil && w.restarted(generation) {
+				continue
+			}
+			return chunk, timestamp, release, err
+		}
+	}), nil)
+	return w.audioBroadcaster.NewReader(false), nil
 }
 
-func (w *adapterWrapper) AudioRecord(p prop.Media) (r audio.Reader, err error) {
-	err = w.state.Update(StateRunning, func() error {
-		r, err = w.AudioRecorder.AudioRecord(p)
+// restart reopens the adapter, and records with p. If it fails, the adapter goes back to recording with
+// the current properties. w.mu must be held.
+func (w *adapterWrapper) restart(p prop.Media, record func(prop.Media) error) error {
+	// The errors of the current recording, which is stopped by closing the adapter, are skipped
+	w.generation++
+	reopen := func() error {
+		if err := w.Adapter.Close(); err != nil {
+			return err
+		}
+		return w.Adapter.Open()
+	}
+
+	if err := reopen(); err != nil {
 		return err
-	})
-	if err != nil {
-		_ = w.Close()
 	}
-	return
+	err := record(p)
+	if err == nil {
+		return nil
+	}
+
+	if errRestore := reopen(); errRestore != nil {
+		return errRestore
+	}
+	if errRestore := record(w.recording); errRestore != nil {
+		return errRestore
+	}
+	return err
+}
+
+// restarted checks if the recording has been restarted since the given generation.
+func (w *adapterWrapper) restarted(generation uint64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.generation != generation
 }
 
 func (w *adapterWrapper) IsAvailable() (bool, error) {
@@ -119,3 +442,34 @@ func (w *adapterWrapper) IsAvailable() (bool, error) {
 	}
 	return w.isAvailable()
 }
+
+// Controls returns the controls of the adapter, or nil if it's closed or has none.
+func (w *adapterWrapper) Controls() []Control {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.controls == nil || w.state == StateClosed {
+		return nil
+	}
+	return w.controls.Controls()
+}
+
+func (w *adapterWrapper) GetControl(id ControlID) (int32, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.controls == nil {
+		return 0, errControlsUnsupported
+	}
+	return w.controls.GetControl(id)
+}
+
+func (w *adapterWrapper) SetControl(id ControlID, value int32) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.controls == nil {
+		return errControlsUnsupported
+	}
+	return w.controls.SetControl(id, value)
+}
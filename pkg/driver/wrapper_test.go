@@ -1,9 +1,16 @@
 package driver
 
 import (
+	"bytes"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/pion/mediadevices/pkg/frame"
 	"github.com/pion/mediadevices/pkg/io/audio"
 	"github.com/pion/mediadevices/pkg/io/video"
 	"github.com/pion/mediadevices/pkg/prop"
@@ -39,6 +46,72 @@ func (a *audioAdapterBrokenMock) AudioRecord(p prop.Media) (r audio.Reader, err
 	return nil, recordErr
 }
 
+// sharedAdapterMock records frames of the requested width until it's closed, and counts its opens and
+// records.
+type sharedAdapterMock struct {
+	adapterMock
+	mu      sync.Mutex
+	closed  chan struct{}
+	opens   int
+	records []prop.Media
+}
+
+func (a *sharedAdapterMock) Open() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closed = make(chan struct{})
+	a.opens++
+	return nil
+}
+
+func (a *sharedAdapterMock) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	close(a.closed)
+	return nil
+}
+
+func (a *sharedAdapterMock) VideoRecord(p prop.Media) (video.Reader, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, p)
+	closed := a.closed
+
+	return video.ReaderFunc(func() (image.Image, func(), error) {
+		select {
+		case <-closed:
+			return nil, func() {}, io.EOF
+		default:
+		}
+		return image.NewGray(image.Rect(0, 0, p.Width, 1)), func() {}, nil
+	}), nil
+}
+
+// encodedAdapterMock is a sharedAdapterMock that records JPEG frames of the requested width.
+type encodedAdapterMock struct {
+	sharedAdapterMock
+}
+
+func (a *encodedAdapterMock) EncodedVideoRecord(p prop.Media) (EncodedVideoReader, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, p)
+	closed := a.closed
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, p.Width, p.Height)), nil); err != nil {
+		return nil, err
+	}
+	return EncodedVideoReaderFunc(func() ([]byte, time.Time, error) {
+		select {
+		case <-closed:
+			return nil, time.Time{}, io.EOF
+		default:
+		}
+		return buf.Bytes(), time.Now(), nil
+	}), nil
+}
+
 type availabilityAdapterMock struct{ videoAdapterMock }
 
 func (a *availabilityAdapterMock) IsAvailable() (bool, error) { return true, nil }
@@ -175,3 +248,205 @@ func TestWrapperAvailabilityAdapter(t *testing.T) {
 		t.Errorf("expected false, but got %v", ok)
 	}
 }
+
+func TestWrapperSharedOpen(t *testing.T) {
+	var a sharedAdapterMock
+	d := wrapAdapter(&a, Info{})
+
+	for i := 0; i < 2; i++ {
+		if err := d.Open(); err != nil {
+			t.Fatalf("expected to successfully open, but got %v", err)
+		}
+	}
+	if a.opens != 1 {
+		t.Errorf("expected the adapter to be opened once, but got %d", a.opens)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatalf("expected to successfully close, but got %v", err)
+	}
+	if d.Status() != StateOpened {
+		t.Errorf("expected the status to be %v, but got %v", StateOpened, d.Status())
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatalf("expected to successfully close, but got %v", err)
+	}
+	if d.Status() != StateClosed {
+		t.Errorf("expected the status to be %v, but got %v", StateClosed, d.Status())
+	}
+
+	// The adapter would panic if it was closed twice
+	if err := d.Close(); err != nil {
+		t.Fatalf("expected closing a closed driver to do nothing, but got %v", err)
+	}
+}
+
+func TestWrapperForceClose(t *testing.T) {
+	var a sharedAdapterMock
+	d := wrapAdapter(&a, Info{})
+
+	for i := 0; i < 2; i++ {
+		if err := d.Open(); err != nil {
+			t.Fatalf("expected to successfully open, but got %v", err)
+		}
+	}
+
+	if err := d.(forceCloser).forceClose(); err != nil {
+		t.Fatalf("expected to successfully close, but got %v", err)
+	}
+	if d.Status() != StateClosed {
+		t.Errorf("expected the status to be %v, but got %v", StateClosed, d.Status())
+	}
+
+	// The users close it afterwards, which must not close the adapter again
+	for i := 0; i < 2; i++ {
+		if err := d.Close(); err != nil {
+			t.Fatalf("expected closing a closed driver to do nothing, but got %v", err)
+		}
+	}
+}
+
+func TestWrapperSharedVideoRecord(t *testing.T) {
+	var a sharedAdapterMock
+	d := wrapAdapter(&a, Info{})
+	vr := d.(VideoRecorder)
+
+	// The frames of the new recording may come after a few frames of the old one
+	expectWidth := func(t *testing.T, r video.Reader, width int) {
+		t.Helper()
+		for i := 0; i < 10; i++ {
+			img, _, err := r.Read()
+			if err != nil {
+				t.Fatalf("expected to read a frame, but got %v", err)
+			}
+			if img.Bounds().Dx() == width {
+				return
+			}
+		}
+		t.Errorf("expected frames of width %d", width)
+	}
+
+	if err := d.Open(); err != nil {
+		t.Fatal(err)
+	}
+	first, err := vr.VideoRecord(prop.Media{Video: prop.Video{Width: 640}})
+	if err != nil {
+		t.Fatalf("expected to successfully start recording, but got %v", err)
+	}
+
+	if err := d.Open(); err != nil {
+		t.Fatal(err)
+	}
+	second, err := vr.VideoRecord(prop.Media{Video: prop.Video{Width: 640}})
+	if err != nil {
+		t.Fatalf("expected to share the recording, but got %v", err)
+	}
+	if len(a.records) != 1 {
+		t.Errorf("expected the adapter to be recorded once, but got %v", a.records)
+	}
+	expectWidth(t, second, 640)
+
+	// Both readers continue with the frames of the restarted recording
+	if _, err := vr.VideoRecord(prop.Media{Video: prop.Video{Width: 320}}); err != nil {
+		t.Fatalf("expected to restart the recording, but got %v", err)
+	}
+	if len(a.records) != 2 || a.records[1].Width != 320 {
+		t.Errorf("expected the adapter to be recorded with the new properties, but got %v", a.records)
+	}
+	for _, r := range []video.Reader{first, second} {
+		expectWidth(t, r, 320)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Status() != StateRunning {
+		t.Errorf("expected the status to be %v, but got %v", StateRunning, d.Status())
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		_, _, err := first.Read()
+		if err == io.EOF {
+			break
+		}
+		if i == 10 {
+			t.Fatalf("expected %v after the last close, but got %v", io.EOF, err)
+		}
+	}
+}
+
+func TestWrapperSharedEncodedVideoRecord(t *testing.T) {
+	var a encodedAdapterMock
+	d := wrapAdapter(&a, Info{})
+	er := d.(EncodedVideoRecorder)
+	if err := d.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if _, err := er.EncodedVideoRecord(prop.Media{Video: prop.Video{Width: 16, Height: 8, FrameFormat: frame.FormatI420}}); err != errEncodedVideoUnsupported {
+		t.Errorf("expected %v for uncompressed frames, but got %v", errEncodedVideoUnsupported, err)
+	}
+
+	p := prop.Media{Video: prop.Video{Width: 16, Height: 8, FrameFormat: frame.FormatMJPEG}}
+	encoded, err := er.EncodedVideoRecord(p)
+	if err != nil {
+		t.Fatalf("expected to start recording, but got %v", err)
+	}
+	data, _, err := encoded.Read()
+	if err != nil {
+		t.Fatalf("expected to read a frame, but got %v", err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("expected a JPEG frame, but got %v", err)
+	}
+
+	// The video readers decode the same recording
+	decoded, err := d.(VideoRecorder).VideoRecord(p)
+	if err != nil {
+		t.Fatalf("expected to share the recording, but got %v", err)
+	}
+	img, _, err := decoded.Read()
+	if err != nil {
+		t.Fatalf("expected to read a decoded frame, but got %v", err)
+	}
+	if img.Bounds().Dx() != 16 {
+		t.Errorf("expected frames of width 16, but got %d", img.Bounds().Dx())
+	}
+	if len(a.records) != 1 {
+		t.Errorf("expected the adapter to be recorded once, but got %v", a.records)
+	}
+}
+
+func TestWrapperStableID(t *testing.T) {
+	camera := Info{DeviceType: Camera, StableID: "v4l2:by-id/usb-webcam-video-index0", GroupID: "usb1/1-2"}
+	microphone := Info{DeviceType: Microphone, StableID: "v4l2:by-id/usb-webcam-video-index0", GroupID: "usb1/1-2"}
+
+	id := wrapAdapter(&videoAdapterMock{}, camera).ID()
+	if other := wrapAdapter(&videoAdapterMock{}, camera).ID(); other != id {
+		t.Errorf("expected the same ID for the same device, but got %s and %s", id, other)
+	}
+	if other := wrapAdapter(&audioAdapterMock{}, microphone).ID(); other == id {
+		t.Errorf("expected different IDs for different device types, but got %s", other)
+	}
+	if a, b := wrapAdapter(&videoAdapterMock{}, Info{}).ID(), wrapAdapter(&videoAdapterMock{}, Info{}).ID(); a == b {
+		t.Errorf("expected random IDs without stable IDs, but got %s twice", a)
+	}
+
+	group := wrapAdapter(&videoAdapterMock{}, camera).Info().GroupID
+	if group == camera.GroupID {
+		t.Errorf("expected the group ID to be hashed, but got %s", group)
+	}
+	if other := wrapAdapter(&audioAdapterMock{}, microphone).Info().GroupID; other != group {
+		t.Errorf("expected the same group ID for the same physical device, but got %s and %s", group, other)
+	}
+
+	SetDeviceIDSalt("application")
+	t.Cleanup(func() { SetDeviceIDSalt("") })
+	if other := wrapAdapter(&videoAdapterMock{}, camera).ID(); other == id {
+		t.Errorf("expected the salt to change the ID, but got %s", other)
+	}
+}
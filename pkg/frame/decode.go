@@ -28,6 +28,9 @@ const (
 
 	// FormatMJPEG https://wiki.videolan.org/MJPEG
 	FormatMJPEG = "MJPEG"
+	// FormatH264 is an H.264 stream in Annex B format, with an access unit per frame. There's no decoder
+	// for it, so it can only be sent as it is.
+	FormatH264 = "H264"
 
 	// FormatZ16 https://www.kernel.org/doc/html/v5.9/userspace-api/media/v4l/pixfmt-z16.html
 	FormatZ16 = "Z16"
@@ -53,3 +56,14 @@ func NewDecoder(f Format) (Decoder, error) {
 
 	return decoder, nil
 }
+
+// IsCompressed checks if the frames of f are compressed by a codec, e.g. JPEG or H.264, so that they
+// can be sent without being decoded and encoded again.
+func IsCompressed(f Format) bool {
+	switch f {
+	case FormatMJPEG, FormatH264:
+		return true
+	default:
+		return false
+	}
+}
@@ -2,6 +2,9 @@ package frame
 
 import "image"
 
+// Decoder decodes the frames of a driver. The decoded frames don't share memory with frame, so frame can be
+// reused as soon as Decode returns. The decoded frames are taken from DefaultPool, if they aren't decoded
+// by an external library, e.g. MJPEG frames, and are put back by the returned release function.
 type Decoder interface {
 	Decode(frame []byte, width, height int) (image.Image, func(), error)
 }
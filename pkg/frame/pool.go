@@ -0,0 +1,92 @@
+package frame
+
+import (
+	"image"
+	"sync"
+)
+
+// Pool reuses the memory of frames with the same size and format, so that frames can be decoded,
+// converted and scaled without allocating new ones once the pool is warm. Frames are taken from the pool
+// with a release function, which puts them back, and must be called once at most, when nobody uses the frame
+// anymore. Frames that aren't released are left to the garbage collector. Pool is safe for concurrent use.
+type Pool struct {
+	mu    sync.Mutex
+	pools map[poolKey]*sync.Pool
+}
+
+// DefaultPool is the pool that the decoders, the video transforms and the drivers take their frames from.
+var DefaultPool = NewPool()
+
+type poolKind uint8
+
+const (
+	poolKindYCbCr poolKind = iota
+	poolKindRGBA
+)
+
+type poolKey struct {
+	kind          poolKind
+	width, height int
+	ratio         image.YCbCrSubsampleRatio
+}
+
+type pooledYCbCr struct {
+	img, orig image.YCbCr
+	release   func()
+}
+
+type pooledRGBA struct {
+	img, orig image.RGBA
+	release   func()
+}
+
+// NewPool creates a new empty Pool.
+func NewPool() *Pool {
+	return &Pool{pools: make(map[poolKey]*sync.Pool)}
+}
+
+func (p *Pool) get(key poolKey) any {
+	p.mu.Lock()
+	pool, ok := p.pools[key]
+	if !ok {
+		pool = &sync.Pool{}
+		pool.New = func() any { return newPooledFrame(pool, key) }
+		p.pools[key] = pool
+	}
+	p.mu.Unlock()
+
+	return pool.Get()
+}
+
+func newPooledFrame(pool *sync.Pool, key poolKey) any {
+	rect := image.Rect(0, 0, key.width, key.height)
+	switch key.kind {
+	case poolKindRGBA:
+		e := &pooledRGBA{orig: *image.NewRGBA(rect)}
+		e.release = func() { pool.Put(e) }
+		return e
+	default:
+		e := &pooledYCbCr{orig: *image.NewYCbCr(rect, key.ratio)}
+		e.release = func() { pool.Put(e) }
+		return e
+	}
+}
+
+// YCbCr takes a YCbCr frame of r and ratio from the pool. The pixels of the frame aren't cleared.
+func (p *Pool) YCbCr(r image.Rectangle, ratio image.YCbCrSubsampleRatio) (*image.YCbCr, func()) {
+	e := p.get(poolKey{kind: poolKindYCbCr, width: r.Dx(), height: r.Dy(), ratio: ratio}).(*pooledYCbCr)
+
+	// The previous user may have changed the frame, e.g. by slicing its planes
+	e.img = e.orig
+	e.img.Rect = r
+	return &e.img, e.release
+}
+
+// RGBA takes an RGBA frame of r from the pool. The pixels of the frame aren't cleared.
+func (p *Pool) RGBA(r image.Rectangle) (*image.RGBA, func()) {
+	e := p.get(poolKey{kind: poolKindRGBA, width: r.Dx(), height: r.Dy()}).(*pooledRGBA)
+
+	e.img = e.orig
+	e.img.Rect = r
+	return &e.img, e.release
+}
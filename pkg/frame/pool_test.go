@@ -0,0 +1,70 @@
+package frame
+
+import (
+	"image"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	pool := NewPool()
+	rect := image.Rect(0, 0, 64, 48)
+
+	img, release := pool.YCbCr(rect, image.YCbCrSubsampleRatio420)
+	if img.Rect != rect || img.SubsampleRatio != image.YCbCrSubsampleRatio420 || len(img.Y) != 64*48 || len(img.Cb) != 32*24 {
+		t.Fatalf("Unexpected frame: %v %v, %d luma and %d chroma bytes", img.Rect, img.SubsampleRatio, len(img.Y), len(img.Cb))
+	}
+	release()
+
+	// sync.Pool may drop frames, e.g. with the race detector, so they're not always reused right away
+	reused := false
+	for i := 0; i < 100 && !reused; i++ {
+		img, release := pool.YCbCr(rect, image.YCbCrSubsampleRatio420)
+		y := &img.Y[0]
+		// Users may change the frames they're given
+		img.Cb, img.Cr = img.Cr, img.Cb
+		release()
+
+		img, release = pool.YCbCr(rect.Add(image.Pt(8, 8)), image.YCbCrSubsampleRatio420)
+		if &img.Y[0] == y {
+			reused = true
+			if &img.Cb[0] == &img.Cr[0] || img.Rect != rect.Add(image.Pt(8, 8)) {
+				t.Error("Expected the reused frame to be reset")
+			}
+		}
+		release()
+	}
+	if !reused {
+		t.Error("Expected the released frames to be reused")
+	}
+
+	other, releaseOther := pool.YCbCr(rect, image.YCbCrSubsampleRatio444)
+	defer releaseOther()
+	if len(other.Cb) != 64*48 {
+		t.Errorf("Expected frames of other formats to have their own size, got %d chroma bytes", len(other.Cb))
+	}
+	rgba, releaseRGBA := pool.RGBA(rect)
+	defer releaseRGBA()
+	if len(rgba.Pix) != 4*64*48 || rgba.Rect != rect {
+		t.Errorf("Unexpected RGBA frame: %v, %d bytes", rgba.Rect, len(rgba.Pix))
+	}
+}
+
+func BenchmarkPool(b *testing.B) {
+	pool := NewPool()
+	rect := image.Rect(0, 0, 1920, 1080)
+
+	b.Run("YCbCr", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, release := pool.YCbCr(rect, image.YCbCrSubsampleRatio420)
+			release()
+		}
+	})
+	b.Run("RGBA", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, release := pool.RGBA(rect)
+			release()
+		}
+	})
+}
@@ -14,15 +14,11 @@ func decodeI420(frame []byte, width, height int) (image.Image, func(), error) {
 		return nil, func() {}, fmt.Errorf("frame length (%d) less than expected (%d)", len(frame), cri)
 	}
 
-	return &image.YCbCr{
-		Y:              frame[:yi],
-		YStride:        width,
-		Cb:             frame[yi:cbi],
-		Cr:             frame[cbi:cri],
-		CStride:        width / 2,
-		SubsampleRatio: image.YCbCrSubsampleRatio420,
-		Rect:           image.Rect(0, 0, width, height),
-	}, func() {}, nil
+	img, release := DefaultPool.YCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	copy(img.Y, frame[:yi])
+	copy(img.Cb, frame[yi:cbi])
+	copy(img.Cr, frame[cbi:cri])
+	return img, release, nil
 }
 
 func decodeNV21(frame []byte, width, height int) (image.Image, func(), error) {
@@ -33,21 +29,14 @@ func decodeNV21(frame []byte, width, height int) (image.Image, func(), error) {
 		return nil, func() {}, fmt.Errorf("frame length (%d) less than expected (%d)", len(frame), ci)
 	}
 
-	var cb, cr []byte
-	for i := yi; i < ci; i += 2 {
-		cr = append(cr, frame[i])
-		cb = append(cb, frame[i+1])
+	img, release := DefaultPool.YCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	copy(img.Y, frame[:yi])
+	for i, j := yi, 0; i < ci; i, j = i+2, j+1 {
+		img.Cr[j] = frame[i]
+		img.Cb[j] = frame[i+1]
 	}
 
-	return &image.YCbCr{
-		Y:              frame[:yi],
-		YStride:        width,
-		Cb:             cb,
-		Cr:             cr,
-		CStride:        width / 2,
-		SubsampleRatio: image.YCbCrSubsampleRatio420,
-		Rect:           image.Rect(0, 0, width, height),
-	}, func() {}, nil
+	return img, release, nil
 }
 
 func decodeNV12(frame []byte, width, height int) (image.Image, func(), error) {
@@ -16,9 +16,8 @@ func decodeYUY2(frame []byte, width, height int) (image.Image, func(), error) {
 		return nil, func() {}, fmt.Errorf("frame length (%d) less than expected (%d)", len(frame), fi)
 	}
 
-	y := make([]byte, yi)
-	cb := make([]byte, ci)
-	cr := make([]byte, ci)
+	img, release := DefaultPool.YCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio422)
+	y, cb, cr := img.Y, img.Cb, img.Cr
 
 	fast := 0
 	slow := 0
@@ -31,15 +30,7 @@ func decodeYUY2(frame []byte, width, height int) (image.Image, func(), error) {
 		slow++
 	}
 
-	return &image.YCbCr{
-		Y:              y,
-		YStride:        width,
-		Cb:             cb,
-		Cr:             cr,
-		CStride:        width / 2,
-		SubsampleRatio: image.YCbCrSubsampleRatio422,
-		Rect:           image.Rect(0, 0, width, height),
-	}, func() {}, nil
+	return img, release, nil
 }
 
 func decodeUYVY(frame []byte, width, height int) (image.Image, func(), error) {
@@ -51,9 +42,8 @@ func decodeUYVY(frame []byte, width, height int) (image.Image, func(), error) {
 		return nil, func() {}, fmt.Errorf("frame length (%d) less than expected (%d)", len(frame), fi)
 	}
 
-	y := make([]byte, yi)
-	cb := make([]byte, ci)
-	cr := make([]byte, ci)
+	img, release := DefaultPool.YCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio422)
+	y, cb, cr := img.Y, img.Cb, img.Cr
 
 	fast := 0
 	slow := 0
@@ -66,13 +56,5 @@ func decodeUYVY(frame []byte, width, height int) (image.Image, func(), error) {
 		slow++
 	}
 
-	return &image.YCbCr{
-		Y:              y,
-		YStride:        width,
-		Cb:             cb,
-		Cr:             cr,
-		CStride:        width / 2,
-		SubsampleRatio: image.YCbCrSubsampleRatio422,
-		Rect:           image.Rect(0, 0, width, height),
-	}, func() {}, nil
+	return img, release, nil
 }
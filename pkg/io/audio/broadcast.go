@@ -2,6 +2,7 @@ package audio
 
 import (
 	"errors"
+	"time"
 
 	"github.com/pion/mediadevices/pkg/io"
 	"github.com/pion/mediadevices/pkg/wave"
@@ -9,9 +10,45 @@ import (
 
 var errEmptySource = errors.New("Source can't be nil")
 
+// broadcasterChunk is the data that's shared with the readers through the ring buffer.
+type broadcasterChunk struct {
+	chunk     wave.Audio
+	timestamp time.Time
+}
+
+// toIOReader adapts source to io.Reader, which produces broadcasterChunk.
+func toIOReader(source Reader) io.Reader {
+	timestamped := WithTimestamp(source)
+	return io.ReaderFunc(func() (any, func(), error) {
+		chunk, timestamp, release, err := timestamped.ReadTimestamped()
+		if err != nil {
+			return nil, release, err
+		}
+		return broadcasterChunk{chunk, timestamp}, release, nil
+	})
+}
+
+// fromIOReader adapts reader, which produces broadcasterChunk, back to TimestampedReader. If the chunks of reader
+// are copies, the chunks of the source are released right away, as they aren't used anymore.
+func fromIOReader(reader io.Reader, copied bool) TimestampedReader {
+	return TimestampedReaderFunc(func() (wave.Audio, time.Time, func(), error) {
+		data, release, err := reader.Read()
+		if err != nil {
+			return nil, time.Time{}, func() {}, err
+		}
+		if copied {
+			release()
+			release = func() {}
+		}
+		chunk := data.(broadcasterChunk)
+		return chunk.chunk, chunk.timestamp, release, nil
+	})
+}
+
 // Broadcaster is a specialized video broadcaster.
 type Broadcaster struct {
 	ioBroadcaster *io.Broadcaster
+	dropPolicy    io.DropPolicy
 }
 
 type BroadcasterConfig struct {
@@ -19,58 +56,62 @@ type BroadcasterConfig struct {
 }
 
 // NewBroadcaster creates a new broadcaster. Source is expected to drop chunks
-// when any of the readers is slower than the source.
+// when any of the readers is slower than the source. If source is a TimestampedReader,
+// its timestamps are given to the readers. Otherwise, chunks are stamped when they're
+// read from source.
 func NewBroadcaster(source Reader, config *BroadcasterConfig) *Broadcaster {
 	var coreConfig *io.BroadcasterConfig
+	var dropPolicy io.DropPolicy
 
 	if config != nil {
 		coreConfig = config.Core
+		if coreConfig != nil {
+			dropPolicy = coreConfig.DropPolicy
+		}
 	}
 
-	broadcaster := io.NewBroadcaster(io.ReaderFunc(func() (any, func(), error) {
-		return source.Read()
-	}), coreConfig)
+	broadcaster := io.NewBroadcaster(toIOReader(source), coreConfig)
 
-	return &Broadcaster{broadcaster}
+	return &Broadcaster{broadcaster, dropPolicy}
 }
 
 // NewReader creates a new reader. Each reader will retrieve the same data from the source.
 // copyFn is used to copy the data from the source to individual readers. Broadcaster uses a small ring
 // buffer, this means that slow readers might miss some data if they're really late and the data is no longer
-// in the ring buffer.
+// in the ring buffer. The returned reader is a TimestampedReader.
 func (broadcaster *Broadcaster) NewReader(copyChunk bool) Reader {
+	return broadcaster.NewReaderWithDropPolicy(copyChunk, broadcaster.dropPolicy)
+}
+
+// NewReaderWithDropPolicy creates a new reader like NewReader, which is given the chunks that policy
+// decides on when it's behind the other readers.
+func (broadcaster *Broadcaster) NewReaderWithDropPolicy(copyChunk bool, policy io.DropPolicy) Reader {
 	copyFn := func(src any) any { return src }
 
 	if copyChunk {
 		buffer := wave.NewBuffer()
 		copyFn = func(src any) any {
-			realSrc, _ := src.(wave.Audio)
-			buffer.StoreCopy(realSrc)
-			return buffer.Load()
+			chunk, _ := src.(broadcasterChunk)
+			buffer.StoreCopy(chunk.chunk)
+			chunk.chunk = buffer.Load()
+			return chunk
 		}
 	}
 
-	reader := broadcaster.ioBroadcaster.NewReader(copyFn)
-	return ReaderFunc(func() (wave.Audio, func(), error) {
-		data, _, err := reader.Read()
-		chunk, _ := data.(wave.Audio)
-		return chunk, func() {}, err
-	})
+	return fromIOReader(broadcaster.ioBroadcaster.NewReader(copyFn, io.WithDropPolicy(policy)), copyChunk)
 }
 
 // ReplaceSource replaces the underlying source. This operation is thread safe.
 func (broadcaster *Broadcaster) ReplaceSource(source Reader) error {
-	return broadcaster.ioBroadcaster.ReplaceSource(io.ReaderFunc(func() (any, func(), error) {
-		return source.Read()
-	}))
+	if source == nil {
+		return errEmptySource
+	}
+
+	return broadcaster.ioBroadcaster.ReplaceSource(toIOReader(source))
 }
 
-// Source retrieves the underlying source. This operation is thread safe.
+// Source retrieves the underlying source. This operation is thread safe. The returned reader is
+// a TimestampedReader.
 func (broadcaster *Broadcaster) Source() Reader {
-	source := broadcaster.ioBroadcaster.Source()
-	return ReaderFunc(func() (wave.Audio, func(), error) {
-		data, _, err := source.Read()
-		img, _ := data.(wave.Audio)
-		return img, func() {}, err
-	})
+	return fromIOReader(broadcaster.ioBroadcaster.Source(), false)
 }
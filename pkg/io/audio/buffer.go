@@ -8,7 +8,8 @@ import (
 
 var errUnsupported = errors.New("unsupported audio format")
 
-// NewBuffer creates audio transform to buffer signal to have exact nSample samples.
+// NewBuffer creates audio transform to buffer signal to have exact nSample samples. The buffered chunks are
+// taken from wave.DefaultPool.
 func NewBuffer(nSamples int) TransformFunc {
 	var inBuff wave.Audio
 
@@ -19,10 +20,11 @@ func NewBuffer(nSamples int) TransformFunc {
 					break
 				}
 
-				buff, _, err := r.Read()
+				buff, release, err := r.Read()
 				if err != nil {
 					return nil, func() {}, err
 				}
+				release = releaseOrNop(release)
 				switch b := buff.(type) {
 				case *wave.Float32Interleaved:
 					ib, ok := inBuff.(*wave.Float32Interleaved)
@@ -59,29 +61,32 @@ func NewBuffer(nSamples int) TransformFunc {
 					ib.Size.Len += b.Size.Len
 
 				default:
+					release()
 					return nil, func() {}, errUnsupported
 				}
+				// The samples are copied to inBuff, so the chunk can be reused
+				release()
 			}
 			switch ib := inBuff.(type) {
 			case *wave.Int16Interleaved:
-				ibCopy := *ib
-				ibCopy.Size.Len = nSamples
-				n := nSamples * ib.Size.Channels
-				ibCopy.Data = make([]int16, n)
-				copy(ibCopy.Data, ib.Data)
-				ib.Data = ib.Data[n:]
+				size := ib.Size
+				size.Len = nSamples
+				chunk, release := wave.DefaultPool.Int16Interleaved(size)
+				n := copy(chunk.Data, ib.Data)
+				// The remaining samples are moved to the front, so that inBuff doesn't grow
+				ib.Data = ib.Data[:copy(ib.Data, ib.Data[n:])]
 				ib.Size.Len -= nSamples
-				return &ibCopy, func() {}, nil
+				return chunk, release, nil
 
 			case *wave.Float32Interleaved:
-				ibCopy := *ib
-				ibCopy.Size.Len = nSamples
-				n := nSamples * ib.Size.Channels
-				ibCopy.Data = make([]float32, n)
-				copy(ibCopy.Data, ib.Data)
-				ib.Data = ib.Data[n:]
+				size := ib.Size
+				size.Len = nSamples
+				chunk, release := wave.DefaultPool.Float32Interleaved(size)
+				n := copy(chunk.Data, ib.Data)
+				// The remaining samples are moved to the front, so that inBuff doesn't grow
+				ib.Data = ib.Data[:copy(ib.Data, ib.Data[n:])]
 				ib.Size.Len -= nSamples
-				return &ibCopy, func() {}, nil
+				return chunk, release, nil
 			}
 			return nil, func() {}, errUnsupported
 		})
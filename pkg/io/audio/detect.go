@@ -16,10 +16,11 @@ func DetectChanges(interval time.Duration, onChange func(prop.Media)) TransformF
 		return ReaderFunc(func() (wave.Audio, func(), error) {
 			var dirty bool
 
-			chunk, _, err := r.Read()
+			chunk, release, err := r.Read()
 			if err != nil {
 				return nil, func() {}, err
 			}
+			release = releaseOrNop(release)
 
 			info := chunk.ChunkInfo()
 			if currentProp.ChannelCount != info.Channels {
@@ -49,7 +50,7 @@ func DetectChanges(interval time.Duration, onChange func(prop.Media)) TransformF
 			}
 
 			chunkCount++
-			return chunk, func() {}, nil
+			return chunk, release, nil
 		})
 	}
 }
@@ -9,13 +9,14 @@ import (
 func NewChannelMixer(channels int, mixer mixer.ChannelMixer) TransformFunc {
 	return func(r Reader) Reader {
 		return ReaderFunc(func() (wave.Audio, func(), error) {
-			buff, _, err := r.Read()
+			buff, release, err := r.Read()
 			if err != nil {
 				return nil, func() {}, err
 			}
+			release = releaseOrNop(release)
 			ci := buff.ChunkInfo()
 			if ci.Channels == channels {
-				return buff, func() {}, nil
+				return buff, release, nil
 			}
 
 			ci.Channels = channels
@@ -31,7 +32,9 @@ func NewChannelMixer(channels int, mixer mixer.ChannelMixer) TransformFunc {
 			case *wave.Float32NonInterleaved:
 				mixed = wave.NewFloat32NonInterleaved(ci)
 			}
-			if err := mixer.Mix(mixed, buff); err != nil {
+			err = mixer.Mix(mixed, buff)
+			release()
+			if err != nil {
 				return nil, func() {}, err
 			}
 			return mixed, func() {}, nil
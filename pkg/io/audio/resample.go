@@ -0,0 +1,319 @@
+package audio
+
+import (
+	"math"
+
+	"github.com/pion/mediadevices/pkg/wave"
+)
+
+// ResampleQuality selects the trade-off between the quality and the CPU usage of a resampler.
+type ResampleQuality int
+
+const (
+	// ResampleQualityLow is suitable for speech.
+	ResampleQualityLow ResampleQuality = iota
+	// ResampleQualityMedium keeps aliasing inaudible for most signals.
+	ResampleQualityMedium
+	// ResampleQualityHigh is transparent, at about twice the CPU usage of ResampleQualityMedium.
+	ResampleQualityHigh
+)
+
+// zeroCrossings returns the number of zero crossings of the sinc kernel on each side of its center.
+func (q ResampleQuality) zeroCrossings() int {
+	switch q {
+	case ResampleQualityLow:
+		return 8
+	case ResampleQualityHigh:
+		return 32
+	default:
+		return 16
+	}
+}
+
+// rolloff returns the cutoff frequency of the low-pass filter, relative to the lowest of the input
+// and output Nyquist frequencies. The filter attenuates the frequencies above it gradually, over the
+// transition band, which must end before the Nyquist frequency to avoid aliasing.
+func (q ResampleQuality) rolloff() float64 {
+	switch q {
+	case ResampleQualityLow:
+		return 0.85
+	case ResampleQualityHigh:
+		return 0.96
+	default:
+		return 0.92
+	}
+}
+
+// beta returns the shape parameter of the Kaiser window, which trades the stopband attenuation for
+// the width of the transition band.
+func (q ResampleQuality) beta() float64 {
+	switch q {
+	case ResampleQualityLow:
+		return 6
+	case ResampleQualityHigh:
+		return 10
+	default:
+		return 8
+	}
+}
+
+// maxResamplePhases bounds the size of the filter tables. Conversions between rates that need more
+// phases, e.g. from 47999 Hz to 48000 Hz, compute the filter for every sample instead.
+const maxResamplePhases = 1024
+
+// NewResampler creates audio transform to convert the sampling rate of the audio to sampleRate,
+// with a polyphase windowed-sinc filter. Int16 and Float32 audio keep their type, other types are
+// converted to Float32Interleaved. The audio is passed through when it's already at sampleRate.
+//
+// The lengths of the resampled chunks vary, so that the duration of the audio is kept.
+func NewResampler(sampleRate int, quality ResampleQuality) TransformFunc {
+	return func(r Reader) Reader {
+		var rs *resampler
+		return ReaderFunc(func() (wave.Audio, func(), error) {
+			for {
+				chunk, release, err := r.Read()
+				if err != nil {
+					return nil, func() {}, err
+				}
+				release = releaseOrNop(release)
+				info := chunk.ChunkInfo()
+				if info.SamplingRate == sampleRate || info.SamplingRate == 0 {
+					rs = nil
+					return chunk, release, nil
+				}
+				if rs == nil || rs.inRate != info.SamplingRate || len(rs.in) != info.Channels {
+					rs = newResampler(info.SamplingRate, sampleRate, info.Channels, quality)
+				}
+
+				rs.push(chunk)
+				// The samples are copied into the resampler, so the chunk can be reused already
+				resampled := rs.pull(chunk)
+				release()
+				// The first chunks may be too short to produce any sample
+				if resampled.ChunkInfo().Len > 0 {
+					return resampled, func() {}, nil
+				}
+			}
+		})
+	}
+}
+
+type resampler struct {
+	inRate, outRate int
+	// The sampling rate is multiplied by up, and divided by down
+	up, down int64
+	// cutoff is the cutoff frequency of the low-pass filter, relative to the input Nyquist frequency
+	cutoff float64
+	// taps is the number of input samples on each side of an output sample that are filtered
+	taps  int
+	beta  float64
+	zeros int
+	// filters are the coefficients for each phase, if there are not too many phases
+	filters [][]float64
+
+	// in are the buffered input samples of each channel, starting from the sample at offset
+	in     [][]float64
+	offset int64
+	// next is the index of the next output sample
+	next int64
+}
+
+func newResampler(inRate, outRate, channels int, quality ResampleQuality) *resampler {
+	g := gcd(inRate, outRate)
+	rs := &resampler{
+		inRate:  inRate,
+		outRate: outRate,
+		up:      int64(outRate / g),
+		down:    int64(inRate / g),
+		cutoff:  math.Min(1, float64(outRate)/float64(inRate)) * quality.rolloff(),
+		beta:    quality.beta(),
+		zeros:   quality.zeroCrossings(),
+		in:      make([][]float64, channels),
+	}
+	rs.taps = int(math.Ceil(float64(rs.zeros) / rs.cutoff))
+
+	// Start with silence, so that the first output sample is aligned with the first input sample
+	for ch := range rs.in {
+		rs.in[ch] = make([]float64, rs.taps-1)
+	}
+	rs.offset = -int64(rs.taps - 1)
+
+	if rs.up <= maxResamplePhases {
+		rs.filters = make([][]float64, rs.up)
+		for phase := range rs.filters {
+			rs.filters[phase] = rs.filter(float64(phase)/float64(rs.up), nil)
+		}
+	}
+	return rs
+}
+
+// filter computes the coefficients of the 2*taps input samples around an output sample, which is at
+// frac (from 0 to 1) after the taps-th input sample. The coefficients are normalized, so that the
+// gain is exactly 1 at 0 Hz.
+func (rs *resampler) filter(frac float64, coeffs []float64) []float64 {
+	coeffs = coeffs[:0]
+	var sum float64
+	for k := 0; k < 2*rs.taps; k++ {
+		// Distance from the output sample to the input sample, in input samples
+		d := frac + float64(rs.taps-1-k)
+		c := rs.cutoff * sinc(rs.cutoff*d) * kaiser(d/float64(rs.taps), rs.beta)
+		coeffs = append(coeffs, c)
+		sum += c
+	}
+	for k := range coeffs {
+		coeffs[k] /= sum
+	}
+	return coeffs
+}
+
+func (rs *resampler) push(chunk wave.Audio) {
+	info := chunk.ChunkInfo()
+	switch c := chunk.(type) {
+	case *wave.Int16Interleaved:
+		for ch := range rs.in {
+			for i := 0; i < info.Len; i++ {
+				rs.in[ch] = append(rs.in[ch], float64(c.Data[i*info.Channels+ch])/0x8000)
+			}
+		}
+	case *wave.Int16NonInterleaved:
+		for ch := range rs.in {
+			for _, s := range c.Data[ch][:info.Len] {
+				rs.in[ch] = append(rs.in[ch], float64(s)/0x8000)
+			}
+		}
+	case *wave.Float32Interleaved:
+		for ch := range rs.in {
+			for i := 0; i < info.Len; i++ {
+				rs.in[ch] = append(rs.in[ch], float64(c.Data[i*info.Channels+ch]))
+			}
+		}
+	case *wave.Float32NonInterleaved:
+		for ch := range rs.in {
+			for _, s := range c.Data[ch][:info.Len] {
+				rs.in[ch] = append(rs.in[ch], float64(s))
+			}
+		}
+	default:
+		for ch := range rs.in {
+			for i := 0; i < info.Len; i++ {
+				s := wave.Float32SampleFormat.Convert(chunk.At(i, ch)).(wave.Float32Sample)
+				rs.in[ch] = append(rs.in[ch], float64(s))
+			}
+		}
+	}
+}
+
+// pull resamples the buffered input, as far as the filter has enough input samples. The resampled
+// audio has the type of like.
+func (rs *resampler) pull(like wave.Audio) wave.Audio {
+	available := rs.offset + int64(len(rs.in[0]))
+
+	// The output sample n is at n*down/up input samples, and needs taps input samples after it
+	n := rs.next
+	if a := available - int64(rs.taps); a > 0 {
+		n = max(n, (a*rs.up+rs.down-1)/rs.down)
+	}
+	info := wave.ChunkInfo{
+		Len:          int(n - rs.next),
+		Channels:     len(rs.in),
+		SamplingRate: rs.outRate,
+	}
+
+	var out wave.EditableAudio
+	switch like.(type) {
+	case *wave.Int16Interleaved:
+		out = wave.NewInt16Interleaved(info)
+	case *wave.Int16NonInterleaved:
+		out = wave.NewInt16NonInterleaved(info)
+	case *wave.Float32NonInterleaved:
+		out = wave.NewFloat32NonInterleaved(info)
+	default:
+		out = wave.NewFloat32Interleaved(info)
+	}
+
+	var coeffs []float64
+	for i := 0; i < info.Len; i++ {
+		pos := (rs.next + int64(i)) * rs.down
+		phase := pos % rs.up
+		if rs.filters != nil {
+			coeffs = rs.filters[phase]
+		} else {
+			coeffs = rs.filter(float64(phase)/float64(rs.up), coeffs)
+		}
+		// Index of the first filtered input sample in the buffers
+		start := int(pos/rs.up - int64(rs.taps-1) - rs.offset)
+		for ch, in := range rs.in {
+			var v float64
+			for k, c := range coeffs {
+				v += c * in[start+k]
+			}
+			setResampled(out, i, ch, v)
+		}
+	}
+	rs.next = n
+
+	// Drop the input samples that won't be filtered anymore
+	if drop := int((n*rs.down)/rs.up - int64(rs.taps-1) - rs.offset); drop > 0 {
+		for ch, in := range rs.in {
+			rs.in[ch] = append(in[:0], in[drop:]...)
+		}
+		rs.offset += int64(drop)
+	}
+	return out
+}
+
+func setResampled(out wave.EditableAudio, i, ch int, v float64) {
+	switch o := out.(type) {
+	case *wave.Int16Interleaved:
+		o.SetInt16(i, ch, wave.Int16Sample(clampInt16(v)))
+	case *wave.Int16NonInterleaved:
+		o.SetInt16(i, ch, wave.Int16Sample(clampInt16(v)))
+	case *wave.Float32Interleaved:
+		o.SetFloat32(i, ch, wave.Float32Sample(v))
+	case *wave.Float32NonInterleaved:
+		o.SetFloat32(i, ch, wave.Float32Sample(v))
+	}
+}
+
+func clampInt16(v float64) int16 {
+	v = math.Round(v * 0x8000)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// kaiser returns the Kaiser window at x, from -1 to 1.
+func kaiser(x, beta float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return besselI0(beta*math.Sqrt(1-x*x)) / besselI0(beta)
+}
+
+// besselI0 is the zeroth order modified Bessel function of the first kind.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,160 @@
+package audio
+
+import (
+	"io"
+	"math"
+	"testing"
+
+	"github.com/pion/mediadevices/pkg/wave"
+)
+
+// sineReader returns chunks of a sine wave of freq Hz, and then io.EOF. The amplitude is in the range
+// of Int16 audio, which represents the Float32Sample values from -0.5 to 0.5.
+func sineReader(freq float64, rate, chunkLen, chunks int, newChunk func(wave.ChunkInfo) wave.EditableAudio) Reader {
+	var i, sent int
+	return ReaderFunc(func() (wave.Audio, func(), error) {
+		if sent == chunks {
+			return nil, func() {}, io.EOF
+		}
+		sent++
+		chunk := newChunk(wave.ChunkInfo{Len: chunkLen, Channels: 2, SamplingRate: rate})
+		for j := 0; j < chunkLen; j++ {
+			v := 0.25 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate))
+			chunk.Set(j, 0, wave.Float32Sample(v))
+			chunk.Set(j, 1, wave.Float32Sample(-v))
+			i++
+		}
+		return chunk, func() {}, nil
+	})
+}
+
+func readAll(t *testing.T, r Reader, rate int) [][2]float64 {
+	t.Helper()
+
+	var samples [][2]float64
+	for {
+		chunk, _, err := r.Read()
+		if err == io.EOF {
+			return samples
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := chunk.ChunkInfo()
+		if info.SamplingRate != rate || info.Channels != 2 {
+			t.Fatalf("Unexpected chunk info: %+v", info)
+		}
+		for i := 0; i < info.Len; i++ {
+			var s [2]float64
+			for ch := range s {
+				s[ch] = float64(wave.Float32SampleFormat.Convert(chunk.At(i, ch)).(wave.Float32Sample))
+			}
+			samples = append(samples, s)
+		}
+	}
+}
+
+func TestResampler(t *testing.T) {
+	newInt16 := func(info wave.ChunkInfo) wave.EditableAudio { return wave.NewInt16Interleaved(info) }
+	newFloat32 := func(info wave.ChunkInfo) wave.EditableAudio { return wave.NewFloat32NonInterleaved(info) }
+
+	testCases := map[string]struct {
+		inRate, outRate int
+		freq            float64
+		quality         ResampleQuality
+		newChunk        func(wave.ChunkInfo) wave.EditableAudio
+		maxError        float64
+	}{
+		"44100To48000": {
+			inRate: 44100, outRate: 48000, freq: 1000, quality: ResampleQualityHigh, newChunk: newInt16, maxError: 0.001,
+		},
+		"16000To48000": {
+			inRate: 16000, outRate: 48000, freq: 440, quality: ResampleQualityMedium, newChunk: newFloat32, maxError: 0.001,
+		},
+		"48000To16000": {
+			inRate: 48000, outRate: 16000, freq: 1000, quality: ResampleQualityLow, newChunk: newInt16, maxError: 0.005,
+		},
+		"47999To48000": {
+			inRate: 47999, outRate: 48000, freq: 1000, quality: ResampleQualityMedium, newChunk: newFloat32, maxError: 0.001,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			const chunks = 50
+			chunkLen := tc.inRate / 100
+			r := NewResampler(tc.outRate, tc.quality)(sineReader(tc.freq, tc.inRate, chunkLen, chunks, tc.newChunk))
+			samples := readAll(t, r, tc.outRate)
+
+			// The filter holds back the last input samples
+			expectedLen := chunks * tc.outRate / 100
+			if len(samples) > expectedLen || len(samples) < expectedLen*9/10 {
+				t.Fatalf("Expected about %d samples, got %d", expectedLen, len(samples))
+			}
+
+			var maxError float64
+			// The first samples are filtered with the silence before the input
+			for i := tc.outRate / 100; i < len(samples); i++ {
+				expected := 0.25 * math.Sin(2*math.Pi*tc.freq*float64(i)/float64(tc.outRate))
+				maxError = math.Max(maxError, math.Abs(samples[i][0]-expected))
+				maxError = math.Max(maxError, math.Abs(samples[i][1]+expected))
+			}
+			if maxError > tc.maxError {
+				t.Errorf("Expected an error below %f, got %f", tc.maxError, maxError)
+			}
+		})
+	}
+
+	t.Run("AntiAliasing", func(t *testing.T) {
+		// 10 kHz is above the Nyquist frequency at 16 kHz
+		r := NewResampler(16000, ResampleQualityMedium)(sineReader(10000, 48000, 480, 20, newInt16))
+		samples := readAll(t, r, 16000)
+
+		var power float64
+		for _, s := range samples[160:] {
+			power += s[0] * s[0]
+		}
+		if rms := math.Sqrt(power / float64(len(samples)-160)); rms > 0.001 {
+			t.Errorf("Expected the tone to be filtered out, got an RMS of %f", rms)
+		}
+	})
+
+	t.Run("PassThrough", func(t *testing.T) {
+		chunk := wave.NewInt16Interleaved(wave.ChunkInfo{Len: 480, Channels: 2, SamplingRate: 48000})
+		var released int
+		r := NewResampler(48000, ResampleQualityHigh)(ReaderFunc(func() (wave.Audio, func(), error) {
+			return chunk, func() { released++ }, nil
+		}))
+		resampled, release, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resampled != chunk {
+			t.Error("Expected the chunk to be passed through")
+		}
+		if released != 0 {
+			t.Error("Expected the chunk to be released by the reader")
+		}
+		release()
+		if released != 1 {
+			t.Errorf("Expected the chunk to be released once, got %d", released)
+		}
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		var read, released int
+		r := NewResampler(48000, ResampleQualityHigh)(ReaderFunc(func() (wave.Audio, func(), error) {
+			read++
+			return wave.NewInt16Interleaved(wave.ChunkInfo{Len: 441, Channels: 2, SamplingRate: 44100}), func() { released++ }, nil
+		}))
+		for i := 0; i < 10; i++ {
+			_, release, err := r.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			release()
+		}
+		if released != read {
+			t.Errorf("Expected the %d chunks that were resampled to be released, got %d", read, released)
+		}
+	})
+}
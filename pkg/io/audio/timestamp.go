@@ -0,0 +1,73 @@
+package audio
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/wave"
+)
+
+// TimestampedReader is a Reader that also reports when each chunk was captured.
+type TimestampedReader interface {
+	Reader
+	// ReadTimestamped is the same as Read, but it also returns the capture time of chunk.
+	ReadTimestamped() (chunk wave.Audio, timestamp time.Time, release func(), err error)
+}
+
+// TimestampedReaderFunc is a proxy type for TimestampedReader
+type TimestampedReaderFunc func() (chunk wave.Audio, timestamp time.Time, release func(), err error)
+
+// Read implements Reader. The timestamp is dropped.
+func (rf TimestampedReaderFunc) Read() (chunk wave.Audio, release func(), err error) {
+	chunk, _, release, err = rf()
+	return
+}
+
+// ReadTimestamped implements TimestampedReader.
+func (rf TimestampedReaderFunc) ReadTimestamped() (chunk wave.Audio, timestamp time.Time, release func(), err error) {
+	return rf()
+}
+
+// WithTimestamp returns r as a TimestampedReader. If r doesn't report timestamps, the time when
+// each chunk is read from r is used instead.
+func WithTimestamp(r Reader) TimestampedReader {
+	if tr, ok := r.(TimestampedReader); ok {
+		return tr
+	}
+
+	return TimestampedReaderFunc(func() (wave.Audio, time.Time, func(), error) {
+		chunk, release, err := r.Read()
+		return chunk, time.Now(), release, err
+	})
+}
+
+// keepTimestamp applies transform so that the chunks coming out of it carry the timestamp of
+// the last chunk that it read. Transforms read chunks synchronously, so the last chunk read is
+// the one that the output chunk was made from. Transforms that report their own timestamps are
+// left as they are.
+func keepTimestamp(transform TransformFunc) TransformFunc {
+	return func(r Reader) Reader {
+		src := WithTimestamp(r)
+
+		var mu sync.Mutex
+		var last time.Time
+		transformed := transform(TimestampedReaderFunc(func() (wave.Audio, time.Time, func(), error) {
+			chunk, timestamp, release, err := src.ReadTimestamped()
+			mu.Lock()
+			last = timestamp
+			mu.Unlock()
+			return chunk, timestamp, release, err
+		}))
+		if tr, ok := transformed.(TimestampedReader); ok {
+			return tr
+		}
+
+		return TimestampedReaderFunc(func() (wave.Audio, time.Time, func(), error) {
+			chunk, release, err := transformed.Read()
+			mu.Lock()
+			timestamp := last
+			mu.Unlock()
+			return chunk, timestamp, release, err
+		})
+	}
+}
@@ -2,90 +2,147 @@ package io
 
 import (
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 const (
-	maskReading                = 1 << 63
 	defaultBroadcasterRingSize = 32
-	// TODO: If the data source has fps greater than 30, they'll see some
-	// 			 fps fluctuation. But, 30 fps should be enough for general cases.
-	defaultBroadcasterRingPollDuration = time.Millisecond * 33
 )
 
 var errEmptySource = fmt.Errorf("Source can't be nil")
 
+// DropPolicy decides which data a reader gets when it's behind the other readers.
+type DropPolicy int
+
+const (
+	// DropPolicyLossless gives every data in order, as long as it's still in the ring buffer. Readers that are
+	// so late that their next data was overwritten continue with the oldest data in the ring buffer.
+	DropPolicyLossless DropPolicy = iota
+	// DropPolicyLatestOnly skips to the latest data, e.g. to render a preview without falling behind.
+	DropPolicyLatestOnly
+)
+
+func (p DropPolicy) String() string {
+	switch p {
+	case DropPolicyLossless:
+		return "lossless"
+	case DropPolicyLatestOnly:
+		return "latest-only"
+	default:
+		return fmt.Sprintf("DropPolicy(%d)", int(p))
+	}
+}
+
 type broadcasterData struct {
 	data  any
 	count uint32
 	err   error
+	// refs counts the ring buffer and the readers that use data. The release function of the source is called
+	// once they're all done with it.
+	refs    atomic.Int32
+	release func()
+	unref   func()
+}
+
+func newBroadcasterData(data any, release func(), err error, count uint32) *broadcasterData {
+	d := &broadcasterData{data: data, count: count, err: err, release: release}
+	d.unref = func() {
+		if d.refs.Add(-1) == 0 && d.release != nil {
+			d.release()
+		}
+	}
+	// The ring buffer and the reader that read it from the source
+	d.refs.Store(2)
+	return d
 }
 
 type broadcasterRing struct {
-	// reading (1 bit) + reserved (31 bits) + data count (32 bits)
-	// IMPORTANT: state has to be the first element in struct, otherwise LoadUint64 will panic in 32 bits systems
-	//            due to unallignment
-	state        uint64
-	buffer       []atomic.Value
-	pollDuration time.Duration
+	mu     sync.Mutex
+	buffer []*broadcasterData
+	// next is the count of the next data to be read from the source
+	next    uint32
+	reading bool
+	// published is closed once the data that is being read from the source is in the ring buffer, to wake up
+	// the readers waiting for it
+	published chan struct{}
 }
 
-func newBroadcasterRing(size uint, pollDuration time.Duration) *broadcasterRing {
-	return &broadcasterRing{buffer: make([]atomic.Value, size), pollDuration: pollDuration}
+func newBroadcasterRing(size uint) *broadcasterRing {
+	return &broadcasterRing{buffer: make([]*broadcasterData, size)}
 }
 
 func (ring *broadcasterRing) index(count uint32) int {
-	return int(count) % len(ring.buffer)
-}
-
-func (ring *broadcasterRing) acquire(count uint32) func(*broadcasterData) {
-	// Reader has reached the latest data, should read from the source.
-	// Only allow 1 reader to read from the source. When there are more than 1 readers,
-	// the other readers will need to share the same data that the first reader gets from
-	// the source.
-	state := uint64(count)
-	if atomic.CompareAndSwapUint64(&ring.state, state, state|maskReading) {
-		return func(data *broadcasterData) {
-			i := ring.index(count)
-			ring.buffer[i].Store(data)
-			atomic.StoreUint64(&ring.state, uint64(count+1))
-		}
-	}
-
-	return nil
+	return int(count % uint32(len(ring.buffer)))
 }
 
-func (ring *broadcasterRing) get(count uint32) *broadcasterData {
+// get returns the data with the given count, or the data that policy replaces it with if the reader is behind.
+// When the reader has reached the latest data, it should read from the source, which get tells by returning
+// a push function to publish the data with. Only 1 reader reads from the source at a time. When there are more
+// than 1 readers, the other readers wait for the data that the first reader gets from the source and share it.
+func (ring *broadcasterRing) get(count uint32, policy DropPolicy) (*broadcasterData, func(*broadcasterData)) {
+	ring.mu.Lock()
 	for {
-		reading := uint64(count) | maskReading
-		// TODO: since it's lockless, it spends a lot of resources in the scheduling.
-		for atomic.LoadUint64(&ring.state) == reading {
-			// Yield current goroutine to let other goroutines to run instead
-			time.Sleep(ring.pollDuration)
+		behind := ring.next - count
+		if behind == 0 {
+			if !ring.reading {
+				ring.reading = true
+				ring.published = make(chan struct{})
+				ring.mu.Unlock()
+				return nil, ring.push
+			}
+
+			published := ring.published
+			ring.mu.Unlock()
+			<-published
+			ring.mu.Lock()
+			continue
 		}
 
-		i := ring.index(count)
-		data := ring.buffer[i].Load().(*broadcasterData)
-		if data.count == count {
-			return data
+		switch {
+		case policy == DropPolicyLatestOnly:
+			count = ring.next - 1
+		case behind > uint32(len(ring.buffer)):
+			count = ring.next - uint32(len(ring.buffer))
 		}
+		data := ring.buffer[ring.index(count)]
+		data.refs.Add(1)
+		ring.mu.Unlock()
+		return data, nil
+	}
+}
 
-		count++
+func (ring *broadcasterRing) push(data *broadcasterData) {
+	ring.mu.Lock()
+	i := ring.index(data.count)
+	evicted := ring.buffer[i]
+	ring.buffer[i] = data
+	ring.next = data.count + 1
+	ring.reading = false
+	close(ring.published)
+	ring.mu.Unlock()
+
+	if evicted != nil {
+		evicted.unref()
 	}
 }
 
 func (ring *broadcasterRing) lastCount() uint32 {
-	// ring.state always keeps track the next count, so we need to subtract it by 1 to get the
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	// ring.next always keeps track the next count, so we need to subtract it by 1 to get the
 	// last count
-	return uint32(atomic.LoadUint64(&ring.state)) - 1
+	return ring.next - 1
 }
 
 // Broadcaster is a generic pull-based broadcaster. Broadcaster is unique in a sense that
 // readers can come and go at anytime, and readers don't need to close or notify broadcaster.
 type Broadcaster struct {
-	source atomic.Value
-	buffer *broadcasterRing
+	source     atomic.Value
+	buffer     *broadcasterRing
+	dropPolicy DropPolicy
 }
 
 // BroadcasterConfig is a config to control broadcaster behaviour
@@ -93,28 +150,42 @@ type BroadcasterConfig struct {
 	// BufferSize configures the underlying ring buffer size that's being used
 	// to avoid data lost for late readers. The default value is 32.
 	BufferSize uint
-	// PollDuration configures the sleep duration in waiting for new data to come.
-	// The default value is 33 ms.
+	// PollDuration used to configure the sleep duration in waiting for new data to come.
+	//
+	// Deprecated: readers are woken up as soon as new data comes, so PollDuration is ignored.
 	PollDuration time.Duration
+	// DropPolicy is the drop policy of the readers that aren't given one. The default value is
+	// DropPolicyLossless.
+	DropPolicy DropPolicy
+}
+
+// ReaderOption configures a reader of a Broadcaster.
+type ReaderOption func(*readerOptions)
+
+type readerOptions struct {
+	dropPolicy DropPolicy
+}
+
+// WithDropPolicy sets the drop policy of the reader.
+func WithDropPolicy(policy DropPolicy) ReaderOption {
+	return func(o *readerOptions) {
+		o.dropPolicy = policy
+	}
 }
 
 // NewBroadcaster creates a new broadcaster. Source is expected to drop frames
 // when any of the readers is slower than the source.
 func NewBroadcaster(source Reader, config *BroadcasterConfig) *Broadcaster {
-	pollDuration := defaultBroadcasterRingPollDuration
 	var bufferSize uint = defaultBroadcasterRingSize
+	var broadcaster Broadcaster
 	if config != nil {
-		if config.PollDuration != 0 {
-			pollDuration = config.PollDuration
-		}
-
 		if config.BufferSize != 0 {
 			bufferSize = config.BufferSize
 		}
+		broadcaster.dropPolicy = config.DropPolicy
 	}
 
-	var broadcaster Broadcaster
-	broadcaster.buffer = newBroadcasterRing(bufferSize, pollDuration)
+	broadcaster.buffer = newBroadcasterRing(bufferSize)
 	broadcaster.ReplaceSource(source)
 
 	return &broadcaster
@@ -123,28 +194,36 @@ func NewBroadcaster(source Reader, config *BroadcasterConfig) *Broadcaster {
 // NewReader creates a new reader. Each reader will retrieve the same data from the source.
 // copyFn is used to copy the data from the source to individual readers. Broadcaster uses a small ring
 // buffer, this means that slow readers might miss some data if they're really late and the data is no longer
-// in the ring buffer.
-func (broadcaster *Broadcaster) NewReader(copyFn func(any) any) Reader {
+// in the ring buffer. Which data slow readers get is decided by their DropPolicy.
+//
+// The data of the source is released once it's out of the ring buffer, and all the readers that read it have
+// called their release function. Readers that copy the data should release it as soon as it's copied.
+func (broadcaster *Broadcaster) NewReader(copyFn func(any) any, opts ...ReaderOption) Reader {
+	options := readerOptions{dropPolicy: broadcaster.dropPolicy}
+	for _, opt := range opts {
+		opt(&options)
+	}
 	currentCount := broadcaster.buffer.lastCount()
 
-	return ReaderFunc(func() (data any, release func(), err error) {
+	return ReaderFunc(func() (any, func(), error) {
 		currentCount++
-		if push := broadcaster.buffer.acquire(currentCount); push != nil {
-			data, _, err = broadcaster.source.Load().(Reader).Read()
-			push(&broadcasterData{
-				data:  data,
-				err:   err,
-				count: currentCount,
-			})
-		} else {
-			ringData := broadcaster.buffer.get(currentCount)
-			data, err, currentCount = ringData.data, ringData.err, ringData.count
+		ringData, push := broadcaster.buffer.get(currentCount, options.dropPolicy)
+		if push != nil {
+			data, release, err := broadcaster.source.Load().(Reader).Read()
+			if err != nil {
+				// There's no memory to release when an error occurred during reading
+				release = nil
+			}
+			ringData = newBroadcasterData(data, release, err, currentCount)
+			push(ringData)
 		}
+		currentCount = ringData.count
 
-		if data != nil { // data is nil if an error occurred during reading
-			data = copyFn(data)
+		if ringData.err != nil {
+			ringData.unref()
+			return nil, func() {}, ringData.err
 		}
-		return
+		return copyFn(ringData.data), ringData.unref, nil
 	})
 }
 
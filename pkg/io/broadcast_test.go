@@ -3,6 +3,7 @@ package io
 import (
 	"fmt"
 	"runtime"
+	"runtime/metrics"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -148,3 +149,143 @@ func TestBroadcast(t *testing.T) {
 		})
 	}
 }
+
+func TestBroadcastDropPolicy(t *testing.T) {
+	var n int
+	src := ReaderFunc(func() (any, func(), error) {
+		n++
+		return n - 1, func() {}, nil
+	})
+	broadcaster := NewBroadcaster(src, &BroadcasterConfig{BufferSize: 4})
+	copyFn := func(src any) any { return src }
+
+	fast := broadcaster.NewReader(copyFn)
+	lossless := broadcaster.NewReader(copyFn, WithDropPolicy(DropPolicyLossless))
+	latestOnly := broadcaster.NewReader(copyFn, WithDropPolicy(DropPolicyLatestOnly))
+	read := func(r Reader) int {
+		t.Helper()
+		data, _, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data.(int)
+	}
+
+	for i := 0; i < 3; i++ {
+		read(fast)
+	}
+	for _, expected := range []int{0, 1, 2} {
+		if actual := read(lossless); actual != expected {
+			t.Errorf("Expected the lossless reader to read %d, got %d", expected, actual)
+		}
+	}
+	if actual := read(latestOnly); actual != 2 {
+		t.Errorf("Expected the latest-only reader to skip to 2, got %d", actual)
+	}
+
+	// The lossless reader continues with the oldest data that's left in the ring buffer
+	for i := 0; i < 6; i++ {
+		read(fast)
+	}
+	if actual := read(lossless); actual != 5 {
+		t.Errorf("Expected the lossless reader to continue with 5, got %d", actual)
+	}
+	if actual := read(latestOnly); actual != 8 {
+		t.Errorf("Expected the latest-only reader to skip to 8, got %d", actual)
+	}
+
+	// Readers that have read the latest data read from the source
+	if actual := read(latestOnly); actual != 9 {
+		t.Errorf("Expected the latest-only reader to read 9 from the source, got %d", actual)
+	}
+	if actual := read(fast); actual != 9 {
+		t.Errorf("Expected the fast reader to read 9, got %d", actual)
+	}
+}
+
+func TestBroadcastWakeUp(t *testing.T) {
+	release := make(chan struct{})
+	src := ReaderFunc(func() (any, func(), error) {
+		<-release
+		return time.Now(), func() {}, nil
+	})
+	// Waiting readers used to poll the ring buffer with PollDuration
+	broadcaster := NewBroadcaster(src, &BroadcasterConfig{PollDuration: time.Hour})
+
+	const readers = 8
+	latencies := make(chan time.Duration, readers)
+	for i := 0; i < readers; i++ {
+		reader := broadcaster.NewReader(func(src any) any { return src })
+		go func() {
+			data, _, err := reader.Read()
+			if err != nil {
+				t.Error(err)
+			}
+			latencies <- time.Since(data.(time.Time))
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	for i := 0; i < readers; i++ {
+		select {
+		case <-latencies:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the waiting readers to be woken up by the new data")
+		}
+	}
+}
+
+// BenchmarkBroadcast reads a source with many readers, and reports how late the readers get the data on
+// average, and how much CPU time the broadcast takes per data.
+func BenchmarkBroadcast(b *testing.B) {
+	cpu := []metrics.Sample{{Name: "/cpu/classes/user:cpu-seconds"}}
+	cpuSeconds := func() float64 {
+		// The CPU metrics are only updated by the garbage collector
+		runtime.GC()
+		metrics.Read(cpu)
+		if cpu[0].Value.Kind() != metrics.KindFloat64 {
+			return 0
+		}
+		return cpu[0].Value.Float64()
+	}
+
+	for _, fps := range []int{30, 60, 120} {
+		for _, n := range []int{1, 16, 256} {
+			b.Run(fmt.Sprintf("FPS-%d/Readers-%d", fps, n), func(b *testing.B) {
+				interval := time.NewTicker(time.Second / time.Duration(fps))
+				defer interval.Stop()
+				src := ReaderFunc(func() (any, func(), error) {
+					<-interval.C
+					return time.Now(), func() {}, nil
+				})
+				broadcaster := NewBroadcaster(src, nil)
+
+				var latency atomic.Int64
+				var wg sync.WaitGroup
+				wg.Add(n)
+				cpuStart := cpuSeconds()
+				b.ResetTimer()
+				for i := 0; i < n; i++ {
+					reader := broadcaster.NewReader(func(src any) any { return src })
+					go func() {
+						defer wg.Done()
+						for j := 0; j < b.N; j++ {
+							data, _, err := reader.Read()
+							if err != nil {
+								b.Error(err)
+								return
+							}
+							latency.Add(int64(time.Since(data.(time.Time))))
+						}
+					}()
+				}
+				wg.Wait()
+				b.StopTimer()
+
+				b.ReportMetric(float64(latency.Load())/float64(b.N*n), "ns-latency/op")
+				b.ReportMetric((cpuSeconds()-cpuStart)*float64(time.Second)/float64(b.N), "ns-cpu/op")
+			})
+		}
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"image"
 	"reflect"
 	"testing"
+
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/io"
 )
 
 func TestBroadcast(t *testing.T) {
@@ -66,3 +69,87 @@ func TestBroadcastWithCopyOnReadError(t *testing.T) {
 		t.Fatal("Expected error to be the same")
 	}
 }
+
+func TestBroadcastRelease(t *testing.T) {
+	var released []int
+	var n int
+	source := ReaderFunc(func() (image.Image, func(), error) {
+		i := n
+		n++
+		return image.NewGray(image.Rect(0, 0, 2, 2)), func() { released = append(released, i) }, nil
+	})
+
+	broadcaster := NewBroadcaster(source, &BroadcasterConfig{Core: &io.BroadcasterConfig{BufferSize: 2}})
+	reader1 := broadcaster.NewReader(false)
+	reader2 := broadcaster.NewReader(false)
+	copied := broadcaster.NewReader(true)
+
+	_, release1, err := reader1.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, release2, err := reader2.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := copied.Read(); err != nil {
+		t.Fatal(err)
+	}
+	release1()
+	release2()
+	if len(released) != 0 {
+		t.Fatal("Expected the frame to be kept while it's in the ring buffer")
+	}
+
+	// The next frames push the first one out of the ring buffer
+	for i := 0; i < 2; i++ {
+		_, release, err := reader1.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if !reflect.DeepEqual([]int{0}, released) {
+		t.Errorf("Expected the first frame to be released, got %v", released)
+	}
+}
+
+// BenchmarkBroadcastPipeline decodes YUY2 frames like a camera does, and encodes them at 2 resolutions, to
+// show the allocations of capturing and encoding in the steady state.
+func BenchmarkBroadcastPipeline(b *testing.B) {
+	const width, height = 1280, 720
+	raw := make([]byte, width*height*2)
+	decoder, err := frame.NewDecoder(frame.FormatYUY2)
+	if err != nil {
+		b.Fatal(err)
+	}
+	source := ReaderFunc(func() (image.Image, func(), error) {
+		return decoder.Decode(raw, width, height)
+	})
+
+	broadcaster := NewBroadcaster(source, nil)
+	readers := []Reader{
+		ToI420(broadcaster.NewReader(false)),
+		ToI420(Scale(640, 360, ScalerFastBoxSampling)(broadcaster.NewReader(false))),
+	}
+
+	read := func() {
+		for _, r := range readers {
+			_, release, err := r.Read()
+			if err != nil {
+				b.Fatal(err)
+			}
+			release()
+		}
+	}
+	// Warm the pools up, until the frames that are pushed out of the ring buffer are reused
+	for i := 0; i < 64; i++ {
+		read()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		read()
+	}
+}
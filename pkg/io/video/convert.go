@@ -5,6 +5,8 @@ import (
 	"image"
 	"image/color"
 	"sync"
+
+	"github.com/pion/mediadevices/pkg/frame"
 )
 
 // imageToYCbCr converts src to *image.YCbCr and store it to dst
@@ -66,56 +68,64 @@ func imageToYCbCr(dst *image.YCbCr, src image.Image) {
 // should be allocated according to subsample ratio
 var bytesPool sync.Pool
 
-// ToI420 converts r to a new reader that will output images in I420 format
+// ToI420 converts r to a new reader that will output images in I420 format. The converted images are taken
+// from frame.DefaultPool, and the images of r are released as soon as they aren't used anymore.
 func ToI420(r Reader) Reader {
 	var yuvImg image.YCbCr
 
-	getSlice := func(cLen int) []uint8 {
+	getSlice := func(cLen int) *[]uint8 {
 		// Retrieve slice from pool
-		dst, ok := bytesPool.Get().([]byte)
+		dst, ok := bytesPool.Get().(*[]byte)
 
 		// Compare value or capacity of retrieved object
 		// If less than expected, reallocate new object
-		if !ok || cap(dst) < 2*cLen {
+		if !ok || cap(*dst) < 2*cLen {
 			// Allocating memory for Cb and Cr
-			dst = make([]byte, 2*cLen, 2*cLen)
+			buf := make([]byte, 2*cLen, 2*cLen)
+			dst = &buf
 		}
 
 		return dst
 	}
 
 	return ReaderFunc(func() (image.Image, func(), error) {
-		img, _, err := r.Read()
+		img, release, err := r.Read()
 		if err != nil {
 			return nil, func() {}, err
 		}
+		release = releaseOrNop(release)
+
+		yuv, ok := img.(*image.YCbCr)
+		if !ok {
+			converted, releaseConverted := frame.DefaultPool.YCbCr(img.Bounds(), image.YCbCrSubsampleRatio444)
+			imageToYCbCr(converted, img)
+			release()
+			yuv, release = converted, releaseConverted
+		}
 
-		var releaseFunc func() = func() {}
-
-		imageToYCbCr(&yuvImg, img)
-
-		// Covert pixel format to I420
-		switch yuvImg.SubsampleRatio {
+		// Covert pixel format to I420. The luma plane is shared with the incoming image, so it's released
+		// with the converted image.
+		var dst *[]uint8
+		switch yuv.SubsampleRatio {
 		case image.YCbCrSubsampleRatio420:
+			return yuv, release, nil
 		case image.YCbCrSubsampleRatio444:
-			cLen := yuvImg.CStride * yuvImg.Rect.Dy() / 4
-			dst := getSlice(cLen)
-			yuvImg = i444ToI420(yuvImg, dst)
-			releaseFunc = func() {
-				bytesPool.Put(dst)
-			}
+			cLen := yuv.CStride * yuv.Rect.Dy() / 4
+			dst = getSlice(cLen)
+			yuvImg = i444ToI420(*yuv, *dst)
 		case image.YCbCrSubsampleRatio422:
-			cLen := yuvImg.CStride * (yuvImg.Rect.Dy() / 2)
-			dst := getSlice(cLen)
-			yuvImg = i422ToI420(yuvImg, dst)
-			releaseFunc = func() {
-				bytesPool.Put(dst)
-			}
+			cLen := yuv.CStride * (yuv.Rect.Dy() / 2)
+			dst = getSlice(cLen)
+			yuvImg = i422ToI420(*yuv, *dst)
 		default:
-			return nil, releaseFunc, fmt.Errorf("unsupported pixel format: %s", yuvImg.SubsampleRatio)
+			release()
+			return nil, func() {}, fmt.Errorf("unsupported pixel format: %s", yuv.SubsampleRatio)
 		}
 
-		return &yuvImg, releaseFunc, nil
+		return &yuvImg, func() {
+			bytesPool.Put(dst)
+			release()
+		}, nil
 	})
 }
 
@@ -159,16 +169,22 @@ func imageToRGBA(dst *image.RGBA, src image.Image) {
 	}
 }
 
-// ToRGBA converts r to a new reader that will output images in RGBA format
+// ToRGBA converts r to a new reader that will output images in RGBA format. The converted images are taken
+// from frame.DefaultPool, and the images of r are released once they're converted.
 func ToRGBA(r Reader) Reader {
-	var dst image.RGBA
 	return ReaderFunc(func() (image.Image, func(), error) {
-		img, _, err := r.Read()
+		img, release, err := r.Read()
 		if err != nil {
 			return nil, func() {}, err
 		}
+		release = releaseOrNop(release)
+		if _, ok := img.(*image.RGBA); ok {
+			return img, release, nil
+		}
 
-		imageToRGBA(&dst, img)
-		return &dst, func() {}, nil
+		dst, releaseDst := frame.DefaultPool.RGBA(img.Bounds())
+		imageToRGBA(dst, img)
+		release()
+		return dst, releaseDst, nil
 	})
 }
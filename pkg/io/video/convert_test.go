@@ -230,6 +230,7 @@ func BenchmarkToI420(b *testing.B) {
 						return img, func() {}, nil
 					}))
 
+					b.ReportAllocs()
 					for i := 0; i < b.N; i++ {
 						_, release, err := r.Read()
 						if err != nil {
@@ -259,11 +260,13 @@ func BenchmarkToRGBA(b *testing.B) {
 						return img, func() {}, nil
 					}))
 
+					b.ReportAllocs()
 					for i := 0; i < b.N; i++ {
-						_, _, err := r.Read()
+						_, release, err := r.Read()
 						if err != nil {
 							b.Fatalf("Unexpected error: %v", err)
 						}
+						release()
 					}
 				})
 			}
@@ -0,0 +1,55 @@
+package video
+
+import (
+	"image"
+)
+
+// Crop returns video cropping transform, which keeps the center width x height of the frames.
+// Frames that are smaller than that are kept as they are in that dimension.
+//
+// The cropped frames share the pixels of the incoming frames, so they aren't copied.
+func Crop(width, height int) TransformFunc {
+	if width <= 0 || height <= 0 {
+		panic("Both width and height have to be positive!")
+	}
+
+	return func(r Reader) Reader {
+		return ReaderFunc(func() (image.Image, func(), error) {
+			img, release, err := r.Read()
+			if err != nil {
+				return nil, func() {}, err
+			}
+			release = releaseOrNop(release)
+
+			bounds := img.Bounds()
+			w, h := min(width, bounds.Dx()), min(height, bounds.Dy())
+			// The offsets are kept even, so that the chroma planes of subsampled YCbCr frames stay aligned
+			x := bounds.Min.X + ((bounds.Dx()-w)/2)&^1
+			y := bounds.Min.Y + ((bounds.Dy()-h)/2)&^1
+			rect := image.Rect(x, y, x+w, y+h)
+
+			// The sub images start at their first pixel, so they're moved to the origin like the frames
+			// of the other transforms
+			switch v := img.(type) {
+			case *image.YCbCr:
+				cropped := v.SubImage(rect).(*image.YCbCr)
+				cropped.Rect = image.Rect(0, 0, w, h)
+				return cropped, release, nil
+
+			case *image.RGBA:
+				cropped := v.SubImage(rect).(*image.RGBA)
+				cropped.Rect = image.Rect(0, 0, w, h)
+				return cropped, release, nil
+
+			case *image.Gray:
+				cropped := v.SubImage(rect).(*image.Gray)
+				cropped.Rect = image.Rect(0, 0, w, h)
+				return cropped, release, nil
+
+			default:
+				release()
+				return nil, func() {}, errUnsupportedImageType
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package video
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCrop(t *testing.T) {
+	// Every pixel of the frames is unique, so that the cropped pixels can be compared to the incoming ones
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 8, 4), image.YCbCrSubsampleRatio420)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = uint8(i)
+	}
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i], ycbcr.Cr[i] = uint8(i), uint8(0x80+i)
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for i := range rgba.Pix {
+		rgba.Pix[i] = uint8(i)
+	}
+
+	cases := map[string]struct {
+		src           image.Image
+		width, height int
+		offset        image.Point
+		expected      image.Rectangle
+	}{
+		"I420": {
+			src: ycbcr, width: 4, height: 4,
+			offset: image.Pt(2, 0), expected: image.Rect(0, 0, 4, 4),
+		},
+		"I420OddOffset": {
+			src: ycbcr, width: 2, height: 2,
+			offset: image.Pt(2, 0), expected: image.Rect(0, 0, 2, 2),
+		},
+		"RGBA": {
+			src: rgba, width: 6, height: 2,
+			offset: image.Pt(0, 0), expected: image.Rect(0, 0, 6, 2),
+		},
+		"Larger": {
+			src: rgba, width: 16, height: 2,
+			offset: image.Pt(0, 0), expected: image.Rect(0, 0, 8, 2),
+		},
+	}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			crop := Crop(c.width, c.height)(ReaderFunc(func() (image.Image, func(), error) {
+				return c.src, func() {}, nil
+			}))
+			img, _, err := crop.Read()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if img.Bounds() != c.expected {
+				t.Fatalf("Expected bounds: %v, got: %v", c.expected, img.Bounds())
+			}
+			for y := 0; y < c.expected.Dy(); y++ {
+				for x := 0; x < c.expected.Dx(); x++ {
+					expected := color.RGBAModel.Convert(c.src.At(x+c.offset.X, y+c.offset.Y))
+					if actual := color.RGBAModel.Convert(img.At(x, y)); actual != expected {
+						t.Errorf("Expected %v at (%d, %d), got %v", expected, x, y, actual)
+					}
+				}
+			}
+		})
+	}
+}
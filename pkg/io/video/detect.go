@@ -18,10 +18,11 @@ func DetectChanges(interval time.Duration, fpsDiffTolerance float64, onChange fu
 		return ReaderFunc(func() (image.Image, func(), error) {
 			var dirty bool
 
-			img, _, err := r.Read()
+			img, release, err := r.Read()
 			if err != nil {
 				return nil, func() {}, err
 			}
+			release = releaseOrNop(release)
 
 			bounds := img.Bounds()
 			if currentProp.Width != bounds.Dx() {
@@ -54,7 +55,7 @@ func DetectChanges(interval time.Duration, fpsDiffTolerance float64, onChange fu
 			}
 
 			frames++
-			return img, func() {}, nil
+			return img, release, nil
 		})
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"image"
 
+	"github.com/pion/mediadevices/pkg/frame"
 	"golang.org/x/image/draw"
 )
 
@@ -35,6 +36,8 @@ var errUnsupportedImageType = errors.New("scaling: unsupported image type")
 // Setting scaler=nil to use default scaler. (ScalerNearestNeighbor)
 // Negative width or height value will keep the aspect ratio of incoming image.
 //
+// The scaled images are taken from frame.DefaultPool.
+//
 // Note: computation cost to scale YCbCr format is 10 times higher than RGB
 // due to the implementation in x/image/draw package.
 func Scale(width, height int, scaler Scaler) TransformFunc {
@@ -55,7 +58,6 @@ func Scale(width, height int, scaler Scaler) TransformFunc {
 		}
 
 		var rect image.Rectangle
-		var imgScaled image.Image
 		if width > 0 && height > 0 {
 			rect = image.Rect(0, 0, width, height)
 		} else if width <= 0 && height <= 0 {
@@ -92,87 +94,41 @@ func Scale(width, height int, scaler Scaler) TransformFunc {
 		src := &rgbLikeYCbCr{y: &image.Gray{}, cb: &image.Gray{}, cr: &image.Gray{}}
 		dst := &rgbLikeYCbCr{y: &image.Gray{}, cb: &image.Gray{}, cr: &image.Gray{}}
 
-		// ycbcrRealloc reallocs image.YCbCr if needed
-		ycbcrRealloc := func(i1 *image.YCbCr) {
-			if imgScaled == nil || imgScaled.ColorModel() != i1.ColorModel() {
-				updateRect(i1.Rect)
-				cacheScaler(rect, i1.Rect)
-				imgScaled = image.NewYCbCr(rect, i1.SubsampleRatio)
-			}
-			imgDst := imgScaled.(*image.YCbCr)
-			if imgDst.Rect.Dx() != i1.Rect.Dx() || imgDst.Rect.Dy() != i1.Rect.Dy() {
-				updateRect(i1.Rect)
-				cacheScaler(rect, i1.Rect)
-			}
-
-			yDx := rect.Dx()
-			yDy := rect.Dy()
-			cRect := fixedRect(rect, i1.SubsampleRatio)
-			cDx := cRect.Dx()
-			cDy := cRect.Dy()
-			yLen := yDx * yDy
-			cLen := cDx * cDy
-			if len(imgDst.Y) < yLen {
-				if cap(imgDst.Y) < yLen {
-					imgDst.Y = make([]uint8, yLen)
-				}
-				imgDst.Y = imgDst.Y[:yLen]
-			}
-			if len(imgDst.Cr) < cLen {
-				if cap(imgDst.Cr) < cLen {
-					imgDst.Cr = make([]uint8, cLen)
-				}
-				imgDst.Cr = imgDst.Cr[:cLen]
-			}
-			if len(imgDst.Cb) < cLen {
-				if cap(imgDst.Cb) < cLen {
-					imgDst.Cb = make([]uint8, cLen)
-				}
-				imgDst.Cb = imgDst.Cb[:cLen]
-			}
-			*dst.y = image.Gray{Pix: imgDst.Y, Stride: imgDst.YStride, Rect: rect}
-			*dst.cb = image.Gray{Pix: imgDst.Cb, Stride: imgDst.CStride, Rect: cRect}
-			*dst.cr = image.Gray{Pix: imgDst.Cr, Stride: imgDst.CStride, Rect: cRect}
-		}
-		// ycbcrRealloc reallocs image.RGBA if needed
-		rgbaRealloc := func(i1 *image.RGBA) {
-			if imgScaled == nil || imgScaled.ColorModel() != i1.ColorModel() {
-				updateRect(i1.Rect)
-				cacheScaler(rect, i1.Rect)
-				imgScaled = image.NewRGBA(rect)
-			}
-			imgDst := imgScaled.(*image.RGBA)
-			if imgDst.Rect.Dx() != i1.Rect.Dx() || imgDst.Rect.Dy() != i1.Rect.Dy() {
-				updateRect(i1.Rect)
-				cacheScaler(rect, i1.Rect)
-			}
-
-			l := 4 * rect.Dx() * rect.Dy()
-			if len(imgDst.Pix) < l {
-				if cap(imgDst.Pix) < l {
-					imgDst.Pix = make([]uint8, l)
-				}
-				imgDst.Pix = imgDst.Pix[:l]
+		// resize updates the output image size and the cached scaler when the size of the incoming images
+		// changes
+		var srcSize image.Point
+		resize := func(sRect image.Rectangle) {
+			if sRect.Size() == srcSize {
+				return
 			}
+			srcSize = sRect.Size()
+			updateRect(sRect)
+			cacheScaler(rect, sRect)
 		}
 
 		return ReaderFunc(func() (image.Image, func(), error) {
-			img, _, err := r.Read()
+			img, release, err := r.Read()
 			if err != nil {
 				return nil, func() {}, err
 			}
+			release = releaseOrNop(release)
+			// The scaled images are copies, so the incoming images aren't used after they're scaled
+			defer release()
 
 			switch v := img.(type) {
 			case *image.RGBA:
-				rgbaRealloc(v)
-				dst := imgScaled.(*image.RGBA)
-				scalerCached.Scale(dst, rect, v, v.Rect, draw.Src, nil)
-
-				cloned := *dst // clone metadata
-				return &cloned, func() {}, nil
+				resize(v.Rect)
+				imgScaled, releaseScaled := frame.DefaultPool.RGBA(rect)
+				scalerCached.Scale(imgScaled, rect, v, v.Rect, draw.Src, nil)
+				return imgScaled, releaseScaled, nil
 
 			case *image.YCbCr:
-				ycbcrRealloc(v)
+				resize(v.Rect)
+				imgScaled, releaseScaled := frame.DefaultPool.YCbCr(rect, v.SubsampleRatio)
+				cRect := fixedRect(rect, v.SubsampleRatio)
+				*dst.y = image.Gray{Pix: imgScaled.Y, Stride: imgScaled.YStride, Rect: rect}
+				*dst.cb = image.Gray{Pix: imgScaled.Cb, Stride: imgScaled.CStride, Rect: cRect}
+				*dst.cr = image.Gray{Pix: imgScaled.Cr, Stride: imgScaled.CStride, Rect: cRect}
 				// Scale each plane
 				*src.y = image.Gray{Pix: v.Y, Stride: v.YStride, Rect: v.Rect}
 				*src.cb = image.Gray{
@@ -182,9 +138,7 @@ func Scale(width, height int, scaler Scaler) TransformFunc {
 					Pix: v.Cr, Stride: v.CStride, Rect: fixedRect(v.Rect, v.SubsampleRatio),
 				}
 				scalerCached.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
-
-				cloned := *(imgScaled.(*image.YCbCr)) // clone metadata
-				return &cloned, func() {}, nil
+				return imgScaled, releaseScaled, nil
 
 			default:
 				return nil, func() {}, errUnsupportedImageType
@@ -12,15 +12,18 @@ func Throttle(rate float32) TransformFunc {
 		ticker := time.NewTicker(time.Duration(int64(float64(time.Second) / float64(rate))))
 		return ReaderFunc(func() (image.Image, func(), error) {
 			for {
-				img, _, err := r.Read()
+				img, release, err := r.Read()
 				if err != nil {
 					ticker.Stop()
 					return nil, func() {}, err
 				}
+				release = releaseOrNop(release)
 				select {
 				case <-ticker.C:
-					return img, func() {}, nil
+					return img, release, nil
 				default:
+					// The dropped frames can be reused right away
+					release()
 				}
 			}
 		})
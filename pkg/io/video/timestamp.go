@@ -0,0 +1,72 @@
+package video
+
+import (
+	"image"
+	"sync"
+	"time"
+)
+
+// TimestampedReader is a Reader that also reports when each frame was captured.
+type TimestampedReader interface {
+	Reader
+	// ReadTimestamped is the same as Read, but it also returns the capture time of img.
+	ReadTimestamped() (img image.Image, timestamp time.Time, release func(), err error)
+}
+
+// TimestampedReaderFunc is a proxy type for TimestampedReader
+type TimestampedReaderFunc func() (img image.Image, timestamp time.Time, release func(), err error)
+
+// Read implements Reader. The timestamp is dropped.
+func (rf TimestampedReaderFunc) Read() (img image.Image, release func(), err error) {
+	img, _, release, err = rf()
+	return
+}
+
+// ReadTimestamped implements TimestampedReader.
+func (rf TimestampedReaderFunc) ReadTimestamped() (img image.Image, timestamp time.Time, release func(), err error) {
+	return rf()
+}
+
+// WithTimestamp returns r as a TimestampedReader. If r doesn't report timestamps, the time when
+// each frame is read from r is used instead.
+func WithTimestamp(r Reader) TimestampedReader {
+	if tr, ok := r.(TimestampedReader); ok {
+		return tr
+	}
+
+	return TimestampedReaderFunc(func() (image.Image, time.Time, func(), error) {
+		img, release, err := r.Read()
+		return img, time.Now(), release, err
+	})
+}
+
+// keepTimestamp applies transform so that the frames coming out of it carry the timestamp of
+// the last frame that it read. Transforms read frames synchronously, so the last frame read is
+// the one that the output frame was made from. Transforms that report their own timestamps are
+// left as they are.
+func keepTimestamp(transform TransformFunc) TransformFunc {
+	return func(r Reader) Reader {
+		src := WithTimestamp(r)
+
+		var mu sync.Mutex
+		var last time.Time
+		transformed := transform(TimestampedReaderFunc(func() (image.Image, time.Time, func(), error) {
+			img, timestamp, release, err := src.ReadTimestamped()
+			mu.Lock()
+			last = timestamp
+			mu.Unlock()
+			return img, timestamp, release, err
+		}))
+		if tr, ok := transformed.(TimestampedReader); ok {
+			return tr
+		}
+
+		return TimestampedReaderFunc(func() (image.Image, time.Time, func(), error) {
+			img, release, err := transformed.Read()
+			mu.Lock()
+			timestamp := last
+			mu.Unlock()
+			return img, timestamp, release, err
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package video
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+func TestTimestamp(t *testing.T) {
+	base := time.Unix(1000, 0)
+	var count int
+	source := TimestampedReaderFunc(func() (image.Image, time.Time, func(), error) {
+		count++
+		return image.NewGray(image.Rect(0, 0, 2, 2)), base.Add(time.Duration(count) * time.Second), func() {}, nil
+	})
+
+	t.Run("WithTimestamp", func(t *testing.T) {
+
+		before := time.Now()
+		_, timestamp, _, err := WithTimestamp(ReaderFunc(source.Read)).ReadTimestamped()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if timestamp.Before(before) {
+			t.Errorf("Expected frames to be stamped when they're read, got %v", timestamp)
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		// A transform that doesn't know about timestamps
+		identity := TransformFunc(func(r Reader) Reader {
+			return ReaderFunc(func() (image.Image, func(), error) {
+				return r.Read()
+			})
+		})
+
+		reader := WithTimestamp(Merge(identity, identity)(source))
+		_, timestamp, _, err := reader.ReadTimestamped()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := base.Add(time.Duration(count) * time.Second); !timestamp.Equal(expected) {
+			t.Errorf("Expected timestamp %v, got %v", expected, timestamp)
+		}
+	})
+
+	t.Run("Broadcaster", func(t *testing.T) {
+		broadcaster := NewBroadcaster(source, nil)
+		reader := WithTimestamp(broadcaster.NewReader(true))
+		_, timestamp, _, err := reader.ReadTimestamped()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := base.Add(time.Duration(count) * time.Second); !timestamp.Equal(expected) {
+			t.Errorf("Expected timestamp %v, got %v", expected, timestamp)
+		}
+	})
+}
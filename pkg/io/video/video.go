@@ -23,11 +23,21 @@ func (rf ReaderFunc) Read() (img image.Image, release func(), err error) {
 	return
 }
 
+// releaseOrNop returns release, or a function that does nothing if a source didn't give one, so that the
+// transforms can always call the release functions of their sources.
+func releaseOrNop(release func()) func() {
+	if release == nil {
+		return func() {}
+	}
+	return release
+}
+
 // TransformFunc produces a new Reader that will produces a transformed video
 type TransformFunc func(r Reader) Reader
 
 // Merge merges transforms and produces a new TransformFunc that will execute
-// transforms in order
+// transforms in order. The produced Reader is a TimestampedReader, which keeps the
+// capture timestamps of the frames across the transforms.
 func Merge(transforms ...TransformFunc) TransformFunc {
 	return func(r Reader) Reader {
 		for _, transform := range transforms {
@@ -35,7 +45,7 @@ func Merge(transforms ...TransformFunc) TransformFunc {
 				continue
 			}
 
-			r = transform(r)
+			r = keepTimestamp(transform)(r)
 		}
 
 		return r
@@ -138,41 +138,71 @@ func (p *Media) MergeConstraints(o MediaConstraints) {
 // FitnessDistance calculates fitness of media property and media constraints.
 // If no media satisfies given constraints, second return value will be false.
 func (p *MediaConstraints) FitnessDistance(o Media) (float64, bool) {
+	var dist float64
+	for _, f := range p.FitnessDistances(o) {
+		if !f.Satisfied {
+			return 0, false
+		}
+		dist += f.Distance
+	}
+	return dist, true
+}
+
+// ConstraintFitness is the fitness distance of a media property to a single constraint.
+type ConstraintFitness struct {
+	// Constraint is the name of the constrained field, e.g. "Width".
+	Constraint string
+	Distance   float64
+	// Satisfied is false if the property doesn't satisfy the constraint.
+	Satisfied bool
+}
+
+// FitnessDistances calculates fitness of media property and each of the media constraints that are set,
+// in the order of the fields of MediaConstraints.
+func (p *MediaConstraints) FitnessDistances(o Media) []ConstraintFitness {
 	cmps := comparisons{}
-	cmps.add(p.DeviceID, o.DeviceID)
-	cmps.add(p.Width, o.Width)
-	cmps.add(p.Height, o.Height)
-	cmps.add(p.FrameFormat, o.FrameFormat)
+	cmps.add("DeviceID", p.DeviceID, o.DeviceID)
+	cmps.add("Width", p.Width, o.Width)
+	cmps.add("Height", p.Height, o.Height)
+	cmps.add("FrameFormat", p.FrameFormat, o.FrameFormat)
 	// skip framerate if not available in media properties
 	if o.FrameRate > 0.0 {
-		cmps.add(p.FrameRate, o.FrameRate)
+		cmps.add("FrameRate", p.FrameRate, o.FrameRate)
 	}
-	cmps.add(p.SampleRate, o.SampleRate)
-	cmps.add(p.Latency, o.Latency)
-	cmps.add(p.ChannelCount, o.ChannelCount)
-	cmps.add(p.IsBigEndian, o.IsBigEndian)
-	cmps.add(p.IsFloat, o.IsFloat)
-	cmps.add(p.IsInterleaved, o.IsInterleaved)
-	return cmps.fitnessDistance()
+	if o.Width > 0 && o.Height > 0 && p.AspectRatio != nil {
+		cmps.add("AspectRatio", p.AspectRatio, float32(o.Width)/float32(o.Height))
+	}
+	cmps.add("SampleRate", p.SampleRate, o.SampleRate)
+	cmps.add("Latency", p.Latency, o.Latency)
+	cmps.add("ChannelCount", p.ChannelCount, o.ChannelCount)
+	cmps.add("IsBigEndian", p.IsBigEndian, o.IsBigEndian)
+	cmps.add("IsFloat", p.IsFloat, o.IsFloat)
+	cmps.add("IsInterleaved", p.IsInterleaved, o.IsInterleaved)
+	return cmps.fitnessDistances()
 }
 
 type comparisons []struct {
+	name            string
 	desired, actual any
 }
 
-func (c *comparisons) add(desired, actual any) {
+func (c *comparisons) add(name string, desired, actual any) {
 	if desired != nil {
 		*c = append(*c,
-			struct{ desired, actual any }{
-				desired, actual,
+			struct {
+				name            string
+				desired, actual any
+			}{
+				name, desired, actual,
 			},
 		)
 	}
 }
 
-// fitnessDistance is an implementation for https://w3c.github.io/mediacapture-main/#dfn-fitness-distance
-func (c *comparisons) fitnessDistance() (float64, bool) {
-	var dist float64
+// fitnessDistances is an implementation for https://w3c.github.io/mediacapture-main/#dfn-fitness-distance,
+// which keeps the distance of each constraint.
+func (c *comparisons) fitnessDistances() []ConstraintFitness {
+	fitness := make([]ConstraintFitness, 0, len(*c))
 	for _, field := range *c {
 		var d float64
 		var ok bool
@@ -216,12 +246,9 @@ func (c *comparisons) fitnessDistance() (float64, bool) {
 		default:
 			panic("unsupported constraint type")
 		}
-		dist += d
-		if !ok {
-			return 0, false
-		}
+		fitness = append(fitness, ConstraintFitness{Constraint: field.name, Distance: d, Satisfied: ok})
 	}
-	return dist, true
+	return fitness
 }
 
 // VideoConstraints represents a video's constraints
@@ -230,6 +257,26 @@ type VideoConstraints struct {
 	FrameRate              FloatConstraint
 	FrameFormat            FrameFormatConstraint
 	DiscardFramesOlderThan time.Duration
+
+	// The constraints below have no matching fields in Video, so they have to come last to keep
+	// the fields of both aligned.
+
+	// AspectRatio constrains the width divided by the height.
+	AspectRatio FloatConstraint
+	// ResizeMode tells whether the video can be made from a device with other properties.
+	ResizeMode ResizeMode
+
+	// The constraints below are set to the controls of the device once it's selected, e.g. the V4L2
+	// controls of a camera. The values are in the units of the device, and the modes are "manual" or
+	// "continuous".
+	// Reference: https://w3c.github.io/mediacapture-image/#constrainable-properties
+	ExposureMode     StringConstraint
+	WhiteBalanceMode StringConstraint
+	FocusDistance    FloatConstraint
+	Zoom             FloatConstraint
+	Pan              FloatConstraint
+	Tilt             FloatConstraint
+	Brightness       FloatConstraint
 }
 
 // Video represents a video's constraints
@@ -49,6 +49,26 @@ func TestCompareMatch(t *testing.T) {
 			}},
 			true,
 		},
+		"AspectRatioExactMatch": {
+			MediaConstraints{VideoConstraints: VideoConstraints{
+				AspectRatio: FloatExact(16.0 / 9.0),
+			}},
+			Media{Video: Video{
+				Width:  1280,
+				Height: 720,
+			}},
+			true,
+		},
+		"AspectRatioExactUnmatch": {
+			MediaConstraints{VideoConstraints: VideoConstraints{
+				AspectRatio: FloatExact(16.0 / 9.0),
+			}},
+			Media{Video: Video{
+				Width:  640,
+				Height: 480,
+			}},
+			false,
+		},
 		"IntExactUnmatch": {
 			MediaConstraints{VideoConstraints: VideoConstraints{
 				Width: IntExact(30),
@@ -480,3 +500,28 @@ func TestFrameRateProps(t *testing.T) {
 		})
 	}
 }
+
+func TestFitnessDistances(t *testing.T) {
+	constraints := MediaConstraints{VideoConstraints: VideoConstraints{
+		Width:     IntExact(640),
+		FrameRate: Float(30.0),
+	}}
+	media := Media{Video: Video{
+		Width:     320,
+		FrameRate: 60.0,
+	}}
+
+	expected := []ConstraintFitness{
+		{Constraint: "Width", Distance: 1.0, Satisfied: false},
+		{Constraint: "FrameRate", Distance: 0.5, Satisfied: true},
+	}
+	fitness := constraints.FitnessDistances(media)
+	if len(fitness) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, fitness)
+	}
+	for i := range expected {
+		if fitness[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], fitness[i])
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package prop
+
+// ResizeMode tells how a video can be made from a device that doesn't have the constrained properties.
+// Reference: https://w3c.github.io/mediacapture-main/#def-constraint-resizeMode
+type ResizeMode int
+
+const (
+	// ResizeModeCropAndScale allows the video to be cropped to an aspect ratio, scaled down, and
+	// to have frames dropped to lower the frame rate. It's the default.
+	ResizeModeCropAndScale ResizeMode = iota
+	// ResizeModeNone only allows the properties of the device.
+	ResizeModeNone
+)
+
+// String implements Stringify
+func (m ResizeMode) String() string {
+	switch m {
+	case ResizeModeCropAndScale:
+		return "crop-and-scale"
+	case ResizeModeNone:
+		return "none"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,230 @@
+package recorder
+
+import (
+	"errors"
+
+	"github.com/pion/mediadevices/internal/bitstream"
+)
+
+const (
+	// av1SelectScreenContentTools is SELECT_SCREEN_CONTENT_TOOLS in the AV1 specification.
+	av1SelectScreenContentTools = 2
+)
+
+var (
+	errAV1MissingSequenceHeader = errors.New("av1: keyframe doesn't contain a sequence header")
+	errAV1InvalidSequenceHeader = errors.New("av1: invalid sequence header")
+)
+
+// av1OBUBytes encodes obu with its size field, as required by the storage formats.
+func av1OBUBytes(obu bitstream.AV1OBU) []byte {
+	b := append([]byte{obu.Header[0] | 0x02}, obu.Header[1:]...)
+	b = appendLEB128(b, uint64(len(obu.Payload)))
+	return append(b, obu.Payload...)
+}
+
+// av1ToStorage converts a temporal unit to the format used by Matroska and ISOBMFF: temporal
+// delimiters and padding are dropped, and every OBU has a size field.
+func av1ToStorage(tu []byte) ([]byte, error) {
+	obus, err := bitstream.SplitAV1OBUs(tu)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	for _, obu := range obus {
+		switch obu.Type {
+		case bitstream.AV1OBUTypeTemporalDelimiter, bitstream.AV1OBUTypePadding:
+		default:
+			b = append(b, av1OBUBytes(obu)...)
+		}
+	}
+	return b, nil
+}
+
+type av1SequenceHeader struct {
+	profile                   uint
+	level                     uint
+	tier                      uint
+	highBitdepth              bool
+	twelveBit                 bool
+	monochrome                bool
+	subsamplingX              bool
+	subsamplingY              bool
+	chromaSamplePosition      uint
+	reducedStillPictureHeader bool
+	maxFrameWidth             uint
+	maxFrameHeight            uint
+}
+
+// parseAV1SequenceHeader parses the fields of a sequence header OBU payload that are needed to
+// describe the stream (AV1 specification, 5.5).
+func parseAV1SequenceHeader(b []byte) (*av1SequenceHeader, error) {
+	r := bitstream.NewReader(b)
+	seq := &av1SequenceHeader{}
+
+	seq.profile = r.ReadBits(3)
+	r.ReadBits(1) // still_picture
+	seq.reducedStillPictureHeader = r.ReadFlag()
+	if seq.reducedStillPictureHeader {
+		seq.level = r.ReadBits(5)
+	} else {
+		decoderModelInfoPresent := false
+		bufferDelayLength := 0
+		if r.ReadFlag() { // timing_info_present_flag
+			r.ReadBits(32) // num_units_in_display_tick
+			r.ReadBits(32) // time_scale
+			equalPictureInterval := r.ReadFlag()
+			if equalPictureInterval {
+				r.ReadUVLC() // num_ticks_per_picture_minus_1
+			}
+			decoderModelInfoPresent = r.ReadFlag()
+			if decoderModelInfoPresent {
+				bufferDelayLength = int(r.ReadBits(5)) + 1
+				r.ReadBits(32) // num_units_in_decoding_tick
+				r.ReadBits(5)  // buffer_removal_time_length_minus_1
+				r.ReadBits(5)  // frame_presentation_time_length_minus_1
+			}
+		}
+		initialDisplayDelayPresent := r.ReadFlag()
+		operatingPoints := int(r.ReadBits(5)) + 1
+		for i := 0; i < operatingPoints; i++ {
+			r.ReadBits(12) // operating_point_idc
+			level := r.ReadBits(5)
+			var tier uint
+			if level > 7 {
+				tier = r.ReadBits(1)
+			}
+			if i == 0 {
+				seq.level, seq.tier = level, tier
+			}
+			if decoderModelInfoPresent && r.ReadFlag() {
+				r.ReadBits(bufferDelayLength) // decoder_buffer_delay
+				r.ReadBits(bufferDelayLength) // encoder_buffer_delay
+				r.ReadBits(1)                 // low_delay_mode_flag
+			}
+			if initialDisplayDelayPresent && r.ReadFlag() {
+				r.ReadBits(4) // initial_display_delay_minus_1
+			}
+		}
+	}
+
+	widthBits := int(r.ReadBits(4)) + 1
+	heightBits := int(r.ReadBits(4)) + 1
+	seq.maxFrameWidth = r.ReadBits(widthBits) + 1
+	seq.maxFrameHeight = r.ReadBits(heightBits) + 1
+	if !seq.reducedStillPictureHeader && r.ReadFlag() { // frame_id_numbers_present_flag
+		r.ReadBits(4) // delta_frame_id_length_minus_2
+		r.ReadBits(3) // additional_frame_id_length_minus_1
+	}
+	r.ReadBits(3) // use_128x128_superblock, enable_filter_intra, enable_intra_edge_filter
+	if !seq.reducedStillPictureHeader {
+		r.ReadBits(4) // enable_interintra_compound, enable_masked_compound, enable_warped_motion, enable_dual_filter
+		enableOrderHint := r.ReadFlag()
+		if enableOrderHint {
+			r.ReadBits(2) // enable_jnt_comp, enable_ref_frame_mvs
+		}
+		forceScreenContentTools := uint(av1SelectScreenContentTools)
+		if !r.ReadFlag() { // seq_choose_screen_content_tools
+			forceScreenContentTools = r.ReadBits(1)
+		}
+		if forceScreenContentTools > 0 && !r.ReadFlag() { // seq_choose_integer_mv
+			r.ReadBits(1) // seq_force_integer_mv
+		}
+		if enableOrderHint {
+			r.ReadBits(3) // order_hint_bits_minus_1
+		}
+	}
+	r.ReadBits(3) // enable_superres, enable_cdef, enable_restoration
+
+	// color_config
+	seq.highBitdepth = r.ReadFlag()
+	if seq.profile == 2 && seq.highBitdepth {
+		seq.twelveBit = r.ReadFlag()
+	}
+	if seq.profile != 1 {
+		seq.monochrome = r.ReadFlag()
+	}
+	var colorPrimaries, transferCharacteristics, matrixCoefficients uint = 2, 2, 2
+	if r.ReadFlag() { // color_description_present_flag
+		colorPrimaries = r.ReadBits(8)
+		transferCharacteristics = r.ReadBits(8)
+		matrixCoefficients = r.ReadBits(8)
+	}
+	switch {
+	case seq.monochrome:
+		r.ReadBits(1) // color_range
+		seq.subsamplingX, seq.subsamplingY = true, true
+	case colorPrimaries == 1 && transferCharacteristics == 13 && matrixCoefficients == 0:
+		// sRGB
+	default:
+		r.ReadBits(1) // color_range
+		switch {
+		case seq.profile == 0:
+			seq.subsamplingX, seq.subsamplingY = true, true
+		case seq.profile == 2 && seq.twelveBit:
+			seq.subsamplingX = r.ReadFlag()
+			if seq.subsamplingX {
+				seq.subsamplingY = r.ReadFlag()
+			}
+		case seq.profile == 2:
+			seq.subsamplingX = true
+		}
+		if seq.subsamplingX && seq.subsamplingY {
+			seq.chromaSamplePosition = r.ReadBits(2)
+		}
+	}
+
+	if r.Err() != nil {
+		return nil, errAV1InvalidSequenceHeader
+	}
+	return seq, nil
+}
+
+// av1DecoderConfig builds an AV1CodecConfigurationRecord (AV1 Codec ISO Media File Format Binding,
+// 2.3.3) from the sequence header found in the temporal unit tu.
+func av1DecoderConfig(tu []byte) ([]byte, *av1SequenceHeader, error) {
+	obus, err := bitstream.SplitAV1OBUs(tu)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, obu := range obus {
+		if obu.Type != bitstream.AV1OBUTypeSequenceHeader {
+			continue
+		}
+
+		seq, err := parseAV1SequenceHeader(obu.Payload)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		b := []byte{
+			0x81, // marker, version
+			byte(seq.profile<<5 | seq.level),
+			byte(seq.tier<<7 | boolBit(seq.highBitdepth)<<6 | boolBit(seq.twelveBit)<<5 | boolBit(seq.monochrome)<<4 |
+				boolBit(seq.subsamplingX)<<3 | boolBit(seq.subsamplingY)<<2 | seq.chromaSamplePosition),
+			0, // initial_presentation_delay_present
+		}
+		return append(b, av1OBUBytes(obu)...), seq, nil
+	}
+	return nil, nil, errAV1MissingSequenceHeader
+}
+
+func boolBit(b bool) uint {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func appendLEB128(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
@@ -0,0 +1,107 @@
+package recorder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/mediadevices/internal/bitstream"
+)
+
+// bitWriter writes MSB first bit fields, to build bitstreams in tests.
+type bitWriter struct {
+	b   []byte
+	pos int
+}
+
+func (w *bitWriter) writeBits(v uint, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		w.b[len(w.b)-1] |= byte(v>>i&1) << (7 - w.pos%8)
+		w.pos++
+	}
+}
+
+func testAV1SequenceHeader() []byte {
+	w := &bitWriter{}
+	w.writeBits(0, 3)    // seq_profile
+	w.writeBits(0, 1)    // still_picture
+	w.writeBits(0, 1)    // reduced_still_picture_header
+	w.writeBits(0, 1)    // timing_info_present_flag
+	w.writeBits(0, 1)    // initial_display_delay_present_flag
+	w.writeBits(0, 5)    // operating_points_cnt_minus_1
+	w.writeBits(0, 12)   // operating_point_idc
+	w.writeBits(8, 5)    // seq_level_idx
+	w.writeBits(1, 1)    // seq_tier
+	w.writeBits(10, 4)   // frame_width_bits_minus_1
+	w.writeBits(10, 4)   // frame_height_bits_minus_1
+	w.writeBits(639, 11) // max_frame_width_minus_1
+	w.writeBits(479, 11) // max_frame_height_minus_1
+	w.writeBits(0, 1)    // frame_id_numbers_present_flag
+	w.writeBits(0, 3)    // use_128x128_superblock, enable_filter_intra, enable_intra_edge_filter
+	w.writeBits(0, 4)    // enable_interintra_compound, enable_masked_compound, enable_warped_motion, enable_dual_filter
+	w.writeBits(1, 1)    // enable_order_hint
+	w.writeBits(0, 2)    // enable_jnt_comp, enable_ref_frame_mvs
+	w.writeBits(1, 1)    // seq_choose_screen_content_tools
+	w.writeBits(1, 1)    // seq_choose_integer_mv
+	w.writeBits(6, 3)    // order_hint_bits_minus_1
+	w.writeBits(0, 3)    // enable_superres, enable_cdef, enable_restoration
+	w.writeBits(0, 1)    // high_bitdepth
+	w.writeBits(0, 1)    // mono_chrome
+	w.writeBits(0, 1)    // color_description_present_flag
+	w.writeBits(0, 1)    // color_range
+	w.writeBits(1, 2)    // chroma_sample_position
+	w.writeBits(0, 1)    // separate_uv_delta_q
+	w.writeBits(0, 1)    // film_grain_params_present
+	return w.b
+}
+
+func TestAV1(t *testing.T) {
+	seqPayload := testAV1SequenceHeader()
+	// OBU headers without size fields, the last OBU extends to the end of the temporal unit
+	temporalDelimiter := []byte{bitstream.AV1OBUTypeTemporalDelimiter<<3 | 0x02, 0}
+	sequenceHeader := append([]byte{bitstream.AV1OBUTypeSequenceHeader<<3 | 0x02, byte(len(seqPayload))}, seqPayload...)
+	keyFrame := []byte{bitstream.AV1OBUTypeFrame << 3, 0x10, 0xFF}   // show_existing_frame = 0, frame_type = KEY_FRAME
+	interFrame := []byte{bitstream.AV1OBUTypeFrame << 3, 0x30, 0xFF} // show_existing_frame = 0, frame_type = INTER_FRAME
+
+	tu := append(append(append([]byte{}, temporalDelimiter...), sequenceHeader...), keyFrame...)
+
+	t.Run("IsKeyFrame", func(t *testing.T) {
+		if !bitstream.IsAV1KeyFrame(tu) {
+			t.Error("Expected a keyframe")
+		}
+		if bitstream.IsAV1KeyFrame(append(append([]byte{}, temporalDelimiter...), interFrame...)) {
+			t.Error("Expected an inter frame")
+		}
+	})
+
+	t.Run("ToStorage", func(t *testing.T) {
+		b, err := av1ToStorage(tu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := append(append([]byte{}, sequenceHeader...), bitstream.AV1OBUTypeFrame<<3|0x02, 2, 0x10, 0xFF)
+		if !bytes.Equal(b, expected) {
+			t.Errorf("Expected %x, got %x", expected, b)
+		}
+	})
+
+	t.Run("DecoderConfig", func(t *testing.T) {
+		config, seq, err := av1DecoderConfig(tu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq.maxFrameWidth != 640 || seq.maxFrameHeight != 480 {
+			t.Errorf("Expected 640x480, got %dx%d", seq.maxFrameWidth, seq.maxFrameHeight)
+		}
+		expected := append([]byte{0x81, 0x08, 0x8D, 0x00}, sequenceHeader...)
+		if !bytes.Equal(config, expected) {
+			t.Errorf("Expected %x, got %x", expected, config)
+		}
+
+		if _, _, err := av1DecoderConfig(keyFrame); err != errAV1MissingSequenceHeader {
+			t.Errorf("Expected error: %v, got: %v", errAV1MissingSequenceHeader, err)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package recorder
+
+import (
+	"strings"
+
+	"github.com/pion/mediadevices/internal/bitstream"
+	"github.com/pion/webrtc/v4"
+)
+
+// mediaCodec describes how the frames of a codec are stored. Matroska and ISOBMFF store the frames,
+// and describe the decoder configuration, the same way.
+type mediaCodec struct {
+	kind       webrtc.RTPCodecType
+	isKeyFrame func(frame []byte) bool
+	// convert converts a frame from the encoder format to the storage format. It's nil when the
+	// formats are the same.
+	convert func(frame []byte) ([]byte, error)
+	// decoderConfig builds the decoder configuration record from the first keyframe, e.g.
+	// AVCDecoderConfigurationRecord for H.264, or OpusHead for Opus. It's nil when the codec doesn't
+	// need one.
+	decoderConfig func(keyframe []byte) ([]byte, error)
+}
+
+// mediaCodecs is indexed by lower case MIME types.
+var mediaCodecs = map[string]mediaCodec{
+	strings.ToLower(webrtc.MimeTypeVP8): {
+		kind:       webrtc.RTPCodecTypeVideo,
+		isKeyFrame: bitstream.IsVP8KeyFrame,
+	},
+	strings.ToLower(webrtc.MimeTypeVP9): {
+		kind:       webrtc.RTPCodecTypeVideo,
+		isKeyFrame: bitstream.IsVP9KeyFrame,
+	},
+	strings.ToLower(webrtc.MimeTypeAV1): {
+		kind:       webrtc.RTPCodecTypeVideo,
+		isKeyFrame: bitstream.IsAV1KeyFrame,
+		convert:    av1ToStorage,
+		decoderConfig: func(keyframe []byte) ([]byte, error) {
+			config, _, err := av1DecoderConfig(keyframe)
+			return config, err
+		},
+	},
+	strings.ToLower(webrtc.MimeTypeH264): {
+		kind:       webrtc.RTPCodecTypeVideo,
+		isKeyFrame: bitstream.IsH264KeyFrame,
+		convert: func(frame []byte) ([]byte, error) {
+			return annexBToLengthPrefixed(frame), nil
+		},
+		decoderConfig: h264DecoderConfig,
+	},
+	strings.ToLower(webrtc.MimeTypeH265): {
+		kind:       webrtc.RTPCodecTypeVideo,
+		isKeyFrame: bitstream.IsH265KeyFrame,
+		convert: func(frame []byte) ([]byte, error) {
+			return annexBToLengthPrefixed(frame), nil
+		},
+		decoderConfig: h265DecoderConfig,
+	},
+	strings.ToLower(webrtc.MimeTypeOpus): {
+		kind:       webrtc.RTPCodecTypeAudio,
+		isKeyFrame: func([]byte) bool { return true },
+		decoderConfig: func(packet []byte) ([]byte, error) {
+			// The stereo flag of the TOC byte tells the channel count, RFC 6716 3.1
+			channels := 1
+			if len(packet) > 0 && packet[0]&0x04 != 0 {
+				channels = 2
+			}
+			return opusHead(channels, opusSampleRate)
+		},
+	},
+}
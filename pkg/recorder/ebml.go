@@ -0,0 +1,93 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// ebmlUnknownSize is the reserved 8 bytes long size that marks an element whose size is unknown.
+var ebmlUnknownSize = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// ebmlID encodes an element ID. IDs already include their length marker, so only the leading
+// zero bytes are dropped.
+func ebmlID(id uint32) []byte {
+	switch {
+	case id > 0xFFFFFF:
+		return []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+	case id > 0xFFFF:
+		return []byte{byte(id >> 16), byte(id >> 8), byte(id)}
+	case id > 0xFF:
+		return []byte{byte(id >> 8), byte(id)}
+	default:
+		return []byte{byte(id)}
+	}
+}
+
+// ebmlSize encodes size as a variable size integer with the shortest possible length.
+func ebmlSize(size uint64) []byte {
+	length := 1
+	// A value with all the bits set is reserved for unknown sizes
+	for length < 8 && size >= 1<<(7*length)-1 {
+		length++
+	}
+	return ebmlSizeN(size, length)
+}
+
+// ebmlSizeN encodes size as a variable size integer with the given length, so that it can be
+// overwritten later without moving the data that follows.
+func ebmlSizeN(size uint64, length int) []byte {
+	b := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		b[i] = byte(size)
+		size >>= 8
+	}
+	b[0] |= 1 << (8 - length)
+	return b
+}
+
+func ebmlElement(id uint32, data []byte) []byte {
+	b := append(ebmlID(id), ebmlSize(uint64(len(data)))...)
+	return append(b, data...)
+}
+
+func ebmlMaster(id uint32, children ...[]byte) []byte {
+	var data []byte
+	for _, child := range children {
+		data = append(data, child...)
+	}
+	return ebmlElement(id, data)
+}
+
+func ebmlUint(id uint32, v uint64) []byte {
+	length := 1
+	for length < 8 && v >= 1<<(8*length) {
+		length++
+	}
+	return ebmlUintN(id, v, length)
+}
+
+// ebmlUintN encodes v with a fixed length, so that it can be overwritten later.
+func ebmlUintN(id uint32, v uint64, length int) []byte {
+	data := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		data[i] = byte(v)
+		v >>= 8
+	}
+	return ebmlElement(id, data)
+}
+
+func ebmlFloat(id uint32, v float64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, math.Float64bits(v))
+	return ebmlElement(id, data)
+}
+
+func ebmlString(id uint32, s string) []byte {
+	return ebmlElement(id, []byte(s))
+}
+
+// ebmlVoid creates a Void element that takes exactly size bytes, header included. It reserves
+// space for an element that is only known once the recording is finished. size must be in [2, 128].
+func ebmlVoid(size int) []byte {
+	return ebmlElement(matroskaIDVoid, make([]byte, size-2))
+}
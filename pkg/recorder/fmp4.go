@@ -0,0 +1,416 @@
+package recorder
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pion/mediadevices"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	fmp4VideoTimescale          = 90000
+	fmp4DefaultSegmentDuration  = 2 * time.Second
+	fmp4TkhdEnabledInMovie      = 0x000003
+	fmp4TfhdDefaultBaseIsMoof   = 0x020000
+	fmp4TrunFlags               = 0x000701 // data-offset, sample-duration, sample-size, and sample-flags present
+	fmp4SampleFlagsKeyFrame     = 0x02000000
+	fmp4SampleFlagsNonKeyFrame  = 0x01010000
+	fmp4LanguageUndetermined    = 0x55C4 // "und" packed as ISO-639-2/T
+	fmp4MovieTimescale          = 1000
+	fmp4SampleEntryResolution   = 0x00480000 // 72 dpi
+	fmp4SampleEntryDepth        = 0x0018
+	fmp4SampleEntryCompressorSz = 32
+)
+
+var errNoTracks = errors.New("recorder: no track to mux")
+
+type fmp4Codec struct {
+	// sampleEntry and configBox are the types of the sample entry, and of the box holding the decoder
+	// configuration in it.
+	sampleEntry string
+	configBox   string
+}
+
+// fmp4Codecs is indexed by lower case MIME types. VP8 and VP9 aren't supported, since their
+// decoder configuration can't be built from the bitstream alone.
+var fmp4Codecs = map[string]fmp4Codec{
+	strings.ToLower(webrtc.MimeTypeH264): {sampleEntry: "avc1", configBox: "avcC"},
+	strings.ToLower(webrtc.MimeTypeH265): {sampleEntry: "hvc1", configBox: "hvcC"},
+	strings.ToLower(webrtc.MimeTypeAV1):  {sampleEntry: "av01", configBox: "av1C"},
+	strings.ToLower(webrtc.MimeTypeOpus): {sampleEntry: "Opus", configBox: "dOps"},
+}
+
+// FMP4Track is an encoded track muxed by an FMP4Muxer.
+type FMP4Track struct {
+	// Reader is usually created by the NewEncodedReader method of a Track. It's closed by the muxer.
+	Reader mediadevices.EncodedReadCloser
+	// MimeType is the MIME type of the codec of Reader. H.264, H.265, AV1, and Opus are supported.
+	MimeType string
+	// Width and Height are the dimensions of video tracks.
+	Width, Height int
+}
+
+// FMP4Segment describes a segment written by an FMP4Muxer.
+type FMP4Segment struct {
+	// Init is set for the initialization segment, made of the ftyp and moov boxes. It's written
+	// once, before the media segments.
+	Init bool
+	// Sequence is the sequence number of media segments, starting from 1.
+	Sequence uint32
+	// Start and Duration are the time range of media segments, from the beginning of the muxing.
+	Start, Duration time.Duration
+}
+
+// FMP4SegmentHandler returns the destination of a segment. When the returned writer is an io.Closer,
+// it's closed once the segment is written.
+type FMP4SegmentHandler func(segment FMP4Segment) (io.Writer, error)
+
+// FMP4Option configures an FMP4Muxer.
+type FMP4Option func(*FMP4Muxer)
+
+// WithSegmentDuration sets the minimum duration of media segments. Segments are cut on the next
+// keyframe of the first video track, or of the first track when there's no video. The default is 2
+// seconds.
+func WithSegmentDuration(d time.Duration) FMP4Option {
+	return func(m *FMP4Muxer) {
+		m.segmentDuration = d
+	}
+}
+
+// FMP4Muxer muxes encoded tracks to fragmented MP4 (ISO/IEC 14496-12), as used by HLS, DASH, and
+// Media Source Extensions. The initialization segment is built from the decoder configuration found
+// in the first keyframe of every track, and every media segment is a moof box followed by an mdat
+// box, starting on a keyframe.
+type FMP4Muxer struct {
+	segmentDuration time.Duration
+	stream          *streamMuxer
+}
+
+// NewFMP4Muxer starts muxing tracks. handler is called for every segment, from the goroutines reading
+// the tracks, but never concurrently. The initialization segment is written once every track has
+// produced its first keyframe.
+func NewFMP4Muxer(tracks []FMP4Track, handler FMP4SegmentHandler, opts ...FMP4Option) (*FMP4Muxer, error) {
+	if len(tracks) == 0 {
+		return nil, errNoTracks
+	}
+
+	m := &FMP4Muxer{segmentDuration: fmp4DefaultSegmentDuration}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	var muxerTracks []*muxerTrack
+	for _, track := range tracks {
+		mimeType := strings.ToLower(track.MimeType)
+		codec, ok := mediaCodecs[mimeType]
+		if _, supported := fmp4Codecs[mimeType]; !ok || !supported {
+			return nil, errUnsupportedCodec
+		}
+		muxerTracks = append(muxerTracks, &muxerTrack{
+			reader:   track.Reader,
+			mimeType: track.MimeType,
+			codec:    codec,
+			width:    track.Width,
+			height:   track.Height,
+		})
+	}
+
+	m.stream = newStreamMuxer(newFMP4Writer(handler, m.segmentDuration), muxerTracks)
+	return m, nil
+}
+
+// Close stops reading the tracks, closes their readers, and writes the last media segment. Besides
+// the errors of the handler, the first error that stopped a track is returned, if any.
+func (m *FMP4Muxer) Close() error {
+	return m.stream.close()
+}
+
+type fmp4Sample struct {
+	data       []byte
+	decodeTime uint64
+	duration   uint32
+	keyframe   bool
+}
+
+type fmp4Track struct {
+	*muxerTrack
+	fmp4Codec
+	timescale uint32
+	// held is the last sample, which is kept until the next one gives its duration.
+	held *fmp4Sample
+	// samples are the samples of the current segment.
+	samples      []fmp4Sample
+	lastDuration uint32
+}
+
+// release moves the held sample to the current segment, now that the next sample starts at
+// decodeTime.
+func (t *fmp4Track) release(decodeTime uint64) {
+	if t.held == nil {
+		return
+	}
+	t.held.duration = uint32(decodeTime - t.held.decodeTime)
+	t.lastDuration = t.held.duration
+	t.samples = append(t.samples, *t.held)
+	t.held = nil
+}
+
+// fmp4Writer implements muxer. Since a sample duration is only known when the next sample of the
+// track arrives, every track holds its last sample back.
+type fmp4Writer struct {
+	handler         FMP4SegmentHandler
+	segmentDuration time.Duration
+	tracks          []*fmp4Track
+	// primary is the track that cuts the segments.
+	primary      *fmp4Track
+	segmentStart time.Duration
+	sequence     uint32
+}
+
+func newFMP4Writer(handler FMP4SegmentHandler, segmentDuration time.Duration) *fmp4Writer {
+	return &fmp4Writer{handler: handler, segmentDuration: segmentDuration}
+}
+
+func (w *fmp4Writer) start(tracks []*muxerTrack) error {
+	for _, t := range tracks {
+		track := &fmp4Track{
+			muxerTrack: t,
+			fmp4Codec:  fmp4Codecs[strings.ToLower(t.mimeType)],
+			timescale:  fmp4VideoTimescale,
+		}
+		if t.codec.kind == webrtc.RTPCodecTypeAudio {
+			track.timescale = opusSampleRate
+		}
+		if w.primary == nil && t.codec.kind == webrtc.RTPCodecTypeVideo {
+			w.primary = track
+		}
+		w.tracks = append(w.tracks, track)
+	}
+	if w.primary == nil {
+		w.primary = w.tracks[0]
+	}
+
+	ftyp := isobmffBox("ftyp", isobmffFields("iso6", uint32(0), "iso6", "mp41", "dash"))
+	return w.write(FMP4Segment{Init: true}, append(ftyp, w.moov()...))
+}
+
+func (w *fmp4Writer) writeSample(sample muxerSample) error {
+	t := w.tracks[sample.track.id-1]
+	decodeTime := fmp4Ticks(sample.timestamp, t.timescale)
+	if t.held != nil && decodeTime < t.held.decodeTime {
+		// Decode times can't go backwards
+		decodeTime = t.held.decodeTime
+	}
+	t.release(decodeTime)
+
+	if t == w.primary && sample.keyframe && sample.timestamp-w.segmentStart >= w.segmentDuration {
+		if err := w.flush(sample.timestamp); err != nil {
+			return err
+		}
+		w.segmentStart = sample.timestamp
+	}
+
+	t.held = &fmp4Sample{
+		data:       sample.data,
+		decodeTime: decodeTime,
+		keyframe:   sample.keyframe,
+	}
+	return nil
+}
+
+// close writes the last segment. The last sample of every track is given the duration of the
+// previous one.
+func (w *fmp4Writer) close() error {
+	for _, t := range w.tracks {
+		if t.held != nil {
+			t.release(t.held.decodeTime + uint64(t.lastDuration))
+		}
+	}
+	return w.flush(math.MaxInt64)
+}
+
+// flush writes the samples of the current segment that start before cut. The samples of the other
+// tracks that start after cut are kept for the next segment, since the tracks are read concurrently.
+func (w *fmp4Writer) flush(cut time.Duration) error {
+	var tracks []*fmp4Track
+	var next [][]fmp4Sample
+	for _, t := range w.tracks {
+		n := len(t.samples)
+		for n > 0 && fmp4Duration(t.samples[n-1].decodeTime, t.timescale) >= cut {
+			n--
+		}
+		if n == 0 {
+			continue
+		}
+		tracks = append(tracks, t)
+		next = append(next, t.samples[n:])
+		t.samples = t.samples[:n]
+	}
+	if len(tracks) == 0 {
+		return nil
+	}
+
+	// The segment is timed by the primary track, unless it has no sample left
+	timed := tracks
+	for _, t := range tracks {
+		if t == w.primary {
+			timed = []*fmp4Track{t}
+		}
+	}
+	start, end := time.Duration(-1), time.Duration(0)
+	for _, t := range timed {
+		first, last := t.samples[0], t.samples[len(t.samples)-1]
+		if s := fmp4Duration(first.decodeTime, t.timescale); start < 0 || s < start {
+			start = s
+		}
+		end = max(end, fmp4Duration(last.decodeTime+uint64(last.duration), t.timescale))
+	}
+
+	w.sequence++
+	// The data offsets are relative to the moof box, its size doesn't depend on their values
+	moof := w.moof(tracks, 0)
+	moof = w.moof(tracks, uint32(len(moof)+8))
+
+	var payloads [][]byte
+	for i, t := range tracks {
+		for _, s := range t.samples {
+			payloads = append(payloads, s.data)
+		}
+		t.samples = next[i]
+	}
+
+	segment := FMP4Segment{Sequence: w.sequence, Start: start, Duration: end - start}
+	return w.write(segment, append(moof, isobmffBox("mdat", payloads...)...))
+}
+
+func (w *fmp4Writer) write(segment FMP4Segment, data []byte) error {
+	dst, err := w.handler(segment)
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.Write(data)
+	if closer, ok := dst.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (w *fmp4Writer) moov() []byte {
+	children := [][]byte{isobmffFullBox("mvhd", 0, 0, isobmffFields(
+		uint32(0), uint32(0), // creation_time, modification_time
+		uint32(fmp4MovieTimescale), uint32(0), // timescale, duration
+		uint32(0x00010000), uint16(0x0100), // rate, volume
+		make([]byte, 10), isobmffMatrix, make([]byte, 24), // reserved, matrix, pre_defined
+		uint32(len(w.tracks)+1), // next_track_ID
+	))}
+
+	var trexs [][]byte
+	for _, t := range w.tracks {
+		children = append(children, t.trak())
+		trexs = append(trexs, isobmffFullBox("trex", 0, 0, isobmffFields(
+			t.id, uint32(1), // track_ID, default_sample_description_index
+			uint32(0), uint32(0), uint32(0), // default_sample_duration, default_sample_size, default_sample_flags
+		)))
+	}
+	children = append(children, isobmffBox("mvex", trexs...))
+	return isobmffBox("moov", children...)
+}
+
+func (t *fmp4Track) trak() []byte {
+	var volume uint16
+	handler, name := "vide", "VideoHandler"
+	mediaHeader := isobmffFullBox("vmhd", 0, 1, make([]byte, 8))
+	if t.codec.kind == webrtc.RTPCodecTypeAudio {
+		volume = 0x0100
+		handler, name = "soun", "SoundHandler"
+		mediaHeader = isobmffFullBox("smhd", 0, 0, make([]byte, 4))
+	}
+
+	return isobmffBox("trak",
+		isobmffFullBox("tkhd", 0, fmp4TkhdEnabledInMovie, isobmffFields(
+			uint32(0), uint32(0), t.id, // creation_time, modification_time, track_ID
+			uint32(0), uint32(0), uint64(0), // reserved, duration, reserved
+			uint16(0), uint16(0), volume, uint16(0), // layer, alternate_group, volume, reserved
+			isobmffMatrix, uint32(t.width)<<16, uint32(t.height)<<16,
+		)),
+		isobmffBox("mdia",
+			isobmffFullBox("mdhd", 0, 0, isobmffFields(
+				uint32(0), uint32(0), // creation_time, modification_time
+				t.timescale, uint32(0), // timescale, duration
+				uint16(fmp4LanguageUndetermined), uint16(0), // language, pre_defined
+			)),
+			isobmffFullBox("hdlr", 0, 0, isobmffFields(uint32(0), handler, make([]byte, 12), name, uint8(0))),
+			isobmffBox("minf",
+				mediaHeader,
+				isobmffBox("dinf", isobmffFullBox("dref", 0, 0, isobmffFields(uint32(1)), isobmffFullBox("url ", 0, 1))),
+				isobmffBox("stbl",
+					isobmffFullBox("stsd", 0, 0, isobmffFields(uint32(1)), t.sampleEntry()),
+					// The samples are described by the fragments
+					isobmffFullBox("stts", 0, 0, isobmffFields(uint32(0))),
+					isobmffFullBox("stsc", 0, 0, isobmffFields(uint32(0))),
+					isobmffFullBox("stsz", 0, 0, isobmffFields(uint32(0), uint32(0))),
+					isobmffFullBox("stco", 0, 0, isobmffFields(uint32(0))),
+				),
+			),
+		),
+	)
+}
+
+func (t *fmp4Track) sampleEntry() []byte {
+	if t.codec.kind == webrtc.RTPCodecTypeAudio {
+		// Opus is the only audio codec
+		return isobmffBox(t.fmp4Codec.sampleEntry, isobmffFields(
+			make([]byte, 6), uint16(1), // reserved, data_reference_index
+			make([]byte, 8), uint16(opusHeadChannels(t.config)), uint16(16), // reserved, channelcount, samplesize
+			uint32(0), uint32(opusSampleRate)<<16, // pre_defined, reserved, samplerate
+		), isobmffBox(t.configBox, opusSpecificBox(t.config)))
+	}
+
+	return isobmffBox(t.fmp4Codec.sampleEntry, isobmffFields(
+		make([]byte, 6), uint16(1), // reserved, data_reference_index
+		make([]byte, 16), uint16(t.width), uint16(t.height), // pre_defined, reserved
+		uint32(fmp4SampleEntryResolution), uint32(fmp4SampleEntryResolution), // horizresolution, vertresolution
+		uint32(0), uint16(1), make([]byte, fmp4SampleEntryCompressorSz), // reserved, frame_count, compressorname
+		uint16(fmp4SampleEntryDepth), uint16(0xFFFF), // depth, pre_defined
+	), isobmffBox(t.configBox, t.config))
+}
+
+// moof creates the moof box of the tracks' samples. dataOffset is the offset of the first sample from
+// the beginning of the moof box.
+func (w *fmp4Writer) moof(tracks []*fmp4Track, dataOffset uint32) []byte {
+	children := [][]byte{isobmffFullBox("mfhd", 0, 0, isobmffFields(w.sequence))}
+	for _, t := range tracks {
+		entries := isobmffFields(uint32(len(t.samples)), dataOffset)
+		for _, s := range t.samples {
+			flags := uint32(fmp4SampleFlagsNonKeyFrame)
+			if s.keyframe {
+				flags = fmp4SampleFlagsKeyFrame
+			}
+			entries = append(entries, isobmffFields(s.duration, uint32(len(s.data)), flags)...)
+			dataOffset += uint32(len(s.data))
+		}
+
+		children = append(children, isobmffBox("traf",
+			isobmffFullBox("tfhd", 0, fmp4TfhdDefaultBaseIsMoof, isobmffFields(t.id)),
+			isobmffFullBox("tfdt", 1, 0, isobmffFields(t.samples[0].decodeTime)),
+			isobmffFullBox("trun", 0, fmp4TrunFlags, entries),
+		))
+	}
+	return isobmffBox("moof", children...)
+}
+
+// fmp4Ticks converts d to a number of ticks of timescale, without overflowing for long durations.
+func fmp4Ticks(d time.Duration, timescale uint32) uint64 {
+	return uint64(d/time.Second)*uint64(timescale) + uint64(d%time.Second)*uint64(timescale)/uint64(time.Second)
+}
+
+func fmp4Duration(ticks uint64, timescale uint32) time.Duration {
+	return time.Duration(ticks/uint64(timescale))*time.Second + time.Duration(ticks%uint64(timescale))*time.Second/time.Duration(timescale)
+}
@@ -0,0 +1,240 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pion/mediadevices"
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/webrtc/v4"
+)
+
+// fakeEncodedReader returns the given frames, and then io.EOF.
+type fakeEncodedReader struct {
+	frames []mediadevices.EncodedBuffer
+}
+
+func (r *fakeEncodedReader) Read() (mediadevices.EncodedBuffer, func(), error) {
+	if len(r.frames) == 0 {
+		return mediadevices.EncodedBuffer{}, func() {}, io.EOF
+	}
+	frame := r.frames[0]
+	r.frames = r.frames[1:]
+	return frame, func() {}, nil
+}
+
+func (r *fakeEncodedReader) Close() error                        { return nil }
+func (r *fakeEncodedReader) Controller() codec.EncoderController { return nil }
+
+type isobmffTestBox struct {
+	typ     string
+	payload []byte
+}
+
+func parseISOBMFF(t *testing.T, b []byte) []isobmffTestBox {
+	t.Helper()
+
+	var boxes []isobmffTestBox
+	for len(b) > 0 {
+		if len(b) < 8 {
+			t.Fatalf("Truncated box header: %x", b)
+		}
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			t.Fatalf("Invalid box size %d", size)
+		}
+		boxes = append(boxes, isobmffTestBox{typ: string(b[4:8]), payload: b[8:size]})
+		b = b[size:]
+	}
+	return boxes
+}
+
+func findISOBMFF(t *testing.T, b []byte, path ...string) []isobmffTestBox {
+	t.Helper()
+
+	boxes := parseISOBMFF(t, b)
+	var found []isobmffTestBox
+	for _, box := range boxes {
+		if box.typ != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			found = append(found, box)
+			continue
+		}
+		payload := box.payload
+		switch box.typ {
+		case "stsd":
+			payload = payload[8:]
+		case "avc1":
+			payload = payload[78:]
+		case "Opus":
+			payload = payload[28:]
+		}
+		found = append(found, findISOBMFF(t, payload, path[1:]...)...)
+	}
+	return found
+}
+
+func TestFMP4Muxer(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0xC0, 0x1F, 0xDA}
+	pps := []byte{0x68, 0xCE, 0x3C, 0x80}
+
+	var videoFrames, audioFrames []mediadevices.EncodedBuffer
+	for i := 0; i < testVideoFrames; i++ {
+		frame := []byte{0, 0, 0, 1, 0x41, byte(i)}
+		if i%testKeyFramePeriod == 0 {
+			frame = append([]byte{0, 0, 0, 1}, sps...)
+			frame = append(append(frame, 0, 0, 0, 1), pps...)
+			frame = append(frame, 0, 0, 0, 1, 0x65, byte(i))
+		}
+		videoFrames = append(videoFrames, mediadevices.EncodedBuffer{
+			Data:      frame,
+			Timestamp: testBase.Add(time.Duration(i) * 40 * time.Millisecond),
+		})
+	}
+	for i := 0; i < testAudioChunks; i++ {
+		audioFrames = append(audioFrames, mediadevices.EncodedBuffer{
+			Data:      []byte{0xFC, byte(i)},
+			Timestamp: testBase.Add(time.Duration(i) * 20 * time.Millisecond),
+		})
+	}
+
+	var segments []FMP4Segment
+	var data [][]byte
+	m, err := NewFMP4Muxer([]FMP4Track{
+		{Reader: &fakeEncodedReader{frames: videoFrames}, MimeType: webrtc.MimeTypeH264, Width: 320, Height: 240},
+		{Reader: &fakeEncodedReader{frames: audioFrames}, MimeType: webrtc.MimeTypeOpus},
+	}, func(segment FMP4Segment) (io.Writer, error) {
+		segments = append(segments, segment)
+		data = append(data, nil)
+		return writerFunc(func(p []byte) (int, error) {
+			data[len(data)-1] = append(data[len(data)-1], p...)
+			return len(p), nil
+		}), nil
+	}, WithSegmentDuration(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.stream.wg.Wait()
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 60 frames at 25 fps, with a keyframe every 30 frames
+	if len(segments) != 3 || !segments[0].Init {
+		t.Fatalf("Expected an initialization segment and 2 media segments, got %+v", segments)
+	}
+	if s := segments[1]; s.Sequence != 1 || s.Start != 0 || s.Duration != 1200*time.Millisecond {
+		t.Errorf("Unexpected first media segment: %+v", s)
+	}
+	if s := segments[2]; s.Sequence != 2 || s.Start != 1200*time.Millisecond || s.Duration != 1200*time.Millisecond {
+		t.Errorf("Unexpected second media segment: %+v", s)
+	}
+
+	t.Run("Init", func(t *testing.T) {
+		boxes := parseISOBMFF(t, data[0])
+		if len(boxes) != 2 || boxes[0].typ != "ftyp" || boxes[1].typ != "moov" {
+			t.Fatalf("Expected ftyp and moov boxes, got %v", boxes)
+		}
+		if traks := findISOBMFF(t, data[0], "moov", "trak"); len(traks) != 2 {
+			t.Fatalf("Expected 2 tracks, got %d", len(traks))
+		}
+		if trexs := findISOBMFF(t, data[0], "moov", "mvex", "trex"); len(trexs) != 2 {
+			t.Fatalf("Expected 2 trex boxes, got %d", len(trexs))
+		}
+
+		avcC := findISOBMFF(t, data[0], "moov", "trak", "mdia", "minf", "stbl", "stsd", "avc1", "avcC")
+		if len(avcC) != 1 {
+			t.Fatal("Expected an avcC box")
+		}
+		expected, _ := h264DecoderConfig(videoFrames[0].Data)
+		if !bytes.Equal(avcC[0].payload, expected) {
+			t.Errorf("Expected avcC %x, got %x", expected, avcC[0].payload)
+		}
+
+		dOps := findISOBMFF(t, data[0], "moov", "trak", "mdia", "minf", "stbl", "stsd", "Opus", "dOps")
+		if len(dOps) != 1 {
+			t.Fatal("Expected a dOps box")
+		}
+		if expected := []byte{0, 2, 0, 0, 0, 0, 0xBB, 0x80, 0, 0, 0}; !bytes.Equal(dOps[0].payload, expected) {
+			t.Errorf("Expected dOps %x, got %x", expected, dOps[0].payload)
+		}
+	})
+
+	t.Run("Media", func(t *testing.T) {
+		var videoSamples int
+		for i, segment := range data[1:] {
+			boxes := parseISOBMFF(t, segment)
+			if len(boxes) != 2 || boxes[0].typ != "moof" || boxes[1].typ != "mdat" {
+				t.Fatalf("Expected moof and mdat boxes, got %v", boxes)
+			}
+			if seq := binary.BigEndian.Uint32(findISOBMFF(t, segment, "moof", "mfhd")[0].payload[4:]); seq != uint32(i+1) {
+				t.Errorf("Expected sequence number %d, got %d", i+1, seq)
+			}
+
+			mdatSize := 0
+			for _, traf := range findISOBMFF(t, segment, "moof", "traf") {
+				trackID := binary.BigEndian.Uint32(findISOBMFF(t, traf.payload, "tfhd")[0].payload[4:])
+				trun := findISOBMFF(t, traf.payload, "trun")[0].payload
+				count := int(binary.BigEndian.Uint32(trun[4:]))
+				offset := int(binary.BigEndian.Uint32(trun[8:]))
+
+				entries := trun[12:]
+				if len(entries) != count*12 {
+					t.Fatalf("Expected %d trun entries, got %d bytes", count, len(entries))
+				}
+				for j := 0; j < count; j++ {
+					size := int(binary.BigEndian.Uint32(entries[j*12+4:]))
+					flags := binary.BigEndian.Uint32(entries[j*12+8:])
+					sample := segment[offset : offset+size]
+					mdatSize += size
+					offset += size
+
+					if trackID != 1 {
+						continue
+					}
+					keyframe := (videoSamples+j)%testKeyFramePeriod == 0
+					if keyframe != (flags == fmp4SampleFlagsKeyFrame) {
+						t.Errorf("Unexpected flags of video sample %d: %x", videoSamples+j, flags)
+					}
+					if keyframe != (j == 0) {
+						t.Errorf("Segments must start with a keyframe")
+					}
+					expected := annexBToLengthPrefixed(videoFrames[videoSamples+j].Data)
+					if !bytes.Equal(sample, expected) {
+						t.Errorf("Expected sample %x, got %x", expected, sample)
+					}
+					if duration := binary.BigEndian.Uint32(entries[j*12:]); duration != 3600 {
+						t.Errorf("Expected a duration of 3600, got %d", duration)
+					}
+				}
+				if trackID == 1 {
+					videoSamples += count
+				}
+			}
+			if len(boxes[1].payload) != mdatSize {
+				t.Errorf("Expected mdat size %d, got %d", mdatSize, len(boxes[1].payload))
+			}
+		}
+		if videoSamples != testVideoFrames {
+			t.Errorf("Expected %d video samples, got %d", testVideoFrames, videoSamples)
+		}
+	})
+
+	t.Run("UnsupportedCodec", func(t *testing.T) {
+		_, err := NewFMP4Muxer([]FMP4Track{{Reader: &fakeEncodedReader{}, MimeType: webrtc.MimeTypeVP8}}, nil)
+		if err != errUnsupportedCodec {
+			t.Errorf("Expected error: %v, got: %v", errUnsupportedCodec, err)
+		}
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
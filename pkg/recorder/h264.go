@@ -0,0 +1,102 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/pion/mediadevices/internal/bitstream"
+)
+
+const (
+	h264NALUTypeSPS = 7
+	h264NALUTypePPS = 8
+)
+
+var errH264MissingParameterSets = errors.New("h264: keyframe doesn't contain SPS and PPS")
+
+// annexBToLengthPrefixed converts the Annex-B access unit au to NAL units prefixed by their 4 bytes
+// length, as stored by Matroska and ISOBMFF. It works for both H.264 and H.265.
+func annexBToLengthPrefixed(au []byte) []byte {
+	var b []byte
+	for _, nalu := range bitstream.SplitAnnexB(au) {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(nalu)))
+		b = append(b, nalu...)
+	}
+	return b
+}
+
+// h264DecoderConfig builds an AVCDecoderConfigurationRecord (ISO/IEC 14496-15, 5.3.3.1) from the
+// parameter sets found in the Annex-B access unit au.
+func h264DecoderConfig(au []byte) ([]byte, error) {
+	var spss, ppss [][]byte
+	for _, nalu := range bitstream.SplitAnnexB(au) {
+		if len(nalu) == 0 {
+			continue
+		}
+		switch nalu[0] & 0x1F {
+		case h264NALUTypeSPS:
+			spss = append(spss, nalu)
+		case h264NALUTypePPS:
+			ppss = append(ppss, nalu)
+		}
+	}
+	if len(spss) == 0 || len(ppss) == 0 || len(spss[0]) < 4 {
+		return nil, errH264MissingParameterSets
+	}
+
+	sps := spss[0]
+	// lengthSizeMinusOne is always 3, annexBToLengthPrefixed uses 4 bytes long lengths
+	b := []byte{1, sps[1], sps[2], sps[3], 0xFC | 3, 0xE0 | byte(len(spss))}
+	for _, sps := range spss {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(sps)))
+		b = append(b, sps...)
+	}
+	b = append(b, byte(len(ppss)))
+	for _, pps := range ppss {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(pps)))
+		b = append(b, pps...)
+	}
+
+	switch sps[1] {
+	case 100, 110, 122, 144:
+		// High profiles carry the chroma format and the bit depths as well
+		chromaFormat, bitDepthLuma, bitDepthChroma, err := h264ParseChromaFormat(sps)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, 0xFC|byte(chromaFormat), 0xF8|byte(bitDepthLuma-8), 0xF8|byte(bitDepthChroma-8), 0)
+	}
+	return b, nil
+}
+
+// h264ParseChromaFormat parses the beginning of a high profile SPS.
+func h264ParseChromaFormat(sps []byte) (chromaFormat, bitDepthLuma, bitDepthChroma uint, err error) {
+	r := bitstream.NewReader(removeEmulationPrevention(sps[4:]))
+	r.ReadUE() // seq_parameter_set_id
+	chromaFormat = r.ReadUE()
+	if chromaFormat == 3 {
+		r.ReadBits(1) // separate_colour_plane_flag
+	}
+	bitDepthLuma = r.ReadUE() + 8
+	bitDepthChroma = r.ReadUE() + 8
+	return chromaFormat, bitDepthLuma, bitDepthChroma, r.Err()
+}
+
+// removeEmulationPrevention removes the emulation prevention bytes from a NAL unit payload.
+func removeEmulationPrevention(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
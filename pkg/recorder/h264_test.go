@@ -0,0 +1,66 @@
+package recorder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/mediadevices/internal/bitstream"
+)
+
+func TestH264(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0xC0, 0x1F, 0xDA}
+	pps := []byte{0x68, 0xCE, 0x3C, 0x80}
+	idr := []byte{0x65, 0x88, 0x84}
+	nonIDR := []byte{0x41, 0x9A}
+
+	var keyframe []byte
+	keyframe = append(append(keyframe, 0, 0, 0, 1), sps...)
+	keyframe = append(append(keyframe, 0, 0, 1), pps...)
+	keyframe = append(append(keyframe, 0, 0, 0, 1), idr...)
+	deltaFrame := append([]byte{0, 0, 0, 1}, nonIDR...)
+
+	t.Run("SplitAnnexB", func(t *testing.T) {
+		nalus := bitstream.SplitAnnexB(keyframe)
+		if len(nalus) != 3 || !bytes.Equal(nalus[0], sps) || !bytes.Equal(nalus[1], pps) || !bytes.Equal(nalus[2], idr) {
+			t.Errorf("Unexpected NAL units: %x", nalus)
+		}
+	})
+
+	t.Run("IsKeyFrame", func(t *testing.T) {
+		if !bitstream.IsH264KeyFrame(keyframe) {
+			t.Error("Expected a keyframe")
+		}
+		if bitstream.IsH264KeyFrame(deltaFrame) {
+			t.Error("Expected a delta frame")
+		}
+	})
+
+	t.Run("AVCC", func(t *testing.T) {
+		expected := []byte{0, 0, 0, 2, 0x41, 0x9A}
+		if avcc := annexBToLengthPrefixed(deltaFrame); !bytes.Equal(avcc, expected) {
+			t.Errorf("Expected %x, got %x", expected, avcc)
+		}
+	})
+
+	t.Run("DecoderConfig", func(t *testing.T) {
+		expected := []byte{1, 0x42, 0xC0, 0x1F, 0xFF, 0xE1, 0, 5, 0x67, 0x42, 0xC0, 0x1F, 0xDA, 1, 0, 4, 0x68, 0xCE, 0x3C, 0x80}
+		config, err := h264DecoderConfig(keyframe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(config, expected) {
+			t.Errorf("Expected %x, got %x", expected, config)
+		}
+
+		if _, err := h264DecoderConfig(deltaFrame); err != errH264MissingParameterSets {
+			t.Errorf("Expected error: %v, got: %v", errH264MissingParameterSets, err)
+		}
+	})
+
+	t.Run("EmulationPrevention", func(t *testing.T) {
+		expected := []byte{0, 0, 1, 0, 0, 0}
+		if b := removeEmulationPrevention([]byte{0, 0, 3, 1, 0, 0, 3, 0}); !bytes.Equal(b, expected) {
+			t.Errorf("Expected %x, got %x", expected, b)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/pion/mediadevices/internal/bitstream"
+)
+
+const (
+	h265NALUTypeVPS      = 32
+	h265NALUTypeSPS      = 33
+	h265NALUTypePPS      = 34
+	h265ProfileTierLevel = 12 // Size of general_profile_tier_level in bytes
+)
+
+var (
+	errH265MissingParameterSets = errors.New("h265: keyframe doesn't contain VPS, SPS and PPS")
+	errH265InvalidSPS           = errors.New("h265: invalid SPS")
+)
+
+func h265NALUType(nalu []byte) byte {
+	return (nalu[0] >> 1) & 0x3F
+}
+
+// h265DecoderConfig builds an HEVCDecoderConfigurationRecord (ISO/IEC 14496-15, 8.3.3.1) from the
+// parameter sets found in the Annex-B access unit au.
+func h265DecoderConfig(au []byte) ([]byte, error) {
+	var vpss, spss, ppss [][]byte
+	for _, nalu := range bitstream.SplitAnnexB(au) {
+		if len(nalu) < 2 {
+			continue
+		}
+		switch h265NALUType(nalu) {
+		case h265NALUTypeVPS:
+			vpss = append(vpss, nalu)
+		case h265NALUTypeSPS:
+			spss = append(spss, nalu)
+		case h265NALUTypePPS:
+			ppss = append(ppss, nalu)
+		}
+	}
+	if len(vpss) == 0 || len(spss) == 0 || len(ppss) == 0 {
+		return nil, errH265MissingParameterSets
+	}
+
+	sps, err := parseH265SPS(spss[0])
+	if err != nil {
+		return nil, err
+	}
+
+	b := []byte{1}
+	b = append(b, sps.profileTierLevel...)
+	b = append(b,
+		0xF0, 0x00, // min_spatial_segmentation_idc
+		0xFC, // parallelismType
+		0xFC|byte(sps.chromaFormat),
+		0xF8|byte(sps.bitDepthLuma-8),
+		0xF8|byte(sps.bitDepthChroma-8),
+		0, 0, // avgFrameRate
+		// lengthSizeMinusOne is always 3, annexBToLengthPrefixed uses 4 bytes long lengths
+		byte(sps.maxSubLayers)<<3|byte(boolBit(sps.temporalIDNesting))<<2|3,
+		3, // numOfArrays
+	)
+	for _, array := range []struct {
+		typ   byte
+		nalus [][]byte
+	}{
+		{h265NALUTypeVPS, vpss},
+		{h265NALUTypeSPS, spss},
+		{h265NALUTypePPS, ppss},
+	} {
+		// array_completeness is set, the parameter sets are only sent with the keyframes
+		b = append(b, 0x80|array.typ)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(array.nalus)))
+		for _, nalu := range array.nalus {
+			b = binary.BigEndian.AppendUint16(b, uint16(len(nalu)))
+			b = append(b, nalu...)
+		}
+	}
+	return b, nil
+}
+
+type h265SPS struct {
+	maxSubLayers      uint
+	temporalIDNesting bool
+	// profileTierLevel is general_profile_tier_level, copied as is in the decoder configuration.
+	profileTierLevel []byte
+	chromaFormat     uint
+	bitDepthLuma     uint
+	bitDepthChroma   uint
+}
+
+// parseH265SPS parses the beginning of an SPS, up to the bit depths (ITU-T H.265, 7.3.2.2).
+func parseH265SPS(nalu []byte) (*h265SPS, error) {
+	rbsp := removeEmulationPrevention(nalu[2:])
+	if len(rbsp) < 1+h265ProfileTierLevel {
+		return nil, errH265InvalidSPS
+	}
+
+	sps := &h265SPS{
+		profileTierLevel: rbsp[1 : 1+h265ProfileTierLevel],
+	}
+	r := bitstream.NewReader(rbsp)
+	r.ReadBits(4) // sps_video_parameter_set_id
+	sps.maxSubLayers = r.ReadBits(3) + 1
+	sps.temporalIDNesting = r.ReadFlag()
+	r.ReadBits(h265ProfileTierLevel * 8)
+
+	subLayers := int(sps.maxSubLayers) - 1
+	profilePresent := make([]bool, subLayers)
+	levelPresent := make([]bool, subLayers)
+	for i := 0; i < subLayers; i++ {
+		profilePresent[i] = r.ReadFlag()
+		levelPresent[i] = r.ReadFlag()
+	}
+	if subLayers > 0 {
+		r.ReadBits(2 * (8 - subLayers)) // reserved_zero_2bits
+	}
+	for i := 0; i < subLayers; i++ {
+		if profilePresent[i] {
+			r.ReadBits(88)
+		}
+		if levelPresent[i] {
+			r.ReadBits(8)
+		}
+	}
+
+	r.ReadUE() // sps_seq_parameter_set_id
+	sps.chromaFormat = r.ReadUE()
+	if sps.chromaFormat == 3 {
+		r.ReadBits(1) // separate_colour_plane_flag
+	}
+	r.ReadUE()        // pic_width_in_luma_samples
+	r.ReadUE()        // pic_height_in_luma_samples
+	if r.ReadFlag() { // conformance_window_flag
+		for i := 0; i < 4; i++ {
+			r.ReadUE()
+		}
+	}
+	sps.bitDepthLuma = r.ReadUE() + 8
+	sps.bitDepthChroma = r.ReadUE() + 8
+	if r.Err() != nil || sps.chromaFormat > 3 {
+		return nil, errH265InvalidSPS
+	}
+	return sps, nil
+}
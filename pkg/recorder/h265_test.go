@@ -0,0 +1,84 @@
+package recorder
+
+import (
+	"bytes"
+	"math/bits"
+	"testing"
+
+	"github.com/pion/mediadevices/internal/bitstream"
+)
+
+func (w *bitWriter) writeUE(v uint) {
+	n := bits.Len(v + 1)
+	w.writeBits(0, n-1)
+	w.writeBits(v+1, n)
+}
+
+func testH265SPS() []byte {
+	w := &bitWriter{}
+	w.writeBits(0, 4) // sps_video_parameter_set_id
+	w.writeBits(0, 3) // sps_max_sub_layers_minus1
+	w.writeBits(1, 1) // sps_temporal_id_nesting_flag
+	for _, b := range testH265ProfileTierLevel {
+		w.writeBits(uint(b), 8)
+	}
+	w.writeUE(0)   // sps_seq_parameter_set_id
+	w.writeUE(1)   // chroma_format_idc
+	w.writeUE(320) // pic_width_in_luma_samples
+	w.writeUE(240) // pic_height_in_luma_samples
+	w.writeBits(0, 1)
+	w.writeUE(2) // bit_depth_luma_minus8
+	w.writeUE(2) // bit_depth_chroma_minus8
+	w.writeBits(1, 1)
+	return append([]byte{0x42, 0x01}, w.b...)
+}
+
+// Main 10 profile, main tier, level 3.1
+var testH265ProfileTierLevel = []byte{0x02, 0x20, 0, 0, 0, 0x90, 0, 0, 0, 0, 0, 0x5D}
+
+func TestH265(t *testing.T) {
+	vps := []byte{0x40, 0x01, 0x0C}
+	sps := testH265SPS()
+	pps := []byte{0x44, 0x01, 0xC1}
+	idr := []byte{0x26, 0x01, 0xAF}
+	trail := []byte{0x02, 0x01, 0xD0}
+
+	var keyframe []byte
+	for _, nalu := range [][]byte{vps, sps, pps, idr} {
+		keyframe = append(append(keyframe, 0, 0, 0, 1), nalu...)
+	}
+	deltaFrame := append([]byte{0, 0, 0, 1}, trail...)
+
+	t.Run("IsKeyFrame", func(t *testing.T) {
+		if !bitstream.IsH265KeyFrame(keyframe) {
+			t.Error("Expected a keyframe")
+		}
+		if bitstream.IsH265KeyFrame(deltaFrame) {
+			t.Error("Expected a delta frame")
+		}
+	})
+
+	t.Run("DecoderConfig", func(t *testing.T) {
+		expected := []byte{1}
+		expected = append(expected, testH265ProfileTierLevel...)
+		expected = append(expected, 0xF0, 0, 0xFC, 0xFD, 0xFA, 0xFA, 0, 0, 0x0F, 3)
+		expected = append(expected, 0xA0, 0, 1, 0, byte(len(vps)))
+		expected = append(expected, vps...)
+		expected = append(expected, 0xA1, 0, 1, 0, byte(len(sps)))
+		expected = append(expected, sps...)
+		expected = append(expected, 0xA2, 0, 1, 0, byte(len(pps)))
+		expected = append(expected, pps...)
+
+		config, err := h265DecoderConfig(keyframe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(config, expected) {
+			t.Errorf("Expected %x, got %x", expected, config)
+		}
+
+		if _, err := h265DecoderConfig(deltaFrame); err != errH265MissingParameterSets {
+			t.Errorf("Expected error: %v, got: %v", errH265MissingParameterSets, err)
+		}
+	})
+}
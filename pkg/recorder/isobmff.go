@@ -0,0 +1,59 @@
+package recorder
+
+import (
+	"encoding/binary"
+)
+
+// isobmffMatrix is the identity transformation matrix of the movie and track headers.
+var isobmffMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+// isobmffBox creates a box (ISO/IEC 14496-12, 4.2) of type typ with the given payloads.
+func isobmffBox(typ string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+
+	b := make([]byte, 0, size)
+	b = binary.BigEndian.AppendUint32(b, uint32(size))
+	b = append(b, typ...)
+	for _, p := range payloads {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// isobmffFullBox creates a box with a version and flags.
+func isobmffFullBox(typ string, version uint8, flags uint32, payloads ...[]byte) []byte {
+	header := binary.BigEndian.AppendUint32(nil, uint32(version)<<24|flags&0xFFFFFF)
+	return isobmffBox(typ, append([][]byte{header}, payloads...)...)
+}
+
+// isobmffFields serializes fixed size fields in big endian. Only unsigned integers, strings, byte
+// slices, and uint32 slices are supported.
+func isobmffFields(fields ...any) []byte {
+	var b []byte
+	for _, field := range fields {
+		switch v := field.(type) {
+		case uint8:
+			b = append(b, v)
+		case uint16:
+			b = binary.BigEndian.AppendUint16(b, v)
+		case uint32:
+			b = binary.BigEndian.AppendUint32(b, v)
+		case uint64:
+			b = binary.BigEndian.AppendUint64(b, v)
+		case string:
+			b = append(b, v...)
+		case []byte:
+			b = append(b, v...)
+		case []uint32:
+			for _, u := range v {
+				b = binary.BigEndian.AppendUint32(b, u)
+			}
+		default:
+			panic("recorder: unsupported ISOBMFF field type")
+		}
+	}
+	return b
+}
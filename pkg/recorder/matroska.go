@@ -0,0 +1,391 @@
+package recorder
+
+import (
+	"io"
+	"math"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Matroska element IDs, https://www.matroska.org/technical/elements.html
+const (
+	matroskaIDEBML               = 0x1A45DFA3
+	matroskaIDEBMLVersion        = 0x4286
+	matroskaIDEBMLReadVersion    = 0x42F7
+	matroskaIDEBMLMaxIDLength    = 0x42F2
+	matroskaIDEBMLMaxSizeLength  = 0x42F3
+	matroskaIDDocType            = 0x4282
+	matroskaIDDocTypeVersion     = 0x4287
+	matroskaIDDocTypeReadVersion = 0x4285
+	matroskaIDVoid               = 0xEC
+
+	matroskaIDSegment      = 0x18538067
+	matroskaIDSeekHead     = 0x114D9B74
+	matroskaIDSeek         = 0x4DBB
+	matroskaIDSeekID       = 0x53AB
+	matroskaIDSeekPosition = 0x53AC
+
+	matroskaIDInfo           = 0x1549A966
+	matroskaIDTimestampScale = 0x2AD7B1
+	matroskaIDDuration       = 0x4489
+	matroskaIDMuxingApp      = 0x4D80
+	matroskaIDWritingApp     = 0x5741
+
+	matroskaIDTracks            = 0x1654AE6B
+	matroskaIDTrackEntry        = 0xAE
+	matroskaIDTrackNumber       = 0xD7
+	matroskaIDTrackUID          = 0x73C5
+	matroskaIDTrackType         = 0x83
+	matroskaIDFlagLacing        = 0x9C
+	matroskaIDCodecID           = 0x86
+	matroskaIDCodecPrivate      = 0x63A2
+	matroskaIDCodecDelay        = 0x56AA
+	matroskaIDSeekPreRoll       = 0x56BB
+	matroskaIDVideo             = 0xE0
+	matroskaIDPixelWidth        = 0xB0
+	matroskaIDPixelHeight       = 0xBA
+	matroskaIDAudio             = 0xE1
+	matroskaIDSamplingFrequency = 0xB5
+	matroskaIDChannels          = 0x9F
+
+	matroskaIDCluster     = 0x1F43B675
+	matroskaIDTimestamp   = 0xE7
+	matroskaIDSimpleBlock = 0xA3
+
+	matroskaIDCues               = 0x1C53BB6B
+	matroskaIDCuePoint           = 0xBB
+	matroskaIDCueTime            = 0xB3
+	matroskaIDCueTrackPositions  = 0xB7
+	matroskaIDCueTrack           = 0xF7
+	matroskaIDCueClusterPosition = 0xF1
+)
+
+const (
+	matroskaTrackTypeVideo = 1
+	matroskaTrackTypeAudio = 2
+
+	// matroskaTimestampScale makes timestamps count milliseconds.
+	matroskaTimestampScale = 1_000_000
+	// matroskaMaxClusterDuration bounds the duration of clusters, in milliseconds, when keyframes
+	// are rare or when there's no video. It also keeps block timestamps in the int16 range.
+	matroskaMaxClusterDuration = 5000
+	// matroskaOpusSeekPreRoll is the recommended pre-roll for Opus, 80 ms, in nanoseconds.
+	matroskaOpusSeekPreRoll = 80_000_000
+
+	// Sizes of the elements that are only known when the recording is finished. Their space is
+	// reserved with Void elements.
+	matroskaSeekSize     = 21
+	matroskaDurationSize = 11
+)
+
+const matroskaWritingApp = "pion/mediadevices"
+
+type matroskaCodec struct {
+	codecID string
+	// webm tells whether the codec is allowed in WebM files, otherwise the Matroska DocType is used.
+	webm bool
+}
+
+// matroskaCodecs is indexed by lower case MIME types. The CodecPrivate element of every codec is
+// the decoder configuration of the track.
+var matroskaCodecs = map[string]matroskaCodec{
+	strings.ToLower(webrtc.MimeTypeVP8):  {codecID: "V_VP8", webm: true},
+	strings.ToLower(webrtc.MimeTypeVP9):  {codecID: "V_VP9", webm: true},
+	strings.ToLower(webrtc.MimeTypeAV1):  {codecID: "V_AV1", webm: true},
+	strings.ToLower(webrtc.MimeTypeH264): {codecID: "V_MPEG4/ISO/AVC"},
+	strings.ToLower(webrtc.MimeTypeH265): {codecID: "V_MPEGH/ISO/HEVC"},
+	strings.ToLower(webrtc.MimeTypeOpus): {codecID: "A_OPUS", webm: true},
+}
+
+// matroskaTrackEntry creates the TrackEntry element of t.
+func matroskaTrackEntry(t *muxerTrack) []byte {
+	children := [][]byte{
+		ebmlUint(matroskaIDTrackNumber, uint64(t.id)),
+		ebmlUint(matroskaIDTrackUID, uint64(t.id)),
+	}
+
+	switch t.codec.kind {
+	case webrtc.RTPCodecTypeVideo:
+		children = append(children, ebmlUint(matroskaIDTrackType, matroskaTrackTypeVideo))
+	default:
+		children = append(children, ebmlUint(matroskaIDTrackType, matroskaTrackTypeAudio))
+	}
+	children = append(children,
+		ebmlUint(matroskaIDFlagLacing, 0),
+		ebmlString(matroskaIDCodecID, matroskaCodecs[strings.ToLower(t.mimeType)].codecID),
+	)
+	if len(t.config) > 0 {
+		children = append(children, ebmlElement(matroskaIDCodecPrivate, t.config))
+	}
+
+	switch t.codec.kind {
+	case webrtc.RTPCodecTypeVideo:
+		children = append(children, ebmlMaster(matroskaIDVideo,
+			ebmlUint(matroskaIDPixelWidth, uint64(t.width)),
+			ebmlUint(matroskaIDPixelHeight, uint64(t.height)),
+		))
+	default:
+		// Opus is the only audio codec
+		children = append(children,
+			ebmlUint(matroskaIDCodecDelay, 0),
+			ebmlUint(matroskaIDSeekPreRoll, matroskaOpusSeekPreRoll),
+			ebmlMaster(matroskaIDAudio,
+				ebmlFloat(matroskaIDSamplingFrequency, opusSampleRate),
+				ebmlUint(matroskaIDChannels, uint64(opusHeadChannels(t.config))),
+			),
+		)
+	}
+
+	return ebmlMaster(matroskaIDTrackEntry, children...)
+}
+
+type matroskaCuePoint struct {
+	timestamp       int64
+	track           uint32
+	clusterPosition int64
+}
+
+// matroskaWriter writes a Matroska file made of SimpleBlocks. Clusters are buffered in memory so
+// that their size is known when they're written. When the destination is an io.WriteSeeker, the
+// segment size, the duration and the position of the cues are filled in when the writer is closed,
+// which makes the file seekable. Otherwise, the segment has an unknown size, as in live streams.
+type matroskaWriter struct {
+	w      io.Writer
+	seeker io.WriteSeeker
+	origin int64
+	offset int64
+
+	segmentSizeOffset int64
+	segmentDataOffset int64
+	durationOffset    int64
+	cuesSeekOffset    int64
+
+	// cueTrack is the track that starts the clusters, the first video track if there's one.
+	cueTrack         uint32
+	cluster          []byte
+	clusterTimestamp int64
+	// clusterCue is the timestamp of the keyframe that starts the cluster, or -1 if there's none.
+	clusterCue int64
+	cues       []matroskaCuePoint
+	// lastBlocks are the last blocks of the tracks, which end the file.
+	lastBlocks map[uint32]matroskaLastBlock
+}
+
+// matroskaLastBlock is the last block of a track. Its duration is the time since the block before it.
+type matroskaLastBlock struct {
+	timestamp, duration int64
+}
+
+func newMatroskaWriter(w io.Writer) *matroskaWriter {
+	return &matroskaWriter{w: w, lastBlocks: map[uint32]matroskaLastBlock{}}
+}
+
+// start implements muxer. It writes everything up to the Tracks element.
+func (m *matroskaWriter) start(tracks []*muxerTrack) error {
+	docType := "webm"
+	for _, t := range tracks {
+		if !matroskaCodecs[strings.ToLower(t.mimeType)].webm {
+			docType = "matroska"
+		}
+	}
+
+	m.cueTrack = tracks[0].id
+	for _, t := range tracks {
+		if t.codec.kind == webrtc.RTPCodecTypeVideo {
+			m.cueTrack = t.id
+			break
+		}
+	}
+
+	if seeker, ok := m.w.(io.WriteSeeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			m.seeker, m.origin = seeker, start
+		}
+	}
+
+	header := ebmlMaster(matroskaIDEBML,
+		ebmlUint(matroskaIDEBMLVersion, 1),
+		ebmlUint(matroskaIDEBMLReadVersion, 1),
+		ebmlUint(matroskaIDEBMLMaxIDLength, 4),
+		ebmlUint(matroskaIDEBMLMaxSizeLength, 8),
+		ebmlString(matroskaIDDocType, docType),
+		ebmlUint(matroskaIDDocTypeVersion, 4),
+		ebmlUint(matroskaIDDocTypeReadVersion, 2),
+	)
+	header = append(header, ebmlID(matroskaIDSegment)...)
+	m.segmentSizeOffset = int64(len(header))
+	header = append(header, ebmlUnknownSize...)
+	m.segmentDataOffset = int64(len(header))
+
+	seek := func(id uint32, position int) []byte {
+		return ebmlMaster(matroskaIDSeek,
+			ebmlElement(matroskaIDSeekID, ebmlID(id)),
+			ebmlUintN(matroskaIDSeekPosition, uint64(position), 8),
+		)
+	}
+
+	timestampScale := ebmlUint(matroskaIDTimestampScale, matroskaTimestampScale)
+	infoData := append(timestampScale, ebmlVoid(matroskaDurationSize)...)
+	infoData = append(infoData, ebmlString(matroskaIDMuxingApp, matroskaWritingApp)...)
+	infoData = append(infoData, ebmlString(matroskaIDWritingApp, matroskaWritingApp)...)
+	info := ebmlElement(matroskaIDInfo, infoData)
+
+	var entries [][]byte
+	for _, t := range tracks {
+		entries = append(entries, matroskaTrackEntry(t))
+	}
+	tracksElement := ebmlMaster(matroskaIDTracks, entries...)
+
+	// SeekHead has a fixed size: 2 seeks, and the reserved space for the cues
+	seekHeadSize := len(ebmlMaster(matroskaIDSeekHead, seek(matroskaIDInfo, 0), seek(matroskaIDTracks, 0), ebmlVoid(matroskaSeekSize)))
+	infoPosition := seekHeadSize
+	tracksPosition := infoPosition + len(info)
+	seekHead := ebmlMaster(matroskaIDSeekHead, seek(matroskaIDInfo, infoPosition), seek(matroskaIDTracks, tracksPosition), ebmlVoid(matroskaSeekSize))
+
+	// The reserved spaces are the last child of SeekHead, and the second child of Info
+	m.cuesSeekOffset = m.segmentDataOffset + int64(seekHeadSize-matroskaSeekSize)
+	infoHeaderSize := len(info) - len(infoData)
+	m.durationOffset = m.segmentDataOffset + int64(infoPosition+infoHeaderSize+len(timestampScale))
+
+	header = append(header, seekHead...)
+	header = append(header, info...)
+	header = append(header, tracksElement...)
+	return m.write(header)
+}
+
+func (m *matroskaWriter) write(b []byte) error {
+	n, err := m.w.Write(b)
+	m.offset += int64(n)
+	return err
+}
+
+// writeSample implements muxer. It adds a SimpleBlock to the current cluster. The tracks are read
+// concurrently, so a block may come after blocks of other tracks with later timestamps. Clusters can't
+// go backwards, so a block is written before the timestamp of its cluster, and dropped if it's too late
+// for that.
+func (m *matroskaWriter) writeSample(sample muxerSample) error {
+	track, keyframe := sample.track.id, sample.keyframe
+	timestamp := sample.timestamp.Milliseconds()
+	relative := timestamp - m.clusterTimestamp
+	if relative < math.MinInt16 {
+		logger.Debugf("%s block at %d ms is too late for the cluster at %d ms, it's dropped",
+			sample.track.mimeType, timestamp, m.clusterTimestamp)
+		return nil
+	}
+	startCluster := m.cluster == nil ||
+		(keyframe && track == m.cueTrack) ||
+		relative > matroskaMaxClusterDuration
+	if startCluster {
+		if err := m.flushCluster(); err != nil {
+			return err
+		}
+		m.cluster = []byte{}
+		m.clusterTimestamp = max(m.clusterTimestamp, timestamp)
+		m.clusterCue = -1
+		if keyframe && track == m.cueTrack {
+			m.clusterCue = timestamp
+		}
+		relative = timestamp - m.clusterTimestamp
+	}
+
+	block := append(ebmlSize(uint64(track)), byte(uint16(relative)>>8), byte(relative))
+	var flags byte
+	if keyframe {
+		flags |= 0x80
+	}
+	block = append(block, flags)
+	block = append(block, sample.data...)
+	m.cluster = append(m.cluster, ebmlElement(matroskaIDSimpleBlock, block)...)
+
+	if last, ok := m.lastBlocks[track]; !ok {
+		m.lastBlocks[track] = matroskaLastBlock{timestamp: timestamp}
+	} else if timestamp > last.timestamp {
+		m.lastBlocks[track] = matroskaLastBlock{timestamp: timestamp, duration: timestamp - last.timestamp}
+	}
+	return nil
+}
+
+// duration returns the end of the last block of the tracks, in milliseconds.
+func (m *matroskaWriter) duration() int64 {
+	var duration int64
+	for _, last := range m.lastBlocks {
+		duration = max(duration, last.timestamp+last.duration)
+	}
+	return duration
+}
+
+func (m *matroskaWriter) flushCluster() error {
+	if len(m.cluster) == 0 {
+		return nil
+	}
+
+	if m.clusterCue >= 0 {
+		m.cues = append(m.cues, matroskaCuePoint{
+			timestamp:       m.clusterCue,
+			track:           m.cueTrack,
+			clusterPosition: m.offset - m.segmentDataOffset,
+		})
+	}
+
+	data := append(ebmlUint(matroskaIDTimestamp, uint64(m.clusterTimestamp)), m.cluster...)
+	m.cluster = nil
+	return m.write(ebmlElement(matroskaIDCluster, data))
+}
+
+// close implements muxer. It flushes the last cluster, writes the cues, and finalizes the file if
+// it's seekable.
+func (m *matroskaWriter) close() error {
+	if err := m.flushCluster(); err != nil {
+		return err
+	}
+
+	cuesPosition := m.offset - m.segmentDataOffset
+	if len(m.cues) > 0 {
+		var points [][]byte
+		for _, cue := range m.cues {
+			points = append(points, ebmlMaster(matroskaIDCuePoint,
+				ebmlUint(matroskaIDCueTime, uint64(cue.timestamp)),
+				ebmlMaster(matroskaIDCueTrackPositions,
+					ebmlUint(matroskaIDCueTrack, uint64(cue.track)),
+					ebmlUint(matroskaIDCueClusterPosition, uint64(cue.clusterPosition)),
+				),
+			))
+		}
+		if err := m.write(ebmlMaster(matroskaIDCues, points...)); err != nil {
+			return err
+		}
+	}
+
+	if m.seeker == nil {
+		return nil
+	}
+
+	patches := []struct {
+		offset int64
+		data   []byte
+	}{
+		{m.segmentSizeOffset, ebmlSizeN(uint64(m.offset-m.segmentDataOffset), 8)},
+		{m.durationOffset, ebmlFloat(matroskaIDDuration, float64(m.duration()))},
+	}
+	if len(m.cues) > 0 {
+		patches = append(patches, struct {
+			offset int64
+			data   []byte
+		}{m.cuesSeekOffset, ebmlMaster(matroskaIDSeek,
+			ebmlElement(matroskaIDSeekID, ebmlID(matroskaIDCues)),
+			ebmlUintN(matroskaIDSeekPosition, uint64(cuesPosition), 8),
+		)})
+	}
+
+	for _, patch := range patches {
+		if _, err := m.seeker.Seek(m.origin+patch.offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := m.seeker.Write(patch.data); err != nil {
+			return err
+		}
+	}
+	_, err := m.seeker.Seek(m.origin+m.offset, io.SeekStart)
+	return err
+}
@@ -0,0 +1,45 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const opusSampleRate = 48000
+
+var errOpusUnsupportedChannelCount = errors.New("opus: only mono and stereo are supported")
+
+// opusHead builds the identification header of an Opus stream (RFC 7845, 5.1). The pre-skip is
+// left at 0 since the encoder's lookahead isn't exposed.
+func opusHead(channels int, inputSampleRate int) ([]byte, error) {
+	if channels < 1 || channels > 2 {
+		return nil, errOpusUnsupportedChannelCount
+	}
+
+	b := []byte("OpusHead")
+	b = append(b, 1, byte(channels))
+	b = binary.LittleEndian.AppendUint16(b, 0) // pre-skip
+	b = binary.LittleEndian.AppendUint32(b, uint32(inputSampleRate))
+	b = binary.LittleEndian.AppendUint16(b, 0) // output gain
+	b = append(b, 0)                           // channel mapping family
+	return b, nil
+}
+
+// opusHeadChannels returns the channel count of an identification header built by opusHead.
+func opusHeadChannels(head []byte) int {
+	if len(head) < 10 {
+		return 0
+	}
+	return int(head[9])
+}
+
+// opusSpecificBox converts an identification header built by opusHead to the payload of the dOps
+// box of ISOBMFF (Encapsulation of Opus in ISO Base Media File Format, 4.3.2). The fields are the
+// same, but in big endian.
+func opusSpecificBox(head []byte) []byte {
+	b := []byte{0, head[9]} // Version, OutputChannelCount
+	b = binary.BigEndian.AppendUint16(b, binary.LittleEndian.Uint16(head[10:]))
+	b = binary.BigEndian.AppendUint32(b, binary.LittleEndian.Uint32(head[12:]))
+	b = binary.BigEndian.AppendUint16(b, binary.LittleEndian.Uint16(head[16:]))
+	return append(b, head[18]) // ChannelMappingFamily
+}
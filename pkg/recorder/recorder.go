@@ -0,0 +1,127 @@
+// Package recorder records MediaStreams to WebM/Matroska files, and muxes encoded tracks to
+// fragmented MP4 segments.
+package recorder
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pion/mediadevices"
+	"github.com/pion/mediadevices/internal/logging"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	errEmptyMediaStream  = errors.New("recorder: media stream has no track")
+	errUnsupportedSource = errors.New("recorder: track doesn't provide its frames")
+)
+
+var logger = logging.NewLogger("mediadevices/recorder")
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithVideoCodec sets the MIME type of the codec used to encode the video tracks. The codec selector
+// of the tracks must have an encoder for it. The default is VP8.
+func WithVideoCodec(mimeType string) Option {
+	return func(r *Recorder) {
+		r.videoCodec = mimeType
+	}
+}
+
+// WithAudioCodec sets the MIME type of the codec used to encode the audio tracks. The codec selector
+// of the tracks must have an encoder for it. The default is Opus.
+func WithAudioCodec(mimeType string) Option {
+	return func(r *Recorder) {
+		r.audioCodec = mimeType
+	}
+}
+
+// Recorder records the tracks of a MediaStream to a WebM file, or to a Matroska file when a codec
+// isn't allowed in WebM, e.g. H.264. Every track gets its own encoder, and the frames are timed with
+// their capture timestamps.
+type Recorder struct {
+	videoCodec string
+	audioCodec string
+	stream     *streamMuxer
+}
+
+// New starts recording the tracks of stream to w. When w is an io.WriteSeeker, the file is finalized
+// on Close so that it's seekable. Otherwise, it's written as a live stream. The header is written
+// once every track has produced its first keyframe.
+func New(w io.Writer, stream mediadevices.MediaStream, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		videoCodec: webrtc.MimeTypeVP8,
+		audioCodec: webrtc.MimeTypeOpus,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	tracks := stream.GetTracks()
+	if len(tracks) == 0 {
+		return nil, errEmptyMediaStream
+	}
+	// GetTracks doesn't keep the order of the tracks, video tracks are written first
+	sort.SliceStable(tracks, func(i, j int) bool {
+		return tracks[i].Kind() == webrtc.RTPCodecTypeVideo && tracks[j].Kind() != webrtc.RTPCodecTypeVideo
+	})
+
+	var muxerTracks []*muxerTrack
+	for _, track := range tracks {
+		t, err := r.newTrack(track)
+		if err != nil {
+			for _, t := range muxerTracks {
+				t.reader.Close()
+			}
+			return nil, err
+		}
+		muxerTracks = append(muxerTracks, t)
+	}
+
+	r.stream = newStreamMuxer(newMatroskaWriter(w), muxerTracks)
+	return r, nil
+}
+
+func (r *Recorder) newTrack(track mediadevices.Track) (*muxerTrack, error) {
+	mimeType := r.audioCodec
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		mimeType = r.videoCodec
+	}
+	codec, err := lookupCodec(mimeType, track.Kind())
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := matroskaCodecs[strings.ToLower(mimeType)]; !ok {
+		return nil, errUnsupportedCodec
+	}
+
+	t := &muxerTrack{mimeType: mimeType, codec: codec}
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		source, ok := track.(interface{ NewReader(bool) video.Reader })
+		if !ok {
+			return nil, errUnsupportedSource
+		}
+		var p prop.Media
+		if _, _, err := video.DetectChanges(0, 0, func(current prop.Media) { p = current })(source.NewReader(false)).Read(); err != nil {
+			return nil, err
+		}
+		t.width, t.height = p.Width, p.Height
+	}
+
+	t.reader, err = track.NewEncodedReader(mimeType)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Close stops the recording and finalizes the file. It doesn't close the underlying writer. Besides
+// finalization errors, the first error that stopped a track is returned, if any.
+func (r *Recorder) Close() error {
+	return r.stream.close()
+}
@@ -0,0 +1,450 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pion/mediadevices"
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/io/audio"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/wave"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	testVideoFrames    = 60
+	testKeyFramePeriod = 30
+	testAudioChunks    = 100
+)
+
+var testBase = time.Unix(1000, 0)
+
+type fakeVideoSource struct {
+	count int
+}
+
+func (s *fakeVideoSource) ID() string   { return "fake-video" }
+func (s *fakeVideoSource) Close() error { return nil }
+
+func (s *fakeVideoSource) Read() (image.Image, func(), error) {
+	img, _, release, err := s.ReadTimestamped()
+	return img, release, err
+}
+
+func (s *fakeVideoSource) ReadTimestamped() (image.Image, time.Time, func(), error) {
+	if s.count >= testVideoFrames {
+		return nil, time.Time{}, func() {}, io.EOF
+	}
+	timestamp := testBase.Add(time.Duration(s.count) * 40 * time.Millisecond)
+	s.count++
+	return image.NewYCbCr(image.Rect(0, 0, 320, 240), image.YCbCrSubsampleRatio420), timestamp, func() {}, nil
+}
+
+type fakeAudioSource struct {
+	count int
+}
+
+func (s *fakeAudioSource) ID() string   { return "fake-audio" }
+func (s *fakeAudioSource) Close() error { return nil }
+
+func (s *fakeAudioSource) Read() (wave.Audio, func(), error) {
+	chunk, _, release, err := s.ReadTimestamped()
+	return chunk, release, err
+}
+
+func (s *fakeAudioSource) ReadTimestamped() (wave.Audio, time.Time, func(), error) {
+	if s.count >= testAudioChunks {
+		return nil, time.Time{}, func() {}, io.EOF
+	}
+	timestamp := testBase.Add(time.Duration(s.count) * 20 * time.Millisecond)
+	s.count++
+	return wave.NewInt16Interleaved(wave.ChunkInfo{Len: 960, Channels: 2, SamplingRate: 48000}), timestamp, func() {}, nil
+}
+
+// fakeVP8Encoder produces frames that only carry the VP8 keyframe flag.
+type fakeVP8Encoder struct {
+	r     video.Reader
+	count int
+}
+
+func (e *fakeVP8Encoder) Read() ([]byte, func(), error) {
+	if _, _, err := e.r.Read(); err != nil {
+		return nil, func() {}, err
+	}
+	frame := []byte{0x01, 0x02, 0x03}
+	if e.count%testKeyFramePeriod == 0 {
+		frame[0] = 0x00
+	}
+	e.count++
+	return frame, func() {}, nil
+}
+
+func (e *fakeVP8Encoder) Controller() codec.EncoderController { return nil }
+func (e *fakeVP8Encoder) Close() error                        { return nil }
+
+type fakeVP8Builder struct{}
+
+func (fakeVP8Builder) RTPCodec() *codec.RTPCodec { return codec.NewRTPVP8Codec(90000) }
+func (fakeVP8Builder) BuildVideoEncoder(r video.Reader, p prop.Media) (codec.ReadCloser, error) {
+	return &fakeVP8Encoder{r: r}, nil
+}
+
+// fakeOpusEncoder produces stereo TOC bytes.
+type fakeOpusEncoder struct {
+	r audio.Reader
+}
+
+func (e *fakeOpusEncoder) Read() ([]byte, func(), error) {
+	if _, _, err := e.r.Read(); err != nil {
+		return nil, func() {}, err
+	}
+	return []byte{0x04, 0x05}, func() {}, nil
+}
+
+func (e *fakeOpusEncoder) Controller() codec.EncoderController { return nil }
+func (e *fakeOpusEncoder) Close() error                        { return nil }
+
+type fakeOpusBuilder struct{}
+
+func (fakeOpusBuilder) RTPCodec() *codec.RTPCodec { return codec.NewRTPOpusCodec(48000) }
+func (fakeOpusBuilder) BuildAudioEncoder(r audio.Reader, p prop.Media) (codec.ReadCloser, error) {
+	return &fakeOpusEncoder{r: r}, nil
+}
+
+type ebmlTestElement struct {
+	id       uint32
+	data     []byte
+	offset   int64
+	children []ebmlTestElement
+}
+
+func (e ebmlTestElement) find(id uint32) *ebmlTestElement {
+	for i := range e.children {
+		if e.children[i].id == id {
+			return &e.children[i]
+		}
+	}
+	return nil
+}
+
+func (e ebmlTestElement) uint() uint64 {
+	var v uint64
+	for _, b := range e.data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func readVint(b []byte) (uint64, int) {
+	length := 1
+	for length <= 8 && b[0]&(0x80>>(length-1)) == 0 {
+		length++
+	}
+	v := uint64(b[0] & (0xFF >> length))
+	for i := 1; i < length; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, length
+}
+
+// parseEBML parses b into elements. Master elements, the ones listed in masters, are parsed
+// recursively. offset is the position of b in the file.
+func parseEBML(t *testing.T, b []byte, offset int64) []ebmlTestElement {
+	masters := map[uint32]bool{
+		matroskaIDEBML: true, matroskaIDSegment: true, matroskaIDSeekHead: true, matroskaIDSeek: true,
+		matroskaIDInfo: true, matroskaIDTracks: true, matroskaIDTrackEntry: true, matroskaIDCluster: true,
+		matroskaIDCues: true, matroskaIDCuePoint: true, matroskaIDCueTrackPositions: true,
+	}
+
+	var elements []ebmlTestElement
+	for pos := 0; pos < len(b); {
+		idLength := 1
+		for b[pos]&(0x80>>(idLength-1)) == 0 {
+			idLength++
+		}
+		var id uint32
+		for _, c := range b[pos : pos+idLength] {
+			id = id<<8 | uint32(c)
+		}
+		size, sizeLength := readVint(b[pos+idLength:])
+		start := pos + idLength + sizeLength
+		if size == 1<<(7*sizeLength)-1 {
+			t.Fatalf("Element %x has an unknown size", id)
+		}
+		if start+int(size) > len(b) {
+			t.Fatalf("Element %x overflows", id)
+		}
+
+		e := ebmlTestElement{id: id, data: b[start : start+int(size)], offset: offset + int64(pos)}
+		if masters[id] {
+			e.children = parseEBML(t, e.data, offset+int64(start))
+		}
+		elements = append(elements, e)
+		pos = start + int(size)
+	}
+	return elements
+}
+
+func TestRecorder(t *testing.T) {
+	selector := mediadevices.NewCodecSelector(
+		mediadevices.WithVideoEncoders(fakeVP8Builder{}),
+		mediadevices.WithAudioEncoders(fakeOpusBuilder{}),
+	)
+	videoTrack := mediadevices.NewVideoTrack(&fakeVideoSource{}, selector)
+	audioTrack := mediadevices.NewAudioTrack(&fakeAudioSource{}, selector)
+	stream, err := mediadevices.NewMediaStream(videoTrack, audioTrack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.webm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := New(f, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sources end by themselves
+	r.stream.wg.Wait()
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	elements := parseEBML(t, b, 0)
+	if len(elements) != 2 || elements[0].id != matroskaIDEBML || elements[1].id != matroskaIDSegment {
+		t.Fatalf("Expected EBML header and Segment, got %v", elements)
+	}
+	if docType := elements[0].find(matroskaIDDocType); docType == nil || string(docType.data) != "webm" {
+		t.Errorf("Expected webm DocType")
+	}
+
+	segment := elements[1]
+	// Segment is the last element of the file
+	segmentDataOffset := int64(len(b) - len(segment.data))
+
+	t.Run("Duration", func(t *testing.T) {
+		duration := segment.find(matroskaIDInfo).find(matroskaIDDuration)
+		if duration == nil {
+			t.Fatal("Expected Duration to be set")
+		}
+		// The last video frame is at 2360 ms, and lasts 40 ms
+		if d := math.Float64frombits(binary.BigEndian.Uint64(duration.data)); d != 2400 {
+			t.Errorf("Expected 2400 ms duration, got %v", d)
+		}
+	})
+
+	t.Run("Tracks", func(t *testing.T) {
+		tracks := segment.find(matroskaIDTracks)
+		if len(tracks.children) != 2 {
+			t.Fatalf("Expected 2 tracks, got %d", len(tracks.children))
+		}
+		video := tracks.children[0]
+		if codecID := video.find(matroskaIDCodecID); string(codecID.data) != "V_VP8" {
+			t.Errorf("Expected V_VP8, got %s", codecID.data)
+		}
+		if !bytes.Contains(video.data, ebmlUint(matroskaIDPixelWidth, 320)) {
+			t.Error("Expected the video track to be 320 pixels wide")
+		}
+		audio := tracks.children[1]
+		codecPrivate := audio.find(matroskaIDCodecPrivate)
+		if codecPrivate == nil || !bytes.HasPrefix(codecPrivate.data, []byte("OpusHead")) || codecPrivate.data[9] != 2 {
+			t.Errorf("Expected a stereo OpusHead, got %v", codecPrivate)
+		}
+	})
+
+	t.Run("Blocks", func(t *testing.T) {
+		blocks := map[uint64]int{}
+		lastVideoTimestamp := int64(-1)
+		for _, cluster := range segment.children {
+			if cluster.id != matroskaIDCluster {
+				continue
+			}
+			clusterTimestamp := int64(cluster.find(matroskaIDTimestamp).uint())
+			for _, block := range cluster.children {
+				if block.id != matroskaIDSimpleBlock {
+					continue
+				}
+				track, n := readVint(block.data)
+				timestamp := clusterTimestamp + int64(int16(binary.BigEndian.Uint16(block.data[n:])))
+				keyframe := block.data[n+2]&0x80 != 0
+				if track == 1 {
+					if blocks[track] == 0 && !keyframe {
+						t.Error("Expected the video track to start with a keyframe")
+					}
+					if timestamp <= lastVideoTimestamp {
+						t.Errorf("Expected video timestamps to increase, got %d after %d", timestamp, lastVideoTimestamp)
+					}
+					lastVideoTimestamp = timestamp
+				}
+				blocks[track]++
+			}
+		}
+		// The first frames might be used to detect the properties of the tracks, before
+		// the encoders start reading
+		if blocks[1] < testVideoFrames-2 || blocks[2] < testAudioChunks-2 {
+			t.Errorf("Expected %d video and %d audio blocks, got %v", testVideoFrames, testAudioChunks, blocks)
+		}
+		if lastVideoTimestamp != (testVideoFrames-1)*40 {
+			t.Errorf("Expected the last video frame at %d ms, got %d", (testVideoFrames-1)*40, lastVideoTimestamp)
+		}
+	})
+
+	t.Run("Cues", func(t *testing.T) {
+		var cuesSeek *ebmlTestElement
+		for _, seek := range segment.find(matroskaIDSeekHead).children {
+			if seek.id == matroskaIDSeek && bytes.Equal(seek.find(matroskaIDSeekID).data, ebmlID(matroskaIDCues)) {
+				cuesSeek = &seek
+			}
+		}
+		if cuesSeek == nil {
+			t.Fatal("Expected SeekHead to point to the cues")
+		}
+
+		cues := segment.find(matroskaIDCues)
+		if cues == nil {
+			t.Fatal("Expected cues")
+		}
+		if position := int64(cuesSeek.find(matroskaIDSeekPosition).uint()); cues.offset-segmentDataOffset != position {
+			t.Errorf("Expected cues at %d, got %d", cues.offset-segmentDataOffset, position)
+		}
+		if len(cues.children) != testVideoFrames/testKeyFramePeriod {
+			t.Errorf("Expected a cue per keyframe, got %d", len(cues.children))
+		}
+		for _, point := range cues.children {
+			position := int64(point.find(matroskaIDCueTrackPositions).find(matroskaIDCueClusterPosition).uint())
+			if b[segmentDataOffset+position] != 0x1F {
+				t.Errorf("Expected a cluster at %d", position)
+			}
+		}
+	})
+}
+
+func TestMatroskaLateBlocks(t *testing.T) {
+	video := &muxerTrack{mimeType: webrtc.MimeTypeVP8, codec: mediaCodec{kind: webrtc.RTPCodecTypeVideo}, width: 320, height: 240}
+	audio := &muxerTrack{mimeType: webrtc.MimeTypeOpus, codec: mediaCodec{kind: webrtc.RTPCodecTypeAudio}}
+	video.id, audio.id = 1, 2
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.webm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m := newMatroskaWriter(f)
+	if err := m.start([]*muxerTrack{video, audio}); err != nil {
+		t.Fatal(err)
+	}
+	samples := []muxerSample{
+		{track: video, timestamp: 40 * time.Second, keyframe: true},
+		// Late, but it can still be written in the cluster of the video keyframe
+		{track: audio, timestamp: 39500 * time.Millisecond},
+		// The keyframe starts a cluster, which doesn't go back before the audio block
+		{track: video, timestamp: 39 * time.Second, keyframe: true},
+		// Too late for the cluster
+		{track: audio, timestamp: time.Second},
+		{track: audio, timestamp: 41000 * time.Millisecond},
+		{track: audio, timestamp: 41020 * time.Millisecond},
+	}
+	for _, sample := range samples {
+		if err := m.writeSample(sample); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment := parseEBML(t, b, 0)[1]
+
+	var timestamps []int64
+	lastCluster := int64(-1)
+	for _, cluster := range segment.children {
+		if cluster.id != matroskaIDCluster {
+			continue
+		}
+		clusterTimestamp := int64(cluster.find(matroskaIDTimestamp).uint())
+		if clusterTimestamp < lastCluster {
+			t.Errorf("Expected clusters not to go backwards, got %d after %d", clusterTimestamp, lastCluster)
+		}
+		lastCluster = clusterTimestamp
+		for _, block := range cluster.children {
+			if block.id == matroskaIDSimpleBlock {
+				_, n := readVint(block.data)
+				timestamps = append(timestamps, clusterTimestamp+int64(int16(binary.BigEndian.Uint16(block.data[n:]))))
+			}
+		}
+	}
+	if expected := []int64{40000, 39500, 39000, 41000, 41020}; !slices.Equal(timestamps, expected) {
+		t.Errorf("Expected blocks at %v, got %v", expected, timestamps)
+	}
+	// The last audio block lasts 20 ms
+	duration := segment.find(matroskaIDInfo).find(matroskaIDDuration)
+	if d := math.Float64frombits(binary.BigEndian.Uint64(duration.data)); d != 41040 {
+		t.Errorf("Expected 41040 ms duration, got %v", d)
+	}
+}
+
+// blockingReader blocks reading until it's closed. reading is closed once it's being read.
+type blockingReader struct {
+	reading, closed chan struct{}
+}
+
+func (r *blockingReader) Read() (mediadevices.EncodedBuffer, func(), error) {
+	close(r.reading)
+	<-r.closed
+	return mediadevices.EncodedBuffer{}, func() {}, io.EOF
+}
+
+func (r *blockingReader) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func (r *blockingReader) Controller() codec.EncoderController { return nil }
+
+func TestStreamMuxerCloseBlockedReader(t *testing.T) {
+	vp8, err := lookupCodec(webrtc.MimeTypeVP8, webrtc.RTPCodecTypeVideo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &blockingReader{reading: make(chan struct{}), closed: make(chan struct{})}
+	track := &muxerTrack{
+		reader:   reader,
+		mimeType: webrtc.MimeTypeVP8,
+		codec:    vp8,
+	}
+	s := newStreamMuxer(nil, []*muxerTrack{track})
+	<-reader.reading
+
+	done := make(chan error)
+	go func() { done <- s.close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected nothing to be muxed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected close to unblock the reader")
+	}
+}
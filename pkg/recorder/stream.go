@@ -0,0 +1,290 @@
+package recorder
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/mediadevices"
+	"github.com/pion/webrtc/v4"
+)
+
+// maxPendingFrames is the number of frames that are kept in memory while waiting for every track
+// to produce its first keyframe. When it's reached, the muxer starts without the late tracks.
+const maxPendingFrames = 256
+
+var (
+	errUnsupportedCodec = errors.New("recorder: unsupported codec")
+	errAlreadyClosed    = errors.New("recorder: already closed")
+)
+
+// muxerTrack is an encoded track that's read by a streamMuxer.
+type muxerTrack struct {
+	reader   mediadevices.EncodedReadCloser
+	mimeType string
+	codec    mediaCodec
+	// width and height are only set for video tracks.
+	width, height int
+
+	// config is the decoder configuration built from the first keyframe.
+	config []byte
+	// id is the 1 based index of the track in the output. It's set when the muxer starts.
+	id uint32
+	// ready is set once the track has received its first keyframe.
+	ready bool
+
+	closeOnce sync.Once
+}
+
+// closeReader closes the reader of the track once, which unblocks a pending Read.
+func (t *muxerTrack) closeReader() {
+	t.closeOnce.Do(func() { t.reader.Close() })
+}
+
+// lookupCodec returns the codec of mimeType, if it's supported and if it's a codec of the given kind.
+func lookupCodec(mimeType string, kind webrtc.RTPCodecType) (mediaCodec, error) {
+	codec, ok := mediaCodecs[strings.ToLower(mimeType)]
+	if !ok || codec.kind != kind {
+		return mediaCodec{}, errUnsupportedCodec
+	}
+	return codec, nil
+}
+
+// muxerSample is a frame in the storage format, timed from the beginning of the output.
+type muxerSample struct {
+	track     *muxerTrack
+	data      []byte
+	timestamp time.Duration
+	keyframe  bool
+}
+
+// muxer writes the samples of the tracks in a container format.
+type muxer interface {
+	// start is called once, with the tracks that are ready, before any sample is written.
+	start(tracks []*muxerTrack) error
+	writeSample(sample muxerSample) error
+	close() error
+}
+
+type pendingFrame struct {
+	track     *muxerTrack
+	data      []byte
+	timestamp time.Time
+	keyframe  bool
+}
+
+// streamMuxer reads encoded tracks concurrently, and gives their frames to a muxer. Since the
+// muxers need the decoder configuration of every track to write their header, the frames are kept
+// until every track has produced its first keyframe. Frames are timed with their capture timestamps,
+// starting from the earliest first frame.
+type streamMuxer struct {
+	muxer  muxer
+	tracks []*muxerTrack
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	started bool
+	pending []pendingFrame
+	base    time.Time
+	// err is the first error that stopped the muxer, readErr is the first error that stopped a track.
+	err     error
+	readErr error
+	closed  bool
+}
+
+func newStreamMuxer(m muxer, tracks []*muxerTrack) *streamMuxer {
+	s := &streamMuxer{
+		muxer:  m,
+		tracks: tracks,
+		stop:   make(chan struct{}),
+	}
+	for _, t := range tracks {
+		s.wg.Add(1)
+		go s.readLoop(t)
+	}
+	return s
+}
+
+func (s *streamMuxer) readLoop(t *muxerTrack) {
+	defer s.wg.Done()
+	defer t.closeReader()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		buffer, release, err := t.reader.Read()
+		if err != nil {
+			// The other tracks keep being muxed
+			s.mu.Lock()
+			if s.readErr == nil && !s.closed && err != io.EOF {
+				s.readErr = err
+			}
+			s.mu.Unlock()
+			return
+		}
+
+		frame := pendingFrame{
+			track:     t,
+			data:      append([]byte(nil), buffer.Data...),
+			timestamp: buffer.Timestamp,
+			keyframe:  t.codec.isKeyFrame(buffer.Data),
+		}
+		release()
+
+		s.mu.Lock()
+		err = s.writeFrame(frame)
+		if err != nil && s.err == nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeFrame must be called with s.mu locked.
+func (s *streamMuxer) writeFrame(frame pendingFrame) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	t := frame.track
+	if !t.ready {
+		if !frame.keyframe {
+			// The output must start with a keyframe to be decodable
+			return nil
+		}
+		if s.started {
+			// The track wasn't ready when the muxer started, it can't be added anymore
+			return nil
+		}
+		if t.codec.decoderConfig != nil {
+			config, err := t.codec.decoderConfig(frame.data)
+			if err != nil {
+				return err
+			}
+			t.config = config
+		}
+		t.ready = true
+	}
+
+	if !s.started {
+		s.pending = append(s.pending, frame)
+		if !s.allTracksReady() && len(s.pending) < maxPendingFrames {
+			return nil
+		}
+		return s.start()
+	}
+
+	return s.writeSample(frame)
+}
+
+func (s *streamMuxer) allTracksReady() bool {
+	for _, t := range s.tracks {
+		if !t.ready {
+			return false
+		}
+	}
+	return true
+}
+
+// start starts the muxer with the tracks that are ready, and writes the pending frames.
+func (s *streamMuxer) start() error {
+	var tracks []*muxerTrack
+	for _, t := range s.tracks {
+		if !t.ready {
+			logger.Warnf("%s track didn't produce a keyframe in time, it's dropped", t.mimeType)
+			continue
+		}
+		t.id = uint32(len(tracks) + 1)
+		tracks = append(tracks, t)
+	}
+
+	for _, frame := range s.pending {
+		if s.base.IsZero() || frame.timestamp.Before(s.base) {
+			s.base = frame.timestamp
+		}
+	}
+
+	s.started = true
+	if err := s.muxer.start(tracks); err != nil {
+		return err
+	}
+
+	pending := s.pending
+	s.pending = nil
+	for _, frame := range pending {
+		if err := s.writeSample(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *streamMuxer) writeSample(frame pendingFrame) error {
+	if frame.track.id == 0 {
+		return nil
+	}
+
+	data := frame.data
+	if frame.track.codec.convert != nil {
+		var err error
+		if data, err = frame.track.codec.convert(data); err != nil {
+			return err
+		}
+	}
+
+	return s.muxer.writeSample(muxerSample{
+		track:     frame.track,
+		data:      data,
+		timestamp: max(frame.timestamp.Sub(s.base), 0),
+		keyframe:  frame.keyframe,
+	})
+}
+
+// close stops reading the tracks, and closes the muxer. Besides the muxer errors, the first error that
+// stopped a track is returned, if any.
+func (s *streamMuxer) close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errAlreadyClosed
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.stop)
+	// The readers are closed before waiting for the read loops, which may be blocked reading them
+	for _, t := range s.tracks {
+		t.closeReader()
+	}
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	if !s.started {
+		if len(s.pending) == 0 {
+			// Nothing was muxed
+			return s.readErr
+		}
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if err := s.muxer.close(); err != nil {
+		return err
+	}
+	return s.readErr
+}
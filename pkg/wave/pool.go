@@ -0,0 +1,79 @@
+package wave
+
+import "sync"
+
+// Pool reuses the memory of audio chunks with the same size and format, so that chunks can be buffered and
+// converted without allocating new ones once the pool is warm. Chunks are taken from the pool with a release
+// function, which puts them back, and must be called once at most, when nobody uses the chunk anymore. Chunks
+// that aren't released are left to the garbage collector. Pool is safe for concurrent use.
+type Pool struct {
+	mu    sync.Mutex
+	pools map[poolKey]*sync.Pool
+}
+
+// DefaultPool is the pool that the audio transforms and the drivers take their chunks from.
+var DefaultPool = NewPool()
+
+type poolKey struct {
+	format SampleFormat
+	size   ChunkInfo
+}
+
+type pooledInt16Interleaved struct {
+	chunk, orig Int16Interleaved
+	release     func()
+}
+
+type pooledFloat32Interleaved struct {
+	chunk, orig Float32Interleaved
+	release     func()
+}
+
+// NewPool creates a new empty Pool.
+func NewPool() *Pool {
+	return &Pool{pools: make(map[poolKey]*sync.Pool)}
+}
+
+func (p *Pool) get(key poolKey) any {
+	p.mu.Lock()
+	pool, ok := p.pools[key]
+	if !ok {
+		pool = &sync.Pool{}
+		pool.New = func() any { return newPooledChunk(pool, key) }
+		p.pools[key] = pool
+	}
+	p.mu.Unlock()
+
+	return pool.Get()
+}
+
+func newPooledChunk(pool *sync.Pool, key poolKey) any {
+	switch key.format {
+	case Float32SampleFormat:
+		e := &pooledFloat32Interleaved{orig: *NewFloat32Interleaved(key.size)}
+		e.release = func() { pool.Put(e) }
+		return e
+	default:
+		e := &pooledInt16Interleaved{orig: *NewInt16Interleaved(key.size)}
+		e.release = func() { pool.Put(e) }
+		return e
+	}
+}
+
+// Int16Interleaved takes an Int16Interleaved chunk of size from the pool. The samples of the chunk aren't cleared.
+func (p *Pool) Int16Interleaved(size ChunkInfo) (*Int16Interleaved, func()) {
+	e := p.get(poolKey{format: Int16SampleFormat, size: size}).(*pooledInt16Interleaved)
+
+	// The previous user may have changed the chunk, e.g. by slicing its samples
+	e.chunk = e.orig
+	return &e.chunk, e.release
+}
+
+// Float32Interleaved takes a Float32Interleaved chunk of size from the pool. The samples of the chunk aren't
+// cleared.
+func (p *Pool) Float32Interleaved(size ChunkInfo) (*Float32Interleaved, func()) {
+	e := p.get(poolKey{format: Float32SampleFormat, size: size}).(*pooledFloat32Interleaved)
+
+	e.chunk = e.orig
+	return &e.chunk, e.release
+}
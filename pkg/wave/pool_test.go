@@ -0,0 +1,53 @@
+package wave
+
+import "testing"
+
+func TestPool(t *testing.T) {
+	pool := NewPool()
+	size := ChunkInfo{Len: 480, Channels: 2, SamplingRate: 48000}
+
+	chunk, release := pool.Int16Interleaved(size)
+	if chunk.Size != size || len(chunk.Data) != 960 {
+		t.Fatalf("Unexpected chunk: %v, %d samples", chunk.Size, len(chunk.Data))
+	}
+	release()
+
+	// sync.Pool may drop chunks, e.g. with the race detector, so they're not always reused right away
+	reused := false
+	for i := 0; i < 100 && !reused; i++ {
+		chunk, release := pool.Int16Interleaved(size)
+		data := &chunk.Data[0]
+		// Users may change the chunks they're given
+		chunk.Data = chunk.Data[2:]
+		release()
+
+		chunk, release = pool.Int16Interleaved(size)
+		if &chunk.Data[0] == data {
+			reused = true
+			if len(chunk.Data) != 960 {
+				t.Errorf("Expected the reused chunk to be reset, got %d samples", len(chunk.Data))
+			}
+		}
+		release()
+	}
+	if !reused {
+		t.Error("Expected the released chunks to be reused")
+	}
+
+	float, releaseFloat := pool.Float32Interleaved(size)
+	defer releaseFloat()
+	if float.Size != size || len(float.Data) != 960 {
+		t.Errorf("Unexpected Float32Interleaved chunk: %v, %d samples", float.Size, len(float.Data))
+	}
+}
+
+func BenchmarkPool(b *testing.B) {
+	pool := NewPool()
+	size := ChunkInfo{Len: 960, Channels: 2, SamplingRate: 48000}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, release := pool.Int16Interleaved(size)
+		release()
+	}
+}
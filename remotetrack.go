@@ -0,0 +1,354 @@
+package mediadevices
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/mediadevices/pkg/io/audio"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/wave"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+)
+
+const (
+	defaultRemoteMaxLate          = 256
+	defaultRemoteMaxDelay         = 200 * time.Millisecond
+	remoteKeyFrameRequestInterval = time.Second
+)
+
+var errUnsupportedRemoteCodec = errors.New("unsupported remote codec")
+
+// RTCPWriter writes RTCP packets to a remote peer, e.g. a *webrtc.PeerConnection.
+type RTCPWriter interface {
+	WriteRTCP(pkts []rtcp.Packet) error
+}
+
+// rtpPacketReader is the part of *webrtc.TrackRemote that's needed to receive its media.
+type rtpPacketReader interface {
+	ReadRTP() (*rtp.Packet, interceptor.Attributes, error)
+}
+
+// RemoteTrackOption configures a track created by NewTrackFromRemote.
+type RemoteTrackOption func(*remoteTrackConfig)
+
+type remoteTrackConfig struct {
+	maxLate    uint16
+	maxDelay   time.Duration
+	rtcpWriter RTCPWriter
+}
+
+// WithJitterBuffer sets how long the RTP packets are buffered to be put back in order. A frame is
+// dropped when it's still incomplete after maxLate packets, or after maxDelay. The default is 256
+// packets and 200 ms.
+func WithJitterBuffer(maxLate uint16, maxDelay time.Duration) RemoteTrackOption {
+	return func(c *remoteTrackConfig) {
+		c.maxLate = maxLate
+		c.maxDelay = maxDelay
+	}
+}
+
+// WithKeyFrameRequests sends PLIs to the remote peer through w, when the track starts and whenever
+// packets are lost or the decoder fails, so that decoding can resume from the next keyframe.
+func WithKeyFrameRequests(w RTCPWriter) RemoteTrackOption {
+	return func(c *remoteTrackConfig) {
+		c.rtcpWriter = w
+	}
+}
+
+// NewTrackFromRemote creates a track from the media received from a remote peer. The RTP packets are
+// reordered, reassembled into frames, and decoded by the first decoder of selector that supports the
+// codec of remote. Lost audio frames are concealed by the decoder. The frames are then available as with
+// local tracks, so that they can be transformed, and encoded again with the encoders of selector.
+//
+// The track belongs to the stream of remote. remote mustn't be read by anything else, and can't be
+// read anymore once the track is closed.
+func NewTrackFromRemote(remote *webrtc.TrackRemote, selector *CodecSelector, opts ...RemoteTrackOption) (Track, error) {
+	return newTrackFromRTP(remote, remote.Codec(), uint32(remote.SSRC()), remote.ID(), remote.StreamID(), selector, opts...)
+}
+
+func newTrackFromRTP(packets rtpPacketReader, codecParams webrtc.RTPCodecParameters, ssrc uint32, id, streamID string, selector *CodecSelector, opts ...RemoteTrackOption) (Track, error) {
+	config := remoteTrackConfig{
+		maxLate:  defaultRemoteMaxLate,
+		maxDelay: defaultRemoteMaxDelay,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	depacketizer, err := newDepacketizer(codecParams.MimeType)
+	if err != nil {
+		return nil, err
+	}
+	samples := &remoteSampleReader{
+		packets:    packets,
+		builder:    samplebuilder.New(config.maxLate, depacketizer, codecParams.ClockRate, samplebuilder.WithMaxTimeDelay(config.maxDelay)),
+		clockRate:  codecParams.ClockRate,
+		ssrc:       ssrc,
+		rtcpWriter: config.rtcpWriter,
+	}
+
+	var track Track
+	if strings.HasPrefix(strings.ToLower(codecParams.MimeType), "audio/") {
+		track, err = newAudioTrackFromRTP(samples, codecParams, id, selector)
+	} else {
+		track, err = newVideoTrackFromRTP(samples, codecParams, id, selector)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if assigner, ok := track.(streamIDAssigner); ok && streamID != "" {
+		assigner.assignStreamID(streamID)
+	}
+	return track, nil
+}
+
+func newVideoTrackFromRTP(samples *remoteSampleReader, codecParams webrtc.RTPCodecParameters, id string, selector *CodecSelector) (Track, error) {
+	decoder, err := selector.BuildVideoDecoder(codecParams.MimeType, samples, prop.Media{})
+	if err != nil {
+		return nil, err
+	}
+	source := &remoteSource{id: id, packets: samples.packets, decoder: decoder}
+
+	samples.requestKeyFrame()
+	reader := video.TimestampedReaderFunc(func() (image.Image, time.Time, func(), error) {
+		for {
+			img, release, err := decoder.Read()
+			if err == nil {
+				return img, samples.lastTimestamp(), release, nil
+			}
+			if err := samples.closedErr(source); err != nil {
+				return nil, time.Time{}, func() {}, err
+			}
+			// Decoding can resume from the next keyframe
+			logger.Debugf("failed to decode %s frame: %v", codecParams.MimeType, err)
+			samples.requestKeyFrame()
+		}
+	})
+
+	return newVideoTrackFromReader(source, reader, selector), nil
+}
+
+func newAudioTrackFromRTP(samples *remoteSampleReader, codecParams webrtc.RTPCodecParameters, id string, selector *CodecSelector) (Track, error) {
+	// Lost frames are given to the decoder as empty frames
+	samples.signalLoss = true
+
+	decoder, err := selector.BuildAudioDecoder(codecParams.MimeType, samples, prop.Media{
+		Audio: prop.Audio{
+			SampleRate:   int(codecParams.ClockRate),
+			ChannelCount: int(codecParams.Channels),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	source := &remoteSource{id: id, packets: samples.packets, decoder: decoder}
+
+	reader := audio.TimestampedReaderFunc(func() (wave.Audio, time.Time, func(), error) {
+		for {
+			chunk, release, err := decoder.Read()
+			if err == nil {
+				return chunk, samples.lastTimestamp(), release, nil
+			}
+			if err := samples.closedErr(source); err != nil {
+				return nil, time.Time{}, func() {}, err
+			}
+			logger.Debugf("failed to decode %s frame: %v", codecParams.MimeType, err)
+		}
+	})
+
+	return newAudioTrackFromReader(source, reader, selector), nil
+}
+
+func newDepacketizer(mimeType string) (rtp.Depacketizer, error) {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		return &codecs.VP8Packet{}, nil
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		return &codecs.VP9Packet{}, nil
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return &codecs.H264Packet{}, nil
+	case strings.ToLower(webrtc.MimeTypeH265):
+		return &codecs.H265Depacketizer{}, nil
+	case strings.ToLower(webrtc.MimeTypeAV1):
+		return &codecs.AV1Depacketizer{}, nil
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		return &codecs.OpusPacket{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedRemoteCodec, mimeType)
+	}
+}
+
+// remoteSampleReader reassembles the RTP packets of a remote track into frames. Every Read returns a
+// single frame, as expected by decoders.
+type remoteSampleReader struct {
+	packets    rtpPacketReader
+	builder    *samplebuilder.SampleBuilder
+	clockRate  uint32
+	ssrc       uint32
+	rtcpWriter RTCPWriter
+	// signalLoss makes Read return an empty frame for every packet lost before a frame
+	signalLoss bool
+	lost       int
+	pending    *media.Sample
+
+	mu sync.Mutex
+	// The capture time of a frame is estimated from the time the first frame arrived, and from the
+	// RTP timestamps since then.
+	hasStarted          bool
+	base                time.Time
+	lastRTPTimestamp    uint32
+	elapsed             int64
+	err                 error
+	lastKeyFrameRequest time.Time
+}
+
+func (r *remoteSampleReader) Read(p []byte) (int, error) {
+	for {
+		if r.lost > 0 {
+			r.lost--
+			return 0, nil
+		}
+
+		sample := r.pending
+		r.pending = nil
+		if sample == nil {
+			sample = r.builder.Pop()
+		}
+		if sample != nil {
+			if sample.PrevDroppedPackets > 0 {
+				if r.signalLoss && r.started() {
+					r.lost = int(sample.PrevDroppedPackets)
+					sample.PrevDroppedPackets = 0
+					r.pending = sample
+					continue
+				}
+				r.requestKeyFrame()
+			}
+			if len(sample.Data) > len(p) {
+				// The frame is kept for the next Read, with a larger buffer
+				r.pending = sample
+				return 0, io.ErrShortBuffer
+			}
+			r.updateTimestamp(sample.PacketTimestamp)
+			return copy(p, sample.Data), nil
+		}
+
+		pkt, _, err := r.packets.ReadRTP()
+		if err != nil {
+			r.mu.Lock()
+			r.err = err
+			r.mu.Unlock()
+			return 0, err
+		}
+		r.builder.Push(pkt)
+	}
+}
+
+func (r *remoteSampleReader) updateTimestamp(rtpTimestamp uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.hasStarted {
+		r.hasStarted = true
+		r.base = time.Now()
+	} else {
+		// The difference is signed so that wrap arounds and reordered frames are handled
+		r.elapsed += int64(int32(rtpTimestamp - r.lastRTPTimestamp))
+	}
+	r.lastRTPTimestamp = rtpTimestamp
+}
+
+// lastTimestamp returns the capture time of the last frame given to the decoder.
+func (r *remoteSampleReader) lastTimestamp() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.base.Add(time.Duration(r.elapsed) * time.Second / time.Duration(r.clockRate))
+}
+
+func (r *remoteSampleReader) started() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hasStarted
+}
+
+// closedErr returns the error that ended the reads of RTP packets, or io.EOF if source is closed.
+func (r *remoteSampleReader) closedErr(source *remoteSource) error {
+	r.mu.Lock()
+	err := r.err
+	r.mu.Unlock()
+
+	if err == nil && source.isClosed() {
+		err = io.EOF
+	}
+	return err
+}
+
+// requestKeyFrame sends a PLI, at most once per remoteKeyFrameRequestInterval.
+func (r *remoteSampleReader) requestKeyFrame() {
+	if r.rtcpWriter == nil {
+		return
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	if now.Sub(r.lastKeyFrameRequest) < remoteKeyFrameRequestInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastKeyFrameRequest = now
+	r.mu.Unlock()
+
+	if err := r.rtcpWriter.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: r.ssrc}}); err != nil {
+		logger.Debugf("failed to request a keyframe: %v", err)
+	}
+}
+
+// remoteSource is the Source of the tracks created from remote tracks.
+type remoteSource struct {
+	id      string
+	packets rtpPacketReader
+	decoder interface{ Close() error }
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (s *remoteSource) ID() string {
+	return s.id
+}
+
+func (s *remoteSource) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *remoteSource) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	// Unblock the pending read, so that the decoder can be closed
+	if deadliner, ok := s.packets.(interface{ SetReadDeadline(time.Time) error }); ok {
+		if err := deadliner.SetReadDeadline(time.Now()); err != nil {
+			return err
+		}
+	}
+	return s.decoder.Close()
+}
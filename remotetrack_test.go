@@ -0,0 +1,237 @@
+package mediadevices
+
+import (
+	"errors"
+	"image"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/wave"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// fakeRTPReader returns the given packets, and then io.EOF.
+type fakeRTPReader struct {
+	packets []*rtp.Packet
+}
+
+func (r *fakeRTPReader) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	if len(r.packets) == 0 {
+		return nil, nil, io.EOF
+	}
+	pkt := r.packets[0]
+	r.packets = r.packets[1:]
+	return pkt, nil, nil
+}
+
+type fakeRTCPWriter struct {
+	mu      sync.Mutex
+	packets []rtcp.Packet
+}
+
+func (w *fakeRTCPWriter) WriteRTCP(pkts []rtcp.Packet) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.packets = append(w.packets, pkts...)
+	return nil
+}
+
+// frameDecoder decodes every frame into a 1x1 image, whose only pixel is the first byte of the frame.
+type frameDecoder struct {
+	r io.Reader
+}
+
+func (d *frameDecoder) Read() (image.Image, func(), error) {
+	buf := make([]byte, 1500)
+	n, err := d.r.Read(buf)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	if n == 0 {
+		return nil, func() {}, errors.New("empty frame")
+	}
+	img := image.NewGray(image.Rect(0, 0, 1, 1))
+	img.Pix[0] = buf[0]
+	return img, func() {}, nil
+}
+
+func (d *frameDecoder) Close() error { return nil }
+
+type frameDecoderBuilder struct{}
+
+func (b *frameDecoderBuilder) RTPCodec() *codec.RTPCodec { return codec.NewRTPVP8Codec(90000) }
+
+func (b *frameDecoderBuilder) BuildVideoDecoder(r io.Reader, p prop.Media) (codec.VideoDecoder, error) {
+	return &frameDecoder{r: r}, nil
+}
+
+// frameAudioDecoder decodes every frame into a single sample, which is the first byte of the frame, or
+// -1 for lost frames.
+type frameAudioDecoder struct {
+	r io.Reader
+}
+
+func (d *frameAudioDecoder) Read() (wave.Audio, func(), error) {
+	buf := make([]byte, 1500)
+	n, err := d.r.Read(buf)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	chunk := wave.NewInt16Interleaved(wave.ChunkInfo{Len: 1, Channels: 1, SamplingRate: 48000})
+	chunk.Data[0] = -1
+	if n > 0 {
+		chunk.Data[0] = int16(buf[0])
+	}
+	return chunk, func() {}, nil
+}
+
+func (d *frameAudioDecoder) Close() error { return nil }
+
+type frameAudioDecoderBuilder struct{}
+
+func (b *frameAudioDecoderBuilder) RTPCodec() *codec.RTPCodec { return codec.NewRTPOpusCodec(48000) }
+
+func (b *frameAudioDecoderBuilder) BuildAudioDecoder(r io.Reader, p prop.Media) (codec.AudioDecoder, error) {
+	return &frameAudioDecoder{r: r}, nil
+}
+
+func TestNewTrackFromRTP(t *testing.T) {
+	const frames = 10
+
+	var packets []*rtp.Packet
+	for i := 0; i < frames; i++ {
+		packets = append(packets, &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         true,
+				PayloadType:    96,
+				SequenceNumber: uint16(65530 + i),
+				Timestamp:      uint32(i * 3000),
+				SSRC:           1234,
+			},
+			// VP8 payload descriptor with the start of partition bit set
+			Payload: []byte{0x10, byte(i)},
+		})
+	}
+	// The jitter buffer puts the packets back in order
+	packets[3], packets[4] = packets[4], packets[3]
+
+	rtcpWriter := &fakeRTCPWriter{}
+	selector := NewCodecSelector(WithVideoDecoders(&frameDecoderBuilder{}))
+	codecParams := webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+	}
+	track, err := newTrackFromRTP(&fakeRTPReader{packets: packets}, codecParams, 1234, "remote", "stream", selector, WithKeyFrameRequests(rtcpWriter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer track.Close()
+
+	if track.ID() != "remote" || track.StreamID() != "stream" {
+		t.Errorf("Unexpected track or stream ID: %s, %s", track.ID(), track.StreamID())
+	}
+
+	r := track.(*VideoTrack).NewReader(false)
+	var decoded []byte
+	for {
+		img, _, err := r.Read()
+		if err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			break
+		}
+		decoded = append(decoded, img.(*image.Gray).Pix[0])
+	}
+	// The last frame can't be known to be complete before the next one starts
+	if len(decoded) < frames-1 {
+		t.Fatalf("Expected at least %d frames, got %d", frames-1, len(decoded))
+	}
+	for i, b := range decoded {
+		if b != byte(i) {
+			t.Errorf("Expected frame %d, got %d", i, b)
+		}
+	}
+
+	rtcpWriter.mu.Lock()
+	defer rtcpWriter.mu.Unlock()
+	if len(rtcpWriter.packets) != 1 {
+		t.Fatalf("Expected a keyframe request when the track starts, got %v", rtcpWriter.packets)
+	}
+	if pli, ok := rtcpWriter.packets[0].(*rtcp.PictureLossIndication); !ok || pli.MediaSSRC != 1234 {
+		t.Errorf("Unexpected keyframe request: %v", rtcpWriter.packets[0])
+	}
+
+	t.Run("Audio", func(t *testing.T) {
+		var packets []*rtp.Packet
+		for i := 0; i < frames; i++ {
+			// The fifth frame is lost
+			if i == 4 {
+				continue
+			}
+			packets = append(packets, &rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					PayloadType:    111,
+					SequenceNumber: uint16(i),
+					Timestamp:      uint32(i * 960),
+					SSRC:           1234,
+				},
+				Payload: []byte{byte(i)},
+			})
+		}
+
+		selector := NewCodecSelector(WithAudioDecoders(&frameAudioDecoderBuilder{}))
+		codecParams := webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2},
+		}
+		// The gap is given up on after a few packets
+		track, err := newTrackFromRTP(&fakeRTPReader{packets: packets}, codecParams, 1234, "remote", "stream", selector, WithJitterBuffer(2, time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer track.Close()
+
+		r := track.(*AudioTrack).NewReader(false)
+		var decoded []int16
+		for {
+			chunk, _, err := r.Read()
+			if err != nil {
+				if err != io.EOF {
+					t.Fatal(err)
+				}
+				break
+			}
+			decoded = append(decoded, chunk.(*wave.Int16Interleaved).Data[0])
+		}
+		if len(decoded) < frames-1 {
+			t.Fatalf("Expected at least %d frames, got %d", frames-1, len(decoded))
+		}
+		for i, v := range decoded {
+			expected := int16(i)
+			if i == 4 {
+				expected = -1
+			}
+			if v != expected {
+				t.Errorf("Expected frame %d to be %d, got %d", i, expected, v)
+			}
+		}
+	})
+
+	t.Run("UnsupportedCodec", func(t *testing.T) {
+		codecParams := webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "video/unknown", ClockRate: 90000},
+		}
+		_, err := newTrackFromRTP(&fakeRTPReader{}, codecParams, 1234, "remote", "stream", selector)
+		if !errors.Is(err, errUnsupportedRemoteCodec) {
+			t.Errorf("Expected error: %v, got: %v", errUnsupportedRemoteCodec, err)
+		}
+	})
+}
@@ -5,28 +5,41 @@ import (
 	"time"
 )
 
-type samplerFunc func() uint32
+// samplerFunc returns the number of samples between the previous and the current encoded data,
+// given the capture time of the current one.
+type samplerFunc func(timestamp time.Time) uint32
 
-// newVideoSampler creates a video sampler that uses the actual video frame rate and
-// the codec's clock rate to come up with a duration for each sample.
+// newVideoSampler creates a video sampler that uses the capture timestamps of the video frames and
+// the codec's clock rate to come up with a duration for each sample. The samples are derived from
+// the time elapsed since the first frame, so that rounding errors don't accumulate.
 func newVideoSampler(clockRate uint32) samplerFunc {
 	clockRateFloat := float64(clockRate)
-	lastTimestamp := time.Now()
+	var first time.Time
+	var lastSamples int64
 
-	return samplerFunc(func() uint32 {
-		now := time.Now()
-		duration := now.Sub(lastTimestamp).Seconds()
-		samples := uint32(math.Round(clockRateFloat * duration))
-		lastTimestamp = now
-		return samples
+	return samplerFunc(func(timestamp time.Time) uint32 {
+		if first.IsZero() {
+			first = timestamp
+		}
+
+		totalSamples := int64(math.Round(clockRateFloat * timestamp.Sub(first).Seconds()))
+		samples := totalSamples - lastSamples
+		if samples < 0 {
+			// Timestamps must be monotonic. Keep the RTP timestamp as it is if they're not.
+			return 0
+		}
+		lastSamples = totalSamples
+		return uint32(samples)
 	})
 }
 
 // newAudioSampler creates a audio sampler that uses a fixed latency and
 // the codec's clock rate to come up with a duration for each sample.
+// Audio codecs encode fixed size frames, so the latency is more accurate than
+// the capture timestamps.
 func newAudioSampler(clockRate uint32, latency time.Duration) samplerFunc {
 	samples := uint32(math.Round(float64(clockRate) * latency.Seconds()))
-	return samplerFunc(func() uint32 {
+	return samplerFunc(func(time.Time) uint32 {
 		return samples
 	})
 }
@@ -0,0 +1,29 @@
+package mediadevices
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVideoSampler(t *testing.T) {
+	sample := newVideoSampler(90000)
+	base := time.Unix(1000, 0)
+
+	if samples := sample(base); samples != 0 {
+		t.Errorf("Expected the first frame to have 0 samples, got %d", samples)
+	}
+
+	// 30 fps doesn't divide the clock rate evenly, the rounding errors must not accumulate
+	var total uint32
+	for i := 1; i <= 300; i++ {
+		total += sample(base.Add(time.Duration(i) * time.Second / 30))
+	}
+	if total != 900000 {
+		t.Errorf("Expected 900000 samples in 10 seconds, got %d", total)
+	}
+
+	// Timestamps that go backwards don't move the RTP timestamp
+	if samples := sample(base); samples != 0 {
+		t.Errorf("Expected 0 samples, got %d", samples)
+	}
+}
@@ -0,0 +1,236 @@
+package mediadevices
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+// NotFoundError is returned when there's no device of the requested kind.
+// Reference: https://w3c.github.io/mediacapture-main/#dom-mediadevices-getusermedia
+type NotFoundError struct{}
+
+func (e *NotFoundError) Error() string {
+	return "failed to find a device of the requested kind"
+}
+
+// OverconstrainedError is returned when no settings of the devices satisfy the constraints.
+// Reference: https://w3c.github.io/mediacapture-main/#overconstrainederror-interface
+type OverconstrainedError struct {
+	// Constraint is the name of a constraint that can't be satisfied, e.g. "Width". It's empty if the
+	// constraints can only be satisfied on their own, but not along with the constraints of the other
+	// tracks that are recording from the device.
+	Constraint string
+}
+
+func (e *OverconstrainedError) Error() string {
+	if e.Constraint == "" {
+		return "no settings satisfy the constraints along with the other tracks of the device"
+	}
+	return fmt.Sprintf("no settings satisfy the %s constraint", e.Constraint)
+}
+
+// NotReadableError is returned when a device fits the constraints, but it can't be opened.
+// Reference: https://w3c.github.io/mediacapture-main/#dom-mediadevices-getusermedia
+type NotReadableError struct {
+	Err error
+}
+
+func (e *NotReadableError) Error() string {
+	return fmt.Sprintf("failed to open the device: %v", e.Err)
+}
+
+func (e *NotReadableError) Unwrap() error {
+	return e.Err
+}
+
+// SelectionCandidate is a set of properties of a device that's considered to be selected for a track.
+type SelectionCandidate struct {
+	DeviceID string
+	Label    string
+	// Properties are the properties of the device. Settings are the properties that the track would
+	// have, which are made from Properties by cropping, scaling down or dropping frames if they fit
+	// better.
+	Properties prop.Media
+	Settings   prop.Media
+	// Fitness is the fitness distance of Settings to each of the constraints. FitnessDistance is their
+	// sum minus the priority of the device, or +Inf if the candidate is rejected.
+	Fitness         []prop.ConstraintFitness
+	FitnessDistance float64
+	// Rejected is true if the candidate can't be selected, for the reason in Reason.
+	Rejected bool
+	Reason   string
+	// Selected is true for the candidate that's selected.
+	Selected bool
+
+	driver      driver.Driver
+	transformed bool
+}
+
+// SelectionExplanation explains how a device is selected for a track. The candidate with the lowest
+// fitness distance is selected. On ties, the candidates that don't have to be transformed are preferred,
+// and then the first one.
+type SelectionExplanation struct {
+	Kind MediaDeviceType
+	// Candidates are the properties of the devices, in the order that they were registered and that
+	// the devices list them.
+	Candidates []SelectionCandidate
+	// Err is the error that the selection fails with, if it does.
+	Err error
+}
+
+// ExplainSelection explains how GetUserMedia would select the devices for constraints, without
+// recording from them.
+func ExplainSelection(constraints MediaStreamConstraints) []SelectionExplanation {
+	var explanations []SelectionExplanation
+	if constraints.Video != nil {
+		explanation := explainSelection(videoInputFilter(), constraintsOf(constraints.Video))
+		explanation.Kind = VideoInput
+		explanations = append(explanations, explanation)
+	}
+	if constraints.Audio != nil {
+		explanation := explainSelection(audioInputFilter(), constraintsOf(constraints.Audio))
+		explanation.Kind = AudioInput
+		explanations = append(explanations, explanation)
+	}
+	return explanations
+}
+
+// explainSelection evaluates the properties of the drivers that filter matches against constraints,
+// and selects the best one.
+func explainSelection(filter driver.FilterFn, constraints MediaTrackConstraints) SelectionExplanation {
+	var explanation SelectionExplanation
+	var errOpen error
+	best := -1
+
+	for _, properties := range queryDriverProperties(filter) {
+		d := properties.driver
+		if properties.err != nil {
+			explanation.Candidates = append(explanation.Candidates, SelectionCandidate{
+				DeviceID:        d.ID(),
+				Label:           d.Info().Label,
+				FitnessDistance: math.Inf(1),
+				Rejected:        true,
+				Reason:          fmt.Sprintf("failed to open: %v", properties.err),
+				driver:          d,
+			})
+			if errOpen == nil {
+				errOpen = properties.err
+			}
+			continue
+		}
+
+		// Video can also be made from the properties of the driver by cropping, scaling down, and
+		// dropping frames, which the track does if they fit better
+		derive := func(p prop.Media, _ prop.MediaConstraints) prop.Media { return p }
+		if driver.FilterVideoRecorder()(d) {
+			derive = deriveVideoSettings
+		}
+		for _, p := range properties.properties {
+			candidate := evaluateCandidate(d, p, properties.controls, constraints, derive)
+			if !candidate.Rejected && (best < 0 || candidate.betterThan(explanation.Candidates[best])) {
+				best = len(explanation.Candidates)
+			}
+			explanation.Candidates = append(explanation.Candidates, candidate)
+		}
+	}
+
+	switch {
+	case best >= 0:
+		explanation.Candidates[best].Selected = true
+	case slices.ContainsFunc(explanation.Candidates, func(c SelectionCandidate) bool { return c.Fitness != nil }):
+		explanation.Err = overconstrained(explanation.Candidates)
+	case errOpen != nil:
+		explanation.Err = &NotReadableError{Err: errOpen}
+	default:
+		explanation.Err = &NotFoundError{}
+	}
+	return explanation
+}
+
+// evaluateCandidate evaluates p of d, which has controls, against constraints.
+func evaluateCandidate(d driver.Driver, p prop.Media, controls []driver.Control, constraints MediaTrackConstraints, derive func(prop.Media, prop.MediaConstraints) prop.Media) SelectionCandidate {
+	dist, transformed, ok := fitness(p, constraints, derive)
+	candidate := SelectionCandidate{
+		DeviceID:        d.ID(),
+		Label:           d.Info().Label,
+		Properties:      p,
+		Settings:        p,
+		FitnessDistance: dist - float64(d.Info().Priority),
+		driver:          d,
+		transformed:     transformed,
+	}
+	// The settings that come closest are explained for the rejected candidates
+	if transformed || !ok {
+		candidate.Settings = derive(p, constraints.MediaConstraints)
+	}
+	candidate.Fitness = constraints.MediaConstraints.FitnessDistances(candidate.Settings)
+	// The controls don't add to the fitness distance, but the device is rejected if it can't satisfy them
+	var errOverconstrained *OverconstrainedError
+	if _, err := selectControls(controls, constraints.MediaConstraints); errors.As(err, &errOverconstrained) {
+		candidate.Fitness = append(candidate.Fitness, prop.ConstraintFitness{Constraint: errOverconstrained.Constraint, Distance: math.Inf(1)})
+		ok = false
+	}
+	if ok {
+		return candidate
+	}
+
+	candidate.FitnessDistance = math.Inf(1)
+	candidate.Rejected = true
+	candidate.Reason = "the constraints aren't satisfied"
+	if passthroughOnly(p.FrameFormat) && constraints.FrameFormat == nil {
+		candidate.Reason = fmt.Sprintf("%s frames are only selected by a FrameFormat constraint", p.FrameFormat)
+		return candidate
+	}
+	for _, f := range candidate.Fitness {
+		if !f.Satisfied {
+			candidate.Reason = fmt.Sprintf("%s isn't satisfied", f.Constraint)
+			break
+		}
+	}
+	return candidate
+}
+
+func (c *SelectionCandidate) betterThan(o SelectionCandidate) bool {
+	if c.FitnessDistance != o.FitnessDistance {
+		return c.FitnessDistance < o.FitnessDistance
+	}
+	return o.transformed && !c.transformed
+}
+
+// overconstrained returns the error for candidates that can't be selected. The failing constraint is
+// the first one that no candidate satisfies along with the constraints before it.
+func overconstrained(candidates []SelectionCandidate) *OverconstrainedError {
+	var remaining [][]prop.ConstraintFitness
+	var names []string
+	for _, c := range candidates {
+		if c.Fitness == nil {
+			continue
+		}
+		if !c.Rejected {
+			// The constraints can be satisfied, so they conflict with something else
+			return &OverconstrainedError{}
+		}
+		remaining = append(remaining, c.Fitness)
+		for _, f := range c.Fitness {
+			if !slices.Contains(names, f.Constraint) {
+				names = append(names, f.Constraint)
+			}
+		}
+	}
+
+	for _, name := range names {
+		remaining = slices.DeleteFunc(remaining, func(fitness []prop.ConstraintFitness) bool {
+			i := slices.IndexFunc(fitness, func(f prop.ConstraintFitness) bool { return f.Constraint == name })
+			return i >= 0 && !fitness[i].Satisfied
+		})
+		if len(remaining) == 0 {
+			return &OverconstrainedError{Constraint: name}
+		}
+	}
+	return &OverconstrainedError{}
+}
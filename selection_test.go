@@ -0,0 +1,144 @@
+package mediadevices
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+var errBrokenCamera = errors.New("camera is broken")
+
+type brokenCamera struct{ fakeCamera }
+
+func (c *brokenCamera) Open() error { return errBrokenCamera }
+
+func TestExplainSelection(t *testing.T) {
+	t.Run("Selected", func(t *testing.T) {
+		d, _ := registerFakeCamera(t)
+		explanations := ExplainSelection(MediaStreamConstraints{
+			Video: func(c *MediaTrackConstraints) {
+				c.DeviceID = prop.StringExact(d.ID())
+				c.Width = prop.Int(320)
+			},
+		})
+		if len(explanations) != 1 || explanations[0].Kind != VideoInput {
+			t.Fatalf("Expected the explanation of the video, got %v", explanations)
+		}
+		explanation := explanations[0]
+		if explanation.Err != nil {
+			t.Fatal(explanation.Err)
+		}
+
+		var selected []SelectionCandidate
+		for _, c := range explanation.Candidates {
+			if c.Selected {
+				selected = append(selected, c)
+			}
+			if c.DeviceID != d.ID() && (!c.Rejected || c.Reason != "DeviceID isn't satisfied") {
+				t.Errorf("Expected the other devices to be rejected by DeviceID, got %+v", c)
+			}
+		}
+		// The camera can also scale 640x480 down, but it's preferred not to
+		if len(selected) != 1 || selected[0].DeviceID != d.ID() || selected[0].Properties.Width != 320 {
+			t.Errorf("Expected the 320x240 properties of the camera to be selected, got %+v", selected)
+		}
+	})
+
+	t.Run("Transformed", func(t *testing.T) {
+		d, _ := registerFakeCamera(t)
+		explanation := explainSelection(driver.FilterID(d.ID()), constraintsOf(func(c *MediaTrackConstraints) {
+			c.Width = prop.IntExact(480)
+		}))
+		if explanation.Err != nil {
+			t.Fatal(explanation.Err)
+		}
+		if len(explanation.Candidates) != 2 {
+			t.Fatalf("Expected 2 candidates, got %d", len(explanation.Candidates))
+		}
+
+		candidate := explanation.Candidates[0]
+		if !candidate.Selected || candidate.Properties.Width != 640 || candidate.Settings.Width != 480 || candidate.Settings.Height != 360 {
+			t.Errorf("Expected 640x480 to be selected and scaled down, got %+v", candidate)
+		}
+		expected := []prop.ConstraintFitness{{Constraint: "Width", Distance: 0, Satisfied: true}}
+		if !slices.Equal(candidate.Fitness, expected) {
+			t.Errorf("Expected fitness %v, got %v", expected, candidate.Fitness)
+		}
+		if c := explanation.Candidates[1]; !c.Rejected || c.Reason != "Width isn't satisfied" {
+			t.Errorf("Expected 320x240 to be rejected by Width, got %+v", c)
+		}
+	})
+
+	t.Run("Overconstrained", func(t *testing.T) {
+		d, _ := registerFakeCamera(t)
+		explanation := explainSelection(driver.FilterID(d.ID()), constraintsOf(func(c *MediaTrackConstraints) {
+			c.Width = prop.IntExact(320)
+			c.FrameRate = prop.FloatExact(60)
+		}))
+
+		var errOverconstrained *OverconstrainedError
+		if !errors.As(explanation.Err, &errOverconstrained) || errOverconstrained.Constraint != "FrameRate" {
+			t.Errorf("Expected the FrameRate constraint to be overconstrained, got %v", explanation.Err)
+		}
+		for _, c := range explanation.Candidates {
+			if !c.Rejected || c.Selected {
+				t.Errorf("Expected every candidate to be rejected, got %+v", c)
+			}
+		}
+	})
+
+	t.Run("NotReadable", func(t *testing.T) {
+		if err := driver.GetManager().Register(&brokenCamera{}, driver.Info{Label: t.Name(), DeviceType: driver.Camera}); err != nil {
+			t.Fatal(err)
+		}
+		drivers := driver.GetManager().Query(func(d driver.Driver) bool { return d.Info().Label == t.Name() })
+		defer driver.GetManager().Delete(drivers[0].ID())
+
+		explanation := explainSelection(driver.FilterID(drivers[0].ID()), MediaTrackConstraints{})
+		var errNotReadable *NotReadableError
+		if !errors.As(explanation.Err, &errNotReadable) || !errors.Is(explanation.Err, errBrokenCamera) {
+			t.Errorf("Expected the camera to be not readable, got %v", explanation.Err)
+		}
+		if len(explanation.Candidates) != 1 || !strings.Contains(explanation.Candidates[0].Reason, errBrokenCamera.Error()) {
+			t.Errorf("Expected the camera to be rejected for failing to open, got %+v", explanation.Candidates)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		explanation := explainSelection(driver.FilterID("unknown"), MediaTrackConstraints{})
+		var errNotFound *NotFoundError
+		if !errors.As(explanation.Err, &errNotFound) {
+			t.Errorf("Expected no device to be found, got %v", explanation.Err)
+		}
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		var ids []string
+		for i := 0; i < 5; i++ {
+			label := fmt.Sprintf("%s%d", t.Name(), i)
+			if err := driver.GetManager().Register(&fakeCamera{}, driver.Info{Label: label, DeviceType: driver.Camera}); err != nil {
+				t.Fatal(err)
+			}
+			d := driver.GetManager().Query(func(d driver.Driver) bool { return d.Info().Label == label })[0]
+			ids = append(ids, d.ID())
+			defer driver.GetManager().Delete(d.ID())
+		}
+		filter := func(d driver.Driver) bool { return strings.HasPrefix(d.Info().Label, t.Name()) }
+
+		// The cameras fit equally well, so the first registered one is selected
+		for i := 0; i < 10; i++ {
+			d, _, err := selectBestDriver(filter, MediaTrackConstraints{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.ID() != ids[0] {
+				t.Fatalf("Expected the first camera to be selected, got %s", d.Info().Label)
+			}
+		}
+	})
+}
@@ -0,0 +1,496 @@
+package mediadevices
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/mediadevices/internal/bitstream"
+	"github.com/pion/mediadevices/pkg/codec"
+	mio "github.com/pion/mediadevices/pkg/io"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	defaultSharedEncodingFallbackRatio = 0.5
+	// rtpHeaderSize is the size of the RTP headers without CSRCs and extensions, which the shared
+	// payloads leave room for
+	rtpHeaderSize = 12
+)
+
+var errInvalidSharedEncodingFallbackRatio = errors.New("shared encoding fallback ratio must be less than 1")
+
+// SharedBitRatePolicy defines how the bitrate of a shared encoder follows the bandwidth estimates of its
+// peer connections.
+type SharedBitRatePolicy int
+
+// SharedBitRatePolicy definitions.
+const (
+	// SharedBitRateMin gives the encoder the lowest estimate, so that none of the peer connections is
+	// congested.
+	SharedBitRateMin SharedBitRatePolicy = iota
+	// SharedBitRateFallback moves the peer connections whose estimates are too low for the others to
+	// encoders of their own, like the lower layers of simulcast. The shared encoder gets the lowest
+	// estimate of the rest.
+	SharedBitRateFallback
+)
+
+// SharedEncoding configures a track to share its encoders between the peer connections that it's bound
+// to. The peer connections that negotiate the same codec and format parameters read from one encoder,
+// and each of them packetizes its output with its own SSRC, sequence numbers and payload type. Their key
+// frame requests are coalesced, and a key frame is forced whenever a peer connection joins. A peer connection
+// that falls too far behind the others to get every frame skips to the next key frame, which is forced too.
+type SharedEncoding struct {
+	// BitRatePolicy configures how the bitrate follows the estimates of the peer connections, when bitrate
+	// adaptation is enabled with SetBitRateAdaptation. The default value is SharedBitRateMin.
+	BitRatePolicy SharedBitRatePolicy
+	// FallbackRatio is used by SharedBitRateFallback. The peer connections whose estimates are lower than
+	// FallbackRatio of the highest one fall back to encoders of their own, until their estimates recover.
+	// The default value is 0.5.
+	FallbackRatio float64
+}
+
+// SetSharedEncoding enables shared encoding for the following Bind calls. Passing nil disables it.
+func (track *baseTrack) SetSharedEncoding(config *SharedEncoding) error {
+	if config != nil {
+		if config.FallbackRatio >= 1 {
+			return errInvalidSharedEncodingFallbackRatio
+		}
+
+		c := *config
+		if c.FallbackRatio <= 0 {
+			c.FallbackRatio = defaultSharedEncodingFallbackRatio
+		}
+		config = &c
+	}
+
+	track.sharedEncodersMu.Lock()
+	defer track.sharedEncodersMu.Unlock()
+	track.sharedEncoding = config
+	return nil
+}
+
+// encodedReaderFactory is a track that can make encoders, which VideoTrack and AudioTrack are. fmtp is the
+// format parameters that the peer connection negotiated.
+type encodedReaderFactory interface {
+	newEncodedReader(fmtp string, codecNames ...string) (EncodedReadCloser, *codec.RTPCodec, error)
+	newPacketizedReader(fmtp, codecName string, ssrc uint32, mtu int) (RTPReadCloser, error)
+}
+
+// newRTPReader makes the reader of a peer connection that negotiated wantedCodec. The encoder is shared
+// with the other peer connections if shared encoding is enabled.
+func (track *baseTrack) newRTPReader(specializedTrack Track, wantedCodec webrtc.RTPCodecParameters, ssrc uint32) (RTPReadCloser, error) {
+	track.sharedEncodersMu.Lock()
+	config := track.sharedEncoding
+	track.sharedEncodersMu.Unlock()
+
+	factory, ok := specializedTrack.(encodedReaderFactory)
+	if !ok {
+		return specializedTrack.NewRTPReader(wantedCodec.MimeType, ssrc, rtpOutboundMTU)
+	}
+	if config == nil {
+		return factory.newPacketizedReader(wantedCodec.SDPFmtpLine, wantedCodec.MimeType, ssrc, rtpOutboundMTU)
+	}
+	return track.newSharedRTPReader(factory, *config, wantedCodec, ssrc)
+}
+
+// newSharedRTPReader joins the shared encoder of wantedCodec, which is started if it's the first peer
+// connection to negotiate it.
+func (track *baseTrack) newSharedRTPReader(factory encodedReaderFactory, config SharedEncoding, wantedCodec webrtc.RTPCodecParameters, ssrc uint32) (RTPReadCloser, error) {
+	key := strings.ToLower(wantedCodec.MimeType) + ";" + wantedCodec.SDPFmtpLine
+
+	track.sharedEncodersMu.Lock()
+	defer track.sharedEncodersMu.Unlock()
+
+	e, ok := track.sharedEncoders[key]
+	if !ok {
+		reader, selectedCodec, err := factory.newEncodedReader(wantedCodec.SDPFmtpLine, wantedCodec.MimeType)
+		if err != nil {
+			return nil, err
+		}
+		e = newSharedEncoder(track, key, config, reader, selectedCodec)
+		if track.sharedEncoders == nil {
+			track.sharedEncoders = make(map[string]*sharedEncoder)
+		}
+		track.sharedEncoders[key] = e
+	}
+
+	p := &sharedPeer{
+		encoder:     e,
+		factory:     factory,
+		mimeType:    wantedCodec.MimeType,
+		fmtp:        wantedCodec.SDPFmtpLine,
+		ssrc:        ssrc,
+		payloadType: uint8(wantedCodec.PayloadType),
+		sequencer:   rtp.NewRandomSequencer(),
+		timestamp:   rand.Uint32(),
+	}
+	if track.kind == VideoInput {
+		p.sample = newVideoSampler(e.codec.ClockRate)
+	}
+	e.join(p)
+	return p, nil
+}
+
+// sharedFrame is an encoded frame that's payloaded once for all the peer connections.
+type sharedFrame struct {
+	payloads [][]byte
+	buffer   EncodedBuffer
+	// count is the number of the frame in the output of the encoder, which tells the peer connections
+	// whether they missed frames
+	count    uint64
+	keyFrame bool
+}
+
+// sharedEncoder is an encoder whose output is read by many peer connections.
+type sharedEncoder struct {
+	track       *baseTrack
+	key         string
+	config      SharedEncoding
+	reader      EncodedReadCloser
+	codec       *codec.RTPCodec
+	broadcaster *mio.Broadcaster
+	// keyFramePending coalesces the key frame requests until the next frame
+	keyFramePending atomic.Bool
+
+	mu sync.Mutex
+	// peers are the peer connections that are reading the encoder, with their bandwidth estimates
+	peers   map[*sharedPeer]int
+	bitRate int
+}
+
+func newSharedEncoder(track *baseTrack, key string, config SharedEncoding, reader EncodedReadCloser, selectedCodec *codec.RTPCodec) *sharedEncoder {
+	e := &sharedEncoder{
+		track:  track,
+		key:    key,
+		config: config,
+		reader: reader,
+		codec:  selectedCodec,
+		peers:  make(map[*sharedPeer]int),
+	}
+	// The frames of the codecs that can't be parsed, e.g. audio, are all taken as key frames
+	isKeyFrame := bitstream.KeyFrameDetector(selectedCodec.MimeType)
+	// The broadcaster reads the encoder from 1 goroutine at a time
+	var count uint64
+	e.broadcaster = mio.NewBroadcaster(mio.ReaderFunc(func() (any, func(), error) {
+		buffer, release, err := reader.Read()
+		e.keyFramePending.Store(false)
+		if err != nil {
+			return nil, func() {}, err
+		}
+		defer release()
+
+		count++
+		frame := sharedFrame{
+			payloads: selectedCodec.Payload(rtpOutboundMTU-rtpHeaderSize, buffer.Data),
+			count:    count,
+			keyFrame: isKeyFrame == nil || isKeyFrame(buffer.Data),
+		}
+		buffer.Data = nil
+		frame.buffer = buffer
+		return frame, func() {}, nil
+	}), nil)
+	return e
+}
+
+// join adds p to the peer connections, which is given a key frame to start with.
+func (e *sharedEncoder) join(p *sharedPeer) {
+	e.mu.Lock()
+	e.peers[p] = 0
+	e.mu.Unlock()
+
+	p.readShared(e.broadcaster.NewReader(func(data any) any { return data }))
+	if err := e.forceKeyFrame(); err != nil {
+		logger.Warnf("failed to force key frame: %s", err)
+	}
+}
+
+// leave removes p from the peer connections. The encoder is closed when the last one leaves.
+func (e *sharedEncoder) leave(p *sharedPeer) error {
+	e.track.sharedEncodersMu.Lock()
+	e.mu.Lock()
+	delete(e.peers, p)
+	last := len(e.peers) == 0
+	if last && e.track.sharedEncoders[e.key] == e {
+		delete(e.track.sharedEncoders, e.key)
+	}
+	e.mu.Unlock()
+	e.track.sharedEncodersMu.Unlock()
+
+	if last {
+		return e.reader.Close()
+	}
+	e.updateBitRate()
+	return nil
+}
+
+// forceKeyFrame asks the encoder for a key frame, unless it's been asked since the last frame.
+func (e *sharedEncoder) forceKeyFrame() error {
+	keyFrameController, ok := e.reader.Controller().(codec.KeyFrameController)
+	if !ok || !e.keyFramePending.CompareAndSwap(false, true) {
+		return nil
+	}
+	return keyFrameController.ForceKeyFrame()
+}
+
+// setEstimate updates the bandwidth estimate of p, and the bitrate of the encoder.
+func (e *sharedEncoder) setEstimate(p *sharedPeer, bitRate int) {
+	e.mu.Lock()
+	if _, ok := e.peers[p]; ok {
+		e.peers[p] = bitRate
+	}
+	e.mu.Unlock()
+	e.updateBitRate()
+}
+
+// updateBitRate applies the bitrate policy to the estimates of the peer connections.
+func (e *sharedEncoder) updateBitRate() {
+	e.mu.Lock()
+	var highest int
+	for _, estimate := range e.peers {
+		highest = max(highest, estimate)
+	}
+	var bitRate int
+	for p, estimate := range e.peers {
+		fallback := e.config.BitRatePolicy == SharedBitRateFallback && estimate > 0 &&
+			float64(estimate) < e.config.FallbackRatio*float64(highest)
+		p.fallback.Store(fallback)
+		if !fallback && estimate > 0 && (bitRate == 0 || estimate < bitRate) {
+			bitRate = estimate
+		}
+	}
+	changed := bitRate > 0 && bitRate != e.bitRate
+	if changed {
+		e.bitRate = bitRate
+	}
+	e.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if bitRateController, ok := e.reader.Controller().(codec.BitRateController); ok {
+		if err := bitRateController.SetBitRate(bitRate); err != nil {
+			logger.Warnf("failed to set the bitrate of the shared encoder: %s", err)
+		}
+	}
+}
+
+// sharedPeer is the RTP reader of a peer connection that reads a shared encoder, or an encoder of its
+// own while it falls back. It's also the encoder controller of the peer connection.
+type sharedPeer struct {
+	encoder     *sharedEncoder
+	factory     encodedReaderFactory
+	mimeType    string
+	fmtp        string
+	ssrc        uint32
+	payloadType uint8
+	sequencer   rtp.Sequencer
+	// timestamp is the RTP timestamp of the next frame
+	timestamp uint32
+	// sample is nil for audio, whose frames tell their samples
+	sample samplerFunc
+	// fallback tells whether the peer connection should read an encoder of its own
+	fallback atomic.Bool
+
+	// shared, lastCount and waitKeyFrame are only used by the reading goroutine
+	shared mio.Reader
+	// lastCount is the count of the last shared frame that was read
+	lastCount uint64
+	// waitKeyFrame tells whether the shared frames are skipped until the next key frame, since the ones
+	// before it can't be decoded
+	waitKeyFrame bool
+
+	mu       sync.Mutex
+	own      EncodedReadCloser
+	ownCodec *codec.RTPCodec
+	closed   bool
+}
+
+func (p *sharedPeer) Read() ([]*rtp.Packet, func(), error) {
+	if err := p.switchEncoder(); err != nil {
+		p.encoder.track.onError(err)
+		return nil, func() {}, err
+	}
+
+	p.mu.Lock()
+	own, ownCodec, closed := p.own, p.ownCodec, p.closed
+	p.mu.Unlock()
+	if closed {
+		return nil, func() {}, io.EOF
+	}
+
+	var payloads [][]byte
+	var buffer EncodedBuffer
+	if own != nil {
+		var release func()
+		var err error
+		buffer, release, err = own.Read()
+		if err != nil {
+			p.encoder.track.onError(err)
+			return nil, func() {}, err
+		}
+		payloads = ownCodec.Payload(rtpOutboundMTU-rtpHeaderSize, buffer.Data)
+		release()
+	} else {
+		frame, err := p.readSharedFrame()
+		if err != nil {
+			p.encoder.track.onError(err)
+			return nil, func() {}, err
+		}
+		payloads, buffer = frame.payloads, frame.buffer
+	}
+
+	return p.packetize(payloads, buffer), func() {}, nil
+}
+
+// readShared starts reading the shared encoder from r, from the next key frame.
+func (p *sharedPeer) readShared(r mio.Reader) {
+	p.shared = r
+	p.lastCount = 0
+	p.waitKeyFrame = true
+}
+
+// readSharedFrame reads the next frame of the shared encoder that can be decoded. The broadcaster skips
+// the frames that a reader is too late for, so when frames are missed, a key frame is forced and the
+// frames are skipped until it comes.
+func (p *sharedPeer) readSharedFrame() (sharedFrame, error) {
+	for {
+		data, release, err := p.shared.Read()
+		if err != nil {
+			return sharedFrame{}, err
+		}
+		frame := data.(sharedFrame)
+		release()
+
+		if p.lastCount != 0 && frame.count != p.lastCount+1 && !p.waitKeyFrame {
+			logger.Debugf("missed %d shared frames, waiting for a key frame", frame.count-p.lastCount-1)
+			p.waitKeyFrame = true
+			if err := p.encoder.forceKeyFrame(); err != nil {
+				logger.Warnf("failed to force key frame: %s", err)
+			}
+		}
+		p.lastCount = frame.count
+		if p.waitKeyFrame && !frame.keyFrame {
+			continue
+		}
+		p.waitKeyFrame = false
+		return frame, nil
+	}
+}
+
+// packetize makes the packets of the payloads of a frame.
+func (p *sharedPeer) packetize(payloads [][]byte, buffer EncodedBuffer) []*rtp.Packet {
+	samples := buffer.Samples
+	if p.sample != nil {
+		// The frames that the peer connection skips, or the ones of another encoder, are taken into account
+		samples = p.sample(buffer.Timestamp)
+	}
+	pkts := make([]*rtp.Packet, len(payloads))
+	for i, payload := range payloads {
+		pkts[i] = &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         i == len(payloads)-1,
+				PayloadType:    p.payloadType,
+				SequenceNumber: p.sequencer.NextSequenceNumber(),
+				Timestamp:      p.timestamp,
+				SSRC:           p.ssrc,
+			},
+			Payload: payload,
+		}
+	}
+	p.timestamp += samples
+	return pkts
+}
+
+// switchEncoder starts or stops the encoder of the peer connection's own, if the bitrate policy has
+// moved it.
+func (p *sharedPeer) switchEncoder() error {
+	fallback := p.fallback.Load()
+	p.mu.Lock()
+	own := p.own
+	p.mu.Unlock()
+	if fallback == (own != nil) {
+		return nil
+	}
+
+	if fallback {
+		reader, selectedCodec, err := p.factory.newEncodedReader(p.fmtp, p.mimeType)
+		if err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.own, p.ownCodec = reader, selectedCodec
+		p.mu.Unlock()
+		return nil
+	}
+
+	p.mu.Lock()
+	p.own, p.ownCodec = nil, nil
+	p.mu.Unlock()
+	// The shared encoder is read from its next frame, which has to be a key frame
+	p.readShared(p.encoder.broadcaster.NewReader(func(data any) any { return data }))
+	if err := p.encoder.forceKeyFrame(); err != nil {
+		logger.Warnf("failed to force key frame: %s", err)
+	}
+	return own.Close()
+}
+
+func (p *sharedPeer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	own := p.own
+	p.own = nil
+	p.mu.Unlock()
+
+	if own != nil {
+		own.Close()
+	}
+	return p.encoder.leave(p)
+}
+
+func (p *sharedPeer) Controller() codec.EncoderController {
+	return p
+}
+
+// ForceKeyFrame implements codec.KeyFrameController. The requests of the peer connections that share
+// the encoder are coalesced.
+func (p *sharedPeer) ForceKeyFrame() error {
+	p.mu.Lock()
+	own := p.own
+	p.mu.Unlock()
+
+	if own != nil {
+		if keyFrameController, ok := own.Controller().(codec.KeyFrameController); ok {
+			return keyFrameController.ForceKeyFrame()
+		}
+		return nil
+	}
+	return p.encoder.forceKeyFrame()
+}
+
+// SetBitRate implements codec.BitRateController. It sets the bandwidth estimate of the peer connection,
+// which the bitrate policy follows.
+func (p *sharedPeer) SetBitRate(bitRate int) error {
+	p.mu.Lock()
+	own := p.own
+	p.mu.Unlock()
+
+	if own != nil {
+		if bitRateController, ok := own.Controller().(codec.BitRateController); ok {
+			if err := bitRateController.SetBitRate(bitRate); err != nil {
+				return err
+			}
+		}
+	}
+	p.encoder.setEstimate(p, bitRate)
+	return nil
+}
@@ -0,0 +1,279 @@
+package mediadevices
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// controllableEncoderBuilder builds encoders that count their key frames, and record their bitrates. The
+// encoders only make a VP8 key frame when it's forced, or for the first frame.
+type controllableEncoderBuilder struct {
+	mu       sync.Mutex
+	encoders []*controllableEncoder
+}
+
+func (b *controllableEncoderBuilder) RTPCodec() *codec.RTPCodec { return codec.NewRTPVP8Codec(90000) }
+
+func (b *controllableEncoderBuilder) BuildVideoEncoder(r video.Reader, p prop.Media) (codec.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := &controllableEncoder{r: r}
+	b.encoders = append(b.encoders, e)
+	return e, nil
+}
+
+func (b *controllableEncoderBuilder) built() []*controllableEncoder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.encoders
+}
+
+type controllableEncoder struct {
+	r video.Reader
+
+	mu        sync.Mutex
+	frames    int
+	forced    bool
+	keyFrames int
+	bitRate   int
+	closed    bool
+}
+
+func (e *controllableEncoder) Read() ([]byte, func(), error) {
+	if _, _, err := e.r.Read(); err != nil {
+		return nil, func() {}, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	keyFrame := e.frames == 0 || e.forced
+	e.frames++
+	e.forced = false
+	if keyFrame {
+		return []byte{0x10, 0, 0}, func() {}, nil
+	}
+	return []byte{0x11, 0, 0}, func() {}, nil
+}
+
+func (e *controllableEncoder) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	return nil
+}
+
+func (e *controllableEncoder) Controller() codec.EncoderController { return e }
+
+func (e *controllableEncoder) ForceKeyFrame() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keyFrames++
+	e.forced = true
+	return nil
+}
+
+func (e *controllableEncoder) SetBitRate(bitRate int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.bitRate = bitRate
+	return nil
+}
+
+func (e *controllableEncoder) state() (keyFrames, bitRate int, closed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.keyFrames, e.bitRate, e.closed
+}
+
+func newSharedEncodingTrack(t *testing.T, config SharedEncoding) (*VideoTrack, *controllableEncoderBuilder) {
+	t.Helper()
+
+	builder := &controllableEncoderBuilder{}
+	d, _ := registerFakeCamera(t)
+	track := newFakeCameraTrack(t, d, NewCodecSelector(WithVideoEncoders(builder)), func(c *MediaTrackConstraints) {})
+	if err := track.SetSharedEncoding(&config); err != nil {
+		t.Fatal(err)
+	}
+	return track, builder
+}
+
+func vp8Parameters(payloadType webrtc.PayloadType) webrtc.RTPCodecParameters {
+	return webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		PayloadType:        payloadType,
+	}
+}
+
+func TestSharedEncoding(t *testing.T) {
+	track, builder := newSharedEncodingTrack(t, SharedEncoding{})
+
+	first, err := track.newRTPReader(track, vp8Parameters(96), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := track.newRTPReader(track, vp8Parameters(97), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(builder.built()); n != 1 {
+		t.Fatalf("Expected the peer connections to share an encoder, got %d encoders", n)
+	}
+	encoder := builder.built()[0]
+	// The key frame for the second peer connection is coalesced with the one of the first
+	if keyFrames, _, _ := encoder.state(); keyFrames != 1 {
+		t.Errorf("Expected 1 key frame to be forced, got %d", keyFrames)
+	}
+
+	for _, c := range []struct {
+		reader      RTPReadCloser
+		ssrc        uint32
+		payloadType uint8
+	}{{first, 1, 96}, {second, 2, 97}} {
+		pkts, _, err := c.reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pkts) != 1 || pkts[0].SSRC != c.ssrc || pkts[0].PayloadType != c.payloadType || !pkts[0].Marker {
+			t.Errorf("Expected a marked packet of SSRC %d and payload type %d, got %v", c.ssrc, c.payloadType, pkts)
+		}
+	}
+
+	for _, r := range []RTPReadCloser{first, second} {
+		if err := r.Controller().(codec.KeyFrameController).ForceKeyFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keyFrames, _, _ := encoder.state(); keyFrames != 2 {
+		t.Errorf("Expected the key frame requests to be coalesced, got %d key frames", keyFrames)
+	}
+
+	first.Controller().(codec.BitRateController).SetBitRate(1_000_000)
+	second.Controller().(codec.BitRateController).SetBitRate(300_000)
+	if _, bitRate, _ := encoder.state(); bitRate != 300_000 {
+		t.Errorf("Expected the lowest estimate to be the bitrate, got %d", bitRate)
+	}
+
+	first.Close()
+	if _, _, closed := encoder.state(); closed {
+		t.Error("Expected the encoder to keep encoding for the second peer connection")
+	}
+	second.Close()
+	if _, _, closed := encoder.state(); !closed {
+		t.Error("Expected the encoder to be closed after the last peer connection")
+	}
+
+	// The next peer connection starts a new encoder
+	third, err := track.newRTPReader(track, vp8Parameters(96), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	if n := len(builder.built()); n != 2 {
+		t.Errorf("Expected a new encoder, got %d encoders", n)
+	}
+}
+
+func TestSharedEncodingFallback(t *testing.T) {
+	track, builder := newSharedEncodingTrack(t, SharedEncoding{BitRatePolicy: SharedBitRateFallback})
+
+	fast, err := track.newRTPReader(track, vp8Parameters(96), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+	slow, err := track.newRTPReader(track, vp8Parameters(96), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+
+	fast.Controller().(codec.BitRateController).SetBitRate(1_000_000)
+	slow.Controller().(codec.BitRateController).SetBitRate(300_000)
+	if _, _, err := slow.Read(); err != nil {
+		t.Fatal(err)
+	}
+	encoders := builder.built()
+	if len(encoders) != 2 {
+		t.Fatalf("Expected the slow peer connection to fall back to its own encoder, got %d encoders", len(encoders))
+	}
+	if _, bitRate, _ := encoders[0].state(); bitRate != 1_000_000 {
+		t.Errorf("Expected the shared encoder to follow the fast peer connection, got %d", bitRate)
+	}
+	slow.Controller().(codec.BitRateController).SetBitRate(250_000)
+	if _, bitRate, _ := encoders[1].state(); bitRate != 250_000 {
+		t.Errorf("Expected the own encoder to follow the slow peer connection, got %d", bitRate)
+	}
+
+	// The slow peer connection joins the shared encoder again when its estimate recovers
+	slow.Controller().(codec.BitRateController).SetBitRate(800_000)
+	if _, _, err := slow.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, closed := encoders[1].state(); !closed {
+		t.Error("Expected the own encoder to be closed")
+	}
+	if _, bitRate, _ := encoders[0].state(); bitRate != 800_000 {
+		t.Errorf("Expected the shared encoder to follow the lowest estimate, got %d", bitRate)
+	}
+}
+
+func TestSharedEncodingLaggingReader(t *testing.T) {
+	track, builder := newSharedEncodingTrack(t, SharedEncoding{})
+
+	fast, err := track.newRTPReader(track, vp8Parameters(96), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+	lagging, err := track.newRTPReader(track, vp8Parameters(96), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lagging.Close()
+
+	// isKeyFrame tells whether the packets, whose VP8 payload descriptors are 1 byte, are of a key frame
+	isKeyFrame := func(pkts []*rtp.Packet) bool {
+		return pkts[0].Payload[1]&0x01 == 0
+	}
+	read := func(r RTPReadCloser) []*rtp.Packet {
+		t.Helper()
+		pkts, release, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+		return pkts
+	}
+
+	for _, r := range []RTPReadCloser{fast, lagging} {
+		if pkts := read(r); !isKeyFrame(pkts) {
+			t.Fatal("Expected the peer connections to start with a key frame")
+		}
+	}
+
+	// The lagging peer connection falls behind more than the broadcaster buffers
+	for i := 0; i < 40; i++ {
+		if pkts := read(fast); isKeyFrame(pkts) {
+			t.Fatal("Expected delta frames")
+		}
+	}
+	encoder := builder.built()[0]
+	keyFrames, _, _ := encoder.state()
+
+	// The delta frames that are left in the buffer can't be decoded without the missed ones
+	if pkts := read(lagging); !isKeyFrame(pkts) {
+		t.Error("Expected the lagging peer connection to skip to a key frame")
+	}
+	if n, _, _ := encoder.state(); n != keyFrames+1 {
+		t.Errorf("Expected a key frame to be forced for the lagging peer connection, got %d", n-keyFrames)
+	}
+	if pkts := read(fast); !isKeyFrame(pkts) {
+		t.Error("Expected the fast peer connection to get the key frame too")
+	}
+}
@@ -0,0 +1,235 @@
+package mediadevices
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	errEmptySimulcastLayers   = errors.New("simulcast requires at least 1 layer")
+	errEmptySimulcastRID      = errors.New("simulcast layer requires a non-empty RID")
+	errInvalidSimulcastScale  = errors.New("simulcast layer scale must be greater than or equal to 1")
+	errDuplicatedSimulcastRID = errors.New("simulcast layer RIDs must be unique")
+)
+
+// SimulcastLayer describes a single encoding of a SimulcastVideoTrack.
+type SimulcastLayer struct {
+	// RID is the RTP stream ID that identifies this layer in the SDP, e.g. "f", "h", "q".
+	RID string
+	// ScaleResolutionDownBy is the factor the source resolution is divided by. The default value,
+	// 0, keeps the source resolution, which is the same as 1.
+	ScaleResolutionDownBy float64
+	// MaxFrameRate limits the frame rate of this layer. The default value, 0, keeps the
+	// source frame rate.
+	MaxFrameRate float32
+	// Selector contains the encoders for this layer. If it's nil, the selector from the source
+	// track will be used.
+	Selector *CodecSelector
+}
+
+// SimulcastVideoTrack fans a VideoTrack out into multiple layers. Each layer is scaled and
+// throttled independently, encoded by its own encoder, and exposed as a separate RID tagged Track.
+// All layers share the same ID and StreamID so that they can be added as encodings of a single
+// webrtc.RTPSender.
+type SimulcastVideoTrack struct {
+	source *VideoTrack
+	layers []*simulcastLayerTrack
+}
+
+// NewSimulcastVideoTrack creates a SimulcastVideoTrack from source with the given layers. The first
+// layer is used as the base encoding when the track is added to a peer connection.
+func NewSimulcastVideoTrack(source *VideoTrack, layers ...SimulcastLayer) (*SimulcastVideoTrack, error) {
+	if len(layers) == 0 {
+		return nil, errEmptySimulcastLayers
+	}
+
+	rids := make(map[string]struct{})
+	for _, layer := range layers {
+		if layer.RID == "" {
+			return nil, errEmptySimulcastRID
+		}
+		if layer.ScaleResolutionDownBy != 0 && layer.ScaleResolutionDownBy < 1 {
+			return nil, errInvalidSimulcastScale
+		}
+		if _, ok := rids[layer.RID]; ok {
+			return nil, fmt.Errorf("%w: %s", errDuplicatedSimulcastRID, layer.RID)
+		}
+		rids[layer.RID] = struct{}{}
+	}
+
+	track := &SimulcastVideoTrack{source: source}
+	for _, layer := range layers {
+		track.layers = append(track.layers, newSimulcastLayerTrack(source, layer))
+	}
+
+	return track, nil
+}
+
+// Source returns the VideoTrack that all layers read from.
+func (track *SimulcastVideoTrack) Source() *VideoTrack {
+	return track.source
+}
+
+// Layers returns the layer tracks in the same order as they were given to NewSimulcastVideoTrack.
+func (track *SimulcastVideoTrack) Layers() []Track {
+	layers := make([]Track, 0, len(track.layers))
+	for _, layer := range track.layers {
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// Layer returns the layer track that has the given rid, or nil if there's no such layer.
+func (track *SimulcastVideoTrack) Layer(rid string) Track {
+	for _, layer := range track.layers {
+		if layer.rid == rid {
+			return layer
+		}
+	}
+	return nil
+}
+
+// SendEncodings returns the encoding parameters of every layer, which can be used in
+// webrtc.RTPTransceiverInit.
+func (track *SimulcastVideoTrack) SendEncodings() []webrtc.RTPEncodingParameters {
+	encodings := make([]webrtc.RTPEncodingParameters, 0, len(track.layers))
+	for _, layer := range track.layers {
+		encodings = append(encodings, webrtc.RTPEncodingParameters{
+			RTPCodingParameters: webrtc.RTPCodingParameters{RID: layer.rid},
+		})
+	}
+	return encodings
+}
+
+// AddToPeerConnection adds all layers to pc as a single send only transceiver. The first layer is
+// used to create the transceiver, and the rest are added as additional encodings to its sender.
+func (track *SimulcastVideoTrack) AddToPeerConnection(pc *webrtc.PeerConnection) (*webrtc.RTPTransceiver, error) {
+	transceiver, err := pc.AddTransceiverFromTrack(track.layers[0], webrtc.RTPTransceiverInit{
+		Direction:     webrtc.RTPTransceiverDirectionSendonly,
+		SendEncodings: track.SendEncodings(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, layer := range track.layers[1:] {
+		if err := transceiver.Sender().AddEncoding(layer); err != nil {
+			return nil, err
+		}
+	}
+
+	return transceiver, nil
+}
+
+// Close closes the source track. All layers will stop receiving frames afterward.
+func (track *SimulcastVideoTrack) Close() error {
+	return track.source.Close()
+}
+
+// simulcastLayerTrack is a VideoTrack that reads from a shared source and reports a RID.
+type simulcastLayerTrack struct {
+	*VideoTrack
+	rid    string
+	source *VideoTrack
+}
+
+func newSimulcastLayerTrack(source *VideoTrack, layer SimulcastLayer) *simulcastLayerTrack {
+	selector := layer.Selector
+	if selector == nil {
+		selector = source.selector
+	}
+
+	var transforms []video.TransformFunc
+	if layer.ScaleResolutionDownBy > 1 {
+		factor := layer.ScaleResolutionDownBy
+		transforms = append(transforms, scaleResolutionDownBy(func() float64 { return factor }))
+	}
+	if layer.MaxFrameRate > 0 {
+		transforms = append(transforms, video.Throttle(layer.MaxFrameRate))
+	}
+
+	reader := video.Merge(transforms...)(source.NewReader(source.shouldCopyFrames))
+	layerSource := &simulcastLayerSource{id: source.ID()}
+
+	return &simulcastLayerTrack{
+		VideoTrack: newVideoTrackFromReader(layerSource, reader, selector).(*VideoTrack),
+		rid:        layer.RID,
+		source:     source,
+	}
+}
+
+// RID returns the RTP stream ID of this layer.
+func (track *simulcastLayerTrack) RID() string {
+	return track.rid
+}
+
+// StreamID returns the stream ID of the source track, so that every layer belongs to the same group
+// as the source.
+func (track *simulcastLayerTrack) StreamID() string {
+	return track.source.StreamID()
+}
+
+func (track *simulcastLayerTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	return track.bind(ctx, track)
+}
+
+// simulcastLayerSource shares the ID of the source track. Closing a layer doesn't close the
+// underlying source since the other layers might still be using it.
+type simulcastLayerSource struct {
+	id string
+}
+
+func (source *simulcastLayerSource) ID() string {
+	return source.id
+}
+
+func (source *simulcastLayerSource) Close() error {
+	return nil
+}
+
+// scaleResolutionDownBy returns a transform that scales every frame down by the value returned by
+// factor, which is evaluated on every frame. The output size follows the input size, and it's always
+// rounded to even numbers since most encoders require it. A factor of 1 or less passes frames through.
+func scaleResolutionDownBy(factor func() float64) video.TransformFunc {
+	return func(r video.Reader) video.Reader {
+		var current image.Image
+		var currentRelease func()
+		var scaled video.Reader
+		var bounds image.Rectangle
+		var lastFactor float64
+
+		// The scaler releases the frames that it's fed once they're scaled
+		feed := video.ReaderFunc(func() (image.Image, func(), error) {
+			return current, currentRelease, nil
+		})
+
+		return video.ReaderFunc(func() (image.Image, func(), error) {
+			img, release, err := r.Read()
+			if err != nil {
+				return nil, func() {}, err
+			}
+			if release == nil {
+				release = func() {}
+			}
+
+			f := factor()
+			if f <= 1 {
+				return img, release, nil
+			}
+
+			if scaled == nil || img.Bounds() != bounds || f != lastFactor {
+				bounds, lastFactor = img.Bounds(), f
+				width := max(int(float64(bounds.Dx())/f)&^1, 2)
+				height := max(int(float64(bounds.Dy())/f)&^1, 2)
+				scaled = video.Scale(width, height, nil)(feed)
+			}
+
+			current, currentRelease = img, release
+			return scaled.Read()
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package mediadevices
+
+import (
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+type simulcastTestSource struct {
+	width, height int
+}
+
+func (source *simulcastTestSource) ID() string   { return "simulcast-test" }
+func (source *simulcastTestSource) Close() error { return nil }
+func (source *simulcastTestSource) Read() (image.Image, func(), error) {
+	return image.NewYCbCr(image.Rect(0, 0, source.width, source.height), image.YCbCrSubsampleRatio420), func() {}, nil
+}
+
+func TestNewSimulcastVideoTrack(t *testing.T) {
+	source := NewVideoTrack(&simulcastTestSource{width: 640, height: 480}, nil).(*VideoTrack)
+	defer source.Close()
+
+	t.Run("InvalidLayers", func(t *testing.T) {
+		cases := map[string]struct {
+			layers []SimulcastLayer
+			err    error
+		}{
+			"Empty":      {nil, errEmptySimulcastLayers},
+			"EmptyRID":   {[]SimulcastLayer{{RID: ""}}, errEmptySimulcastRID},
+			"Upscale":    {[]SimulcastLayer{{RID: "f", ScaleResolutionDownBy: 0.5}}, errInvalidSimulcastScale},
+			"Duplicated": {[]SimulcastLayer{{RID: "f"}, {RID: "f"}}, errDuplicatedSimulcastRID},
+		}
+		for name, c := range cases {
+			t.Run(name, func(t *testing.T) {
+				_, err := NewSimulcastVideoTrack(source, c.layers...)
+				if !errors.Is(err, c.err) {
+					t.Errorf("Expected error: %v, got: %v", c.err, err)
+				}
+			})
+		}
+	})
+
+	track, err := NewSimulcastVideoTrack(source,
+		SimulcastLayer{RID: "f"},
+		SimulcastLayer{RID: "h", ScaleResolutionDownBy: 2},
+		SimulcastLayer{RID: "q", ScaleResolutionDownBy: 4},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layers := track.Layers()
+	if len(layers) != 3 {
+		t.Fatalf("Expected 3 layers, got %d", len(layers))
+	}
+
+	expected := []struct {
+		rid           string
+		width, height int
+	}{
+		{"f", 640, 480},
+		{"h", 320, 240},
+		{"q", 160, 120},
+	}
+	for i, e := range expected {
+		layer := layers[i]
+		if layer.RID() != e.rid {
+			t.Errorf("Expected RID %s, got %s", e.rid, layer.RID())
+		}
+		if layer.ID() != source.ID() {
+			t.Errorf("Expected layer ID %s, got %s", source.ID(), layer.ID())
+		}
+		if layer.StreamID() != layers[0].StreamID() {
+			t.Errorf("Expected every layer to share the same StreamID")
+		}
+		if layer.Kind() != webrtc.RTPCodecTypeVideo {
+			t.Errorf("Expected video kind, got %s", layer.Kind())
+		}
+		if track.Layer(e.rid) != layer {
+			t.Errorf("Expected to find layer %s", e.rid)
+		}
+
+		img, _, err := layer.(*simulcastLayerTrack).NewReader(false).Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != e.width || img.Bounds().Dy() != e.height {
+			t.Errorf("Expected %s layer to be %dx%d, got %dx%d",
+				e.rid, e.width, e.height, img.Bounds().Dx(), img.Bounds().Dy())
+		}
+	}
+
+	encodings := track.SendEncodings()
+	if len(encodings) != 3 || encodings[0].RID != "f" || encodings[1].RID != "h" || encodings[2].RID != "q" {
+		t.Errorf("Unexpected send encodings: %v", encodings)
+	}
+}
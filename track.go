@@ -7,6 +7,8 @@ import (
 	"io"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pion/interceptor"
 	"github.com/pion/rtcp"
@@ -16,6 +18,7 @@ import (
 	"github.com/pion/mediadevices/pkg/driver"
 	"github.com/pion/mediadevices/pkg/io/audio"
 	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
 	"github.com/pion/mediadevices/pkg/wave"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
@@ -58,7 +61,8 @@ type Track interface {
 	// immediately called.
 	OnEnded(func(error))
 	Kind() webrtc.RTPCodecType
-	// StreamID is the group this track belongs too. This must be unique
+	// StreamID is the group this track belongs too. It's assigned by the first MediaStream that
+	// contains the track, and it stays the same for the lifetime of the track afterward.
 	StreamID() string
 	// RID is the RTP Stearm ID for this track. This is only used for Simulcast
 	RID() string
@@ -92,14 +96,30 @@ type baseTrack struct {
 	selector              *CodecSelector
 	activePeerConnections map[string]chan<- chan<- struct{}
 	encoderController     codec.EncoderController
+	bitRateMu             sync.Mutex
+	bitRateAdaptation     *BitRateAdaptation
+	streamIDMu            sync.Mutex
+	streamID              string
+	streamIDAssigned      bool
+	encodersMu            sync.Mutex
+	encoders              map[*trackEncoder]struct{}
+	sharedEncodersMu      sync.Mutex
+	sharedEncoding        *SharedEncoding
+	sharedEncoders        map[string]*sharedEncoder
 }
 
 func newBaseTrack(source Source, kind MediaDeviceType, selector *CodecSelector) *baseTrack {
+	generator, err := uuid.NewRandom()
+	if err != nil {
+		panic(err)
+	}
+
 	return &baseTrack{
 		Source:                source,
 		kind:                  kind,
 		selector:              selector,
 		activePeerConnections: make(map[string]chan<- chan<- struct{}),
+		streamID:              generator.String(),
 	}
 }
 
@@ -115,14 +135,25 @@ func (track *baseTrack) Kind() webrtc.RTPCodecType {
 	}
 }
 
+// StreamID returns the ID of the MediaStream this track belongs to. A track that hasn't been added to
+// any MediaStream is the only member of its own group.
 func (track *baseTrack) StreamID() string {
-	// TODO: StreamID should be used to group multiple tracks. Should get this information from mediastream instead.
-	generator, err := uuid.NewRandom()
-	if err != nil {
-		panic(err)
-	}
+	track.streamIDMu.Lock()
+	defer track.streamIDMu.Unlock()
+	return track.streamID
+}
+
+// assignStreamID groups this track into the stream that has the given id. Only the first stream
+// is taken so that the StreamID doesn't change after it has been negotiated.
+func (track *baseTrack) assignStreamID(id string) {
+	track.streamIDMu.Lock()
+	defer track.streamIDMu.Unlock()
 
-	return generator.String()
+	if track.streamIDAssigned {
+		return
+	}
+	track.streamID = id
+	track.streamIDAssigned = true
 }
 
 // RID is only relevant if you wish to use Simulcast
@@ -174,7 +205,7 @@ func (track *baseTrack) bind(ctx webrtc.TrackLocalContext, specializedTrack Trac
 	var errReasons []string
 	for _, wantedCodec := range ctx.CodecParameters() {
 		logger.Debugf("trying to build %s rtp reader", wantedCodec.MimeType)
-		encodedReader, err = specializedTrack.NewRTPReader(wantedCodec.MimeType, uint32(ctx.SSRC()), rtpOutboundMTU)
+		encodedReader, err = track.newRTPReader(specializedTrack, wantedCodec, uint32(ctx.SSRC()))
 
 		track.errMu.Lock()
 		if track.err != nil {
@@ -236,15 +267,27 @@ func (track *baseTrack) bind(ctx webrtc.TrackLocalContext, specializedTrack Trac
 	}()
 
 	track.encoderController = encodedReader.Controller()
-	keyFrameController, ok := track.encoderController.(codec.KeyFrameController)
-	if ok {
-		go track.rtcpReadLoop(ctx.RTCPReader(), keyFrameController, stopRead)
+	keyFrameController, _ := track.encoderController.(codec.KeyFrameController)
+
+	var adapter *bitRateAdapter
+	if config := track.bitRateAdaptationConfig(); config != nil {
+		if bitRateController, ok := track.encoderController.(codec.BitRateController); ok {
+			adapter = newBitRateAdapter(*config, uint32(ctx.SSRC()), bitRateController)
+			go adapter.run(stopRead)
+		}
+	}
+
+	if keyFrameController != nil || adapter != nil {
+		go track.rtcpReadLoop(ctx.RTCPReader(), keyFrameController, adapter, ctx.SSRC(), stopRead)
 	}
 
 	return selectedCodec, nil
 }
 
-func (track *baseTrack) rtcpReadLoop(reader interceptor.RTCPReader, keyFrameController codec.KeyFrameController, stopRead chan struct{}) {
+// rtcpReadLoop forces a key frame whenever a PLI or FIR targeting ssrc arrives. Requests for other
+// SSRCs, e.g. other simulcast layers, are ignored. Bandwidth feedback is given to adapter. Both
+// keyFrameController and adapter are optional.
+func (track *baseTrack) rtcpReadLoop(reader interceptor.RTCPReader, keyFrameController codec.KeyFrameController, adapter *bitRateAdapter, ssrc webrtc.SSRC, stopRead chan struct{}) {
 	readerBuffer := make([]byte, rtcpInboundMTU)
 
 readLoop:
@@ -271,17 +314,42 @@ readLoop:
 		}
 
 		for _, pkt := range pkts {
-			switch pkt.(type) {
-			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
-				if err := keyFrameController.ForceKeyFrame(); err != nil {
-					logger.Warnf("failed to force key frame: %s", err)
-					continue readLoop
-				}
+			if adapter != nil {
+				adapter.handleRTCP(pkt)
+			}
+
+			if keyFrameController == nil || !isKeyFrameRequestFor(pkt, ssrc) {
+				continue
+			}
+
+			if err := keyFrameController.ForceKeyFrame(); err != nil {
+				logger.Warnf("failed to force key frame: %s", err)
+				continue readLoop
 			}
 		}
 	}
 }
 
+// isKeyFrameRequestFor checks if pkt is a PLI or FIR that's targeting ssrc.
+func isKeyFrameRequestFor(pkt rtcp.Packet, ssrc webrtc.SSRC) bool {
+	switch p := pkt.(type) {
+	case *rtcp.PictureLossIndication:
+		return p.MediaSSRC == uint32(ssrc)
+	case *rtcp.FullIntraRequest:
+		// RFC 5104 requires the media source SSRC of FIR to be 0, and the target SSRCs to be listed
+		// in the FCI entries. Some senders fill the media source SSRC instead, so accept both.
+		if p.MediaSSRC == uint32(ssrc) {
+			return true
+		}
+		for _, entry := range p.FIR {
+			if entry.SSRC == uint32(ssrc) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (track *baseTrack) unbind(ctx webrtc.TrackLocalContext) error {
 	ch := track.removeActivePeerConnection(ctx.ID())
 	// If there isn't a registered chanel for this ctx, it means it has already been unbound
@@ -310,7 +378,7 @@ func (track *baseTrack) removeActivePeerConnection(id string) chan<- chan<- stru
 
 func newTrackFromDriver(d driver.Driver, constraints MediaTrackConstraints, selector *CodecSelector) (Track, error) {
 	if err := d.Open(); err != nil {
-		return nil, err
+		return nil, &NotReadableError{Err: err}
 	}
 
 	switch recorder := d.(type) {
@@ -328,6 +396,14 @@ type VideoTrack struct {
 	*baseTrack
 	*video.Broadcaster
 	shouldCopyFrames bool
+	encodeQueueMu    sync.Mutex
+	encodeQueue      *EncodeQueue
+	// encodeQueueCounters is shared by the encode queues of the track
+	encodeQueueCounters encodeQueueCounters
+	cpuOveruseMu        sync.Mutex
+	cpuOveruse          *CPUOveruseDetection
+	// capture is nil if the track isn't recorded from a driver
+	capture *videoCapture
 }
 
 // NewVideoTrack constructs a new VideoTrack
@@ -347,12 +423,13 @@ func (track *VideoTrack) SetShouldCopyFrames(shouldCopyFrames bool) {
 
 func newVideoTrackFromReader(source Source, reader video.Reader, selector *CodecSelector) Track {
 	base := newBaseTrack(source, VideoInput, selector)
-	wrappedReader := video.ReaderFunc(func() (img image.Image, release func(), err error) {
-		img, _, err = reader.Read()
+	timestampedReader := video.WithTimestamp(reader)
+	wrappedReader := video.TimestampedReaderFunc(func() (img image.Image, timestamp time.Time, release func(), err error) {
+		img, timestamp, release, err = timestampedReader.ReadTimestamped()
 		if err != nil {
 			base.onError(err)
 		}
-		return img, func() {}, err
+		return img, timestamp, release, err
 	})
 
 	// TODO: Allow users to configure broadcaster
@@ -366,12 +443,16 @@ func newVideoTrackFromReader(source Source, reader video.Reader, selector *Codec
 
 // newVideoTrackFromDriver is an internal video track creation from driver
 func newVideoTrackFromDriver(d driver.Driver, recorder driver.VideoRecorder, constraints MediaTrackConstraints, selector *CodecSelector) (Track, error) {
-	reader, err := recorder.VideoRecord(constraints.selectedMedia)
+	capture, err := newVideoCapture(d, recorder, constraints)
 	if err != nil {
 		return nil, err
 	}
 
-	return newVideoTrackFromReader(d, reader, selector), nil
+	track := newVideoTrackFromReader(capture, capture, selector).(*VideoTrack)
+	track.capture = capture
+	capture.setOnSettings(track.notifyEncoders)
+	capture.setOnEnded(track.onError)
+	return track, nil
 }
 
 // Transform transforms the underlying source by applying the given fns in serial order
@@ -388,41 +469,174 @@ func (track *VideoTrack) Unbind(ctx webrtc.TrackLocalContext) error {
 	return track.unbind(ctx)
 }
 
-func (track *VideoTrack) newEncodedReader(codecNames ...string) (EncodedReadCloser, *codec.RTPCodec, error) {
+// newEncodedReader reads the track encoded with the first of codecNames that can encode it. fmtp is the
+// format parameters that the peer connection negotiated, or empty if the reader isn't negotiated.
+func (track *VideoTrack) newEncodedReader(fmtp string, codecNames ...string) (EncodedReadCloser, *codec.RTPCodec, error) {
+	if reader, selectedCodec, ok := track.newPassthroughReader(fmtp, codecNames...); ok {
+		return reader, selectedCodec, nil
+	}
+
 	reader := track.NewReader(track.shouldCopyFrames)
 	inputProp, err := detectCurrentVideoProp(track.Broadcaster)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// Only the encoders that are codec.InputPropController can encode frames of another size than the one
+	// that they're built with, which is known once the encoder is built
+	var resizable atomic.Bool
+
+	var fallback *bitRateFallback
+	if config := track.bitRateAdaptationConfig(); config != nil && config.Fallback != BitRateFallbackNone {
+		fallback = newBitRateFallback(config, resizable.Load)
+		reader = video.Merge(fallback.transform)(reader)
+	}
+
+	var overuse *overuseDetector
+	if config := track.cpuOveruseConfig(); config != nil {
+		overuse = newOveruseDetector(config, track.GetSettings().FrameRate, resizable.Load)
+		reader = video.Merge(overuse.transform)(reader)
+	}
+
+	reader = video.Merge(keepEncoderSize(inputProp.Width, inputProp.Height, resizable.Load))(reader)
+
+	var queue *encodeQueue
+	if config := track.encodeQueueConfig(); config != nil {
+		settings := track.GetSettings()
+		frameRate := settings.FrameRate
+		if frameRate <= 0 {
+			frameRate = inputProp.FrameRate
+		}
+		queue = newEncodeQueue(reader, config, &track.encodeQueueCounters, frameRate, settings.DiscardFramesOlderThan)
+		reader = queue
+	}
+	if overuse != nil {
+		reader = overuse.encoderInput(reader)
+	}
+
 	encodedReader, selectedCodec, err := track.selector.selectVideoCodecByNames(reader, inputProp, codecNames...)
 	if err != nil {
+		if queue != nil {
+			queue.Close()
+		}
 		return nil, nil, err
 	}
+	_, ok := encodedReader.Controller().(codec.InputPropController)
+	resizable.Store(ok)
+	if fallback != nil && fallback.mode == BitRateFallbackResolution && !ok {
+		logger.Warnf("the %s encoder can't change its input resolution, so the resolution fallback isn't applied", selectedCodec.MimeType)
+	}
+
+	var propMu sync.Mutex
+	currentProp := inputProp
+	removeEncoder := track.addEncoder(encodedReader, func(settings prop.Media) prop.Media {
+		if queue != nil {
+			queue.setMaxAge(settings.DiscardFramesOlderThan)
+			settings.FrameRate = queue.expectedFrameRate(settings.FrameRate)
+		}
+		propMu.Lock()
+		currentProp = settings
+		propMu.Unlock()
+		return settings
+	})
+
+	controllerFn := encodedReader.Controller
+	if fallback != nil {
+		controllerFn = func() codec.EncoderController {
+			return fallback.controller(encodedReader.Controller())
+		}
+	}
 
 	sample := newVideoSampler(selectedCodec.ClockRate)
 
 	return &encodedReadCloserImpl{
 		readFn: func() (EncodedBuffer, func(), error) {
-			data, release, err := encodedReader.Read()
+			if queue != nil {
+				// Encoders are locked while they read a frame, so the frame rate is set between the reads
+				if frameRate, changed := queue.takeFrameRate(); changed {
+					setEncoderFrameRate(encodedReader, &propMu, &currentProp, frameRate)
+				}
+			}
+
+			data, timestamp, release, err := encodedReader.ReadTimestamped()
+			if err != nil {
+				return EncodedBuffer{}, release, err
+			}
+			if overuse != nil {
+				overuse.encoded(time.Now())
+			}
 			buffer := EncodedBuffer{
-				Data:    data,
-				Samples: sample(),
+				Data:      data,
+				Samples:   sample(timestamp),
+				Timestamp: timestamp,
 			}
 			return buffer, release, err
 		},
-		closeFn:      encodedReader.Close,
-		controllerFn: encodedReader.Controller,
+		closeFn: func() error {
+			removeEncoder()
+			if queue != nil {
+				// The queue is closed first to wake the encoder up if it waits for a frame
+				queue.Close()
+			}
+			return encodedReader.Close()
+		},
+		controllerFn: controllerFn,
 	}, selectedCodec, nil
 }
 
+// setEncoderFrameRate tells encoder that its input has frameRate now, if it implements
+// codec.InputPropController. Nothing tells the others, see EncodeQueue.
+func setEncoderFrameRate(encoder codec.Controllable, mu *sync.Mutex, current *prop.Media, frameRate float32) {
+	controller, ok := encoder.Controller().(codec.InputPropController)
+	if !ok {
+		return
+	}
+
+	mu.Lock()
+	current.FrameRate = frameRate
+	p := *current
+	mu.Unlock()
+
+	if err := controller.SetInputProp(p); err != nil {
+		logger.Warnf("failed to update the encoder frame rate: %s", err)
+	}
+}
+
+// keepEncoderSize scales the frames back to width x height, unless resizable returns true. The encoders
+// that aren't codec.InputPropController, e.g. x264 and SVT-AV1, read the frames as if they had the size that
+// they were built with, so they're kept at that size when the settings of the track change.
+func keepEncoderSize(width, height int, resizable func() bool) video.TransformFunc {
+	return func(r video.Reader) video.Reader {
+		if width <= 0 || height <= 0 {
+			return r
+		}
+		size := image.Pt(width, height)
+
+		// The scaler releases the frames that it's fed once they're scaled
+		var current image.Image
+		var currentRelease func()
+		scaled := video.Scale(width, height, nil)(video.ReaderFunc(func() (image.Image, func(), error) {
+			return current, currentRelease, nil
+		}))
+
+		return video.ReaderFunc(func() (image.Image, func(), error) {
+			img, release, err := r.Read()
+			if err != nil || img.Bounds().Size() == size || resizable() {
+				return img, release, err
+			}
+			current, currentRelease = img, release
+			return scaled.Read()
+		})
+	}
+}
+
 func (track *VideoTrack) NewEncodedReader(codecName string) (EncodedReadCloser, error) {
-	reader, _, err := track.newEncodedReader(codecName)
+	reader, _, err := track.newEncodedReader("", codecName)
 	return reader, err
 }
 
 func (track *VideoTrack) NewEncodedIOReader(codecName string) (io.ReadCloser, error) {
-	encodedReader, _, err := track.newEncodedReader(codecName)
+	encodedReader, _, err := track.newEncodedReader("", codecName)
 	if err != nil {
 		return nil, err
 	}
@@ -430,7 +644,12 @@ func (track *VideoTrack) NewEncodedIOReader(codecName string) (io.ReadCloser, er
 }
 
 func (track *VideoTrack) NewRTPReader(codecName string, ssrc uint32, mtu int) (RTPReadCloser, error) {
-	encodedReader, selectedCodec, err := track.newEncodedReader(codecName)
+	return track.newPacketizedReader("", codecName, ssrc, mtu)
+}
+
+// newPacketizedReader is NewRTPReader for a peer connection that negotiated fmtp.
+func (track *VideoTrack) newPacketizedReader(fmtp, codecName string, ssrc uint32, mtu int) (RTPReadCloser, error) {
+	encodedReader, selectedCodec, err := track.newEncodedReader(fmtp, codecName)
 	if err != nil {
 		return nil, err
 	}
@@ -465,6 +684,8 @@ func (track *VideoTrack) EncoderController() codec.EncoderController {
 type AudioTrack struct {
 	*baseTrack
 	*audio.Broadcaster
+	// capture is nil if the track isn't recorded from a driver
+	capture *audioCapture
 }
 
 // NewAudioTrack constructs a new AudioTrack
@@ -474,12 +695,13 @@ func NewAudioTrack(source AudioSource, selector *CodecSelector) Track {
 
 func newAudioTrackFromReader(source Source, reader audio.Reader, selector *CodecSelector) Track {
 	base := newBaseTrack(source, AudioInput, selector)
-	wrappedReader := audio.ReaderFunc(func() (chunk wave.Audio, release func(), err error) {
-		chunk, _, err = reader.Read()
+	timestampedReader := audio.WithTimestamp(reader)
+	wrappedReader := audio.TimestampedReaderFunc(func() (chunk wave.Audio, timestamp time.Time, release func(), err error) {
+		chunk, timestamp, release, err = timestampedReader.ReadTimestamped()
 		if err != nil {
 			base.onError(err)
 		}
-		return chunk, func() {}, err
+		return chunk, timestamp, release, err
 	})
 
 	// TODO: Allow users to configure broadcaster
@@ -493,12 +715,16 @@ func newAudioTrackFromReader(source Source, reader audio.Reader, selector *Codec
 
 // newAudioTrackFromDriver is an internal audio track creation from driver
 func newAudioTrackFromDriver(d driver.Driver, recorder driver.AudioRecorder, constraints MediaTrackConstraints, selector *CodecSelector) (Track, error) {
-	reader, err := recorder.AudioRecord(constraints.selectedMedia)
+	capture, err := newAudioCapture(d, recorder, constraints)
 	if err != nil {
 		return nil, err
 	}
 
-	return newAudioTrackFromReader(d, reader, selector), nil
+	track := newAudioTrackFromReader(capture, capture, selector).(*AudioTrack)
+	track.capture = capture
+	capture.setOnSettings(track.notifyEncoders)
+	capture.setOnEnded(track.onError)
+	return track, nil
 }
 
 // Transform transforms the underlying source by applying the given fns in serial order
@@ -515,7 +741,9 @@ func (track *AudioTrack) Unbind(ctx webrtc.TrackLocalContext) error {
 	return track.unbind(ctx)
 }
 
-func (track *AudioTrack) newEncodedReader(codecNames ...string) (EncodedReadCloser, *codec.RTPCodec, error) {
+// newEncodedReader reads the track encoded with the first of codecNames that can encode it. The format
+// parameters don't change how audio is encoded, so fmtp is ignored.
+func (track *AudioTrack) newEncodedReader(_ string, codecNames ...string) (EncodedReadCloser, *codec.RTPCodec, error) {
 	reader := track.NewReader(false)
 	inputProp, err := detectCurrentAudioProp(track.Broadcaster)
 	if err != nil {
@@ -527,29 +755,44 @@ func (track *AudioTrack) newEncodedReader(codecNames ...string) (EncodedReadClos
 		return nil, nil, err
 	}
 
+	removeEncoder := track.addEncoder(encodedReader, func(settings prop.Media) prop.Media {
+		// The audio is resampled to the clock rate of the codec
+		if settings.SampleRate != 0 {
+			settings.SampleRate = int(selectedCodec.ClockRate)
+		}
+		return settings
+	})
+
 	sample := newAudioSampler(selectedCodec.ClockRate, selectedCodec.Latency)
 
 	return &encodedReadCloserImpl{
 		readFn: func() (EncodedBuffer, func(), error) {
-			data, release, err := encodedReader.Read()
+			data, timestamp, release, err := encodedReader.ReadTimestamped()
+			if err != nil {
+				return EncodedBuffer{}, release, err
+			}
 			buffer := EncodedBuffer{
-				Data:    data,
-				Samples: sample(),
+				Data:      data,
+				Samples:   sample(timestamp),
+				Timestamp: timestamp,
 			}
 			return buffer, release, err
 		},
-		closeFn:      encodedReader.Close,
+		closeFn: func() error {
+			removeEncoder()
+			return encodedReader.Close()
+		},
 		controllerFn: encodedReader.Controller,
 	}, selectedCodec, nil
 }
 
 func (track *AudioTrack) NewEncodedReader(codecName string) (EncodedReadCloser, error) {
-	reader, _, err := track.newEncodedReader(codecName)
+	reader, _, err := track.newEncodedReader("", codecName)
 	return reader, err
 }
 
 func (track *AudioTrack) NewEncodedIOReader(codecName string) (io.ReadCloser, error) {
-	encodedReader, _, err := track.newEncodedReader(codecName)
+	encodedReader, _, err := track.newEncodedReader("", codecName)
 	if err != nil {
 		return nil, err
 	}
@@ -557,7 +800,12 @@ func (track *AudioTrack) NewEncodedIOReader(codecName string) (io.ReadCloser, er
 }
 
 func (track *AudioTrack) NewRTPReader(codecName string, ssrc uint32, mtu int) (RTPReadCloser, error) {
-	encodedReader, selectedCodec, err := track.newEncodedReader(codecName)
+	return track.newPacketizedReader("", codecName, ssrc, mtu)
+}
+
+// newPacketizedReader is NewRTPReader for a peer connection that negotiated fmtp.
+func (track *AudioTrack) newPacketizedReader(fmtp, codecName string, ssrc uint32, mtu int) (RTPReadCloser, error) {
+	encodedReader, selectedCodec, err := track.newEncodedReader(fmtp, codecName)
 	if err != nil {
 		return nil, err
 	}
@@ -141,7 +141,7 @@ func TestRtcpHandler(t *testing.T) {
 		stop := make(chan struct{}, 1)
 		stopped := make(chan struct{})
 		go func() {
-			tr.rtcpReadLoop(&fakeRTCPReader{end: stop}, &fakeKeyFrameController{}, stop)
+			tr.rtcpReadLoop(&fakeRTCPReader{end: stop}, &fakeKeyFrameController{}, nil, 0x4bc4fcb4, stop)
 			stopped <- struct{}{}
 		}()
 
@@ -191,7 +191,7 @@ func TestRtcpHandler(t *testing.T) {
 				mockKeyFrameController := &fakeKeyFrameController{called: make(chan struct{}, 1)}
 				mockRTCPReader := &fakeRTCPReader{end: stop, mockReturn: make(chan []byte, 1)}
 
-				go tr.rtcpReadLoop(mockRTCPReader, mockKeyFrameController, stop)
+				go tr.rtcpReadLoop(mockRTCPReader, mockKeyFrameController, nil, 0x4bc4fcb4, stop)
 
 				mockRTCPReader.mockReturn <- packet
 
@@ -203,4 +203,31 @@ func TestRtcpHandler(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("ShouldIgnoreOtherSSRC", func(t *testing.T) {
+		tr := &baseTrack{}
+		stop := make(chan struct{}, 1)
+		defer func() {
+			stop <- struct{}{}
+		}()
+		mockKeyFrameController := &fakeKeyFrameController{called: make(chan struct{}, 1)}
+		mockRTCPReader := &fakeRTCPReader{end: stop, mockReturn: make(chan []byte, 1)}
+
+		go tr.rtcpReadLoop(mockRTCPReader, mockKeyFrameController, nil, 0x12345678, stop)
+
+		mockRTCPReader.mockReturn <- []byte{
+			// v=2, p=0, FMT=1, PSFB, len=1
+			0x81, 0xce, 0x00, 0x02,
+			// ssrc=0x0
+			0x00, 0x00, 0x00, 0x00,
+			// ssrc=0x4bc4fcb4
+			0x4b, 0xc4, 0xfc, 0xb4,
+		}
+
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-mockKeyFrameController.called:
+			t.Error("Key frame is unexpectedly forced for another SSRC")
+		}
+	})
 }
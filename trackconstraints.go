@@ -0,0 +1,747 @@
+package mediadevices
+
+import (
+	"errors"
+	"image"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/io/audio"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/wave"
+)
+
+var (
+	errNotConstrainable = errors.New("constraints can only be applied to tracks from drivers")
+	errCaptureClosed    = errors.New("track is closed")
+)
+
+// ConstrainableTrack is a Track whose constraints can be changed while it's being used. The tracks
+// that GetUserMedia and GetDisplayMedia return are ConstrainableTracks.
+// Reference: https://w3c.github.io/mediacapture-main/#constrainable-interface
+type ConstrainableTrack interface {
+	Track
+	// ApplyConstraints replaces the constraints of the track. The driver is restarted with the properties
+	// that fit best, or the frames are scaled down or throttled to fit the constraints, without ending
+	// the track. The controls of the device, e.g. the zoom of a camera, are set to fit their constraints.
+	// The encoders reading the track are told about the new settings if they implement
+	// codec.InputPropController. When no settings satisfy the constraints, the track is left unchanged,
+	// and an *OverconstrainedError is returned.
+	ApplyConstraints(MediaOption) error
+	// GetConstraints returns the constraints that were applied last.
+	GetConstraints() MediaTrackConstraints
+	// GetSettings returns the current properties of the track.
+	GetSettings() prop.Media
+	// GetCapabilities returns the properties that the driver of the track supports.
+	GetCapabilities() []prop.Media
+}
+
+// capture is the source of a track that's recorded from a driver. The captures of the same driver share
+// its recording, which each of them scales down or throttles to fit its own constraints.
+type capture struct {
+	driver driver.Driver
+	// derive returns the settings that can be made from native properties to fit constraints
+	derive func(native prop.Media, constraints prop.MediaConstraints) prop.Media
+	// record starts reading the recording of the driver, which is restarted if it has other properties
+	record func(native prop.Media) error
+	// transform makes the recording fit settings
+	transform func(native, settings prop.Media)
+
+	// The fields below are guarded by sharedDevicesMu
+	constraints MediaTrackConstraints
+	settings    prop.Media
+	closed      bool
+	// removed is true once the driver has been deleted from the manager
+	removed bool
+	// onSettings is called with the new settings when they change
+	onSettings func(prop.Media)
+	// onEnded is called with ErrDeviceRemoved when the driver is deleted from the manager
+	onEnded func(error)
+}
+
+// sharedDevice is a driver whose recording is shared by captures.
+type sharedDevice struct {
+	// native is the properties that the driver records with
+	native   prop.Media
+	captures []*capture
+	// starting is closed once a capture has started or restarted the recording, or failed to. It's nil
+	// then.
+	starting chan struct{}
+}
+
+var (
+	// sharedDevices are the drivers that are being recorded. A driver that's registered again, e.g. when
+	// the device is plugged in again, has the same ID but isn't the same driver.
+	sharedDevices   = make(map[driver.Driver]*sharedDevice)
+	sharedDevicesMu sync.Mutex
+)
+
+// start records from the driver, which has been opened for c. If other captures are recording from the
+// driver, the recording is restarted with the properties that fit all of them, if it has to be.
+func (c *capture) start() error {
+	// The controls are shared by the captures, so the last one to set them wins
+	if err := applyControls(c.driver, c.constraints.MediaConstraints); err != nil {
+		c.driver.Close()
+		return err
+	}
+
+	sharedDevicesMu.Lock()
+	device, ok := startedDevice(c.driver)
+	if !ok {
+		return c.startFirst()
+	}
+
+	notify, err := device.update(c, c.constraints)
+	sharedDevicesMu.Unlock()
+	if err != nil {
+		// The driver keeps recording for the other captures
+		c.driver.Close()
+		return err
+	}
+	notify()
+	return nil
+}
+
+// startedDevice returns the shared device of d, once no capture is starting or restarting its recording.
+// sharedDevicesMu must be held, and it's released while waiting.
+func startedDevice(d driver.Driver) (*sharedDevice, bool) {
+	device, ok := sharedDevices[d]
+	for ok && device.starting != nil {
+		// Another capture is starting the recording, which the others wait for
+		starting := device.starting
+		sharedDevicesMu.Unlock()
+		<-starting
+		sharedDevicesMu.Lock()
+		device, ok = sharedDevices[d]
+	}
+	return device, ok
+}
+
+// startFirst starts the recording of the driver for c, which is the first capture of it. The driver is
+// reserved for c while the recording starts, which is done without holding sharedDevicesMu since it may
+// take a while. sharedDevicesMu must be held, and it's released.
+func (c *capture) startFirst() error {
+	device := &sharedDevice{starting: make(chan struct{})}
+	sharedDevices[c.driver] = device
+	sharedDevicesMu.Unlock()
+
+	// The first capture records with the properties that selectBestDriver found, which may have to be
+	// transformed to fit the constraints
+	native := c.constraints.selectedMedia
+	err := c.record(native)
+
+	sharedDevicesMu.Lock()
+	defer sharedDevicesMu.Unlock()
+	close(device.starting)
+	device.starting = nil
+	if err != nil {
+		// The next capture that was waiting starts the recording itself
+		delete(sharedDevices, c.driver)
+		return err
+	}
+
+	c.settings = native
+	if _, transformed, _ := fitness(native, c.constraints, c.derive); transformed {
+		c.settings = c.derive(native, c.constraints.MediaConstraints)
+		c.transform(native, c.settings)
+	}
+	c.constraints.selectedMedia = c.settings
+	device.native = native
+	device.captures = []*capture{c}
+	return nil
+}
+
+// update finds the properties of the driver that fit the constraints of all the captures best, with
+// constraints for c, which is added to the captures if it's new. The recording is restarted if the
+// properties have changed, and the captures are transformed to fit their constraints. The returned
+// function tells the captures whose settings have changed about them, and has to be called without
+// holding sharedDevicesMu. sharedDevicesMu must be held. It's released while the recording restarts,
+// for which the driver is reserved like in startFirst.
+func (device *sharedDevice) update(c *capture, constraints MediaTrackConstraints) (func(), error) {
+	joining := !slices.Contains(device.captures, c)
+	captures := device.captures
+	if joining {
+		captures = append(slices.Clip(captures), c)
+	}
+	constraintsOf := func(cc *capture) MediaTrackConstraints {
+		if cc == c {
+			return constraints
+		}
+		return cc.constraints
+	}
+
+	var best prop.Media
+	var bestTransformed []bool
+	minFitnessDist, minTransforms := math.Inf(1), 0
+	properties := c.driver.Properties()
+	for _, p := range properties {
+		var fitnessDist float64
+		var transformed []bool
+		for _, cc := range captures {
+			dist, transform, ok := fitness(p, constraintsOf(cc), cc.derive)
+			if !ok {
+				transformed = nil
+				break
+			}
+			fitnessDist += dist
+			transformed = append(transformed, transform)
+		}
+		if transformed == nil {
+			continue
+		}
+
+		// On ties, the properties that need the fewest transforms are preferred, and then the smallest
+		transforms := countTrue(transformed)
+		better := fitnessDist < minFitnessDist
+		if fitnessDist == minFitnessDist {
+			better = transforms < minTransforms || (transforms == minTransforms && p.Width*p.Height < best.Width*best.Height)
+		}
+		if better {
+			best, bestTransformed = p, transformed
+			minFitnessDist, minTransforms = fitnessDist, transforms
+		}
+	}
+	if bestTransformed == nil {
+		// The error tells whether the constraints can't be satisfied on their own
+		candidates := make([]SelectionCandidate, 0, len(properties))
+		for _, p := range properties {
+			candidates = append(candidates, evaluateCandidate(c.driver, p, driverControls(c.driver), constraints, c.derive))
+		}
+		return nil, overconstrained(candidates)
+	}
+
+	native := device.native
+	if !recordsWith(native, best) {
+		native = mergeSelected(constraints, best)
+	}
+	if joining || native != device.native {
+		device.starting = make(chan struct{})
+		sharedDevicesMu.Unlock()
+		err := c.record(native)
+		sharedDevicesMu.Lock()
+		close(device.starting)
+		device.starting = nil
+		if err != nil {
+			return nil, err
+		}
+	}
+	device.native = native
+	device.captures = captures
+
+	var notifications []func()
+	for i, cc := range captures {
+		settings := native
+		if bestTransformed[i] {
+			settings = cc.derive(native, constraintsOf(cc).MediaConstraints)
+		}
+		cc.transform(native, settings)
+		if settings != cc.settings {
+			cc.settings = settings
+			if onSettings := cc.onSettings; onSettings != nil {
+				notifications = append(notifications, func() { onSettings(settings) })
+			}
+		}
+	}
+	c.constraints = constraints
+	c.constraints.selectedMedia = c.settings
+
+	return func() {
+		for _, notify := range notifications {
+			notify()
+		}
+	}, nil
+}
+
+// fitness returns the fitness distance of the best settings that can be made from p for constraints,
+// and whether p has to be transformed for them. The third return value is false if none fit.
+func fitness(p prop.Media, constraints MediaTrackConstraints, derive func(prop.Media, prop.MediaConstraints) prop.Media) (float64, bool, bool) {
+	dist, ok := constraints.MediaConstraints.FitnessDistance(p)
+	if passthroughOnly(p.FrameFormat) {
+		// The frames can't be decoded, so they're neither transformed nor selected unless they're asked for
+		return dist, false, ok && constraints.FrameFormat != nil
+	}
+	if derived := derive(p, constraints.MediaConstraints); derived != p {
+		if derivedDist, derivedOK := constraints.MediaConstraints.FitnessDistance(derived); derivedOK && (!ok || derivedDist < dist) {
+			return derivedDist, true, true
+		}
+	}
+	return dist, false, ok
+}
+
+// passthroughOnly checks if the frames of f are compressed, and can't be decoded, e.g. H.264. They can
+// only be read by the encoded readers of the codec of f.
+func passthroughOnly(f frame.Format) bool {
+	if !frame.IsCompressed(f) {
+		return false
+	}
+	_, err := frame.NewDecoder(f)
+	return err != nil
+}
+
+func countTrue(values []bool) int {
+	var n int
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// recordsWith checks if a driver that records with native has all the properties of p.
+func recordsWith(native, p prop.Media) bool {
+	merged := native
+	merged.Merge(p)
+	return merged == native
+}
+
+// mergeSelected fills the properties that the driver doesn't have with constraints, the same way as
+// selectBestDriver.
+func mergeSelected(constraints MediaTrackConstraints, p prop.Media) prop.Media {
+	var selected prop.Media
+	selected.MergeConstraints(constraints.MediaConstraints)
+	selected.Merge(p)
+	return selected
+}
+
+func (c *capture) ID() string {
+	return c.driver.ID()
+}
+
+// Close stops sharing the recording of the driver. The driver is closed once all its users are closed.
+func (c *capture) Close() error {
+	sharedDevicesMu.Lock()
+	if c.closed {
+		sharedDevicesMu.Unlock()
+		return nil
+	}
+	c.closed = true
+
+	if device, ok := startedDevice(c.driver); ok {
+		device.captures = slices.DeleteFunc(device.captures, func(cc *capture) bool { return cc == c })
+		if len(device.captures) == 0 {
+			delete(sharedDevices, c.driver)
+		}
+	}
+	sharedDevicesMu.Unlock()
+
+	return c.driver.Close()
+}
+
+// apply changes the constraints of c.
+func (c *capture) apply(constraints MediaTrackConstraints) error {
+	sharedDevicesMu.Lock()
+	device, ok := startedDevice(c.driver)
+	if !ok || c.closed {
+		sharedDevicesMu.Unlock()
+		return errCaptureClosed
+	}
+	controls, err := selectControls(driverControls(c.driver), constraints.MediaConstraints)
+	if err != nil {
+		sharedDevicesMu.Unlock()
+		return err
+	}
+	notify, err := device.update(c, constraints)
+	sharedDevicesMu.Unlock()
+	if err != nil {
+		return err
+	}
+	notify()
+	return setControls(c.driver, controls)
+}
+
+func (c *capture) setOnSettings(f func(prop.Media)) {
+	sharedDevicesMu.Lock()
+	defer sharedDevicesMu.Unlock()
+	c.onSettings = f
+}
+
+func (c *capture) setOnEnded(f func(error)) {
+	sharedDevicesMu.Lock()
+	defer sharedDevicesMu.Unlock()
+	c.onEnded = f
+}
+
+// readError returns the error to read the capture with, when reading its recording fails with err.
+func (c *capture) readError(err error) error {
+	sharedDevicesMu.Lock()
+	defer sharedDevicesMu.Unlock()
+	if c.removed {
+		return ErrDeviceRemoved
+	}
+	return err
+}
+
+// endCaptures ends the captures that are recording from d, which has been deleted from the manager.
+func endCaptures(d driver.Driver) {
+	sharedDevicesMu.Lock()
+	var handlers []func(error)
+	if device, ok := sharedDevices[d]; ok {
+		for _, c := range device.captures {
+			c.removed = true
+			if c.onEnded != nil {
+				handlers = append(handlers, c.onEnded)
+			}
+		}
+	}
+	sharedDevicesMu.Unlock()
+
+	for _, f := range handlers {
+		f(ErrDeviceRemoved)
+	}
+}
+
+func (c *capture) getConstraints() MediaTrackConstraints {
+	sharedDevicesMu.Lock()
+	defer sharedDevicesMu.Unlock()
+	return c.constraints
+}
+
+func (c *capture) getSettings() prop.Media {
+	sharedDevicesMu.Lock()
+	defer sharedDevicesMu.Unlock()
+	return c.settings
+}
+
+func (c *capture) getCapabilities() []prop.Media {
+	return c.driver.Properties()
+}
+
+// videoCapture is a capture from a video driver.
+type videoCapture struct {
+	*capture
+	recorder driver.VideoRecorder
+
+	mu sync.Mutex
+	// recording is read from the driver, and reader is the recording after the transforms
+	recording video.Reader
+	reader    video.TimestampedReader
+}
+
+func newVideoCapture(d driver.Driver, recorder driver.VideoRecorder, constraints MediaTrackConstraints) (*videoCapture, error) {
+	c := &videoCapture{recorder: recorder}
+	c.capture = &capture{
+		driver:      d,
+		derive:      deriveVideoSettings,
+		record:      c.record,
+		transform:   c.transform,
+		constraints: constraints,
+	}
+	if err := c.start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *videoCapture) record(native prop.Media) error {
+	recording, err := c.recorder.VideoRecord(native)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recording = recording
+	c.reader = video.WithTimestamp(recording)
+	return nil
+}
+
+func (c *videoCapture) transform(native, settings prop.Media) {
+	var transforms []video.TransformFunc
+	if settings.Width != native.Width || settings.Height != native.Height {
+		width, height := cropSize(native, settings)
+		if width != native.Width || height != native.Height {
+			transforms = append(transforms, video.Crop(width, height))
+		}
+		if width != settings.Width || height != settings.Height {
+			transforms = append(transforms, video.Scale(settings.Width, settings.Height, nil))
+		}
+	}
+	if settings.FrameRate != native.FrameRate {
+		transforms = append(transforms, video.Throttle(settings.FrameRate))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reader = video.WithTimestamp(video.Merge(transforms...)(c.recording))
+}
+
+func (c *videoCapture) ReadTimestamped() (image.Image, time.Time, func(), error) {
+	c.mu.Lock()
+	reader := c.reader
+	c.mu.Unlock()
+	data, timestamp, release, err := reader.ReadTimestamped()
+	if err != nil {
+		err = c.readError(err)
+	}
+	return data, timestamp, release, err
+}
+
+func (c *videoCapture) Read() (image.Image, func(), error) {
+	img, _, release, err := c.ReadTimestamped()
+	return img, release, err
+}
+
+// deriveVideoSettings crops native to the aspect ratio, scales it down, and lowers its frame rate to
+// fit constraints. If only one of the width and the height is given, the other one follows the aspect
+// ratio, or the one of native if there's none.
+func deriveVideoSettings(native prop.Media, constraints prop.MediaConstraints) prop.Media {
+	settings := native
+	if constraints.ResizeMode == prop.ResizeModeNone {
+		return settings
+	}
+
+	var width, height int
+	var aspectRatio float32
+	var hasWidth, hasHeight, hasAspectRatio bool
+	if constraints.Width != nil {
+		width, hasWidth = constraints.Width.Value()
+	}
+	if constraints.Height != nil {
+		height, hasHeight = constraints.Height.Value()
+	}
+	if constraints.AspectRatio != nil {
+		aspectRatio, hasAspectRatio = constraints.AspectRatio.Value()
+		hasAspectRatio = hasAspectRatio && aspectRatio > 0
+	}
+	if native.Width > 0 && native.Height > 0 {
+		if !hasAspectRatio {
+			aspectRatio = float32(native.Width) / float32(native.Height)
+		}
+		switch {
+		case hasWidth && !hasHeight:
+			height = int(math.Round(float64(width) / float64(aspectRatio)))
+		case hasHeight && !hasWidth:
+			width = int(math.Round(float64(height) * float64(aspectRatio)))
+		case !hasWidth && !hasHeight && hasAspectRatio:
+			// The largest size of the aspect ratio is cropped
+			width, height = native.Width, native.Height
+			if float32(native.Width) > float32(native.Height)*aspectRatio {
+				width = int(math.Round(float64(native.Height) * float64(aspectRatio)))
+			} else {
+				height = int(math.Round(float64(native.Width) / float64(aspectRatio)))
+			}
+		}
+		// YCbCr frames are subsampled, so the size is kept even
+		width, height = width&^1, height&^1
+		if (hasWidth || hasHeight || hasAspectRatio) && width > 0 && height > 0 && width <= native.Width && height <= native.Height {
+			settings.Width, settings.Height = width, height
+		}
+	}
+
+	if constraints.FrameRate != nil {
+		if frameRate, ok := constraints.FrameRate.Value(); ok && frameRate > 0 && frameRate < native.FrameRate {
+			settings.FrameRate = frameRate
+		}
+	}
+	return settings
+}
+
+// cropSize returns the largest size of the aspect ratio of settings that fits in native.
+func cropSize(native, settings prop.Media) (int, int) {
+	width, height := native.Width, native.Height
+	if settings.Width*native.Height > settings.Height*native.Width {
+		height = native.Width * settings.Height / settings.Width
+	} else {
+		width = native.Height * settings.Width / settings.Height
+	}
+	return width &^ 1, height &^ 1
+}
+
+// audioCapture is a capture from an audio driver.
+type audioCapture struct {
+	*capture
+	recorder driver.AudioRecorder
+
+	mu        sync.Mutex
+	recording audio.Reader
+	reader    audio.TimestampedReader
+}
+
+func newAudioCapture(d driver.Driver, recorder driver.AudioRecorder, constraints MediaTrackConstraints) (*audioCapture, error) {
+	c := &audioCapture{recorder: recorder}
+	c.capture = &capture{
+		driver:      d,
+		derive:      deriveAudioSettings,
+		record:      c.record,
+		transform:   c.transform,
+		constraints: constraints,
+	}
+	if err := c.start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *audioCapture) record(native prop.Media) error {
+	recording, err := c.recorder.AudioRecord(native)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recording = recording
+	c.reader = audio.WithTimestamp(recording)
+	return nil
+}
+
+func (c *audioCapture) transform(native, settings prop.Media) {
+	var transforms []audio.TransformFunc
+	if settings.SampleRate != native.SampleRate {
+		transforms = append(transforms, audio.NewResampler(settings.SampleRate, audio.ResampleQualityHigh))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reader = audio.WithTimestamp(audio.Merge(transforms...)(c.recording))
+}
+
+func (c *audioCapture) ReadTimestamped() (wave.Audio, time.Time, func(), error) {
+	c.mu.Lock()
+	reader := c.reader
+	c.mu.Unlock()
+	data, timestamp, release, err := reader.ReadTimestamped()
+	if err != nil {
+		err = c.readError(err)
+	}
+	return data, timestamp, release, err
+}
+
+func (c *audioCapture) Read() (wave.Audio, func(), error) {
+	chunk, _, release, err := c.ReadTimestamped()
+	return chunk, release, err
+}
+
+// deriveAudioSettings resamples native to fit constraints.
+func deriveAudioSettings(native prop.Media, constraints prop.MediaConstraints) prop.Media {
+	settings := native
+	if constraints.SampleRate != nil {
+		if sampleRate, ok := constraints.SampleRate.Value(); ok && sampleRate > 0 && native.SampleRate > 0 {
+			settings.SampleRate = sampleRate
+		}
+	}
+	return settings
+}
+
+// trackEncoder is an encoder that reads a track.
+type trackEncoder struct {
+	controllable codec.Controllable
+	// inputProp converts the settings of the track to the properties of the encoder input
+	inputProp func(prop.Media) prop.Media
+}
+
+// addEncoder registers an encoder to be told when the settings of the track change. The returned
+// function unregisters it.
+func (track *baseTrack) addEncoder(controllable codec.Controllable, inputProp func(prop.Media) prop.Media) func() {
+	encoder := &trackEncoder{controllable: controllable, inputProp: inputProp}
+
+	track.encodersMu.Lock()
+	defer track.encodersMu.Unlock()
+	if track.encoders == nil {
+		track.encoders = make(map[*trackEncoder]struct{})
+	}
+	track.encoders[encoder] = struct{}{}
+
+	return func() {
+		track.encodersMu.Lock()
+		defer track.encodersMu.Unlock()
+		delete(track.encoders, encoder)
+	}
+}
+
+// notifyEncoders gives the new settings of the track to the encoders that read it. The frames of the
+// encoders that can't be told are kept at the size that they were built with, by keepEncoderSize.
+func (track *baseTrack) notifyEncoders(settings prop.Media) {
+	track.encodersMu.Lock()
+	defer track.encodersMu.Unlock()
+
+	for encoder := range track.encoders {
+		controller, ok := encoder.controllable.Controller().(codec.InputPropController)
+		if !ok {
+			continue
+		}
+		if err := controller.SetInputProp(encoder.inputProp(settings)); err != nil {
+			logger.Warnf("failed to update the encoder input: %s", err)
+		}
+	}
+}
+
+// constraintsOf returns the constraints that opt sets.
+func constraintsOf(opt MediaOption) MediaTrackConstraints {
+	var constraints MediaTrackConstraints
+	if opt != nil {
+		opt(&constraints)
+	}
+	return constraints
+}
+
+// ApplyConstraints implements ConstrainableTrack.
+func (track *VideoTrack) ApplyConstraints(opt MediaOption) error {
+	if track.capture == nil {
+		return errNotConstrainable
+	}
+	return track.capture.apply(constraintsOf(opt))
+}
+
+// GetConstraints implements ConstrainableTrack.
+func (track *VideoTrack) GetConstraints() MediaTrackConstraints {
+	if track.capture == nil {
+		return MediaTrackConstraints{}
+	}
+	return track.capture.getConstraints()
+}
+
+// GetSettings implements ConstrainableTrack.
+func (track *VideoTrack) GetSettings() prop.Media {
+	if track.capture == nil {
+		return prop.Media{}
+	}
+	return track.capture.getSettings()
+}
+
+// GetCapabilities implements ConstrainableTrack.
+func (track *VideoTrack) GetCapabilities() []prop.Media {
+	if track.capture == nil {
+		return nil
+	}
+	return track.capture.getCapabilities()
+}
+
+// ApplyConstraints implements ConstrainableTrack.
+func (track *AudioTrack) ApplyConstraints(opt MediaOption) error {
+	if track.capture == nil {
+		return errNotConstrainable
+	}
+	return track.capture.apply(constraintsOf(opt))
+}
+
+// GetConstraints implements ConstrainableTrack.
+func (track *AudioTrack) GetConstraints() MediaTrackConstraints {
+	if track.capture == nil {
+		return MediaTrackConstraints{}
+	}
+	return track.capture.getConstraints()
+}
+
+// GetSettings implements ConstrainableTrack.
+func (track *AudioTrack) GetSettings() prop.Media {
+	if track.capture == nil {
+		return prop.Media{}
+	}
+	return track.capture.getSettings()
+}
+
+// GetCapabilities implements ConstrainableTrack.
+func (track *AudioTrack) GetCapabilities() []prop.Media {
+	if track.capture == nil {
+		return nil
+	}
+	return track.capture.getCapabilities()
+}
@@ -0,0 +1,612 @@
+package mediadevices
+
+import (
+	"errors"
+	"image"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/webrtc/v4"
+)
+
+// fakeCamera records frames of the requested size, and counts how many times it has been recorded from.
+type fakeCamera struct {
+	// If started isn't nil, the recordings are sent to recording when they start, and block until
+	// started is closed
+	recording chan struct{}
+	started   chan struct{}
+
+	mu      sync.Mutex
+	closed  chan struct{}
+	records []prop.Media
+}
+
+func (c *fakeCamera) Open() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = make(chan struct{})
+	return nil
+}
+
+func (c *fakeCamera) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	close(c.closed)
+	return nil
+}
+
+func (c *fakeCamera) Properties() []prop.Media {
+	return []prop.Media{
+		{Video: prop.Video{Width: 640, Height: 480, FrameRate: 30, FrameFormat: frame.FormatI420}},
+		{Video: prop.Video{Width: 320, Height: 240, FrameRate: 30, FrameFormat: frame.FormatI420}},
+	}
+}
+
+func (c *fakeCamera) VideoRecord(p prop.Media) (video.Reader, error) {
+	if c.started != nil {
+		c.recording <- struct{}{}
+		<-c.started
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = append(c.records, p)
+	closed := c.closed
+
+	return video.ReaderFunc(func() (image.Image, func(), error) {
+		select {
+		case <-closed:
+			return nil, func() {}, io.EOF
+		case <-time.After(time.Millisecond):
+		}
+		return image.NewYCbCr(image.Rect(0, 0, p.Width, p.Height), image.YCbCrSubsampleRatio420), func() {}, nil
+	}), nil
+}
+
+func (c *fakeCamera) recordCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.records)
+}
+
+// fakeVideoEncoder passes the size of the frames through, and records the input properties it's given.
+// A fixed size encoder isn't a codec.InputPropController.
+type fakeVideoEncoder struct {
+	r         video.Reader
+	fixedSize bool
+	mu        sync.Mutex
+	p         []prop.Media
+}
+
+func (e *fakeVideoEncoder) Read() ([]byte, func(), error) {
+	img, _, err := e.r.Read()
+	if err != nil {
+		return nil, func() {}, err
+	}
+	return []byte{byte(img.Bounds().Dx() / 10)}, func() {}, nil
+}
+
+func (e *fakeVideoEncoder) Close() error { return nil }
+
+func (e *fakeVideoEncoder) Controller() codec.EncoderController {
+	if e.fixedSize {
+		return nil
+	}
+	return e
+}
+
+func (e *fakeVideoEncoder) SetInputProp(p prop.Media) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.p = append(e.p, p)
+	return nil
+}
+
+type fakeVideoEncoderBuilder struct {
+	fixedSize bool
+	encoder   *fakeVideoEncoder
+}
+
+func (b *fakeVideoEncoderBuilder) RTPCodec() *codec.RTPCodec { return codec.NewRTPVP8Codec(90000) }
+
+func (b *fakeVideoEncoderBuilder) BuildVideoEncoder(r video.Reader, p prop.Media) (codec.ReadCloser, error) {
+	b.encoder = &fakeVideoEncoder{r: r, fixedSize: b.fixedSize}
+	return b.encoder, nil
+}
+
+func registerFakeCamera(t *testing.T) (driver.Driver, *fakeCamera) {
+	t.Helper()
+
+	camera := &fakeCamera{}
+	if err := driver.GetManager().Register(camera, driver.Info{Label: t.Name(), DeviceType: driver.Camera}); err != nil {
+		t.Fatal(err)
+	}
+	drivers := driver.GetManager().Query(func(d driver.Driver) bool { return d.Info().Label == t.Name() })
+	if len(drivers) != 1 {
+		t.Fatalf("Expected the camera to be registered, got %d drivers", len(drivers))
+	}
+	t.Cleanup(func() { driver.GetManager().Delete(drivers[0].ID()) })
+	return drivers[0], camera
+}
+
+func newFakeCameraTrack(t *testing.T, d driver.Driver, selector *CodecSelector, opt MediaOption) *VideoTrack {
+	t.Helper()
+
+	d, c, err := selectBestDriver(driver.FilterID(d.ID()), constraintsOf(opt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, err := newTrackFromDriver(d, c, selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { track.Close() })
+	return track.(*VideoTrack)
+}
+
+// expectFrameWidth reads r until a frame of width comes. The frames of new settings may come after a few
+// frames of the old ones.
+func expectFrameWidth(t *testing.T, r video.Reader, width int) {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		img, _, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() == width {
+			return
+		}
+	}
+	t.Errorf("Expected frames of width %d", width)
+}
+
+func TestApplyConstraints(t *testing.T) {
+	builder := &fakeVideoEncoderBuilder{}
+	selector := NewCodecSelector(WithVideoEncoders(builder))
+	d, camera := registerFakeCamera(t)
+	track := newFakeCameraTrack(t, d, selector, func(c *MediaTrackConstraints) {
+		c.Width = prop.Int(640)
+		c.Height = prop.Int(480)
+	})
+	track.OnEnded(func(err error) {
+		t.Errorf("Unexpected end of the track: %v", err)
+	})
+
+	reader, err := track.NewEncodedReader(webrtc.MimeTypeVP8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	expectWidth := func(t *testing.T, width int) {
+		t.Helper()
+		for i := 0; i < 10; i++ {
+			buf, _, err := reader.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(buf.Data[0])*10 == width {
+				return
+			}
+		}
+		t.Errorf("Expected frames of width %d", width)
+	}
+	expectWidth(t, 640)
+
+	if capabilities := track.GetCapabilities(); len(capabilities) != 2 {
+		t.Errorf("Expected the properties of the camera, got %v", capabilities)
+	}
+
+	t.Run("RestartDriver", func(t *testing.T) {
+		if err := track.ApplyConstraints(func(c *MediaTrackConstraints) {
+			c.Width = prop.Int(320)
+			c.Height = prop.Int(240)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if settings := track.GetSettings(); settings.Width != 320 || settings.Height != 240 {
+			t.Errorf("Unexpected settings: %v", settings)
+		}
+		if n := camera.recordCount(); n != 2 {
+			t.Errorf("Expected the camera to be restarted, got %d records", n)
+		}
+		expectWidth(t, 320)
+
+		builder.encoder.mu.Lock()
+		defer builder.encoder.mu.Unlock()
+		if len(builder.encoder.p) != 1 || builder.encoder.p[0].Width != 320 || builder.encoder.p[0].Height != 240 {
+			t.Errorf("Expected the encoder to be given the new settings, got %v", builder.encoder.p)
+		}
+	})
+
+	t.Run("Scale", func(t *testing.T) {
+		if err := track.ApplyConstraints(func(c *MediaTrackConstraints) {
+			c.Width = prop.IntExact(160)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		settings := track.GetSettings()
+		if settings.Width != 160 || settings.Height != 120 {
+			t.Errorf("Expected the aspect ratio to be kept, got %v", settings)
+		}
+		if n := camera.recordCount(); n != 2 {
+			t.Errorf("Expected the camera to keep recording, got %d records", n)
+		}
+		expectWidth(t, 160)
+	})
+
+	t.Run("Overconstrained", func(t *testing.T) {
+		constraints := track.GetConstraints()
+		err := track.ApplyConstraints(func(c *MediaTrackConstraints) {
+			c.Width = prop.IntExact(1280)
+		})
+		var errOverconstrained *OverconstrainedError
+		if !errors.As(err, &errOverconstrained) || errOverconstrained.Constraint != "Width" {
+			t.Errorf("Expected the Width constraint to be overconstrained, got: %v", err)
+		}
+		if settings := track.GetSettings(); settings.Width != 160 {
+			t.Errorf("Expected the settings to be kept, got %v", settings)
+		}
+		if track.GetConstraints() != constraints {
+			t.Error("Expected the constraints to be kept")
+		}
+	})
+
+	t.Run("NotConstrainable", func(t *testing.T) {
+		track := NewVideoTrack(&simulcastTestSource{}, selector).(ConstrainableTrack)
+		if err := track.ApplyConstraints(func(c *MediaTrackConstraints) {}); !errors.Is(err, errNotConstrainable) {
+			t.Errorf("Expected error: %v, got: %v", errNotConstrainable, err)
+		}
+	})
+}
+
+func TestApplyConstraintsFixedSizeEncoder(t *testing.T) {
+	selector := NewCodecSelector(WithVideoEncoders(&fakeVideoEncoderBuilder{fixedSize: true}))
+	d, _ := registerFakeCamera(t)
+	track := newFakeCameraTrack(t, d, selector, func(c *MediaTrackConstraints) {
+		c.Width = prop.Int(640)
+		c.Height = prop.Int(480)
+	})
+
+	reader, err := track.NewEncodedReader(webrtc.MimeTypeVP8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if err := track.ApplyConstraints(func(c *MediaTrackConstraints) {
+		c.Width = prop.IntExact(320)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expectFrameWidth(t, track.NewReader(false), 320)
+
+	// The encoder can't be told about the new size, so its frames are scaled back to the size it was built with
+	for i := 0; i < 10; i++ {
+		buf, _, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if width := int(buf.Data[0]) * 10; width != 640 {
+			t.Fatalf("Expected the encoder to get frames of width 640, got %d", width)
+		}
+	}
+}
+
+func TestSharedCapture(t *testing.T) {
+	selector := NewCodecSelector()
+
+	t.Run("ScaledView", func(t *testing.T) {
+		d, camera := registerFakeCamera(t)
+		first := newFakeCameraTrack(t, d, selector, func(c *MediaTrackConstraints) {
+			c.Width = prop.Int(640)
+			c.Height = prop.Int(480)
+		})
+		second := newFakeCameraTrack(t, d, selector, func(c *MediaTrackConstraints) {
+			c.Width = prop.Int(320)
+			c.Height = prop.Int(240)
+		})
+
+		if settings := second.GetSettings(); settings.Width != 320 || settings.Height != 240 {
+			t.Errorf("Unexpected settings: %v", settings)
+		}
+		if n := camera.recordCount(); n != 1 {
+			t.Errorf("Expected the recording to be shared, got %d records", n)
+		}
+		expectFrameWidth(t, first.NewReader(false), 640)
+		expectFrameWidth(t, second.NewReader(false), 320)
+
+		// The camera is closed with the last track
+		if err := first.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if d.Status() != driver.StateRunning {
+			t.Errorf("Expected the camera to keep running, got %v", d.Status())
+		}
+		expectFrameWidth(t, second.NewReader(false), 320)
+		if err := second.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if d.Status() != driver.StateClosed {
+			t.Errorf("Expected the camera to be closed, got %v", d.Status())
+		}
+	})
+
+	t.Run("Restart", func(t *testing.T) {
+		d, camera := registerFakeCamera(t)
+		first := newFakeCameraTrack(t, d, selector, func(c *MediaTrackConstraints) {
+			c.Width = prop.Int(320)
+			c.Height = prop.Int(240)
+		})
+		first.OnEnded(func(err error) {
+			t.Errorf("Unexpected end of the track: %v", err)
+		})
+		firstReader := first.NewReader(false)
+		expectFrameWidth(t, firstReader, 320)
+
+		// The camera has to record at 640x480 for the second track, and the first one is scaled down
+		second := newFakeCameraTrack(t, d, selector, func(c *MediaTrackConstraints) {
+			c.Width = prop.IntExact(640)
+		})
+		if n := camera.recordCount(); n != 2 {
+			t.Errorf("Expected the camera to be restarted, got %d records", n)
+		}
+		if settings := first.GetSettings(); settings.Width != 320 || settings.Height != 240 {
+			t.Errorf("Expected the settings of the first track to be kept, got %v", settings)
+		}
+		expectFrameWidth(t, second.NewReader(false), 640)
+		expectFrameWidth(t, firstReader, 320)
+	})
+
+	t.Run("SlowStart", func(t *testing.T) {
+		d, camera := registerFakeCamera(t)
+		camera.recording, camera.started = make(chan struct{}, 2), make(chan struct{})
+		constraints := constraintsOf(func(c *MediaTrackConstraints) {
+			c.Width = prop.Int(640)
+		})
+		tracks := make(chan Track, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				d, c, err := selectBestDriver(driver.FilterID(d.ID()), constraints)
+				if err != nil {
+					t.Error(err)
+					tracks <- nil
+					return
+				}
+				track, err := newTrackFromDriver(d, c, selector)
+				if err != nil {
+					t.Error(err)
+				}
+				tracks <- track
+			}()
+		}
+
+		start := sync.OnceFunc(func() { close(camera.started) })
+		defer start()
+
+		// Other cameras can be started while the recording of the first one is starting
+		<-camera.recording
+		t.Run("Other", func(t *testing.T) {
+			other, _ := registerFakeCamera(t)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				d, c, err := selectBestDriver(driver.FilterID(other.ID()), constraints)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				track, err := newTrackFromDriver(d, c, selector)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				track.Close()
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				start()
+				t.Error("Expected the other camera to start while the first one is starting")
+				<-done
+			}
+		})
+
+		start()
+		for _, track := range []Track{<-tracks, <-tracks} {
+			if track != nil {
+				t.Cleanup(func() { track.Close() })
+			}
+		}
+		if n := camera.recordCount(); n != 1 {
+			t.Errorf("Expected the recording to be shared, got %d records", n)
+		}
+	})
+
+	t.Run("SlowRestart", func(t *testing.T) {
+		d, camera := registerFakeCamera(t)
+		first := newFakeCameraTrack(t, d, selector, func(c *MediaTrackConstraints) {
+			c.Width = prop.Int(320)
+			c.Height = prop.Int(240)
+		})
+
+		// The second track restarts the camera at 640x480, which blocks until started is closed
+		camera.recording, camera.started = make(chan struct{}, 1), make(chan struct{})
+		start := sync.OnceFunc(func() { close(camera.started) })
+		defer start()
+		tracks := make(chan Track, 1)
+		go func() {
+			d, c, err := selectBestDriver(driver.FilterID(d.ID()), constraintsOf(func(c *MediaTrackConstraints) {
+				c.Width = prop.IntExact(640)
+			}))
+			if err != nil {
+				t.Error(err)
+				tracks <- nil
+				return
+			}
+			track, err := newTrackFromDriver(d, c, selector)
+			if err != nil {
+				t.Error(err)
+			}
+			tracks <- track
+		}()
+		<-camera.recording
+
+		// The first track and other cameras are still usable while the camera restarts
+		t.Run("Other", func(t *testing.T) {
+			other, _ := registerFakeCamera(t)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				first.GetSettings()
+				d, c, err := selectBestDriver(driver.FilterID(other.ID()), constraintsOf(func(c *MediaTrackConstraints) {
+					c.Width = prop.Int(640)
+				}))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				track, err := newTrackFromDriver(d, c, selector)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				track.Close()
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				start()
+				t.Error("Expected the other tracks to be usable while the camera restarts")
+				<-done
+			}
+		})
+
+		start()
+		if second := <-tracks; second != nil {
+			defer second.Close()
+			expectFrameWidth(t, second.(*VideoTrack).NewReader(false), 640)
+		}
+		expectFrameWidth(t, first.NewReader(false), 320)
+	})
+
+	t.Run("Overconstrained", func(t *testing.T) {
+		d, _ := registerFakeCamera(t)
+		newFakeCameraTrack(t, d, selector, func(c *MediaTrackConstraints) {
+			c.Width = prop.IntExact(320)
+		})
+
+		// The joining track can't be satisfied, which must not stop the camera of the first one
+		var constraints MediaTrackConstraints
+		constraints.Width = prop.IntExact(1280)
+		constraints.selectedMedia = d.Properties()[0]
+		if err := d.Open(); err != nil {
+			t.Fatal(err)
+		}
+		_, err := newTrackFromDriver(d, constraints, selector)
+		var errOverconstrained *OverconstrainedError
+		if !errors.As(err, &errOverconstrained) || errOverconstrained.Constraint != "Width" {
+			t.Errorf("Expected the Width constraint to be overconstrained, got: %v", err)
+		}
+		if d.Status() != driver.StateRunning {
+			t.Errorf("Expected the camera to keep running, got %v", d.Status())
+		}
+	})
+}
+
+func TestSelectDerivedSettings(t *testing.T) {
+	selector := NewCodecSelector()
+	d, camera := registerFakeCamera(t)
+
+	// The camera has no 16:9 mode at 15 fps, so it's cropped, scaled down and throttled
+	track := newFakeCameraTrack(t, d, selector, func(c *MediaTrackConstraints) {
+		c.Width = prop.IntExact(480)
+		c.Height = prop.IntExact(270)
+		c.FrameRate = prop.FloatExact(15)
+	})
+	if settings := track.GetSettings(); settings.Width != 480 || settings.Height != 270 || settings.FrameRate != 15 {
+		t.Errorf("Unexpected settings: %v", settings)
+	}
+	if n := camera.recordCount(); n != 1 || camera.records[0].Width != 640 {
+		t.Errorf("Expected the camera to record at 640x480, got %v", camera.records)
+	}
+	reader := track.NewReader(false)
+	img, _, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(480, 270) {
+		t.Errorf("Expected frames of 480x270, got %v", size)
+	}
+
+	t.Run("ResizeModeNone", func(t *testing.T) {
+		_, _, err := selectBestDriver(driver.FilterID(d.ID()), constraintsOf(func(c *MediaTrackConstraints) {
+			c.Width = prop.IntExact(480)
+			c.ResizeMode = prop.ResizeModeNone
+		}))
+		var errOverconstrained *OverconstrainedError
+		if !errors.As(err, &errOverconstrained) || errOverconstrained.Constraint != "Width" {
+			t.Errorf("Expected the Width constraint to be overconstrained, got: %v", err)
+		}
+	})
+}
+
+func TestDeriveVideoSettings(t *testing.T) {
+	native := prop.Media{Video: prop.Video{Width: 640, Height: 480, FrameRate: 30}}
+
+	testCases := map[string]struct {
+		constraints prop.VideoConstraints
+		expected    prop.Video
+	}{
+		"Width": {
+			constraints: prop.VideoConstraints{Width: prop.Int(320)},
+			expected:    prop.Video{Width: 320, Height: 240, FrameRate: 30},
+		},
+		"Height": {
+			constraints: prop.VideoConstraints{Height: prop.IntExact(360)},
+			expected:    prop.Video{Width: 480, Height: 360, FrameRate: 30},
+		},
+		"Upscale": {
+			constraints: prop.VideoConstraints{Width: prop.Int(1280), Height: prop.Int(720)},
+			expected:    prop.Video{Width: 640, Height: 480, FrameRate: 30},
+		},
+		"FrameRate": {
+			constraints: prop.VideoConstraints{FrameRate: prop.Float(15)},
+			expected:    prop.Video{Width: 640, Height: 480, FrameRate: 15},
+		},
+		"Range": {
+			constraints: prop.VideoConstraints{Width: prop.IntRanged{Min: 100, Max: 200}},
+			expected:    prop.Video{Width: 640, Height: 480, FrameRate: 30},
+		},
+		"CropAndScale": {
+			constraints: prop.VideoConstraints{Width: prop.IntExact(480), Height: prop.IntExact(270)},
+			expected:    prop.Video{Width: 480, Height: 270, FrameRate: 30},
+		},
+		"AspectRatio": {
+			constraints: prop.VideoConstraints{AspectRatio: prop.FloatExact(16.0 / 9.0)},
+			expected:    prop.Video{Width: 640, Height: 360, FrameRate: 30},
+		},
+		"WidthAndAspectRatio": {
+			constraints: prop.VideoConstraints{Width: prop.Int(320), AspectRatio: prop.Float(1)},
+			expected:    prop.Video{Width: 320, Height: 320, FrameRate: 30},
+		},
+		"ResizeModeNone": {
+			constraints: prop.VideoConstraints{Width: prop.Int(320), ResizeMode: prop.ResizeModeNone},
+			expected:    prop.Video{Width: 640, Height: 480, FrameRate: 30},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			settings := deriveVideoSettings(native, prop.MediaConstraints{VideoConstraints: tc.constraints})
+			if settings.Video != tc.expected {
+				t.Errorf("Expected %+v, got %+v", tc.expected, settings.Video)
+			}
+		})
+	}
+}